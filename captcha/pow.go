@@ -0,0 +1,148 @@
+package captcha
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPoWDifficulty = 18 // leading zero bits, about 260k hashes on average
+	powChallengeTTL      = 5 * time.Minute
+)
+
+// Challenge is handed to the client, which must find a nonce so that
+// sha256(challenge + ":" + nonce) starts with Difficulty zero bits, then send
+// "<challenge>:<nonce>" as the token.
+type Challenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ProofOfWork issues stateless HMAC-signed challenges and remembers solved
+// ones until they expire so a solution cannot be replayed.
+type ProofOfWork struct {
+	key        []byte
+	difficulty int
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewProofOfWork creates a verifier; instances sharing key accept each other's challenges.
+func NewProofOfWork(key []byte, difficulty int) *ProofOfWork {
+	return &ProofOfWork{key: key, difficulty: difficulty, used: map[string]time.Time{}}
+}
+
+// newProofOfWorkFromEnv reads CAPTCHA_POW_KEY (base64, random when unset) and CAPTCHA_POW_DIFFICULTY.
+func newProofOfWorkFromEnv() (*ProofOfWork, error) {
+	var key []byte
+	if env := os.Getenv("CAPTCHA_POW_KEY"); env != "" {
+		decoded, err := base64.StdEncoding.DecodeString(env)
+		if err != nil || len(decoded) < 16 {
+			return nil, errors.New("captcha: CAPTCHA_POW_KEY must be base64 of at least 16 bytes")
+		}
+		key = decoded
+	} else {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+
+	difficulty := defaultPoWDifficulty
+	if env := os.Getenv("CAPTCHA_POW_DIFFICULTY"); env != "" {
+		parsed, err := strconv.Atoi(env)
+		if err != nil || parsed < 1 || parsed > 32 {
+			return nil, errors.New("captcha: CAPTCHA_POW_DIFFICULTY must be between 1 and 32")
+		}
+		difficulty = parsed
+	}
+	return NewProofOfWork(key, difficulty), nil
+}
+
+func (p *ProofOfWork) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// Issue returns a new challenge.
+func (p *ProofOfWork) Issue() (Challenge, error) {
+	expiresAt := time.Now().Add(powChallengeTTL)
+	payload := make([]byte, 24)
+	binary.BigEndian.PutUint64(payload, uint64(expiresAt.Unix()))
+	if _, err := rand.Read(payload[8:]); err != nil {
+		return Challenge{}, err
+	}
+	encoding := base64.RawURLEncoding
+	return Challenge{
+		Challenge:  encoding.EncodeToString(payload) + "." + encoding.EncodeToString(p.sign(payload)),
+		Difficulty: p.difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// Verify implements Verifier.
+func (p *ProofOfWork) Verify(ctx context.Context, token, remoteIP string) error {
+	challenge, nonce, ok := strings.Cut(token, ":")
+	if !ok || nonce == "" || len(nonce) > 64 {
+		return ErrRejected
+	}
+	encodedPayload, encodedSignature, ok := strings.Cut(challenge, ".")
+	if !ok {
+		return ErrRejected
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) != 24 {
+		return ErrRejected
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, p.sign(payload)) {
+		return ErrRejected
+	}
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+	now := time.Now()
+	if now.After(expiresAt) {
+		return fmt.Errorf("%w: challenge expired", ErrRejected)
+	}
+	if leadingZeroBits(sha256.Sum256([]byte(challenge+":"+nonce))) < p.difficulty {
+		return ErrRejected
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, expiry := range p.used {
+		if now.After(expiry) {
+			delete(p.used, key)
+		}
+	}
+	if _, seen := p.used[challenge]; seen {
+		return fmt.Errorf("%w: challenge already used", ErrRejected)
+	}
+	p.used[challenge] = expiresAt
+	return nil
+}
+
+func leadingZeroBits(sum [32]byte) int {
+	count := 0
+	for _, b := range sum {
+		if b != 0 {
+			return count + bits.LeadingZeros8(b)
+		}
+		count += 8
+	}
+	return count
+}
@@ -0,0 +1,247 @@
+// Command fieldcrypt manages encryption of personal data columns.
+//
+//	go run ./cmd/fieldcrypt genkey   # print a new random key for FIELD_ENCRYPTION_KEYS / BLIND_INDEX_KEY
+//	go run ./cmd/fieldcrypt encrypt  # encrypt existing plain text rows in place and backfill blind indexes
+//	go run ./cmd/fieldcrypt rotate   # re-wrap every value with FIELD_ENCRYPTION_ACTIVE_KEY
+//
+// encrypt and rotate run in batches and can be safely re-run if interrupted.
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"registration-system/database"
+	"registration-system/fieldcrypt"
+	"registration-system/models"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+	"gorm.io/gorm/schema"
+)
+
+const batchSize = 500
+
+// blindIndex - คอลัมน์ blind index ที่คำนวณจาก plain text ของคอลัมน์เข้ารหัส
+type blindIndex struct {
+	column  string
+	compute func(string) string
+}
+
+// encryptedTable - model ที่มีคอลัมน์เข้ารหัส (หาคอลัมน์จาก field ชนิด EncryptedString/EncryptedDate)
+// และ blind index ของคอลัมน์เหล่านั้น
+type encryptedTable struct {
+	model   interface{}
+	indexes map[string]blindIndex
+}
+
+var registrationIndexes = map[string]blindIndex{
+	"phone_number":        {column: "phone_number_index", compute: models.PhoneIndex},
+	"national_id":         {column: "national_id_index", compute: models.NationalIDIndex},
+	"monk_certificate_no": {column: "monk_certificate_index", compute: models.MonkCertificateIndex},
+}
+
+// encryptedTables - ทุก model ที่มีคอลัมน์เข้ารหัสต้องอยู่ในรายการนี้ ไม่เช่นนั้น rotate จะข้ามไป
+var encryptedTables = []encryptedTable{
+	{model: &models.Registration{}, indexes: registrationIndexes},
+	{model: &models.TeacherRegistration{}, indexes: registrationIndexes},
+	{model: &models.RecordVersion{}},
+	{model: &models.ImportJob{}},
+	{model: &models.RegistrationGroup{}, indexes: map[string]blindIndex{"leader_phone": {column: "leader_phone_index", compute: models.PhoneIndex}}},
+	{model: &models.Temple{}},
+	{model: &models.Notification{}},
+	{model: &models.LineLink{}, indexes: map[string]blindIndex{"line_user_id": {column: "line_user_index", compute: models.LineUserIndex}}},
+	{model: &models.IdempotencyKey{}},
+	{model: &models.WebhookSubscription{}},
+	{model: &models.WebhookDelivery{}},
+	{model: &models.MedicalProfile{}},
+	{model: &models.Medication{}},
+	{model: &models.MedicalIncident{}},
+}
+
+var (
+	encryptedStringType = reflect.TypeOf(models.EncryptedString(""))
+	encryptedDateType   = reflect.TypeOf(models.EncryptedDate{})
+	encryptedArrayType  = reflect.TypeOf(models.EncryptedStringArray{})
+)
+
+// typedValue - ชนิดที่ค่าเดิมไม่ใช่ string ธรรมดา (timestamptz, text[]) ต้องแปลงผ่าน Scan/Value ของชนิดนั้น
+type typedValue interface {
+	sql.Scanner
+	driver.Valuer
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("usage: fieldcrypt genkey|encrypt|rotate")
+		os.Exit(1)
+	}
+
+	if os.Args[1] == "genkey" {
+		key, err := fieldcrypt.GenerateKey()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+	if err := fieldcrypt.LoadFromEnv(); err != nil {
+		log.Fatal(err)
+	}
+	if !fieldcrypt.Enabled() {
+		log.Fatal("FIELD_ENCRYPTION_KEYS is not set, nothing to do")
+	}
+
+	var rotate bool
+	switch os.Args[1] {
+	case "encrypt":
+		rotate = false
+	case "rotate":
+		rotate = true
+	default:
+		log.Fatalf("unknown command %q", os.Args[1])
+	}
+
+	database.Connect()
+	database.Migrate()
+
+	for _, table := range encryptedTables {
+		name, updated, err := processTable(table, rotate)
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		log.Printf("%s: updated %d rows (active key version %d)", name, updated, fieldcrypt.ActiveVersion())
+	}
+}
+
+// processTable - เข้ารหัส/re-wrap ทีละ batch (รวมแถวที่ถูก soft delete)
+func processTable(table encryptedTable, rotate bool) (string, int, error) {
+	parsed, err := schema.Parse(table.model, &sync.Map{}, database.DB.NamingStrategy)
+	if err != nil {
+		return "", 0, err
+	}
+	name := parsed.Table
+
+	var stringColumns []string
+	typedColumns := map[string]func() typedValue{}
+	selectColumns := []string{"id"}
+	for _, field := range parsed.Fields {
+		switch field.FieldType {
+		case encryptedStringType:
+			stringColumns = append(stringColumns, field.DBName)
+		case encryptedDateType:
+			typedColumns[field.DBName] = func() typedValue { return &models.EncryptedDate{} }
+		case encryptedArrayType:
+			typedColumns[field.DBName] = func() typedValue { return &models.EncryptedStringArray{} }
+		default:
+			continue
+		}
+		selectColumns = append(selectColumns, field.DBName)
+	}
+	for _, index := range table.indexes {
+		selectColumns = append(selectColumns, index.column)
+	}
+
+	var lastID uint
+	updated := 0
+	for {
+		var rows []map[string]interface{}
+		err := database.DB.Table(name).
+			Select(strings.Join(selectColumns, ", ")).
+			Where("id > ?", lastID).Order("id").Limit(batchSize).Find(&rows).Error
+		if err != nil {
+			return name, updated, err
+		}
+		if len(rows) == 0 {
+			return name, updated, nil
+		}
+
+		for _, row := range rows {
+			lastID = toUint(row["id"])
+			changes := map[string]interface{}{}
+
+			for _, column := range stringColumns {
+				value, _ := row[column].(string)
+				next, err := convert(value, rotate)
+				if err != nil {
+					return name, updated, fmt.Errorf("row %d column %s: %w", lastID, column, err)
+				}
+				if next != value {
+					changes[column] = next
+				}
+
+				if index, ok := table.indexes[column]; ok {
+					plaintext, err := fieldcrypt.Decrypt(value)
+					if err != nil {
+						return name, updated, fmt.Errorf("row %d column %s: %w", lastID, column, err)
+					}
+					if computed := index.compute(plaintext); computed != row[index.column] {
+						changes[index.column] = computed
+					}
+				}
+			}
+
+			// ค่าที่ยังไม่เข้ารหัสอาจอยู่ในรูปแบบเดิม (timestamptz, text[]) จึงแปลงผ่าน Scan/Value ของชนิดนั้น
+			for column, newValue := range typedColumns {
+				value, _ := row[column].(string)
+				if value != "" && !fieldcrypt.IsEncrypted(value) {
+					typed := newValue()
+					if err := typed.Scan(value); err != nil {
+						return name, updated, fmt.Errorf("row %d column %s: %w", lastID, column, err)
+					}
+					encrypted, err := typed.Value()
+					if err != nil {
+						return name, updated, err
+					}
+					changes[column] = encrypted
+				} else if rotate {
+					next, err := fieldcrypt.Rewrap(value)
+					if err != nil {
+						return name, updated, fmt.Errorf("row %d column %s: %w", lastID, column, err)
+					}
+					if next != value {
+						changes[column] = next
+					}
+				}
+			}
+
+			if len(changes) == 0 {
+				continue
+			}
+			if err := database.DB.Table(name).Where("id = ?", lastID).UpdateColumns(changes).Error; err != nil {
+				return name, updated, err
+			}
+			updated++
+		}
+	}
+}
+
+// convert - encrypt เข้ารหัสเฉพาะค่าที่ยังเป็น plain text, rotate re-wrap ทุกค่าด้วย key ปัจจุบัน
+func convert(value string, rotate bool) (string, error) {
+	if rotate {
+		return fieldcrypt.Rewrap(value)
+	}
+	return fieldcrypt.EncryptIfPlain(value)
+}
+
+func toUint(v interface{}) uint {
+	switch id := v.(type) {
+	case int64:
+		return uint(id)
+	case int32:
+		return uint(id)
+	case uint:
+		return id
+	case uint64:
+		return uint(id)
+	}
+	return 0
+}
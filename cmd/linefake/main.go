@@ -0,0 +1,154 @@
+// Command linefake is a local stand-in for the LINE Messaging API so the bot
+// and LINE notifications can be developed without a LINE channel.
+//
+//	LINE_API_BASE_URL=http://localhost:4040 NOTIFY_LINE=line LINE_CHANNEL_ACCESS_TOKEN=dev \
+//	LINE_CHANNEL_SECRET=dev go run .            # the API server
+//	LINE_CHANNEL_SECRET=dev go run ./cmd/linefake
+//
+// It accepts push and reply calls (printed to stdout, listed at GET /messages)
+// and simulates users talking to the bot:
+//
+//	curl -d 'user=U1&text=ผูก R-000001 0812345678' localhost:4040/simulate
+//
+// Environment: LINEFAKE_ADDR (default ":4040"), LINE_CHANNEL_SECRET (must match
+// the API server), LINE_WEBHOOK_URL (default http://localhost:3000/api/line/webhook).
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sentMessage - ข้อความที่ API server ส่งออกมา
+type sentMessage struct {
+	Kind       string            `json:"kind"` // "push" or "reply"
+	To         string            `json:"to,omitempty"`
+	ReplyToken string            `json:"reply_token,omitempty"`
+	Messages   []json.RawMessage `json:"messages"`
+	At         time.Time         `json:"at"`
+}
+
+var (
+	mu   sync.Mutex
+	sent []sentMessage
+)
+
+func main() {
+	addr := envOr("LINEFAKE_ADDR", ":4040")
+	secret := os.Getenv("LINE_CHANNEL_SECRET")
+	webhookURL := envOr("LINE_WEBHOOK_URL", "http://localhost:3000/api/line/webhook")
+
+	http.HandleFunc("/v2/bot/message/push", receive("push"))
+	http.HandleFunc("/v2/bot/message/reply", receive("reply"))
+
+	http.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sent)
+	})
+
+	http.HandleFunc("/simulate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST user, text (and optionally type=follow|unfollow)", http.StatusMethodNotAllowed)
+			return
+		}
+		if secret == "" {
+			http.Error(w, "LINE_CHANNEL_SECRET is not set", http.StatusInternalServerError)
+			return
+		}
+		status, body, err := simulate(webhookURL, secret, r.FormValue("user"), r.FormValue("type"), r.FormValue("text"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, "webhook responded %d %s\n", status, body)
+	})
+
+	log.Printf("Fake LINE API listening on %s, webhook target %s", addr, webhookURL)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// receive - รับ push/reply แบบเดียวกับ LINE (ต้องมี Bearer token)
+func receive(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			http.Error(w, `{"message":"Authentication failed"}`, http.StatusUnauthorized)
+			return
+		}
+		var payload struct {
+			To         string            `json:"to"`
+			ReplyToken string            `json:"replyToken"`
+			Messages   []json.RawMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || len(payload.Messages) == 0 {
+			http.Error(w, `{"message":"The request body has 1 error(s)"}`, http.StatusBadRequest)
+			return
+		}
+
+		message := sentMessage{Kind: kind, To: payload.To, ReplyToken: payload.ReplyToken, Messages: payload.Messages, At: time.Now()}
+		mu.Lock()
+		sent = append(sent, message)
+		mu.Unlock()
+		for _, m := range payload.Messages {
+			log.Printf("%s to=%s token=%s %s", kind, payload.To, payload.ReplyToken, m)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}
+}
+
+// simulate - ส่ง webhook event ที่ลงลายเซ็นแล้วไปยัง API server เหมือนผู้ใช้พิมพ์ข้อความหา bot
+func simulate(webhookURL, secret, user, eventType, text string) (int, string, error) {
+	if user == "" {
+		user = "Ufake0000000000000000000000000001"
+	}
+	if eventType == "" {
+		eventType = "message"
+	}
+	event := map[string]interface{}{
+		"type":       eventType,
+		"timestamp":  time.Now().UnixMilli(),
+		"source":     map[string]string{"type": "user", "userId": user},
+		"replyToken": fmt.Sprintf("fake-reply-%d", time.Now().UnixNano()),
+	}
+	if eventType == "message" {
+		event["message"] = map[string]string{"type": "text", "id": fmt.Sprint(time.Now().UnixNano()), "text": text}
+	}
+	body, _ := json.Marshal(map[string]interface{}{"destination": "fake", "events": []interface{}{event}})
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Line-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return resp.StatusCode, string(respBody), nil
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
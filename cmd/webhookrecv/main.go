@@ -0,0 +1,157 @@
+// Command webhookrecv is a local webhook receiver for testing outgoing
+// webhooks: it verifies the signature of every delivery like a real
+// integration should, prints the payload and lists what it received.
+//
+//	WEBHOOK_SECRET=whsec_... go run ./cmd/webhookrecv
+//
+// Point a webhook at http://localhost:4050/hook (POST /api/admin/webhooks),
+// then POST /api/admin/webhooks/:id/test or register someone.
+//
+// Failures can be simulated to exercise retries and auto-disable:
+//
+//	curl -d status=500 localhost:4050/fail   # answer every delivery with 500
+//	curl -d status=0 localhost:4050/fail     # back to 204
+//
+// Environment: WEBHOOK_RECV_ADDR (default ":4050"), WEBHOOK_SECRET (the secret
+// returned when the webhook was created; empty skips verification),
+// WEBHOOK_TOLERANCE (max timestamp age, default "5m").
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// receivedDelivery - webhook ที่ได้รับ
+type receivedDelivery struct {
+	ID        string          `json:"id"`
+	Event     string          `json:"event"`
+	Verified  bool            `json:"verified"`
+	Status    int             `json:"status"` // status ที่ตอบกลับ
+	Payload   json.RawMessage `json:"payload"`
+	Timestamp int64           `json:"timestamp"`
+	At        time.Time       `json:"at"`
+}
+
+var (
+	mu         sync.Mutex
+	received   []receivedDelivery
+	failStatus int
+)
+
+func main() {
+	addr := envOr("WEBHOOK_RECV_ADDR", ":4050")
+	secret := os.Getenv("WEBHOOK_SECRET")
+	tolerance, err := time.ParseDuration(envOr("WEBHOOK_TOLERANCE", "5m"))
+	if err != nil {
+		log.Fatal("Invalid WEBHOOK_TOLERANCE:", err)
+	}
+	if secret == "" {
+		log.Println("WEBHOOK_SECRET is not set, signatures are not verified")
+	}
+
+	http.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST only", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		delivery := receivedDelivery{
+			ID:      r.Header.Get("X-Webhook-Id"),
+			Event:   r.Header.Get("X-Webhook-Event"),
+			Payload: json.RawMessage(body),
+			At:      time.Now(),
+		}
+		delivery.Timestamp, _ = strconv.ParseInt(r.Header.Get("X-Webhook-Timestamp"), 10, 64)
+
+		status := http.StatusNoContent
+		if secret != "" {
+			if problem := verify(secret, delivery.Timestamp, r.Header.Get("X-Webhook-Signature"), body, tolerance); problem != "" {
+				status = http.StatusUnauthorized
+				log.Printf("rejected delivery %s (%s): %s", delivery.ID, delivery.Event, problem)
+			} else {
+				delivery.Verified = true
+			}
+		}
+		mu.Lock()
+		if status == http.StatusNoContent && failStatus != 0 {
+			status = failStatus
+		}
+		delivery.Status = status
+		received = append(received, delivery)
+		mu.Unlock()
+
+		log.Printf("delivery %s %s verified=%t -> %d %s", delivery.ID, delivery.Event, delivery.Verified, status, body)
+		if status == http.StatusNoContent {
+			w.WriteHeader(status)
+			return
+		}
+		http.Error(w, http.StatusText(status), status)
+	})
+
+	http.HandleFunc("/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(received)
+	})
+
+	http.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST status (0 = succeed again)", http.StatusMethodNotAllowed)
+			return
+		}
+		status, err := strconv.Atoi(r.FormValue("status"))
+		if err != nil || (status != 0 && (status < 300 || status > 599)) {
+			http.Error(w, "status must be 0 or 300-599", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		failStatus = status
+		mu.Unlock()
+		fmt.Fprintf(w, "answering deliveries with %d\n", status)
+	})
+
+	log.Printf("Webhook receiver listening on %s (POST /hook)", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+// verify - ตรวจลายมือชื่อ HMAC-SHA256 ของ "<timestamp>.<body>" และอายุของ timestamp (กันส่งซ้ำ)
+func verify(secret string, timestamp int64, signature string, body []byte, tolerance time.Duration) string {
+	if timestamp == 0 {
+		return "missing X-Webhook-Timestamp"
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return fmt.Sprintf("timestamp is %s off", age.Round(time.Second))
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return "signature mismatch"
+	}
+	return ""
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -62,11 +62,75 @@ func Migrate() {
 		&models.Transaction{},
 		&models.ActivityLog{},
 		&models.DeviceLog{},
+		&models.Building{},
+		&models.Room{},
+		&models.RoomAssignment{},
+		&models.MedicalConditionType{},
+		&models.MedicalProfile{},
+		&models.Medication{},
+		&models.MedicalIncident{},
+		&models.ConsentRecord{},
+		&models.DataSubjectRequest{},
+		&models.RetentionPolicy{},
+		&models.RecordVersion{},
+		&models.ImportMappingTemplate{},
+		&models.ImportJob{},
+		&models.RegistrationGroup{},
+		&models.Temple{},
+		&models.AreaBoundary{},
+		&models.Notification{},
+		&models.LineLink{},
+		&models.PhoneVerification{},
+		&models.BlockedRequest{},
+		&models.IdempotencyKey{},
+		&models.CheckIn{},
+		&models.PurgedRecord{},
+		&models.WebhookSubscription{},
+		&models.WebhookDelivery{},
+		&models.WebhookAttempt{},
 	)
 
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// เลขบัตรประชาชนและเลขใบสุทธิห้ามซ้ำในรายการที่ยังไม่ถูกลบ (ค่าว่าง = ไม่ได้กรอก)
+	for _, table := range []string{"registrations", "teacher_registrations"} {
+		for _, column := range []string{"national_id_index", "monk_certificate_index"} {
+			err := DB.Exec(fmt.Sprintf(
+				"CREATE UNIQUE INDEX IF NOT EXISTS idx_%s_%s_unique ON %s (%s) WHERE %s <> '' AND deleted_at IS NULL",
+				table, column, table, column, column,
+			)).Error
+			if err != nil {
+				log.Fatal("Failed to create unique identity index:", err)
+			}
+		}
+	}
+
+	// sync_xid - transaction ที่เขียนแถวล่าสุด ให้ sync ดึงเฉพาะแถวของ transaction ที่จบแล้วทั้งหมด
+	// (updated_at ถูกตั้งก่อน commit จึงเรียงตามลำดับ commit ไม่ได้)
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE OR REPLACE FUNCTION stamp_sync_xid() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+	NEW.sync_xid := pg_current_xact_id()::text::bigint;
+	RETURN NEW;
+END
+$$`).Error; err != nil {
+			return err
+		}
+		for _, table := range []string{"registrations", "teacher_registrations", "check_ins", "purged_records"} {
+			if err := tx.Exec("DROP TRIGGER IF EXISTS stamp_sync_xid ON " + table).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("CREATE TRIGGER stamp_sync_xid BEFORE INSERT OR UPDATE ON " + table + " FOR EACH ROW EXECUTE FUNCTION stamp_sync_xid()").Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal("Failed to create sync triggers:", err)
+	}
+
 	log.Println("Database migrated successfully")
 }
@@ -0,0 +1,183 @@
+// Package events is the in-process event bus for domain events (registration
+// created, chanting stage changed, ...). Handlers publish after their
+// transaction commits; subscribers such as the admin SSE stream receive the
+// events live and can catch up from a bounded replay buffer after reconnecting.
+//
+// Event IDs are "<boot epoch>-<sequence>", so an ID from before a restart is
+// recognised as unknown and the subscriber is told to reload instead of
+// silently missing events.
+package events
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBufferSize = 1000
+	// subscriberQueue is how far a subscriber may fall behind before it is
+	// dropped; it reconnects and replays from the buffer instead.
+	subscriberQueue = 256
+)
+
+// Event is one domain event.
+type Event struct {
+	ID   string      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+
+	// Roles lists the user roles allowed to receive the event (any of them).
+	Roles []string `json:"-"`
+
+	seq uint64
+}
+
+// Subscription receives events until it is closed or falls behind.
+type Subscription struct {
+	C <-chan Event
+
+	bus   *Bus
+	ch    chan Event
+	allow func(Event) bool
+}
+
+// Close stops delivery. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if _, ok := s.bus.subscribers[s]; ok {
+		delete(s.bus.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// Bus fans events out to subscribers and keeps the most recent ones for replay.
+type Bus struct {
+	mu          sync.Mutex
+	epoch       string
+	seq         uint64
+	buffer      []Event // ring buffer, buffer[seq % size]
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBus creates a bus that keeps the last size events for replay.
+func NewBus(size int) *Bus {
+	if size < 1 {
+		size = defaultBufferSize
+	}
+	return &Bus{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffer:      make([]Event, size),
+		subscribers: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish assigns the event an ID, stores it for replay and delivers it to
+// every subscriber allowed to see it. Subscribers whose queue is full are dropped.
+func (b *Bus) Publish(eventType string, roles []string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event := Event{
+		ID:    b.epoch + "-" + strconv.FormatUint(b.seq, 10),
+		Type:  eventType,
+		Time:  time.Now(),
+		Data:  data,
+		Roles: roles,
+		seq:   b.seq,
+	}
+	b.buffer[b.seq%uint64(len(b.buffer))] = event
+
+	for sub := range b.subscribers {
+		if !sub.allow(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return event
+}
+
+// Subscribe starts a subscription. When lastEventID is set, the buffered events
+// after it are returned for replay; complete is false when that ID is unknown
+// or already evicted from the buffer, meaning the caller may have missed events.
+func (b *Bus) Subscribe(lastEventID string, allow func(Event) bool) (sub *Subscription, replay []Event, complete bool) {
+	if allow == nil {
+		allow = func(Event) bool { return true }
+	}
+	ch := make(chan Event, subscriberQueue)
+	sub = &Subscription{C: ch, bus: b, ch: ch, allow: allow}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+	epoch, seqText, ok := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if !ok || err != nil || epoch != b.epoch || seq > b.seq {
+		return sub, nil, false
+	}
+	size := uint64(len(b.buffer))
+	complete = b.seq-seq <= size
+	oldest := seq + 1
+	if !complete {
+		oldest = b.seq - size + 1
+	}
+	for n := oldest; n <= b.seq; n++ {
+		if event := b.buffer[n%size]; event.seq == n && allow(event) {
+			replay = append(replay, event)
+		}
+	}
+	return sub, replay, complete
+}
+
+var (
+	defaultMu  sync.RWMutex
+	defaultBus = NewBus(defaultBufferSize)
+)
+
+// LoadFromEnv sizes the default bus from EVENT_BUFFER_SIZE (default 1000).
+func LoadFromEnv() {
+	size := defaultBufferSize
+	if env := os.Getenv("EVENT_BUFFER_SIZE"); env != "" {
+		parsed, err := strconv.Atoi(env)
+		if err != nil || parsed < 1 {
+			log.Printf("Invalid EVENT_BUFFER_SIZE %q, using %d", env, size)
+		} else {
+			size = parsed
+		}
+	}
+	defaultMu.Lock()
+	defaultBus = NewBus(size)
+	defaultMu.Unlock()
+}
+
+// Default returns the process-wide bus.
+func Default() *Bus {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultBus
+}
+
+// Publish publishes on the default bus.
+func Publish(eventType string, roles []string, data interface{}) Event {
+	return Default().Publish(eventType, roles, data)
+}
+
+// Subscribe subscribes to the default bus.
+func Subscribe(lastEventID string, allow func(Event) bool) (*Subscription, []Event, bool) {
+	return Default().Subscribe(lastEventID, allow)
+}
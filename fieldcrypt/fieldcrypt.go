@@ -0,0 +1,354 @@
+// Package fieldcrypt provides envelope encryption for individual database columns
+// and keyed blind indexes so encrypted values can still be looked up.
+//
+// Every value is encrypted with its own random data key (AES-256-GCM). The data key
+// is wrapped with a versioned master key, so rotating the master key only requires
+// re-wrapping data keys (see Rewrap) instead of re-encrypting every value.
+//
+// Stored format: enc:v1:<master key version>:<base64 wrapped data key>:<base64 ciphertext>
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey = errors.New("fieldcrypt: unknown master key version")
+	ErrMalformed  = errors.New("fieldcrypt: malformed ciphertext")
+	// ErrReservedPrefix is returned when encryption is disabled and a plain text value
+	// starts with the storage prefix, which would otherwise be read back as ciphertext
+	ErrReservedPrefix = errors.New("fieldcrypt: plain text value starts with the reserved " + prefix + " prefix")
+)
+
+type keyring struct {
+	keys       map[int][]byte // master key version -> 32-byte key
+	active     int
+	indexKey   []byte
+	configured bool
+}
+
+var (
+	mu   sync.RWMutex
+	ring = &keyring{keys: map[int][]byte{}}
+)
+
+// LoadFromEnv reads the keyring from environment variables:
+//
+//	FIELD_ENCRYPTION_KEYS       comma-separated "version:base64key" pairs (32-byte keys)
+//	FIELD_ENCRYPTION_ACTIVE_KEY version used for new values (default: highest version)
+//	BLIND_INDEX_KEY             base64 key for blind indexes (required when keys are set)
+//
+// When no keys are configured values are stored in plain text and a warning is logged,
+// which keeps local development working without any setup.
+func LoadFromEnv() error {
+	keysEnv := strings.TrimSpace(os.Getenv("FIELD_ENCRYPTION_KEYS"))
+	if keysEnv == "" {
+		log.Println("WARNING: FIELD_ENCRYPTION_KEYS not set, personal data will be stored unencrypted")
+		mu.Lock()
+		ring = &keyring{keys: map[int][]byte{}, indexKey: []byte(os.Getenv("BLIND_INDEX_KEY"))}
+		mu.Unlock()
+		return nil
+	}
+
+	r := &keyring{keys: map[int][]byte{}, configured: true}
+	for _, pair := range strings.Split(keysEnv, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("fieldcrypt: invalid key entry %q (expected version:base64key)", pair)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || version <= 0 {
+			return fmt.Errorf("fieldcrypt: invalid key version %q", parts[0])
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil || len(key) != 32 {
+			return fmt.Errorf("fieldcrypt: key version %d must be 32 bytes base64", version)
+		}
+		r.keys[version] = key
+		if version > r.active {
+			r.active = version
+		}
+	}
+
+	if activeEnv := os.Getenv("FIELD_ENCRYPTION_ACTIVE_KEY"); activeEnv != "" {
+		active, err := strconv.Atoi(activeEnv)
+		if err != nil {
+			return fmt.Errorf("fieldcrypt: invalid FIELD_ENCRYPTION_ACTIVE_KEY %q", activeEnv)
+		}
+		if _, ok := r.keys[active]; !ok {
+			return fmt.Errorf("fieldcrypt: active key version %d not found in FIELD_ENCRYPTION_KEYS", active)
+		}
+		r.active = active
+	}
+
+	indexKey, err := base64.StdEncoding.DecodeString(os.Getenv("BLIND_INDEX_KEY"))
+	if err != nil || len(indexKey) < 32 {
+		return errors.New("fieldcrypt: BLIND_INDEX_KEY must be at least 32 bytes base64")
+	}
+	r.indexKey = indexKey
+
+	mu.Lock()
+	ring = r
+	mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether master keys are configured
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return ring.configured
+}
+
+// ActiveVersion returns the master key version used for new values
+func ActiveVersion() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return ring.active
+}
+
+// IsEncrypted reports whether s is in the encrypted storage format
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// KeyVersion returns the master key version s was wrapped with (0 for plain text)
+func KeyVersion(s string) int {
+	if !IsEncrypted(s) {
+		return 0
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, prefix), ":", 2)
+	version, _ := strconv.Atoi(parts[0])
+	return version
+}
+
+// Encrypt encrypts plaintext with a fresh data key wrapped by the active master key.
+// Empty strings are returned unchanged. Input that merely looks encrypted is still
+// treated as plain text (it may come from a public form), see EncryptIfPlain.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return plaintext, nil
+	}
+
+	mu.RLock()
+	r := ring
+	mu.RUnlock()
+	if !r.configured {
+		if IsEncrypted(plaintext) {
+			return "", ErrReservedPrefix
+		}
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(r.keys[r.active], dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%d:%s:%s", prefix, r.active,
+		base64.RawStdEncoding.EncodeToString(wrapped),
+		base64.RawStdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// EncryptIfPlain encrypts value unless it is already stored in the encrypted format.
+// Only for migrating stored columns in place; user input must go through Encrypt.
+func EncryptIfPlain(value string) (string, error) {
+	if IsEncrypted(value) {
+		return value, nil
+	}
+	return Encrypt(value)
+}
+
+// Decrypt returns the plaintext of an encrypted value. Plain text input is returned
+// as is so rows written before encryption was enabled keep working.
+func Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	version, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	mu.RLock()
+	masterKey, ok := ring.keys[version]
+	mu.RUnlock()
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	dataKey, err := open(masterKey, wrapped)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Rewrap re-wraps the data key of an encrypted value with the active master key.
+// The ciphertext itself is not touched. Plain text input is encrypted.
+func Rewrap(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return Encrypt(value)
+	}
+
+	version, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	mu.RLock()
+	r := ring
+	mu.RUnlock()
+	if version == r.active {
+		return value, nil
+	}
+
+	oldKey, ok := r.keys[version]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	dataKey, err := open(oldKey, wrapped)
+	if err != nil {
+		return "", err
+	}
+	rewrapped, err := seal(r.keys[r.active], dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%d:%s:%s", prefix, r.active,
+		base64.RawStdEncoding.EncodeToString(rewrapped),
+		base64.RawStdEncoding.EncodeToString(ciphertext)), nil
+}
+
+// BlindIndex returns a deterministic keyed hash of value for equality lookups
+// on encrypted columns. Callers should normalize value first (see NormalizePhone).
+func BlindIndex(value string) string {
+	if value == "" {
+		return ""
+	}
+	mu.RLock()
+	key := ring.indexKey
+	mu.RUnlock()
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// NormalizeDigits strips everything except digits, e.g. "1-2345-67890-12-1" -> "1234567890121"
+func NormalizeDigits(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// NormalizePhone strips everything except digits and converts +66 numbers to the
+// local 0-prefixed form so "+66 81-234-5678" and "0812345678" share one index
+func NormalizePhone(phone string) string {
+	digits := NormalizeDigits(phone)
+	if strings.HasPrefix(digits, "66") && len(digits) == 11 {
+		digits = "0" + digits[2:]
+	}
+	return digits
+}
+
+// GenerateKey returns a new random 32-byte key encoded as base64
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func parse(value string) (int, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return 0, nil, nil, ErrMalformed
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, nil, nil, ErrMalformed
+	}
+	wrapped, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, nil, nil, ErrMalformed
+	}
+	ciphertext, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, ErrMalformed
+	}
+	return version, wrapped, ciphertext, nil
+}
+
+// seal encrypts data with AES-256-GCM and prepends the nonce
+func seal(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// open decrypts data produced by seal
+func open(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+}
@@ -0,0 +1,246 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey returns a deterministic 32-byte base64 key
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune('a'+b)), 32)))
+}
+
+// loadKeys configures the keyring from env for one test and restores plain text mode afterwards
+func loadKeys(t *testing.T, keys, active string) {
+	t.Helper()
+	t.Setenv("FIELD_ENCRYPTION_KEYS", keys)
+	t.Setenv("FIELD_ENCRYPTION_ACTIVE_KEY", active)
+	t.Setenv("BLIND_INDEX_KEY", testKey(9))
+	if err := LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv: %v", err)
+	}
+	t.Cleanup(func() {
+		mu.Lock()
+		ring = &keyring{keys: map[int][]byte{}}
+		mu.Unlock()
+	})
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	loadKeys(t, "1:"+testKey(1), "")
+
+	for _, plaintext := range []string{"0812345678", "วัดป่าสันติธรรม", "a,b\n\"c\"", "enc:v1:looks:like:ciphertext"} {
+		encrypted, err := Encrypt(plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%q): %v", plaintext, err)
+		}
+		if !IsEncrypted(encrypted) || encrypted == plaintext {
+			t.Fatalf("Encrypt(%q) = %q, want encrypted value", plaintext, encrypted)
+		}
+		decrypted, err := Decrypt(encrypted)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if decrypted != plaintext {
+			t.Errorf("round trip = %q, want %q", decrypted, plaintext)
+		}
+	}
+
+	if encrypted, err := Encrypt(""); err != nil || encrypted != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v, want empty", encrypted, err)
+	}
+	if decrypted, err := Decrypt("legacy plain text"); err != nil || decrypted != "legacy plain text" {
+		t.Errorf("Decrypt(plain) = %q, %v, want input unchanged", decrypted, err)
+	}
+}
+
+func TestEncryptUsesFreshDataKey(t *testing.T) {
+	loadKeys(t, "1:"+testKey(1), "")
+
+	a, _ := Encrypt("same")
+	b, _ := Encrypt("same")
+	if a == b {
+		t.Error("two encryptions of the same value are identical")
+	}
+}
+
+func TestDecryptTamperedOrMalformed(t *testing.T) {
+	loadKeys(t, "1:"+testKey(1), "")
+
+	encrypted, _ := Encrypt("secret")
+	tampered := encrypted[:len(encrypted)-2] + "AA"
+	if _, err := Decrypt(tampered); err == nil {
+		t.Error("Decrypt accepted a tampered ciphertext")
+	}
+	if _, err := Decrypt(prefix + "1:onlyonepart"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("Decrypt(malformed) error = %v, want ErrMalformed", err)
+	}
+}
+
+func TestRewrapAndKeyVersion(t *testing.T) {
+	keys := "1:" + testKey(1) + ",2:" + testKey(2)
+	loadKeys(t, keys, "1")
+
+	old, err := Encrypt("0812345678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := KeyVersion(old); v != 1 {
+		t.Fatalf("KeyVersion = %d, want 1", v)
+	}
+
+	loadKeys(t, keys, "2")
+	if v := ActiveVersion(); v != 2 {
+		t.Fatalf("ActiveVersion = %d, want 2", v)
+	}
+	rewrapped, err := Rewrap(old)
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if v := KeyVersion(rewrapped); v != 2 {
+		t.Errorf("KeyVersion after Rewrap = %d, want 2", v)
+	}
+	// only the data key is re-wrapped, the ciphertext part stays the same
+	if oldCT, newCT := old[strings.LastIndex(old, ":"):], rewrapped[strings.LastIndex(rewrapped, ":"):]; oldCT != newCT {
+		t.Error("Rewrap changed the ciphertext")
+	}
+	if plaintext, err := Decrypt(rewrapped); err != nil || plaintext != "0812345678" {
+		t.Errorf("Decrypt(rewrapped) = %q, %v", plaintext, err)
+	}
+	if again, _ := Rewrap(rewrapped); again != rewrapped {
+		t.Error("Rewrap with the active key should return the value unchanged")
+	}
+
+	plain, err := Rewrap("plain")
+	if err != nil || KeyVersion(plain) != 2 {
+		t.Errorf("Rewrap(plain) = %q, %v, want encrypted with version 2", plain, err)
+	}
+	if v := KeyVersion("plain"); v != 0 {
+		t.Errorf("KeyVersion(plain) = %d, want 0", v)
+	}
+
+	// a retired key can no longer decrypt
+	loadKeys(t, "2:"+testKey(2), "")
+	if _, err := Decrypt(old); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with removed key error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestLoadFromEnvErrors(t *testing.T) {
+	tests := []struct {
+		name, keys, active, index string
+	}{
+		{"missing version", testKey(1), "", testKey(9)},
+		{"bad version", "x:" + testKey(1), "", testKey(9)},
+		{"short key", "1:" + base64.StdEncoding.EncodeToString([]byte("short")), "", testKey(9)},
+		{"unknown active", "1:" + testKey(1), "3", testKey(9)},
+		{"missing index key", "1:" + testKey(1), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FIELD_ENCRYPTION_KEYS", tt.keys)
+			t.Setenv("FIELD_ENCRYPTION_ACTIVE_KEY", tt.active)
+			t.Setenv("BLIND_INDEX_KEY", tt.index)
+			if err := LoadFromEnv(); err == nil {
+				t.Error("LoadFromEnv succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestReservedPrefix(t *testing.T) {
+	t.Run("plain text mode rejects the prefix", func(t *testing.T) {
+		t.Setenv("FIELD_ENCRYPTION_KEYS", "")
+		if err := LoadFromEnv(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Encrypt(prefix + "1:x:y"); !errors.Is(err, ErrReservedPrefix) {
+			t.Errorf("Encrypt(prefixed) error = %v, want ErrReservedPrefix", err)
+		}
+		if value, err := Encrypt("0812345678"); err != nil || value != "0812345678" {
+			t.Errorf("Encrypt(plain) = %q, %v, want unchanged", value, err)
+		}
+	})
+
+	t.Run("prefixed input is encrypted, EncryptIfPlain keeps ciphertext", func(t *testing.T) {
+		loadKeys(t, "1:"+testKey(1), "")
+		input := prefix + "1:not:real"
+		encrypted, err := Encrypt(input)
+		if err != nil || encrypted == input {
+			t.Fatalf("Encrypt(prefixed) = %q, %v, want a new ciphertext", encrypted, err)
+		}
+		if decrypted, _ := Decrypt(encrypted); decrypted != input {
+			t.Errorf("Decrypt = %q, want %q", decrypted, input)
+		}
+		if kept, err := EncryptIfPlain(encrypted); err != nil || kept != encrypted {
+			t.Errorf("EncryptIfPlain(ciphertext) = %q, %v, want unchanged", kept, err)
+		}
+		if migrated, err := EncryptIfPlain("plain"); err != nil || !IsEncrypted(migrated) {
+			t.Errorf("EncryptIfPlain(plain) = %q, %v, want encrypted", migrated, err)
+		}
+	})
+}
+
+func TestBlindIndex(t *testing.T) {
+	loadKeys(t, "1:"+testKey(1), "")
+
+	if BlindIndex("") != "" {
+		t.Error("BlindIndex(\"\") should be empty")
+	}
+	a := BlindIndex("0812345678")
+	if len(a) != 32 || a != BlindIndex("0812345678") {
+		t.Errorf("BlindIndex not deterministic or wrong length: %q", a)
+	}
+	if a == BlindIndex("0812345679") {
+		t.Error("different values share a blind index")
+	}
+
+	t.Setenv("BLIND_INDEX_KEY", testKey(8))
+	if err := LoadFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if a == BlindIndex("0812345678") {
+		t.Error("blind index does not depend on BLIND_INDEX_KEY")
+	}
+}
+
+func TestNormalizePhoneSharesBlindIndex(t *testing.T) {
+	loadKeys(t, "1:"+testKey(1), "")
+
+	tests := []struct {
+		input, want string
+	}{
+		{"0812345678", "0812345678"},
+		{"081-234-5678", "0812345678"},
+		{"081 234 5678", "0812345678"},
+		{"+66 81-234-5678", "0812345678"},
+		{"66812345678", "0812345678"},
+		{"(02) 123-4567", "021234567"},
+		{"", ""},
+	}
+	want := BlindIndex("0812345678")
+	for _, tt := range tests {
+		got := NormalizePhone(tt.input)
+		if got != tt.want {
+			t.Errorf("NormalizePhone(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+		if tt.want == "0812345678" && BlindIndex(got) != want {
+			t.Errorf("BlindIndex(NormalizePhone(%q)) differs from the canonical number", tt.input)
+		}
+	}
+}
+
+func TestNormalizeDigits(t *testing.T) {
+	tests := map[string]string{
+		"1-2345-67890-12-1": "1234567890121",
+		" 12 34 ":           "1234",
+		"abc":               "",
+	}
+	for input, want := range tests {
+		if got := NormalizeDigits(input); got != want {
+			t.Errorf("NormalizeDigits(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"registration-system/captcha"
+	"registration-system/database"
+	"registration-system/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetCaptchaChallenge - บอกแบบฟอร์มสาธารณะว่าต้องใช้ captcha แบบใด และออกโจทย์ proof of work เมื่อใช้ CAPTCHA_PROVIDER=pow
+func GetCaptchaChallenge(c *fiber.Ctx) error {
+	switch verifier := captcha.Get().(type) {
+	case nil:
+		return c.JSON(fiber.Map{"enabled": false})
+	case *captcha.ProofOfWork:
+		challenge, err := verifier.Issue()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "ไม่สามารถสร้างโจทย์ได้",
+			})
+		}
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(fiber.Map{
+			"enabled":    true,
+			"provider":   "pow",
+			"challenge":  challenge.Challenge,
+			"difficulty": challenge.Difficulty,
+			"expires_at": challenge.ExpiresAt,
+		})
+	default:
+		return c.JSON(fiber.Map{"enabled": true, "provider": "widget"})
+	}
+}
+
+// GetBlockedRequests - รายการคำขอสาธารณะที่ถูกบล็อก พร้อมสรุปตามเหตุผลและ IP ใน 24 ชั่วโมงล่าสุด
+func GetBlockedRequests(c *fiber.Ctx) error {
+	query := database.DB.Order("created_at DESC")
+	if route := c.Query("route"); route != "" {
+		query = query.Where("route = ?", route)
+	}
+	if reason := c.Query("reason"); reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if ip := c.Query("ip_address"); ip != "" {
+		query = query.Where("ip_address = ?", ip)
+	}
+	if since := c.Query("since"); since != "" {
+		parsed, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "รูปแบบเวลาไม่ถูกต้อง (RFC3339)",
+			})
+		}
+		query = query.Where("created_at >= ?", parsed)
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	var requests []models.BlockedRequest
+	if err := query.Limit(limit).Find(&requests).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	var byReason []struct {
+		Route  string `json:"route"`
+		Reason string `json:"reason"`
+		Total  int64  `json:"total"`
+	}
+	database.DB.Model(&models.BlockedRequest{}).
+		Select("route, reason, SUM(count) AS total").
+		Where("created_at >= ?", since).
+		Group("route, reason").Order("total DESC").
+		Scan(&byReason)
+	var topIPs []struct {
+		IPAddress string `json:"ip_address"`
+		Total     int64  `json:"total"`
+	}
+	database.DB.Model(&models.BlockedRequest{}).
+		Select("ip_address, SUM(count) AS total").
+		Where("created_at >= ?", since).
+		Group("ip_address").Order("total DESC").Limit(20).
+		Scan(&topIPs)
+
+	return c.JSON(fiber.Map{
+		"requests": requests,
+		"last_24h": fiber.Map{
+			"by_reason": byReason,
+			"top_ips":   topIPs,
+		},
+	})
+}
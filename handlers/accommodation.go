@@ -0,0 +1,905 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"registration-system/database"
+	"registration-system/middleware"
+	"registration-system/models"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type BuildingRequest struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // "kuti" or "hall"
+	Description string `json:"description"`
+}
+
+type RoomRequest struct {
+	BuildingID   uint   `json:"building_id"`
+	Name         string `json:"name"`
+	Capacity     int    `json:"capacity"`
+	GroundFloor  bool   `json:"ground_floor"`
+	NearBathroom bool   `json:"near_bathroom"`
+	TeacherOnly  bool   `json:"teacher_only"`
+	Notes        string `json:"notes"`
+}
+
+type RoomAssignmentRequest struct {
+	RoomID                uint   `json:"room_id"`
+	RegistrationID        *uint  `json:"registration_id"`
+	TeacherRegistrationID *uint  `json:"teacher_registration_id"`
+	Note                  string `json:"note"`
+}
+
+type AutoAssignRequest struct {
+	BuildingID uint `json:"building_id"` // จำกัดเฉพาะอาคาร (ไม่ระบุ = ทุกอาคาร)
+	DryRun     bool `json:"dry_run"`     // แสดงผลการจัดโดยไม่บันทึก
+}
+
+// errAssignment - ข้อผิดพลาดจากการตรวจสอบการจัดที่พัก (ส่งกลับเป็น 409)
+type errAssignment struct{ msg string }
+
+func (e errAssignment) Error() string { return e.msg }
+
+// GetBuildings - ดึงรายการอาคารพร้อมห้องพัก
+func GetBuildings(c *fiber.Ctx) error {
+	var buildings []models.Building
+
+	if err := database.DB.Preload("Rooms", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	}).Order("name").Find(&buildings).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	return c.JSON(buildings)
+}
+
+// CreateBuilding - เพิ่มอาคารที่พัก
+func CreateBuilding(c *fiber.Ctx) error {
+	var req BuildingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณากรอกชื่ออาคาร",
+		})
+	}
+	if req.Type != "kuti" && req.Type != "hall" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ประเภทต้องเป็น 'kuti' หรือ 'hall'",
+		})
+	}
+
+	building := models.Building{
+		Name:        req.Name,
+		Type:        req.Type,
+		Description: req.Description,
+	}
+
+	if err := database.DB.Create(&building).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	return c.Status(201).JSON(building)
+}
+
+// UpdateBuilding - แก้ไขข้อมูลอาคาร
+func UpdateBuilding(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var building models.Building
+
+	if err := database.DB.First(&building, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลอาคาร",
+		})
+	}
+
+	var req BuildingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.Type != "" && req.Type != "kuti" && req.Type != "hall" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ประเภทต้องเป็น 'kuti' หรือ 'hall'",
+		})
+	}
+
+	if req.Name != "" {
+		building.Name = req.Name
+	}
+	if req.Type != "" {
+		building.Type = req.Type
+	}
+	building.Description = req.Description
+
+	if err := database.DB.Save(&building).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	return c.JSON(building)
+}
+
+// DeleteBuilding - ลบอาคาร (ต้องไม่มีห้องพักเหลืออยู่)
+func DeleteBuilding(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var building models.Building
+
+	if err := database.DB.First(&building, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลอาคาร",
+		})
+	}
+
+	var roomCount int64
+	database.DB.Model(&models.Room{}).Where("building_id = ?", building.ID).Count(&roomCount)
+	if roomCount > 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ไม่สามารถลบอาคารที่ยังมีห้องพักอยู่ได้",
+		})
+	}
+
+	if err := database.DB.Delete(&building).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบข้อมูลสำเร็จ",
+	})
+}
+
+// CreateRoom - เพิ่มห้องพัก
+func CreateRoom(c *fiber.Ctx) error {
+	var req RoomRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณากรอกชื่อห้อง",
+		})
+	}
+	if req.Capacity <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "จำนวนที่นอนต้องมากกว่า 0",
+		})
+	}
+
+	var building models.Building
+	if err := database.DB.First(&building, req.BuildingID).Error; err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลอาคาร",
+		})
+	}
+
+	room := models.Room{
+		BuildingID:   req.BuildingID,
+		Name:         req.Name,
+		Capacity:     req.Capacity,
+		GroundFloor:  req.GroundFloor,
+		NearBathroom: req.NearBathroom,
+		TeacherOnly:  req.TeacherOnly,
+		Notes:        req.Notes,
+	}
+
+	if err := database.DB.Create(&room).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	return c.Status(201).JSON(room)
+}
+
+// UpdateRoom - แก้ไขข้อมูลห้องพัก (ลดจำนวนที่นอนต่ำกว่าผู้พักปัจจุบันไม่ได้)
+func UpdateRoom(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var room models.Room
+
+	if err := database.DB.First(&room, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลห้องพัก",
+		})
+	}
+
+	var req RoomRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	var occupied int64
+	database.DB.Model(&models.RoomAssignment{}).Where("room_id = ?", room.ID).Count(&occupied)
+
+	if req.Capacity > 0 {
+		if int64(req.Capacity) < occupied {
+			return c.Status(409).JSON(fiber.Map{
+				"error": fmt.Sprintf("ห้องนี้มีผู้พักอยู่แล้ว %d คน ไม่สามารถลดจำนวนที่นอนได้", occupied),
+			})
+		}
+		room.Capacity = req.Capacity
+	}
+
+	if req.TeacherOnly && !room.TeacherOnly {
+		var monkCount int64
+		database.DB.Model(&models.RoomAssignment{}).Where("room_id = ? AND registration_id IS NOT NULL", room.ID).Count(&monkCount)
+		if monkCount > 0 {
+			return c.Status(409).JSON(fiber.Map{
+				"error": "ห้องนี้มีผู้ลงทะเบียนทั่วไปพักอยู่ ไม่สามารถกำหนดเป็นห้องพระอาจารย์ได้",
+			})
+		}
+	}
+
+	if req.Name != "" {
+		room.Name = req.Name
+	}
+	room.GroundFloor = req.GroundFloor
+	room.NearBathroom = req.NearBathroom
+	room.TeacherOnly = req.TeacherOnly
+	room.Notes = req.Notes
+
+	if err := database.DB.Save(&room).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	return c.JSON(room)
+}
+
+// DeleteRoom - ลบห้องพัก (ต้องไม่มีผู้พักอยู่)
+func DeleteRoom(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var room models.Room
+
+	if err := database.DB.First(&room, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลห้องพัก",
+		})
+	}
+
+	var occupied int64
+	database.DB.Model(&models.RoomAssignment{}).Where("room_id = ?", room.ID).Count(&occupied)
+	if occupied > 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ไม่สามารถลบห้องที่มีผู้พักอยู่ได้",
+		})
+	}
+
+	if err := database.DB.Delete(&room).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบข้อมูลสำเร็จ",
+	})
+}
+
+// CreateRoomAssignment - จัดที่พักให้ผู้ลงทะเบียนหรือพระอาจารย์
+func CreateRoomAssignment(c *fiber.Ctx) error {
+	var req RoomAssignmentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if (req.RegistrationID == nil) == (req.TeacherRegistrationID == nil) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ต้องระบุ registration_id หรือ teacher_registration_id อย่างใดอย่างหนึ่ง",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+
+	assignment := models.RoomAssignment{
+		RoomID:                req.RoomID,
+		RegistrationID:        req.RegistrationID,
+		TeacherRegistrationID: req.TeacherRegistrationID,
+		Note:                  req.Note,
+		AssignedByID:          userID,
+	}
+
+	var occupantName string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		name, err := checkRoomAssignment(tx, &assignment)
+		if err != nil {
+			return err
+		}
+		occupantName = name
+		return tx.Create(&assignment).Error
+	})
+	if err != nil {
+		var conflict errAssignment
+		if errors.As(err, &conflict) {
+			return c.Status(409).JSON(fiber.Map{
+				"error": conflict.msg,
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	database.DB.Preload("Room.Building").First(&assignment, assignment.ID)
+
+	activityLog := models.ActivityLog{
+		Action:      "จัดที่พัก",
+		Description: fmt.Sprintf("จัดให้ %s พักที่ %s ห้อง %s", occupantName, assignment.Room.Building.Name, assignment.Room.Name),
+		Module:      "accommodation",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.Status(201).JSON(assignment)
+}
+
+// DeleteRoomAssignment - ยกเลิกการจัดที่พัก
+func DeleteRoomAssignment(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var assignment models.RoomAssignment
+
+	if err := database.DB.Preload("Room.Building").First(&assignment, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการจัดที่พัก",
+		})
+	}
+
+	if err := database.DB.Delete(&assignment).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลได้",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "ยกเลิกการจัดที่พัก",
+		Description: fmt.Sprintf("ยกเลิกที่พัก %s ห้อง %s (assignment #%d)", assignment.Room.Building.Name, assignment.Room.Name, assignment.ID),
+		Module:      "accommodation",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบข้อมูลสำเร็จ",
+	})
+}
+
+// checkRoomAssignment - ตรวจสอบความจุห้อง, ห้องพระอาจารย์ และการจัดซ้ำ
+// ต้องเรียกภายใน transaction เพราะ lock แถวของห้องไว้จนจบ transaction
+func checkRoomAssignment(tx *gorm.DB, assignment *models.RoomAssignment) (string, error) {
+	var room models.Room
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&room, assignment.RoomID).Error; err != nil {
+		return "", errAssignment{"ไม่พบข้อมูลห้องพัก"}
+	}
+
+	var name string
+	if assignment.RegistrationID != nil {
+		var registration models.Registration
+		if err := tx.First(&registration, *assignment.RegistrationID).Error; err != nil {
+			return "", errAssignment{"ไม่พบข้อมูลการลงทะเบียน"}
+		}
+		if room.TeacherOnly {
+			return "", errAssignment{"ห้องนี้สำหรับพระอาจารย์เท่านั้น"}
+		}
+		var existing int64
+		tx.Model(&models.RoomAssignment{}).Where("registration_id = ?", registration.ID).Count(&existing)
+		if existing > 0 {
+			return "", errAssignment{fmt.Sprintf("%s ได้รับการจัดที่พักแล้ว", registration.FullName)}
+		}
+		name = registration.FullName
+	} else {
+		var teacher models.TeacherRegistration
+		if err := tx.First(&teacher, *assignment.TeacherRegistrationID).Error; err != nil {
+			return "", errAssignment{"ไม่พบข้อมูลการลงทะเบียนพระอาจารย์"}
+		}
+		var existing int64
+		tx.Model(&models.RoomAssignment{}).Where("teacher_registration_id = ?", teacher.ID).Count(&existing)
+		if existing > 0 {
+			return "", errAssignment{fmt.Sprintf("%s ได้รับการจัดที่พักแล้ว", teacher.FullName)}
+		}
+		name = teacher.FullName
+	}
+
+	var occupied int64
+	tx.Model(&models.RoomAssignment{}).Where("room_id = ?", room.ID).Count(&occupied)
+	if occupied >= int64(room.Capacity) {
+		return "", errAssignment{fmt.Sprintf("ห้อง %s เต็มแล้ว (%d/%d)", room.Name, occupied, room.Capacity)}
+	}
+
+	return name, nil
+}
+
+// accessibilityKeywords - คำในอาการป่วยที่บ่งบอกว่าควรพักชั้นล่าง/ใกล้ห้องน้ำ
+var accessibilityKeywords = []string{
+	"เดินไม่สะดวก", "เดินลำบาก", "รถเข็น", "ไม้เท้า", "เข่า", "ขา", "อัมพาต", "หัวใจ",
+	"เบาหวาน", "ปัสสาวะ", "ไต", "wheelchair", "mobility", "knee", "diabetes",
+}
+
+// needsAccessibleRoom - ตรวจจาก MedicalCondition ว่าควรได้ห้องชั้นล่างใกล้ห้องน้ำหรือไม่
+func needsAccessibleRoom(medicalCondition string) bool {
+	condition := strings.ToLower(strings.TrimSpace(medicalCondition))
+	if condition == "" || condition == "-" || condition == "ไม่มี" {
+		return false
+	}
+	for _, keyword := range accessibilityKeywords {
+		if strings.Contains(condition, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// autoAssignCandidate - ผู้ที่ยังไม่ได้รับการจัดที่พัก
+type autoAssignCandidate struct {
+	RegistrationID        *uint
+	TeacherRegistrationID *uint
+	FullName              string
+	Vassa                 int
+	IsTeacher             bool
+	NeedsAccessible       bool
+}
+
+// autoAssignRoom - ห้องพร้อมจำนวนที่ว่างระหว่างการจัด
+type autoAssignRoom struct {
+	Room      models.Room
+	Remaining int
+}
+
+// AutoAssignResult - ผลการจัดที่พักรายคน
+type AutoAssignResult struct {
+	RegistrationID        *uint  `json:"registration_id,omitempty"`
+	TeacherRegistrationID *uint  `json:"teacher_registration_id,omitempty"`
+	FullName              string `json:"full_name"`
+	Vassa                 int    `json:"vassa"`
+	RoomID                uint   `json:"room_id,omitempty"`
+	RoomName              string `json:"room_name,omitempty"`
+	BuildingName          string `json:"building_name,omitempty"`
+	Reason                string `json:"reason,omitempty"` // เหตุผลที่จัดไม่ได้
+}
+
+// AutoAssignRooms - จัดที่พักอัตโนมัติ
+// พระอาจารย์ได้ก่อน ตามด้วยผู้ที่ต้องการห้องชั้นล่าง (จาก MedicalProfile หรือ MedicalCondition) แล้วเรียงตามพรรษามากไปน้อย
+func AutoAssignRooms(c *fiber.Ctx) error {
+	var req AutoAssignRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "ข้อมูลไม่ถูกต้อง",
+			})
+		}
+	}
+
+	userID := c.Locals("userID").(uint)
+	var results []AutoAssignResult
+	var assignedCount int
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock ห้องทั้งหมดที่เกี่ยวข้องเพื่อกันการจัดซ้อนกับการจัดด้วยมือ
+		var rooms []models.Room
+		roomQuery := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Building").Order("building_id, name")
+		if req.BuildingID != 0 {
+			roomQuery = roomQuery.Where("building_id = ?", req.BuildingID)
+		}
+		if err := roomQuery.Find(&rooms).Error; err != nil {
+			return err
+		}
+
+		var occupancy []struct {
+			RoomID uint
+			Count  int
+		}
+		tx.Model(&models.RoomAssignment{}).Select("room_id, COUNT(*) as count").Group("room_id").Scan(&occupancy)
+		occupied := make(map[uint]int, len(occupancy))
+		for _, o := range occupancy {
+			occupied[o.RoomID] = o.Count
+		}
+
+		available := make([]*autoAssignRoom, 0, len(rooms))
+		for _, room := range rooms {
+			if remaining := room.Capacity - occupied[room.ID]; remaining > 0 {
+				available = append(available, &autoAssignRoom{Room: room, Remaining: remaining})
+			}
+		}
+
+		candidates, err := loadAutoAssignCandidates(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, candidate := range candidates {
+			result := AutoAssignResult{
+				RegistrationID:        candidate.RegistrationID,
+				TeacherRegistrationID: candidate.TeacherRegistrationID,
+				FullName:              candidate.FullName,
+				Vassa:                 candidate.Vassa,
+			}
+
+			room := pickRoom(available, candidate)
+			if room == nil {
+				result.Reason = "ไม่มีห้องว่างที่เหมาะสม"
+				results = append(results, result)
+				continue
+			}
+
+			room.Remaining--
+			result.RoomID = room.Room.ID
+			result.RoomName = room.Room.Name
+			result.BuildingName = room.Room.Building.Name
+			results = append(results, result)
+			assignedCount++
+
+			if req.DryRun {
+				continue
+			}
+
+			assignment := models.RoomAssignment{
+				RoomID:                room.Room.ID,
+				RegistrationID:        candidate.RegistrationID,
+				TeacherRegistrationID: candidate.TeacherRegistrationID,
+				AutoAssign:            true,
+				AssignedByID:          userID,
+			}
+			if err := tx.Create(&assignment).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถจัดที่พักอัตโนมัติได้",
+		})
+	}
+
+	if !req.DryRun && assignedCount > 0 {
+		activityLog := models.ActivityLog{
+			Action:      "จัดที่พักอัตโนมัติ",
+			Description: fmt.Sprintf("จัดที่พักอัตโนมัติ %d คน จากผู้ที่ยังไม่มีที่พัก %d คน", assignedCount, len(results)),
+			Module:      "accommodation",
+			UserID:      userID,
+		}
+		database.DB.Create(&activityLog)
+	}
+
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"dry_run":  req.DryRun,
+		"assigned": assignedCount,
+		"pending":  len(results) - assignedCount,
+		"results":  results,
+	})
+}
+
+// loadAutoAssignCandidates - โหลดผู้ที่ยังไม่มีที่พักและเรียงลำดับความสำคัญ
+func loadAutoAssignCandidates(tx *gorm.DB) ([]autoAssignCandidate, error) {
+	var teachers []models.TeacherRegistration
+	if err := tx.Where("id NOT IN (?)", tx.Model(&models.RoomAssignment{}).Select("teacher_registration_id").Where("teacher_registration_id IS NOT NULL")).
+		Find(&teachers).Error; err != nil {
+		return nil, err
+	}
+
+	var registrations []models.Registration
+	if err := tx.Where("id NOT IN (?)", tx.Model(&models.RoomAssignment{}).Select("registration_id").Where("registration_id IS NOT NULL")).
+		Find(&registrations).Error; err != nil {
+		return nil, err
+	}
+
+	// ข้อมูลสุขภาพแบบมีโครงสร้างมีผลเหนือการเดาจากข้อความ
+	var profiles []models.MedicalProfile
+	if err := tx.Preload("Conditions").Find(&profiles).Error; err != nil {
+		return nil, err
+	}
+	accessibleRegistrations := make(map[uint]bool)
+	accessibleTeachers := make(map[uint]bool)
+	for _, profile := range profiles {
+		accessible := profile.MobilityNeeds != "" && profile.MobilityNeeds != "none"
+		for _, condition := range profile.Conditions {
+			accessible = accessible || condition.RequiresAccessibleRoom
+		}
+		if profile.RegistrationID != nil {
+			accessibleRegistrations[*profile.RegistrationID] = accessible
+		}
+		if profile.TeacherRegistrationID != nil {
+			accessibleTeachers[*profile.TeacherRegistrationID] = accessible
+		}
+	}
+
+	candidates := make([]autoAssignCandidate, 0, len(teachers)+len(registrations))
+	for i := range teachers {
+		accessible, hasProfile := accessibleTeachers[teachers[i].ID]
+		if !hasProfile {
+			accessible = needsAccessibleRoom(teachers[i].MedicalCondition.String())
+		}
+		candidates = append(candidates, autoAssignCandidate{
+			TeacherRegistrationID: &teachers[i].ID,
+			FullName:              teachers[i].FullName,
+			Vassa:                 teachers[i].Vassa,
+			IsTeacher:             true,
+			NeedsAccessible:       accessible,
+		})
+	}
+	for i := range registrations {
+		accessible, hasProfile := accessibleRegistrations[registrations[i].ID]
+		if !hasProfile {
+			accessible = needsAccessibleRoom(registrations[i].MedicalCondition.String())
+		}
+		candidates = append(candidates, autoAssignCandidate{
+			RegistrationID:  &registrations[i].ID,
+			FullName:        registrations[i].FullName,
+			Vassa:           registrations[i].Vassa,
+			NeedsAccessible: accessible,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.IsTeacher != b.IsTeacher {
+			return a.IsTeacher
+		}
+		if a.NeedsAccessible != b.NeedsAccessible {
+			return a.NeedsAccessible
+		}
+		return a.Vassa > b.Vassa
+	})
+
+	return candidates, nil
+}
+
+// pickRoom - เลือกห้องที่เหมาะสมที่สุดสำหรับผู้พัก
+// ผู้ที่ต้องการห้องชั้นล่างจะได้เฉพาะห้องชั้นล่าง ส่วนคนอื่นจะถูกเลี่ยงไม่ให้ใช้ห้องชั้นล่าง/ห้องพระอาจารย์ถ้ามีห้องอื่น
+func pickRoom(rooms []*autoAssignRoom, candidate autoAssignCandidate) *autoAssignRoom {
+	var best *autoAssignRoom
+	bestScore := -1 << 31
+
+	for _, room := range rooms {
+		if room.Remaining <= 0 {
+			continue
+		}
+		if room.Room.TeacherOnly && !candidate.IsTeacher {
+			continue
+		}
+		if candidate.NeedsAccessible && !room.Room.GroundFloor {
+			continue
+		}
+
+		score := 0
+		if candidate.IsTeacher && room.Room.TeacherOnly {
+			score += 100
+		}
+		if candidate.NeedsAccessible {
+			if room.Room.NearBathroom {
+				score += 50
+			}
+		} else {
+			// เก็บห้องชั้นล่าง/ใกล้ห้องน้ำไว้ให้ผู้ที่จำเป็น
+			if room.Room.GroundFloor {
+				score -= 20
+			}
+			if room.Room.NearBathroom {
+				score -= 10
+			}
+		}
+		// เติมห้องที่มีคนอยู่แล้วให้เต็มก่อนเปิดห้องใหม่
+		score -= room.Remaining
+
+		if score > bestScore {
+			best = room
+			bestScore = score
+		}
+	}
+
+	return best
+}
+
+// RoomOccupancy - สรุปการเข้าพักรายห้อง
+type RoomOccupancy struct {
+	RoomID       uint   `json:"room_id"`
+	RoomName     string `json:"room_name"`
+	Capacity     int    `json:"capacity"`
+	Occupied     int    `json:"occupied"`
+	Available    int    `json:"available"`
+	GroundFloor  bool   `json:"ground_floor"`
+	NearBathroom bool   `json:"near_bathroom"`
+	TeacherOnly  bool   `json:"teacher_only"`
+}
+
+// BuildingOccupancy - สรุปการเข้าพักรายอาคาร
+type BuildingOccupancy struct {
+	BuildingID   uint            `json:"building_id"`
+	BuildingName string          `json:"building_name"`
+	Type         string          `json:"type"`
+	Capacity     int             `json:"capacity"`
+	Occupied     int             `json:"occupied"`
+	Available    int             `json:"available"`
+	Rooms        []RoomOccupancy `json:"rooms"`
+}
+
+// GetOccupancyReport - รายงานการเข้าพักรายอาคาร/รายห้อง
+func GetOccupancyReport(c *fiber.Ctx) error {
+	var buildings []models.Building
+	if err := database.DB.Preload("Rooms", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name")
+	}).Order("name").Find(&buildings).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	var occupancy []struct {
+		RoomID uint
+		Count  int
+	}
+	database.DB.Model(&models.RoomAssignment{}).Select("room_id, COUNT(*) as count").Group("room_id").Scan(&occupancy)
+	occupied := make(map[uint]int, len(occupancy))
+	for _, o := range occupancy {
+		occupied[o.RoomID] = o.Count
+	}
+
+	report := make([]BuildingOccupancy, 0, len(buildings))
+	var totalCapacity, totalOccupied int
+	for _, building := range buildings {
+		summary := BuildingOccupancy{
+			BuildingID:   building.ID,
+			BuildingName: building.Name,
+			Type:         building.Type,
+			Rooms:        make([]RoomOccupancy, 0, len(building.Rooms)),
+		}
+		for _, room := range building.Rooms {
+			summary.Rooms = append(summary.Rooms, RoomOccupancy{
+				RoomID:       room.ID,
+				RoomName:     room.Name,
+				Capacity:     room.Capacity,
+				Occupied:     occupied[room.ID],
+				Available:    room.Capacity - occupied[room.ID],
+				GroundFloor:  room.GroundFloor,
+				NearBathroom: room.NearBathroom,
+				TeacherOnly:  room.TeacherOnly,
+			})
+			summary.Capacity += room.Capacity
+			summary.Occupied += occupied[room.ID]
+		}
+		summary.Available = summary.Capacity - summary.Occupied
+		totalCapacity += summary.Capacity
+		totalOccupied += summary.Occupied
+		report = append(report, summary)
+	}
+
+	var registrationCount, teacherCount int64
+	database.DB.Model(&models.Registration{}).Count(&registrationCount)
+	database.DB.Model(&models.TeacherRegistration{}).Count(&teacherCount)
+
+	var assignedRegistrations, assignedTeachers int64
+	database.DB.Model(&models.RoomAssignment{}).Where("registration_id IS NOT NULL").Count(&assignedRegistrations)
+	database.DB.Model(&models.RoomAssignment{}).Where("teacher_registration_id IS NOT NULL").Count(&assignedTeachers)
+
+	return c.JSON(fiber.Map{
+		"summary": fiber.Map{
+			"capacity":                 totalCapacity,
+			"occupied":                 totalOccupied,
+			"available":                totalCapacity - totalOccupied,
+			"unassigned_registrations": registrationCount - assignedRegistrations,
+			"unassigned_teachers":      teacherCount - assignedTeachers,
+		},
+		"buildings": report,
+	})
+}
+
+// RosterEntry - รายชื่อผู้พักหนึ่งแถวสำหรับพิมพ์
+type RosterEntry struct {
+	BuildingName     string `json:"building_name"`
+	RoomName         string `json:"room_name"`
+	FullName         string `json:"full_name"`
+	Nickname         string `json:"nickname"`
+	Type             string `json:"type"` // "registration" or "teacher"
+	Vassa            int    `json:"vassa"`
+	TempleName       string `json:"temple_name"`
+	PhoneNumber      string `json:"phone_number"`
+	MedicalCondition string `json:"medical_condition,omitempty"` // เฉพาะผู้มี role "medical"
+}
+
+// GetAccommodationRoster - รายชื่อผู้พักเรียงตามอาคาร/ห้อง สำหรับพิมพ์
+// โรคประจำตัวแสดงเฉพาะผู้มี role "medical" และบันทึกการเข้าถึง
+func GetAccommodationRoster(c *fiber.Ctx) error {
+	includeMedical := middleware.HasRole(c, "medical")
+	var assignments []models.RoomAssignment
+
+	query := database.DB.Joins("JOIN rooms ON rooms.id = room_assignments.room_id").
+		Joins("JOIN buildings ON buildings.id = rooms.building_id").
+		Preload("Room.Building").Preload("Registration").Preload("TeacherRegistration").
+		Order("buildings.name, rooms.name")
+	if buildingID := c.Query("building_id"); buildingID != "" {
+		query = query.Where("rooms.building_id = ?", buildingID)
+	}
+
+	if err := query.Find(&assignments).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	roster := make([]RosterEntry, 0, len(assignments))
+	for _, assignment := range assignments {
+		entry := RosterEntry{
+			BuildingName: assignment.Room.Building.Name,
+			RoomName:     assignment.Room.Name,
+		}
+		switch {
+		case assignment.Registration != nil:
+			entry.Type = "registration"
+			entry.FullName = assignment.Registration.FullName
+			entry.Nickname = assignment.Registration.Nickname
+			entry.Vassa = assignment.Registration.Vassa
+			entry.TempleName = assignment.Registration.TempleName
+			entry.PhoneNumber = assignment.Registration.PhoneNumber.String()
+			if includeMedical {
+				entry.MedicalCondition = assignment.Registration.MedicalCondition.String()
+			}
+		case assignment.TeacherRegistration != nil:
+			entry.Type = "teacher"
+			entry.FullName = assignment.TeacherRegistration.FullName
+			entry.Nickname = assignment.TeacherRegistration.Nickname
+			entry.Vassa = assignment.TeacherRegistration.Vassa
+			entry.TempleName = assignment.TeacherRegistration.TempleName
+			entry.PhoneNumber = assignment.TeacherRegistration.PhoneNumber.String()
+			if includeMedical {
+				entry.MedicalCondition = assignment.TeacherRegistration.MedicalCondition.String()
+			}
+		default:
+			// ผู้ลงทะเบียนถูกลบไปแล้ว (soft delete)
+			continue
+		}
+		roster = append(roster, entry)
+	}
+
+	if includeMedical {
+		logMedicalAccess(c, "ดูรายชื่อผู้พักพร้อมโรคประจำตัว", fmt.Sprintf("ดูรายชื่อผู้พัก %d รายการพร้อมโรคประจำตัว", len(roster)))
+	}
+
+	// เรียงตามอาคาร/ห้อง ภายในห้องให้พระอาจารย์ก่อนแล้วตามพรรษา
+	sort.SliceStable(roster, func(i, j int) bool {
+		a, b := roster[i], roster[j]
+		if a.BuildingName != b.BuildingName {
+			return a.BuildingName < b.BuildingName
+		}
+		if a.RoomName != b.RoomName {
+			return a.RoomName < b.RoomName
+		}
+		if a.Type != b.Type {
+			return a.Type == "teacher"
+		}
+		return a.Vassa > b.Vassa
+	})
+
+	return c.JSON(roster)
+}
@@ -47,3 +47,13 @@ func GetSubDistricts(c *fiber.Ctx) error {
 
 	return c.JSON(subDistricts)
 }
+
+// validateAddress - ตรวจว่าจังหวัด/อำเภอ/ตำบลมีอยู่จริงและสัมพันธ์กัน
+func validateAddress(provinceID, districtID, subDistrictID uint) bool {
+	var count int64
+	database.DB.Model(&models.SubDistrict{}).
+		Joins("JOIN districts ON districts.id = sub_districts.district_id").
+		Where("sub_districts.id = ? AND districts.id = ? AND districts.province_id = ?", subDistrictID, districtID, provinceID).
+		Count(&count)
+	return count > 0
+}
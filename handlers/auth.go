@@ -42,6 +42,60 @@ type UserResponse struct {
 	Roles    []string `json:"roles"`
 }
 
+// validRoles - roles ที่กำหนดให้ผู้ใช้ได้
+// "medical" เข้าถึงข้อมูลสุขภาพได้ (ทีมปฐมพยาบาล/ครัว)
+// "superadmin" ลบข้อมูลถาวรได้ และกำหนด role medical/superadmin ให้ผู้อื่นได้
+var validRoles = []string{"registration", "finance", "medical", "superadmin"}
+
+const invalidRoleMessage = "Role ไม่ถูกต้อง (ต้องเป็น 'registration', 'finance', 'medical' หรือ 'superadmin')"
+
+// EnsureSuperadmin - เพิ่ม role superadmin ให้ผู้ใช้ที่ระบุใน SUPERADMIN_USERNAME (ใช้ตั้งค่าครั้งแรก)
+func EnsureSuperadmin() {
+	username := strings.TrimSpace(os.Getenv("SUPERADMIN_USERNAME"))
+	if username == "" {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		log.Printf("SUPERADMIN_USERNAME %q not found", username)
+		return
+	}
+	for _, role := range user.Roles {
+		if role == "superadmin" {
+			return
+		}
+	}
+
+	user.Roles = append(user.Roles, "superadmin")
+	if err := database.DB.Model(&user).Update("roles", user.Roles).Error; err != nil {
+		log.Printf("Error granting superadmin to %q: %v", username, err)
+		return
+	}
+	log.Printf("Granted superadmin role to %q", username)
+}
+
+// privilegedRoles - roles ที่สมัครเองไม่ได้ และกำหนด/ถอดได้เฉพาะ superadmin
+var privilegedRoles = []string{"medical", "superadmin"}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidRole(role string) bool {
+	for _, valid := range validRoles {
+		if role == valid {
+			return true
+		}
+	}
+	return false
+}
+
 // Login handles user login with HTTP-only cookies
 func Login(c *fiber.Ctx) error {
 	var req LoginRequest
@@ -173,9 +227,15 @@ func RegisterAdmin(c *fiber.Ctx) error {
 
 	// Validate roles if provided
 	for _, role := range req.Roles {
-		if role != "registration" && role != "finance" {
+		if !isValidRole(role) {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"error": "Role ไม่ถูกต้อง (ต้องเป็น 'registration' หรือ 'finance')",
+				"error": invalidRoleMessage,
+			})
+		}
+		// การสมัครไม่ต้อง login จึงขอ role medical หรือ superadmin ไม่ได้
+		if containsRole(privilegedRoles, role) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": fmt.Sprintf("ไม่สามารถสมัครด้วย role %s ได้", role),
 			})
 		}
 	}
@@ -301,9 +361,17 @@ func UpdateUser(c *fiber.Ctx) error {
 	if req.Roles != nil {
 		// Validate roles
 		for _, role := range *req.Roles {
-			if role != "registration" && role != "finance" {
+			if !isValidRole(role) {
 				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-					"error": "Role ไม่ถูกต้อง (ต้องเป็น 'registration' หรือ 'finance')",
+					"error": invalidRoleMessage,
+				})
+			}
+		}
+		// เพิ่มหรือถอด medical/superadmin ได้เฉพาะ superadmin
+		for _, role := range privilegedRoles {
+			if containsRole(*req.Roles, role) != containsRole(user.Roles, role) && !middleware.HasRole(c, "superadmin") {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"error": fmt.Sprintf("เฉพาะ superadmin เท่านั้นที่กำหนด role %s ได้", role),
 				})
 			}
 		}
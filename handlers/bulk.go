@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"registration-system/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBulkItems - จำนวนรายการสูงสุดต่อคำขอ
+const maxBulkItems = 1000
+
+// errBulkFailed - มีบางรายการไม่สำเร็จ ต้องยกเลิกทั้ง transaction
+var errBulkFailed = errors.New("bulk operation failed")
+
+// RegistrationFilter - เงื่อนไขเลือกผู้ลงทะเบียนสำหรับ bulk operation (ทุกเงื่อนไขเป็น AND)
+type RegistrationFilter struct {
+	ProvinceID     *uint   `json:"province_id"`
+	DistrictID     *uint   `json:"district_id"`
+	TempleName     *string `json:"temple_name"`
+	TempleID       *uint   `json:"temple_id"`
+	VassaMin       *int    `json:"vassa_min"`
+	VassaMax       *int    `json:"vassa_max"`
+	ChantedPariwat *bool   `json:"chanted_pariwat"`
+	ChantedManat   *bool   `json:"chanted_manat"`
+	ChantedOkApan  *bool   `json:"chanted_ok_apan"`
+	CreatedFrom    string  `json:"created_from"` // YYYY-MM-DD
+	CreatedTo      string  `json:"created_to"`   // YYYY-MM-DD
+}
+
+// BulkChantingUpdate - สถานะการสวดที่จะตั้ง (field ที่ไม่ส่งมาจะไม่ถูกแก้ไข)
+type BulkChantingUpdate struct {
+	ChantedPariwat *bool `json:"chanted_pariwat"`
+	ChantedManat   *bool `json:"chanted_manat"`
+	ChantedOkApan  *bool `json:"chanted_ok_apan"`
+}
+
+// BulkRegistrationRequest - คำขอ bulk operation ระบุ ids หรือ filter อย่างใดอย่างหนึ่ง
+type BulkRegistrationRequest struct {
+	Action   string              `json:"action"` // "chanting" or "delete"
+	IDs      []uint              `json:"ids"`
+	Filter   *RegistrationFilter `json:"filter"`
+	Chanting *BulkChantingUpdate `json:"chanting"`
+	DryRun   bool                `json:"dry_run"`
+}
+
+// BulkItemResult - ผลของแต่ละรายการ
+type BulkItemResult struct {
+	ID       uint   `json:"id"`
+	FullName string `json:"full_name,omitempty"`
+	Status   string `json:"status"` // "updated", "deleted", "unchanged", "not_found", "failed"
+	Message  string `json:"message,omitempty"`
+}
+
+// apply - เพิ่มเงื่อนไขของ filter ลงใน query (คืน false ถ้าไม่มีเงื่อนไขใดเลย)
+func (f *RegistrationFilter) apply(query *gorm.DB) (*gorm.DB, bool, error) {
+	hasCondition := false
+	where := func(condition string, value interface{}) {
+		query = query.Where(condition, value)
+		hasCondition = true
+	}
+
+	if f.ProvinceID != nil {
+		where("province_id = ?", *f.ProvinceID)
+	}
+	if f.DistrictID != nil {
+		where("district_id = ?", *f.DistrictID)
+	}
+	if f.TempleName != nil {
+		where("temple_name ILIKE ?", "%"+*f.TempleName+"%")
+	}
+	if f.TempleID != nil {
+		where("temple_id = ?", *f.TempleID)
+	}
+	if f.VassaMin != nil {
+		where("vassa >= ?", *f.VassaMin)
+	}
+	if f.VassaMax != nil {
+		where("vassa <= ?", *f.VassaMax)
+	}
+	if f.ChantedPariwat != nil {
+		where("chanted_pariwat = ?", *f.ChantedPariwat)
+	}
+	if f.ChantedManat != nil {
+		where("chanted_manat = ?", *f.ChantedManat)
+	}
+	if f.ChantedOkApan != nil {
+		where("chanted_ok_apan = ?", *f.ChantedOkApan)
+	}
+	if f.CreatedFrom != "" {
+		date, err := time.Parse("2006-01-02", f.CreatedFrom)
+		if err != nil {
+			return nil, false, fmt.Errorf("รูปแบบ created_from ไม่ถูกต้อง (ใช้ YYYY-MM-DD)")
+		}
+		where("created_at >= ?", date)
+	}
+	if f.CreatedTo != "" {
+		date, err := time.Parse("2006-01-02", f.CreatedTo)
+		if err != nil {
+			return nil, false, fmt.Errorf("รูปแบบ created_to ไม่ถูกต้อง (ใช้ YYYY-MM-DD)")
+		}
+		where("created_at < ?", date.AddDate(0, 0, 1))
+	}
+	return query, hasCondition, nil
+}
+
+// BulkUpdateRegistrations - อัพเดทสถานะการสวดหรือลบผู้ลงทะเบียนหลายรายการในครั้งเดียว
+func BulkUpdateRegistrations(c *fiber.Ctx) error {
+	var req BulkRegistrationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	switch req.Action {
+	case "chanting":
+		if req.Chanting == nil || (req.Chanting.ChantedPariwat == nil && req.Chanting.ChantedManat == nil && req.Chanting.ChantedOkApan == nil) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "กรุณาระบุสถานะการสวดที่ต้องการอัพเดท",
+			})
+		}
+	case "delete":
+	default:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "action ต้องเป็น 'chanting' หรือ 'delete'",
+		})
+	}
+
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณาระบุ ids หรือ filter อย่างใดอย่างหนึ่ง",
+		})
+	}
+	if len(req.IDs) > maxBulkItems {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("ระบุได้สูงสุด %d รายการ", maxBulkItems),
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	results := []BulkItemResult{}
+	var affected int
+
+	err := eventTransaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Order("id")
+		if len(req.IDs) > 0 {
+			query = query.Where("id IN ?", req.IDs)
+		} else {
+			var hasCondition bool
+			var err error
+			query, hasCondition, err = req.Filter.apply(query)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+			if !hasCondition {
+				return fiber.NewError(fiber.StatusBadRequest, "filter ต้องมีเงื่อนไขอย่างน้อยหนึ่งข้อ")
+			}
+		}
+
+		var registrations []models.Registration
+		if err := query.Limit(maxBulkItems + 1).Find(&registrations).Error; err != nil {
+			return err
+		}
+		if len(registrations) > maxBulkItems {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("filter ตรงกับข้อมูลเกิน %d รายการ กรุณาระบุเงื่อนไขให้แคบลง", maxBulkItems))
+		}
+
+		found := map[uint]bool{}
+		for i := range registrations {
+			registration := &registrations[i]
+			found[registration.ID] = true
+			result := BulkItemResult{ID: registration.ID, FullName: registration.FullName}
+
+			if req.Action == "delete" {
+				result.Status = "deleted"
+				if !req.DryRun {
+					if err := bulkDeleteRegistration(tx, registration, userID); err != nil {
+						result.Status = "failed"
+						result.Message = err.Error()
+					}
+				}
+			} else {
+				before := registrationFieldsOf(registration)
+				if req.Chanting.ChantedPariwat != nil {
+					registration.ChantedPariwat = *req.Chanting.ChantedPariwat
+				}
+				if req.Chanting.ChantedManat != nil {
+					registration.ChantedManat = *req.Chanting.ChantedManat
+				}
+				if req.Chanting.ChantedOkApan != nil {
+					registration.ChantedOkApan = *req.Chanting.ChantedOkApan
+				}
+				after := registrationFieldsOf(registration)
+
+				result.Status = "updated"
+				if len(diffFields(&before, &after)) == 0 {
+					result.Status = "unchanged"
+				} else if !req.DryRun {
+					if err := bulkUpdateChanting(tx, registration, &before, &after, userID); err != nil {
+						result.Status = "failed"
+						result.Message = err.Error()
+					}
+				}
+			}
+
+			if result.Status == "updated" || result.Status == "deleted" {
+				affected++
+			}
+			results = append(results, result)
+		}
+
+		for _, id := range req.IDs {
+			if !found[id] {
+				results = append(results, BulkItemResult{ID: id, Status: "not_found", Message: "ไม่พบข้อมูลการลงทะเบียน"})
+			}
+		}
+
+		for _, result := range results {
+			if result.Status == "failed" {
+				return errBulkFailed
+			}
+		}
+		if req.DryRun || affected == 0 {
+			return nil
+		}
+
+		// บันทึก Activity Log สรุปครั้งเดียว
+		action := "อัพเดทสถานะการสวดแบบกลุ่ม"
+		if req.Action == "delete" {
+			action = "ลบข้อมูลการลงทะเบียนแบบกลุ่ม"
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      action,
+			Description: fmt.Sprintf("%s จำนวน %d รายการ", action, affected),
+			Module:      "registration",
+			UserID:      userID,
+		}).Error
+	})
+
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	if errors.Is(err, errBulkFailed) {
+		return c.Status(422).JSON(fiber.Map{
+			"error":   "มีบางรายการไม่สำเร็จ ยกเลิกการเปลี่ยนแปลงทั้งหมด",
+			"results": results,
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดำเนินการได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"dry_run":  req.DryRun,
+		"affected": affected,
+		"results":  results,
+	})
+}
+
+func bulkUpdateChanting(tx *gorm.DB, registration *models.Registration, before, after *registrationFields, userID uint) error {
+	// savepoint - ให้รายการที่ผิดพลาดไม่ทำให้ transaction ใช้ต่อไม่ได้ระหว่างสร้างรายงาน
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(registration).UpdateColumns(map[string]interface{}{
+			"chanted_pariwat": registration.ChantedPariwat,
+			"chanted_manat":   registration.ChantedManat,
+			"chanted_ok_apan": registration.ChantedOkApan,
+			"version":         gorm.Expr("version + 1"),
+			"updated_at":      time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		if err := recordVersion(tx, "registration", registration.ID, "update", before, after, &userID); err != nil {
+			return err
+		}
+		return enqueueChantingCompleted(tx, registration, before)
+	})
+}
+
+func bulkDeleteRegistration(tx *gorm.DB, registration *models.Registration, userID uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		before := registrationFieldsOf(registration)
+		if err := softDelete(tx, registration, userID); err != nil {
+			return err
+		}
+		// คืนที่พักที่จัดไว้
+		if err := tx.Where("registration_id = ?", registration.ID).Delete(&models.RoomAssignment{}).Error; err != nil {
+			return err
+		}
+		return recordVersion(tx, "registration", registration.ID, "delete", &before, nil, &userID)
+	})
+}
@@ -1,16 +1,19 @@
 package handlers
 
 import (
+	"errors"
 	"registration-system/database"
 	"registration-system/models"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type UpdateChantingStatusRequest struct {
-	ChantedPariwat bool `json:"chanted_pariwat"`
-	ChantedManat   bool `json:"chanted_manat"`
-	ChantedOkApan  bool `json:"chanted_ok_apan"`
+	ChantedPariwat bool  `json:"chanted_pariwat"`
+	ChantedManat   bool  `json:"chanted_manat"`
+	ChantedOkApan  bool  `json:"chanted_ok_apan"`
+	Version        *uint `json:"version,omitempty"` // version ที่แก้ไขอยู่ (ใช้แทน If-Match ได้)
 }
 
 // UpdateChantingStatus updates the chanting status for a registration
@@ -32,17 +35,45 @@ func UpdateChantingStatus(c *fiber.Ctx) error {
 		})
 	}
 
+	expected, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != registration.Version {
+		return versionConflict(c, registration.Version, &registration)
+	}
+
+	before := registrationFieldsOf(&registration)
+
 	// Update chanting status
 	registration.ChantedPariwat = req.ChantedPariwat
 	registration.ChantedManat = req.ChantedManat
 	registration.ChantedOkApan = req.ChantedOkApan
 
-	if err := database.DB.Save(&registration).Error; err != nil {
+	registration.Version = expected + 1
+	err := eventTransaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &registration, expected); err != nil {
+			return err
+		}
+		after := registrationFieldsOf(&registration)
+		if err := recordVersion(tx, "registration", registration.ID, "update", &before, &after, currentUserID(c)); err != nil {
+			return err
+		}
+		return enqueueChantingCompleted(tx, &registration, &before)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.Registration
+		database.DB.First(&current, registration.ID)
+		return versionConflict(c, current.Version, &current)
+	}
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถอัพเดทสถานะได้",
 		})
 	}
 
+	redactMedicalCondition(c, &registration)
+	setETag(c, registration.Version)
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "อัพเดทสถานะสำเร็จ",
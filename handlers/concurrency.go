@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errVersionConflict - ข้อมูลถูกแก้ไขโดยผู้อื่นหลังจากที่ client โหลดไป
+var errVersionConflict = errors.New("version conflict")
+
+// setETag - ส่ง version ของข้อมูลเป็น ETag
+func setETag(c *fiber.Ctx, version uint) {
+	c.Set(fiber.HeaderETag, strconv.Quote(strconv.FormatUint(uint64(version), 10)))
+}
+
+// expectedVersion - อ่าน version ที่ client แก้ไขอยู่ จาก If-Match หรือ field "version" ใน body
+func expectedVersion(c *fiber.Ctx, bodyVersion *uint) (uint, bool) {
+	if ifMatch := strings.TrimSpace(c.Get(fiber.HeaderIfMatch)); ifMatch != "" {
+		value := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+		version, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		return uint(version), true
+	}
+	if bodyVersion != nil {
+		return *bodyVersion, true
+	}
+	return 0, false
+}
+
+// versionRequired - ตอบกลับเมื่อ client ไม่ได้ส่ง version มา
+func versionRequired(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+		"error": "กรุณาส่ง version ของข้อมูล (If-Match หรือ field version)",
+	})
+}
+
+// versionConflict - ตอบ 409 พร้อมข้อมูลล่าสุดให้ client นำไปแก้ไขต่อ
+// (current ที่เป็นข้อมูลการลงทะเบียนต้องส่งเป็น pointer เพื่อให้ล้าง medical_condition ได้)
+func versionConflict(c *fiber.Ctx, version uint, current interface{}) error {
+	redactMedicalCondition(c, current)
+	setETag(c, version)
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error":   "ข้อมูลถูกแก้ไขโดยผู้อื่นแล้ว กรุณาตรวจสอบข้อมูลล่าสุดก่อนบันทึกอีกครั้ง",
+		"current": current,
+	})
+}
+
+// updateVersioned - บันทึกทุก field เฉพาะเมื่อ version ในฐานข้อมูลยังเป็น expected
+// (record ต้องตั้ง Version เป็น expected+1 ไว้แล้ว)
+func updateVersioned(tx *gorm.DB, record interface{}, expected uint) error {
+	result := tx.Model(record).Select("*").Omit(clause.Associations, "created_at", "deleted_at", "deleted_by_id").
+		Where("version = ?", expected).Updates(record)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"registration-system/database"
+	"registration-system/events"
+	"registration-system/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	eventHeartbeatInterval = 25 * time.Second
+	// eventStreamMaxAge - ปิด stream เป็นระยะให้ client ต่อใหม่ (ตรวจ session และสิทธิ์ใหม่ทุกครั้งที่ต่อ)
+	eventStreamMaxAge = 30 * time.Minute
+)
+
+// roles ที่รับ event แต่ละกลุ่มได้
+var (
+	registrationEventRoles = []string{"registration", "superadmin"}
+	financeEventRoles      = []string{"finance", "superadmin"}
+)
+
+// pendingEvents - event ที่เกิดใน transaction รอส่งเข้า event bus หลัง commit
+type pendingEvents struct {
+	events   []pendingEvent
+	webhooks bool // มีรายการส่ง webhook ใหม่ ปลุก worker หลัง commit
+}
+
+type pendingEvent struct {
+	eventType string
+	roles     []string
+	data      interface{}
+}
+
+type pendingEventsKey struct{}
+
+// eventTransaction - เหมือน database.DB.Transaction แต่ส่ง event ที่ stageEvent ไว้เข้า event bus เมื่อ commit สำเร็จ
+func eventTransaction(fn func(tx *gorm.DB) error) error {
+	pending := &pendingEvents{}
+	ctx := context.WithValue(context.Background(), pendingEventsKey{}, pending)
+	if err := database.DB.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	for _, event := range pending.events {
+		events.Publish(event.eventType, event.roles, event.data)
+	}
+	if pending.webhooks {
+		wakeWebhookWorker()
+	}
+	return nil
+}
+
+// stageEvent - สร้างรายการส่ง webhook ใน tx และเก็บ event ไว้ส่งเข้า event bus หลัง commit
+// (tx ต้องมาจาก eventTransaction ไม่เช่นนั้น event bus จะไม่ได้รับ แต่ webhook ยังถูกส่งในรอบถัดไปของ worker)
+func stageEvent(tx *gorm.DB, eventType string, roles []string, data interface{}) error {
+	staged, err := stageWebhookDeliveries(tx, eventType, data)
+	if err != nil {
+		return err
+	}
+	if pending, ok := tx.Statement.Context.Value(pendingEventsKey{}).(*pendingEvents); ok {
+		pending.events = append(pending.events, pendingEvent{eventType: eventType, roles: roles, data: data})
+		pending.webhooks = pending.webhooks || staged
+	}
+	return nil
+}
+
+// RegistrationEvent - ข้อมูลของ event registration.* (ส่งเฉพาะชื่อ field ที่เปลี่ยน ไม่ส่งค่า)
+type RegistrationEvent struct {
+	RecordType    string   `json:"record_type"` // "registration" or "teacher-registration"
+	ID            uint     `json:"id"`
+	Action        string   `json:"action"` // "create", "update", "delete", "restore", "revert"
+	FullName      string   `json:"full_name"`
+	ChangedFields []string `json:"changed_fields,omitempty"`
+	UserID        *uint    `json:"user_id,omitempty"`
+}
+
+// ChantingEvent - ข้อมูลของ event chanting.stage_changed
+type ChantingEvent struct {
+	ID        uint            `json:"id"`
+	FullName  string          `json:"full_name"`
+	Stages    map[string]bool `json:"stages"`
+	Completed []string        `json:"completed"` // ขั้นที่เพิ่งสวดเสร็จ
+	Reverted  []string        `json:"reverted"`  // ขั้นที่ถูกแก้กลับเป็นยังไม่สวด
+	UserID    *uint           `json:"user_id,omitempty"`
+}
+
+// stageRegistrationEvents - event ของการเปลี่ยนแปลงข้อมูลการลงทะเบียน (เรียกจาก recordVersion)
+func stageRegistrationEvents(tx *gorm.DB, recordType string, recordID uint, action string, before, after *registrationFields, changes []FieldChange, userID *uint) error {
+	eventType := "registration.updated"
+	switch action {
+	case "create":
+		eventType = "registration.created"
+	case "delete":
+		eventType = "registration.deleted"
+	}
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+	data := RegistrationEvent{RecordType: recordType, ID: recordID, Action: action, FullName: snapshot.FullName, UserID: userID}
+	if action != "create" && action != "delete" {
+		for _, change := range changes {
+			data.ChangedFields = append(data.ChangedFields, change.Field)
+		}
+	}
+	if err := stageEvent(tx, eventType, registrationEventRoles, data); err != nil {
+		return err
+	}
+
+	if before == nil || after == nil || after.ChantedPariwat == nil {
+		return nil
+	}
+	chanting := ChantingEvent{ID: recordID, FullName: after.FullName, Stages: map[string]bool{}, Completed: []string{}, Reverted: []string{}, UserID: userID}
+	for _, stage := range []struct {
+		key           string
+		before, after *bool
+	}{
+		{"pariwat", before.ChantedPariwat, after.ChantedPariwat},
+		{"manat", before.ChantedManat, after.ChantedManat},
+		{"ok_apan", before.ChantedOkApan, after.ChantedOkApan},
+	} {
+		was := stage.before != nil && *stage.before
+		now := stage.after != nil && *stage.after
+		chanting.Stages[stage.key] = now
+		if now && !was {
+			chanting.Completed = append(chanting.Completed, stage.key)
+		} else if was && !now {
+			chanting.Reverted = append(chanting.Reverted, stage.key)
+		}
+	}
+	if len(chanting.Completed) > 0 || len(chanting.Reverted) > 0 {
+		return stageEvent(tx, "chanting.stage_changed", registrationEventRoles, chanting)
+	}
+	return nil
+}
+
+// stageTransactionCreated - event เมื่อเพิ่มรายการรายรับรายจ่าย
+func stageTransactionCreated(tx *gorm.DB, transaction *models.Transaction) error {
+	return stageEvent(tx, "transaction.created", financeEventRoles, fiber.Map{
+		"id":          transaction.ID,
+		"type":        transaction.Type,
+		"amount":      transaction.Amount,
+		"category":    transaction.Category,
+		"description": transaction.Description,
+		"date":        transaction.Date.Format("2006-01-02"),
+		"user_id":     transaction.UserID,
+	})
+}
+
+// writeEvent - เขียน event หนึ่งรายการในรูปแบบ text/event-stream
+func writeEvent(w *bufio.Writer, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+		return err
+	}
+	return nil
+}
+
+// StreamEvents - ส่ง event ของระบบแบบ Server-Sent Events ตามสิทธิ์ของผู้ใช้
+// ต่อใหม่ด้วย header Last-Event-ID (หรือ ?last_event_id=) เพื่อรับ event ที่พลาดไปจาก buffer
+// ถ้า event ที่พลาดไม่อยู่ใน buffer แล้วจะได้ event "reset" ให้โหลดข้อมูลใหม่ทั้งหมด
+func StreamEvents(c *fiber.Ctx) error {
+	roles, _ := c.Locals("roles").([]string)
+	allow := func(event events.Event) bool {
+		for _, role := range event.Roles {
+			for _, userRole := range roles {
+				if role == userRole {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	lastEventID := c.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	sub, replay, complete := events.Subscribe(lastEventID, allow)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no") // ไม่ให้ nginx buffer
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if !complete {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+		for _, event := range replay {
+			if writeEvent(w, event) != nil {
+				return
+			}
+		}
+		if w.Flush() != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(eventHeartbeatInterval)
+		defer heartbeat.Stop()
+		maxAge := time.NewTimer(eventStreamMaxAge)
+		defer maxAge.Stop()
+		for {
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					// ตามไม่ทัน ให้ client ต่อใหม่แล้วรับจาก buffer
+					return
+				}
+				if writeEvent(w, event) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			case <-maxAge.C:
+				return
+			}
+			if w.Flush() != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
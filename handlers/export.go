@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"registration-system/database"
+	"registration-system/middleware"
+	"registration-system/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// exportBatchSize - จำนวนแถวที่อ่านจากฐานข้อมูลต่อครั้งระหว่างส่งออก
+const exportBatchSize = 500
+
+// exportRow - ข้อมูลหนึ่งแถวของไฟล์ส่งออก (ใช้ทั้งผู้ลงทะเบียนและพระอาจารย์)
+type exportRow struct {
+	ID               uint
+	FullName         string
+	Nickname         string
+	BirthDate        time.Time
+	Province         string
+	District         string
+	SubDistrict      string
+	AddressDetail    string
+	PhoneNumber      string
+	TempleName       string
+	MedicalCondition string
+	Vassa            int
+	ChantingStage    string
+	CreatedAt        time.Time
+}
+
+// exportColumn - คอลัมน์ที่เลือกส่งออกได้
+type exportColumn struct {
+	Key         string
+	Header      string
+	StudentOnly bool // เฉพาะผู้ลงทะเบียน (ไม่มีในข้อมูลพระอาจารย์)
+	Medical     bool // ข้อมูลสุขภาพ ส่งออกได้เฉพาะ role "medical" และบันทึกการเข้าถึง
+	Default     bool // ส่งออกเมื่อไม่ได้เลือกคอลัมน์
+	Value       func(row *exportRow) interface{}
+}
+
+var exportColumns = []exportColumn{
+	{Key: "id", Header: "รหัส", Default: true, Value: func(r *exportRow) interface{} { return r.ID }},
+	{Key: "full_name", Header: "ชื่อ-นามสกุล", Default: true, Value: func(r *exportRow) interface{} { return r.FullName }},
+	{Key: "nickname", Header: "ฉายา/ชื่อเล่น", Default: true, Value: func(r *exportRow) interface{} { return r.Nickname }},
+	{Key: "birth_date", Header: "วันเกิด", Value: func(r *exportRow) interface{} { return r.BirthDate.Format("2006-01-02") }},
+	{Key: "age", Header: "อายุ", Default: true, Value: func(r *exportRow) interface{} { return ageOn(r.BirthDate, time.Now()) }},
+	{Key: "vassa", Header: "พรรษา", Default: true, Value: func(r *exportRow) interface{} { return r.Vassa }},
+	{Key: "temple_name", Header: "วัด", Default: true, Value: func(r *exportRow) interface{} { return r.TempleName }},
+	{Key: "address_detail", Header: "ที่อยู่", Value: func(r *exportRow) interface{} { return r.AddressDetail }},
+	{Key: "sub_district", Header: "ตำบล", Default: true, Value: func(r *exportRow) interface{} { return r.SubDistrict }},
+	{Key: "district", Header: "อำเภอ", Default: true, Value: func(r *exportRow) interface{} { return r.District }},
+	{Key: "province", Header: "จังหวัด", Default: true, Value: func(r *exportRow) interface{} { return r.Province }},
+	{Key: "phone_number", Header: "เบอร์โทร", Default: true, Value: func(r *exportRow) interface{} { return r.PhoneNumber }},
+	{Key: "medical_condition", Header: "โรคประจำตัว", Medical: true, Value: func(r *exportRow) interface{} { return r.MedicalCondition }},
+	{Key: "chanting_stage", Header: "สถานะการสวด", StudentOnly: true, Default: true, Value: func(r *exportRow) interface{} { return r.ChantingStage }},
+	{Key: "created_at", Header: "วันที่ลงทะเบียน", Value: func(r *exportRow) interface{} { return r.CreatedAt.Format("2006-01-02 15:04") }},
+}
+
+// ageOn - อายุเต็มปี ณ วันที่กำหนด
+func ageOn(birthDate, now time.Time) int {
+	if birthDate.IsZero() {
+		return 0
+	}
+	age := now.Year() - birthDate.Year()
+	if now.Month() < birthDate.Month() || (now.Month() == birthDate.Month() && now.Day() < birthDate.Day()) {
+		age--
+	}
+	return age
+}
+
+// chantingStage - ขั้นการสวดล่าสุดที่ผ่านแล้ว
+func chantingStage(r *models.Registration) string {
+	switch {
+	case r.ChantedOkApan:
+		return "สวดออกอาพานแล้ว"
+	case r.ChantedManat:
+		return "สวดมานัดแล้ว"
+	case r.ChantedPariwat:
+		return "สวดปริวาสแล้ว"
+	default:
+		return "ยังไม่ได้สวด"
+	}
+}
+
+// selectExportColumns - เลือกคอลัมน์จาก ?columns=a,b,c (ไม่ระบุ = คอลัมน์เริ่มต้น)
+func selectExportColumns(param string, teacher bool) ([]exportColumn, error) {
+	available := map[string]exportColumn{}
+	var defaults []exportColumn
+	for _, column := range exportColumns {
+		if teacher && column.StudentOnly {
+			continue
+		}
+		available[column.Key] = column
+		if column.Default {
+			defaults = append(defaults, column)
+		}
+	}
+
+	if strings.TrimSpace(param) == "" {
+		return defaults, nil
+	}
+
+	var columns []exportColumn
+	for _, key := range strings.Split(param, ",") {
+		column, ok := available[strings.TrimSpace(key)]
+		if !ok {
+			return nil, fmt.Errorf("ไม่รู้จักคอลัมน์ '%s'", strings.TrimSpace(key))
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// exportCell - ข้อความที่ขึ้นต้นด้วย = + - @ tab หรือ CR ถูก Excel/LibreOffice ตีความเป็นสูตร (formula injection)
+// จึงเติม ' นำหน้า ข้อความยังคงเป็น string (ใน XLSX เขียนเป็น inline string ไม่ใช่สูตร) ส่วนตัวเลขส่งตามเดิม
+func exportCell(value interface{}) interface{} {
+	text, ok := value.(string)
+	if !ok || text == "" {
+		return value
+	}
+	switch text[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + text
+	}
+	return text
+}
+
+// streamExport - เขียนไฟล์ CSV/XLSX ทีละ batch โดยไม่โหลดข้อมูลทั้งหมดเข้าหน่วยความจำ
+func streamExport(c *fiber.Ctx, format, filename string, columns []exportColumn, iterate func(emit func(*exportRow) error) error) {
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.Header
+	}
+
+	switch format {
+	case "csv":
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			// BOM ให้ Excel อ่านภาษาไทยได้ถูกต้อง
+			w.WriteString("\ufeff")
+			writer := csv.NewWriter(w)
+			writer.Write(headers)
+
+			count := 0
+			err := iterate(func(row *exportRow) error {
+				record := make([]string, len(columns))
+				for i, column := range columns {
+					record[i] = fmt.Sprint(exportCell(column.Value(row)))
+				}
+				if err := writer.Write(record); err != nil {
+					return err
+				}
+				count++
+				if count%exportBatchSize == 0 {
+					writer.Flush()
+					return w.Flush()
+				}
+				return nil
+			})
+			writer.Flush()
+			w.Flush()
+			if err != nil {
+				log.Printf("Error streaming CSV export %s: %v", filename, err)
+			}
+		})
+
+	case "xlsx":
+		c.Set(fiber.HeaderContentType, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s.xlsx"`, filename))
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			file := excelize.NewFile()
+			defer file.Close()
+
+			// StreamWriter เก็บแถวที่เกินหน่วยความจำไว้ในไฟล์ชั่วคราว
+			sheet, err := file.NewStreamWriter("Sheet1")
+			if err != nil {
+				log.Printf("Error creating XLSX export %s: %v", filename, err)
+				return
+			}
+			headerRow := make([]interface{}, len(headers))
+			for i, header := range headers {
+				headerRow[i] = header
+			}
+			sheet.SetRow("A1", headerRow)
+
+			rowNumber := 1
+			err = iterate(func(row *exportRow) error {
+				rowNumber++
+				values := make([]interface{}, len(columns))
+				for i, column := range columns {
+					values[i] = exportCell(column.Value(row))
+				}
+				cell, _ := excelize.CoordinatesToCellName(1, rowNumber)
+				return sheet.SetRow(cell, values)
+			})
+			if err == nil {
+				err = sheet.Flush()
+			}
+			if err == nil {
+				err = file.Write(w)
+			}
+			w.Flush()
+			if err != nil {
+				log.Printf("Error streaming XLSX export %s: %v", filename, err)
+			}
+		})
+	}
+}
+
+// parseExportRequest - อ่าน format และคอลัมน์จาก query string
+// คอลัมน์ข้อมูลสุขภาพต้องมี role "medical" (ไม่เช่นนั้นคืน 403)
+func parseExportRequest(c *fiber.Ctx, teacher bool) (string, []exportColumn, *fiber.Error) {
+	format := c.Query("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		return "", nil, fiber.NewError(fiber.StatusBadRequest, "format ต้องเป็น 'csv' หรือ 'xlsx'")
+	}
+	columns, err := selectExportColumns(c.Query("columns"), teacher)
+	if err != nil {
+		return "", nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	for _, column := range columns {
+		if column.Medical && !middleware.HasRole(c, "medical") {
+			return "", nil, fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("คอลัมน์ '%s' ส่งออกได้เฉพาะผู้มีสิทธิ์ medical", column.Key))
+		}
+	}
+	return format, columns, nil
+}
+
+func logExport(c *fiber.Ctx, module, format string, columns []exportColumn) {
+	keys := make([]string, len(columns))
+	for i, column := range columns {
+		keys[i] = column.Key
+	}
+	activityLog := models.ActivityLog{
+		Action:      "ส่งออกข้อมูล (" + strings.ToUpper(format) + ")",
+		Description: "คอลัมน์: " + strings.Join(keys, ", "),
+		Module:      module,
+		UserID:      c.Locals("userID").(uint),
+	}
+	database.DB.Create(&activityLog)
+
+	for _, column := range columns {
+		if column.Medical {
+			logMedicalAccess(c, "ส่งออกข้อมูลสุขภาพ", fmt.Sprintf("ส่งออก %s (%s) พร้อมคอลัมน์ %s", module, strings.ToUpper(format), column.Key))
+		}
+	}
+}
+
+// ExportRegistrations - ส่งออกรายชื่อผู้ลงทะเบียนเป็น CSV/XLSX (?format=csv|xlsx&columns=...)
+func ExportRegistrations(c *fiber.Ctx) error {
+	format, columns, err := parseExportRequest(c, false)
+	if err != nil {
+		return c.Status(err.Code).JSON(fiber.Map{
+			"error": err.Message,
+		})
+	}
+
+	query := filterRegistrationList(c, database.DB.Model(&models.Registration{})).
+		Preload("Province").Preload("District").Preload("SubDistrict")
+
+	filename := "registrations-" + time.Now().Format("20060102")
+	streamExport(c, format, filename, columns, func(emit func(*exportRow) error) error {
+		var batch []models.Registration
+		return query.FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				r := &batch[i]
+				row := &exportRow{
+					ID: r.ID, FullName: r.FullName, Nickname: r.Nickname, BirthDate: r.BirthDate.Time,
+					Province: r.Province.NameTh, District: r.District.NameTh, SubDistrict: r.SubDistrict.NameTh,
+					AddressDetail: r.AddressDetail.String(), PhoneNumber: r.PhoneNumber.String(), TempleName: r.TempleName,
+					MedicalCondition: r.MedicalCondition.String(), Vassa: r.Vassa, ChantingStage: chantingStage(r), CreatedAt: r.CreatedAt,
+				}
+				if err := emit(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	})
+
+	logExport(c, "registration", format, columns)
+	return nil
+}
+
+// ExportTeacherRegistrations - ส่งออกรายชื่อพระอาจารย์เป็น CSV/XLSX (?format=csv|xlsx&columns=...)
+func ExportTeacherRegistrations(c *fiber.Ctx) error {
+	format, columns, err := parseExportRequest(c, true)
+	if err != nil {
+		return c.Status(err.Code).JSON(fiber.Map{
+			"error": err.Message,
+		})
+	}
+
+	query := filterRegistrationList(c, database.DB.Model(&models.TeacherRegistration{})).
+		Preload("Province").Preload("District").Preload("SubDistrict")
+
+	filename := "teacher-registrations-" + time.Now().Format("20060102")
+	streamExport(c, format, filename, columns, func(emit func(*exportRow) error) error {
+		var batch []models.TeacherRegistration
+		return query.FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				r := &batch[i]
+				row := &exportRow{
+					ID: r.ID, FullName: r.FullName, Nickname: r.Nickname, BirthDate: r.BirthDate.Time,
+					Province: r.Province.NameTh, District: r.District.NameTh, SubDistrict: r.SubDistrict.NameTh,
+					AddressDetail: r.AddressDetail.String(), PhoneNumber: r.PhoneNumber.String(), TempleName: r.TempleName,
+					MedicalCondition: r.MedicalCondition.String(), Vassa: r.Vassa, CreatedAt: r.CreatedAt,
+				}
+				if err := emit(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	})
+
+	logExport(c, "teacher-registration", format, columns)
+	return nil
+}
@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"registration-system/database"
 	"registration-system/models"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // FinanceTransactionRequest - Request body for finance transactions
@@ -17,6 +19,7 @@ type FinanceTransactionRequest struct {
 	Date        string   `json:"date"`       // Format: "2006-01-02"
 	Category    string   `json:"category"`    // หมวดหมู่ เช่น "บุญบารมี", "ค่าใช้จ่ายทั่วไป"
 	ImageURLs   []string `json:"image_urls,omitempty"`   // URLs ของภาพจาก Cloudinary (สูงสุด 5 ภาพ)
+	Version     *uint    `json:"version,omitempty"`      // version ที่แก้ไขอยู่ (ใช้แทน If-Match ได้)
 }
 
 // GetFinanceTransactions - ดึงรายการรายรับรายจ่ายทั้งหมด (Finance System)
@@ -75,6 +78,7 @@ func GetFinanceTransaction(c *fiber.Ctx) error {
 		})
 	}
 
+	setETag(c, transaction.Version)
 	return c.JSON(transaction)
 }
 
@@ -133,8 +137,13 @@ func CreateFinanceTransaction(c *fiber.Ctx) error {
 		UserID:      userID,
 	}
 
-	result := database.DB.Create(&transaction)
-	if result.Error != nil {
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&transaction).Error; err != nil {
+			return err
+		}
+		return stageTransactionCreated(tx, &transaction)
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถบันทึกข้อมูลได้",
 		})
@@ -173,6 +182,14 @@ func UpdateFinanceTransaction(c *fiber.Ctx) error {
 		})
 	}
 
+	expected, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != transaction.Version {
+		return versionConflict(c, transaction.Version, transaction)
+	}
+
 	if req.Type != "" && req.Type != "income" && req.Type != "expense" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "ประเภทต้องเป็น 'income' หรือ 'expense'",
@@ -211,7 +228,13 @@ func UpdateFinanceTransaction(c *fiber.Ctx) error {
 		transaction.ImageURLs = models.StringArray(req.ImageURLs)
 	}
 
-	if err := database.DB.Save(&transaction).Error; err != nil {
+	transaction.Version = expected + 1
+	if err := updateVersioned(database.DB, &transaction, expected); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			var current models.Transaction
+			database.DB.Preload("User").First(&current, transaction.ID)
+			return versionConflict(c, current.Version, current)
+		}
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถอัพเดทข้อมูลได้",
 		})
@@ -228,6 +251,7 @@ func UpdateFinanceTransaction(c *fiber.Ctx) error {
 	database.DB.Create(&activityLog)
 
 	database.DB.Preload("User").First(&transaction, transaction.ID)
+	setETag(c, transaction.Version)
 	return c.JSON(transaction)
 }
 
@@ -242,18 +266,21 @@ func DeleteFinanceTransaction(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := database.DB.Delete(&transaction).Error; err != nil {
+	userID := c.Locals("userID").(uint)
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return softDelete(tx, &transaction, userID)
+	}); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถลบข้อมูลได้",
 		})
 	}
 
 	// บันทึก Activity Log
-	userID := c.Locals("userID").(uint)
 	activityLog := models.ActivityLog{
 		Action:      "ลบรายการ " + transaction.Type + " (Finance)",
 		Description: transaction.Description + " - จำนวน " + formatFinanceMoney(transaction.Amount),
 		Module:      "finance",
+		RecordID:    &transaction.ID,
 		UserID:      userID,
 	}
 	database.DB.Create(&activityLog)
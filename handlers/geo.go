@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"registration-system/database"
+	"registration-system/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxBoundaryFileSize - ขนาดไฟล์ GeoJSON สูงสุด (ขอบเขตอำเภอทั้งประเทศแบบละเอียดใหญ่ราว 50MB)
+const maxBoundaryFileSize = 64 << 20
+
+// boundaryNameProperties - ชื่อ property ที่พบบ่อยในไฟล์ขอบเขตของไทย (ใช้เมื่อไม่ระบุ name_property)
+var boundaryNameProperties = map[string][]string{
+	"province": {"name_th", "pro_th", "ADM1_TH", "PROV_NAMT", "NAME_TH", "province_th", "name_en", "pro_en", "ADM1_EN", "PROV_NAMEE"},
+	"district": {"name_th", "amp_th", "ADM2_TH", "AMP_NAMT", "NAME_TH", "district_th", "name_en", "amp_en", "ADM2_EN", "AMP_NAMEE"},
+}
+
+// boundaryProvinceProperties - property ชื่อจังหวัดของ feature อำเภอ (ชื่ออำเภอซ้ำกันได้ในหลายจังหวัด)
+var boundaryProvinceProperties = []string{"pro_th", "ADM1_TH", "PROV_NAMT", "province_th", "province", "pro_en", "ADM1_EN", "PROV_NAMEE"}
+
+// GeoFeatureCollection - GeoJSON FeatureCollection
+type GeoFeatureCollection struct {
+	Type     string       `json:"type"`
+	Features []GeoFeature `json:"features"`
+}
+
+// GeoFeature - GeoJSON Feature (geometry เป็น null ได้เมื่อยังไม่มีข้อมูลขอบเขต)
+type GeoFeature struct {
+	Type       string                 `json:"type"`
+	ID         uint                   `json:"id,omitempty"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// geoGeometry - ใช้อ่านพิกัดเพื่อหาจุดกึ่งกลาง
+type geoGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// ringCentroid - จุดกึ่งกลางและพื้นที่ (มีเครื่องหมาย) ของวงรอบรูปหลายเหลี่ยม
+func ringCentroid(ring [][]float64) (float64, float64, float64) {
+	var area, cx, cy float64
+	for i := 0; i+1 < len(ring); i++ {
+		if len(ring[i]) < 2 || len(ring[i+1]) < 2 {
+			continue
+		}
+		x0, y0, x1, y1 := ring[i][0], ring[i][1], ring[i+1][0], ring[i+1][1]
+		cross := x0*y1 - x1*y0
+		area += cross
+		cx += (x0 + x1) * cross
+		cy += (y0 + y1) * cross
+	}
+	area /= 2
+	if area == 0 {
+		return 0, 0, 0
+	}
+	return cx / (6 * area), cy / (6 * area), area
+}
+
+// geometryCentroid - จุดกึ่งกลางของ Point/Polygon/MultiPolygon (ถ่วงน้ำหนักด้วยพื้นที่ของแต่ละส่วน)
+func geometryCentroid(raw []byte) (lat, lng float64, ok bool) {
+	var geometry geoGeometry
+	if err := json.Unmarshal(raw, &geometry); err != nil {
+		return 0, 0, false
+	}
+
+	var polygons [][][][]float64
+	switch geometry.Type {
+	case "Point":
+		var point []float64
+		if err := json.Unmarshal(geometry.Coordinates, &point); err != nil || len(point) < 2 {
+			return 0, 0, false
+		}
+		return point[1], point[0], true
+	case "Polygon":
+		var polygon [][][]float64
+		if err := json.Unmarshal(geometry.Coordinates, &polygon); err != nil {
+			return 0, 0, false
+		}
+		polygons = [][][][]float64{polygon}
+	case "MultiPolygon":
+		if err := json.Unmarshal(geometry.Coordinates, &polygons); err != nil {
+			return 0, 0, false
+		}
+	default:
+		return 0, 0, false
+	}
+
+	var totalArea, sumX, sumY float64
+	for _, polygon := range polygons {
+		if len(polygon) == 0 {
+			continue
+		}
+		x, y, area := ringCentroid(polygon[0]) // วงนอก
+		area = math.Abs(area)
+		totalArea += area
+		sumX += x * area
+		sumY += y * area
+	}
+	if totalArea == 0 {
+		return 0, 0, false
+	}
+	return sumY / totalArea, sumX / totalArea, true
+}
+
+func featureProperty(properties map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if value, ok := properties[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ImportAreaBoundaries - นำเข้าขอบเขตจังหวัด/อำเภอจากไฟล์ GeoJSON FeatureCollection และคำนวณจุดกึ่งกลาง
+// form-data: file, level=province|district, name_property, province_property (ไม่ระบุ = เดาจาก property ที่พบบ่อย)
+func ImportAreaBoundaries(c *fiber.Ctx) error {
+	level := c.FormValue("level")
+	if level != "province" && level != "district" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "level ต้องเป็น 'province' หรือ 'district'",
+		})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณาแนบไฟล์ GeoJSON",
+		})
+	}
+	if fileHeader.Size > maxBoundaryFileSize {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไฟล์มีขนาดใหญ่เกินไป",
+		})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่สามารถอ่านไฟล์ได้",
+		})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่สามารถอ่านไฟล์ได้",
+		})
+	}
+
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry   json.RawMessage        `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil || collection.Type != "FeatureCollection" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไฟล์ต้องเป็น GeoJSON FeatureCollection",
+		})
+	}
+
+	nameProperties := boundaryNameProperties[level]
+	if name := c.FormValue("name_property"); name != "" {
+		nameProperties = []string{name}
+	}
+	provinceProperties := boundaryProvinceProperties
+	if name := c.FormValue("province_property"); name != "" {
+		provinceProperties = []string{name}
+	}
+
+	resolver, err := newAddressResolver()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถโหลดข้อมูลที่อยู่ได้",
+		})
+	}
+
+	type boundaryMatch struct {
+		areaID   uint
+		geometry []byte
+	}
+	var matches []boundaryMatch
+	unmatched := []string{}
+	for i, feature := range collection.Features {
+		name := featureProperty(feature.Properties, nameProperties...)
+		if len(feature.Geometry) == 0 || string(feature.Geometry) == "null" {
+			unmatched = append(unmatched, fmt.Sprintf("feature %d (%s): ไม่มี geometry", i+1, name))
+			continue
+		}
+
+		var areaID uint
+		if level == "province" {
+			areaID, err = matchPlace(resolver.provinces, name, "จังหวัด")
+		} else {
+			province := featureProperty(feature.Properties, provinceProperties...)
+			var provinceID uint
+			if provinceID, err = matchPlace(resolver.provinces, province, "จังหวัด"); err == nil {
+				areaID, err = matchPlace(resolver.districts[provinceID], name, "อำเภอ")
+			}
+		}
+		if err != nil {
+			unmatched = append(unmatched, fmt.Sprintf("feature %d: %s", i+1, err.Error()))
+			continue
+		}
+		matches = append(matches, boundaryMatch{areaID: areaID, geometry: feature.Geometry})
+	}
+
+	var model interface{} = &models.Province{}
+	if level == "district" {
+		model = &models.District{}
+	}
+
+	userID := c.Locals("userID").(uint)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, match := range matches {
+			boundary := models.AreaBoundary{Level: level, AreaID: match.areaID, Geometry: match.geometry}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "level"}, {Name: "area_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"geometry", "updated_at"}),
+			}).Create(&boundary).Error; err != nil {
+				return err
+			}
+			if lat, lng, ok := geometryCentroid(match.geometry); ok {
+				if err := tx.Model(model).Where("id = ?", match.areaID).
+					Updates(map[string]interface{}{"centroid_lat": lat, "centroid_lng": lng}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      "นำเข้าขอบเขตแผนที่",
+			Description: fmt.Sprintf("นำเข้าขอบเขตระดับ %s จากไฟล์ %s: จับคู่ได้ %d, ไม่พบ %d", level, fileHeader.Filename, len(matches), len(unmatched)),
+			Module:      "geo",
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลขอบเขตได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"level":     level,
+		"imported":  len(matches),
+		"unmatched": unmatched,
+	})
+}
+
+// geoCountRow - จำนวนผู้ลงทะเบียนต่อพื้นที่แยกตามสถานะ
+type geoCountRow struct {
+	AreaID uint
+	Type   string
+	Status *string
+	Count  int64
+}
+
+// geoCounts - จำนวนต่อพื้นที่ (column = province_id หรือ district_id) เป็น properties ของ feature
+func geoCounts(filter *statisticsFilter, column string) (map[uint]map[string]interface{}, error) {
+	source, args := filter.source()
+	var rows []geoCountRow
+	if err := database.DB.Raw(`SELECT `+column+` AS area_id, type, status, COUNT(*) AS count FROM `+source+`
+		GROUP BY `+column+`, type, status`, args...).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := map[uint]map[string]interface{}{}
+	for _, row := range rows {
+		properties, ok := counts[row.AreaID]
+		if !ok {
+			properties = map[string]interface{}{"count": int64(0), "teacher_count": int64(0), "stages": map[string]int64{}}
+			counts[row.AreaID] = properties
+		}
+		properties["count"] = properties["count"].(int64) + row.Count
+		if row.Type == "teacher" {
+			properties["teacher_count"] = properties["teacher_count"].(int64) + row.Count
+		} else if row.Status != nil {
+			properties["stages"].(map[string]int64)[*row.Status] += row.Count
+		}
+	}
+	return counts, nil
+}
+
+// geoFeatureCollection - สร้าง FeatureCollection จากรายการพื้นที่ พร้อมจำนวนผู้ลงทะเบียน
+// geometry=centroid ส่งเฉพาะจุดกึ่งกลาง (ไฟล์เล็กกว่ามาก)
+func geoFeatureCollection(c *fiber.Ctx, level string, areas []GeoFeature, counts map[uint]map[string]interface{}, centroids map[uint][2]*float64) error {
+	boundaries := map[uint]models.GeoJSONGeometry{}
+	if c.Query("geometry") != "centroid" {
+		ids := make([]uint, len(areas))
+		for i, area := range areas {
+			ids[i] = area.ID
+		}
+		var rows []models.AreaBoundary
+		database.DB.Where("level = ? AND area_id IN ?", level, ids).Find(&rows)
+		for _, row := range rows {
+			boundaries[row.AreaID] = row.Geometry
+		}
+	}
+
+	for i := range areas {
+		area := &areas[i]
+		if properties, ok := counts[area.ID]; ok {
+			for key, value := range properties {
+				area.Properties[key] = value
+			}
+		} else {
+			area.Properties["count"] = 0
+			area.Properties["teacher_count"] = 0
+			area.Properties["stages"] = map[string]int64{}
+		}
+
+		centroid := centroids[area.ID]
+		if centroid[0] != nil && centroid[1] != nil {
+			area.Properties["centroid"] = []float64{*centroid[1], *centroid[0]}
+		}
+		switch {
+		case len(boundaries[area.ID]) > 0:
+			area.Geometry = json.RawMessage(boundaries[area.ID])
+		case centroid[0] != nil && centroid[1] != nil:
+			area.Geometry, _ = json.Marshal(fiber.Map{"type": "Point", "coordinates": []float64{*centroid[1], *centroid[0]}})
+		default:
+			area.Geometry = json.RawMessage("null")
+		}
+	}
+
+	return c.JSON(GeoFeatureCollection{Type: "FeatureCollection", Features: areas}, "application/geo+json")
+}
+
+// GetProvinceGeoJSON - จังหวัดทั้งหมดเป็น GeoJSON พร้อมจำนวนผู้ลงทะเบียน
+// Query: เหมือน /admin/statistics (from, to, type, temple_id, stage) และ geometry=centroid
+func GetProvinceGeoJSON(c *fiber.Ctx) error {
+	filter, err := parseStatisticsFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	filter.ProvinceID = 0
+
+	var provinces []models.Province
+	if err := database.DB.Order("id").Find(&provinces).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch provinces",
+		})
+	}
+	counts, err := geoCounts(filter, "province_id")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถคำนวณจำนวนผู้ลงทะเบียนได้",
+		})
+	}
+
+	areas := make([]GeoFeature, len(provinces))
+	centroids := map[uint][2]*float64{}
+	for i, province := range provinces {
+		areas[i] = GeoFeature{Type: "Feature", ID: province.ID, Properties: map[string]interface{}{
+			"id": province.ID, "name_th": province.NameTh, "name_en": province.NameEn, "region": regionOfProvince[province.NameTh],
+		}}
+		centroids[province.ID] = [2]*float64{province.CentroidLat, province.CentroidLng}
+	}
+	return geoFeatureCollection(c, "province", areas, counts, centroids)
+}
+
+// GetDistrictGeoJSON - อำเภอในจังหวัดเป็น GeoJSON พร้อมจำนวนผู้ลงทะเบียน
+func GetDistrictGeoJSON(c *fiber.Ctx) error {
+	filter, err := parseStatisticsFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	var province models.Province
+	if err := database.DB.First(&province, c.Params("province_id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบจังหวัด",
+		})
+	}
+	filter.ProvinceID = int(province.ID)
+
+	var districts []models.District
+	if err := database.DB.Where("province_id = ?", province.ID).Order("id").Find(&districts).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to fetch districts",
+		})
+	}
+	counts, err := geoCounts(filter, "district_id")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถคำนวณจำนวนผู้ลงทะเบียนได้",
+		})
+	}
+
+	areas := make([]GeoFeature, len(districts))
+	centroids := map[uint][2]*float64{}
+	for i, district := range districts {
+		areas[i] = GeoFeature{Type: "Feature", ID: district.ID, Properties: map[string]interface{}{
+			"id": district.ID, "name_th": district.NameTh, "name_en": district.NameEn, "province_id": province.ID,
+		}}
+		centroids[district.ID] = [2]*float64{district.CentroidLat, district.CentroidLng}
+	}
+	return geoFeatureCollection(c, "district", areas, counts, centroids)
+}
@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"registration-system/database"
+	"registration-system/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// maxGroupParticipants - จำนวนผู้ลงทะเบียนสูงสุดต่อกลุ่ม
+const maxGroupParticipants = 50
+
+// GroupDefaults - ค่าเริ่มต้นที่ใช้ร่วมกันทุกคนในกลุ่ม (แต่ละคนระบุทับได้)
+type GroupDefaults struct {
+	TempleName    string `json:"temple_name"`
+	TempleID      *uint  `json:"temple_id"`
+	ProvinceID    uint   `json:"province_id"`
+	DistrictID    uint   `json:"district_id"`
+	SubDistrictID uint   `json:"sub_district_id"`
+	AddressDetail string `json:"address_detail"`
+}
+
+// GroupParticipantRequest - ผู้ลงทะเบียนหนึ่งคนในกลุ่ม (field ที่ว่างใช้ค่าจาก defaults)
+type GroupParticipantRequest struct {
+	FullName          string `json:"full_name"`
+	Nickname          string `json:"nickname"`
+	BirthDate         string `json:"birth_date"`
+	PhoneNumber       string `json:"phone_number"` // ว่างได้ ใช้เบอร์ผู้ติดต่อของกลุ่ม
+	MedicalCondition  string `json:"medical_condition"`
+	Vassa             int    `json:"vassa"`
+	NationalID        string `json:"national_id"`
+	MonkCertificateNo string `json:"monk_certificate_no"`
+	OrdinationDate    string `json:"ordination_date"`
+	Preceptor         string `json:"preceptor"`
+	TempleName        string `json:"temple_name"`
+	TempleID          *uint  `json:"temple_id"`
+	ProvinceID        uint   `json:"province_id"`
+	DistrictID        uint   `json:"district_id"`
+	SubDistrictID     uint   `json:"sub_district_id"`
+	AddressDetail     string `json:"address_detail"`
+}
+
+// GroupRegistrationRequest - Request body สำหรับการลงทะเบียนแบบกลุ่ม
+type GroupRegistrationRequest struct {
+	Leader struct {
+		FullName               string `json:"full_name"`
+		Role                   string `json:"role"`
+		PhoneNumber            string `json:"phone_number"`
+		PhoneVerificationToken string `json:"phone_verification_token,omitempty"` // เบอร์ผู้ติดต่อถูกใช้แทนเบอร์ของผู้ที่ไม่มีโทรศัพท์ จึงต้องยืนยันเหมือนการลงทะเบียนเดี่ยว
+	} `json:"leader"`
+	Defaults     GroupDefaults             `json:"defaults"`
+	Participants []GroupParticipantRequest `json:"participants"`
+	Notes        string                    `json:"notes"`
+	Consent      *ConsentRequest           `json:"consent,omitempty"`
+}
+
+// CancelGroupRequest - เหตุผลการยกเลิกกลุ่ม
+type CancelGroupRequest struct {
+	Notes string `json:"notes"`
+}
+
+// newGroupCode - รหัสกลุ่ม เช่น "G-7K3QX9" (ไม่มีตัวอักษรที่สับสนง่าย เช่น O/0, I/1)
+func newGroupCode() string {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	buf := make([]byte, 6)
+	rand.Read(buf)
+	for i := range buf {
+		buf[i] = alphabet[int(buf[i])%len(alphabet)]
+	}
+	return "G-" + string(buf)
+}
+
+// buildGroupRegistrations - ตรวจสอบผู้ลงทะเบียนทุกคน คืน error รายคน (index -> ข้อความ)
+// leaderVerifiedAt ใช้กับผู้ที่ใช้เบอร์ผู้ติดต่อ (เบอร์ของตนเองยังไม่ได้ยืนยัน)
+func buildGroupRegistrations(req *GroupRegistrationRequest, leaderVerifiedAt *time.Time) ([]models.Registration, map[int][]string) {
+	registrations := make([]models.Registration, 0, len(req.Participants))
+	errs := map[int][]string{}
+	phones := map[string]int{}
+	identities := map[string]int{}
+
+	for i, p := range req.Participants {
+		var rowErrors []string
+
+		if strings.TrimSpace(p.FullName) == "" {
+			rowErrors = append(rowErrors, "กรุณากรอกชื่อ-นามสกุล")
+		}
+		birthDate, err := time.Parse("2006-01-02", p.BirthDate)
+		if err != nil {
+			rowErrors = append(rowErrors, "รูปแบบวันเกิดไม่ถูกต้อง (ใช้ YYYY-MM-DD)")
+		}
+		if p.Vassa < 0 {
+			rowErrors = append(rowErrors, "พรรษาต้องไม่ติดลบ")
+		}
+
+		// ใช้ค่าเริ่มต้นของกลุ่มเมื่อไม่ได้ระบุ
+		templeID, templeName := p.TempleID, p.TempleName
+		if templeID == nil && strings.TrimSpace(templeName) == "" {
+			templeID, templeName = req.Defaults.TempleID, req.Defaults.TempleName
+		}
+		templeID, templeName, err = resolveTemple(templeID, templeName)
+		if err != nil {
+			rowErrors = append(rowErrors, "ไม่พบวัดที่เลือกในทะเบียนวัด")
+		}
+		addressDetail := firstNonEmpty(p.AddressDetail, req.Defaults.AddressDetail)
+		provinceID, districtID, subDistrictID := p.ProvinceID, p.DistrictID, p.SubDistrictID
+		if provinceID == 0 && districtID == 0 && subDistrictID == 0 {
+			provinceID, districtID, subDistrictID = req.Defaults.ProvinceID, req.Defaults.DistrictID, req.Defaults.SubDistrictID
+		}
+		if !validateAddress(provinceID, districtID, subDistrictID) {
+			rowErrors = append(rowErrors, "ที่อยู่ไม่ถูกต้อง")
+		}
+
+		// พระที่ไม่มีโทรศัพท์ใช้เบอร์ผู้ติดต่อของกลุ่ม
+		phone := strings.TrimSpace(p.PhoneNumber)
+		var verifiedAt *time.Time
+		if phone != "" {
+			index := models.PhoneIndex(phone)
+			if first, ok := phones[index]; ok {
+				rowErrors = append(rowErrors, fmt.Sprintf("เบอร์โทรซ้ำกับผู้ลงทะเบียนลำดับที่ %d", first+1))
+			} else {
+				phones[index] = i
+			}
+		} else {
+			phone, verifiedAt = req.Leader.PhoneNumber, leaderVerifiedAt
+		}
+
+		identity := registrationFields{
+			BirthDate:         p.BirthDate,
+			Vassa:             p.Vassa,
+			NationalID:        p.NationalID,
+			MonkCertificateNo: p.MonkCertificateNo,
+			OrdinationDate:    p.OrdinationDate,
+			Preceptor:         p.Preceptor,
+		}
+		if identityErr := checkIdentity(&identity, "", 0); identityErr != nil {
+			rowErrors = append(rowErrors, identityErr.Message)
+		}
+		for _, index := range []string{models.NationalIDIndex(identity.NationalID), models.MonkCertificateIndex(identity.MonkCertificateNo)} {
+			if index == "" {
+				continue
+			}
+			if first, ok := identities[index]; ok {
+				rowErrors = append(rowErrors, fmt.Sprintf("เลขบัตรประชาชน/เลขใบสุทธิซ้ำกับผู้ลงทะเบียนลำดับที่ %d", first+1))
+			} else {
+				identities[index] = i
+			}
+		}
+
+		if len(rowErrors) > 0 {
+			errs[i] = rowErrors
+			continue
+		}
+		registrations = append(registrations, models.Registration{
+			FullName:          strings.TrimSpace(p.FullName),
+			Nickname:          p.Nickname,
+			BirthDate:         models.EncryptedDate{Time: birthDate},
+			ProvinceID:        provinceID,
+			DistrictID:        districtID,
+			SubDistrictID:     subDistrictID,
+			AddressDetail:     models.EncryptedString(addressDetail),
+			PhoneNumber:       models.EncryptedString(phone),
+			PhoneVerifiedAt:   verifiedAt,
+			TempleName:        templeName,
+			TempleID:          templeID,
+			MedicalCondition:  models.EncryptedString(p.MedicalCondition),
+			Vassa:             p.Vassa,
+			NationalID:        models.EncryptedString(identity.NationalID),
+			MonkCertificateNo: models.EncryptedString(identity.MonkCertificateNo),
+			OrdinationDate:    parseOptionalDate(identity.OrdinationDate),
+			Preceptor:         identity.Preceptor,
+		})
+	}
+	return registrations, errs
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// CreateGroupRegistration - ลงทะเบียนหลายรูปพร้อมกันในนามวัด (บันทึกทั้งหมดหรือไม่บันทึกเลย)
+func CreateGroupRegistration(c *fiber.Ctx) error {
+	var req GroupRegistrationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if strings.TrimSpace(req.Leader.FullName) == "" || strings.TrimSpace(req.Leader.PhoneNumber) == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณากรอกชื่อและเบอร์โทรของผู้ติดต่อ",
+		})
+	}
+	if len(req.Participants) == 0 || len(req.Participants) > maxGroupParticipants {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("ต้องมีผู้ลงทะเบียน 1-%d รูป", maxGroupParticipants),
+		})
+	}
+
+	consents, err := buildConsentRecords(c, req.Consent)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณายอมรับนโยบายความเป็นส่วนตัวก่อนลงทะเบียน",
+		})
+	}
+
+	phoneVerification, verifyErr := checkPhoneVerification(req.Leader.PhoneVerificationToken, req.Leader.PhoneNumber)
+	if verifyErr != nil {
+		return verifyErr.respond(c)
+	}
+
+	registrations, errs := buildGroupRegistrations(&req, phoneVerifiedAt(phoneVerification))
+	if len(errs) > 0 {
+		return c.Status(422).JSON(fiber.Map{
+			"error":        "ข้อมูลผู้ลงทะเบียนบางรายการไม่ถูกต้อง ยังไม่มีการบันทึกข้อมูล",
+			"participants": errs,
+		})
+	}
+
+	templeID, templeName, err := resolveTemple(req.Defaults.TempleID, req.Defaults.TempleName)
+	if err != nil {
+		return c.Status(422).JSON(fiber.Map{
+			"error": "ไม่พบวัดที่เลือกในทะเบียนวัด",
+		})
+	}
+
+	group := models.RegistrationGroup{
+		Status:      "active",
+		LeaderName:  strings.TrimSpace(req.Leader.FullName),
+		LeaderRole:  req.Leader.Role,
+		LeaderPhone: models.EncryptedString(strings.TrimSpace(req.Leader.PhoneNumber)),
+		TempleName:  templeName,
+		TempleID:    templeID,
+		Notes:       req.Notes,
+	}
+
+	err = eventTransaction(func(tx *gorm.DB) error {
+		// สุ่มรหัสใหม่ถ้าซ้ำ
+		for attempt := 0; ; attempt++ {
+			group.Code = newGroupCode()
+			var count int64
+			tx.Model(&models.RegistrationGroup{}).Where("code = ?", group.Code).Count(&count)
+			if count == 0 {
+				break
+			}
+			if attempt >= 5 {
+				return errors.New("cannot generate group code")
+			}
+		}
+		if err := consumePhoneVerification(tx, phoneVerification); err != nil {
+			return err
+		}
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+
+		for i := range registrations {
+			registrations[i].GroupID = &group.ID
+			if err := tx.Create(&registrations[i]).Error; err != nil {
+				return err
+			}
+			after := registrationFieldsOf(&registrations[i])
+			if err := recordVersion(tx, "registration", registrations[i].ID, "create", nil, &after, currentUserID(c)); err != nil {
+				return err
+			}
+			// ผู้ติดต่อให้ความยินยอมแทนทุกคนในกลุ่ม
+			records := append([]models.ConsentRecord(nil), consents...)
+			if err := saveConsentRecords(tx, records, &registrations[i].ID, nil); err != nil {
+				return err
+			}
+		}
+		return enqueueGroupRegistrationCreated(tx, &group, len(registrations))
+	})
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create group registration",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"code":          group.Code,
+		"group_id":      group.ID,
+		"participants":  len(registrations),
+		"leader_name":   group.LeaderName,
+		"temple_name":   group.TempleName,
+		"registered_at": group.CreatedAt,
+	})
+}
+
+// GetRegistrationGroups - รายการกลุ่มพร้อมจำนวนผู้ลงทะเบียน (?status=active|cancelled&code=)
+func GetRegistrationGroups(c *fiber.Ctx) error {
+	type groupSummary struct {
+		models.RegistrationGroup
+		ParticipantCount int64 `json:"participant_count"`
+	}
+
+	query := database.DB.Model(&models.RegistrationGroup{}).Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if code := c.Query("code"); code != "" {
+		query = query.Where("code = ?", strings.ToUpper(strings.TrimSpace(code)))
+	}
+
+	var groups []models.RegistrationGroup
+	if err := query.Find(&groups).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	// นับรวมที่ถูกลบด้วย เพื่อให้กลุ่มที่ยกเลิกแล้วยังเห็นจำนวนเดิม
+	result := make([]groupSummary, 0, len(groups))
+	for _, group := range groups {
+		summary := groupSummary{RegistrationGroup: group}
+		database.DB.Unscoped().Model(&models.Registration{}).Where("group_id = ?", group.ID).Count(&summary.ParticipantCount)
+		result = append(result, summary)
+	}
+	return c.JSON(result)
+}
+
+// GetRegistrationGroup - รายละเอียดกลุ่มพร้อมผู้ลงทะเบียนทุกคน
+func GetRegistrationGroup(c *fiber.Ctx) error {
+	var group models.RegistrationGroup
+	err := database.DB.Preload("Registrations", func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Order("id")
+	}).Preload("Registrations.Province").Preload("Registrations.District").Preload("Registrations.SubDistrict").
+		First(&group, c.Params("id")).Error
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบกลุ่ม",
+		})
+	}
+	maskRegistrationIdentity(group.Registrations)
+	redactMedicalCondition(c, group.Registrations)
+	return c.JSON(group)
+}
+
+// CancelRegistrationGroup - ยกเลิกทั้งกลุ่ม (ลบผู้ลงทะเบียนทุกคนแบบ soft delete และคืนที่พัก)
+func CancelRegistrationGroup(c *fiber.Ctx) error {
+	var group models.RegistrationGroup
+	if err := database.DB.First(&group, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบกลุ่ม",
+		})
+	}
+	if group.Status == "cancelled" {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "กลุ่มนี้ถูกยกเลิกแล้ว",
+		})
+	}
+
+	var req CancelGroupRequest
+	c.BodyParser(&req)
+
+	userID := c.Locals("userID").(uint)
+	var cancelled int
+	err := eventTransaction(func(tx *gorm.DB) error {
+		var registrations []models.Registration
+		if err := tx.Where("group_id = ?", group.ID).Find(&registrations).Error; err != nil {
+			return err
+		}
+		for i := range registrations {
+			if err := bulkDeleteRegistration(tx, &registrations[i], userID); err != nil {
+				return err
+			}
+		}
+		cancelled = len(registrations)
+
+		now := time.Now()
+		if err := tx.Model(&group).Updates(map[string]interface{}{
+			"status":             "cancelled",
+			"cancelled_at":       &now,
+			"cancelled_by_id":    userID,
+			"cancellation_notes": req.Notes,
+		}).Error; err != nil {
+			return err
+		}
+
+		// ถังขยะใช้ log นี้หาผู้ลบจากเวลาที่ลบ
+		return tx.Create(&models.ActivityLog{
+			Action:      "ลบข้อมูลการลงทะเบียนทั้งกลุ่ม",
+			Description: fmt.Sprintf("ยกเลิกกลุ่ม %s (%s) จำนวน %d รูป", group.Code, group.TempleName, cancelled),
+			Module:      "registration",
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถยกเลิกกลุ่มได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"message":   "ยกเลิกกลุ่มสำเร็จ",
+		"cancelled": cancelled,
+	})
+}
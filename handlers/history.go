@@ -0,0 +1,547 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"registration-system/database"
+	"registration-system/middleware"
+	"registration-system/models"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// registrationFields - field ที่เก็บประวัติของการลงทะเบียน (ใช้ทั้งผู้ลงทะเบียนและพระอาจารย์)
+type registrationFields struct {
+	FullName         string `json:"full_name"`
+	Nickname         string `json:"nickname"`
+	BirthDate        string `json:"birth_date"`
+	ProvinceID       uint   `json:"province_id"`
+	DistrictID       uint   `json:"district_id"`
+	SubDistrictID    uint   `json:"sub_district_id"`
+	AddressDetail    string `json:"address_detail"`
+	PhoneNumber      string `json:"phone_number"`
+	TempleName       string `json:"temple_name"`
+	TempleID         *uint  `json:"temple_id,omitempty"`
+	MedicalCondition string `json:"medical_condition"`
+	Vassa            int    `json:"vassa"`
+
+	// ข้อมูลยืนยันตัวตน (ไม่บังคับ)
+	NationalID        string `json:"national_id,omitempty"`
+	MonkCertificateNo string `json:"monk_certificate_no,omitempty"`
+	OrdinationDate    string `json:"ordination_date,omitempty"`
+	Preceptor         string `json:"preceptor,omitempty"`
+
+	// สถานะการสวด (เฉพาะผู้ลงทะเบียน)
+	ChantedPariwat *bool `json:"chanted_pariwat,omitempty"`
+	ChantedManat   *bool `json:"chanted_manat,omitempty"`
+	ChantedOkApan  *bool `json:"chanted_ok_apan,omitempty"`
+}
+
+// FieldChange - การเปลี่ยนแปลงของ field เดียว
+type FieldChange struct {
+	Field    string      `json:"field"`
+	OldValue interface{} `json:"old_value"`
+	NewValue interface{} `json:"new_value"`
+}
+
+// RecordVersionResponse - ประวัติหนึ่งเวอร์ชันสำหรับแสดงผล
+type RecordVersionResponse struct {
+	models.RecordVersion
+	Changes  []FieldChange          `json:"changes"`
+	Snapshot map[string]interface{} `json:"snapshot"`
+}
+
+// sensitiveHistoryFields - field ที่ต้องมี role ที่กำหนดจึงจะเห็นค่าในประวัติ
+var sensitiveHistoryFields = map[string][]string{
+	"birth_date":          {"superadmin"},
+	"address_detail":      {"superadmin"},
+	"phone_number":        {"superadmin"},
+	"medical_condition":   {"medical", "superadmin"},
+	"national_id":         {"superadmin"},
+	"monk_certificate_no": {"superadmin"},
+}
+
+const redactedValue = "[ซ่อนข้อมูล]"
+
+func registrationFieldsOf(r *models.Registration) registrationFields {
+	// คัดลอกค่า เพื่อไม่ให้ snapshot เปลี่ยนตามเมื่อแก้ไข r ภายหลัง
+	chantedPariwat, chantedManat, chantedOkApan := r.ChantedPariwat, r.ChantedManat, r.ChantedOkApan
+	return registrationFields{
+		FullName:          r.FullName,
+		Nickname:          r.Nickname,
+		BirthDate:         r.BirthDate.Format("2006-01-02"),
+		ProvinceID:        r.ProvinceID,
+		DistrictID:        r.DistrictID,
+		SubDistrictID:     r.SubDistrictID,
+		AddressDetail:     r.AddressDetail.String(),
+		PhoneNumber:       r.PhoneNumber.String(),
+		TempleName:        r.TempleName,
+		TempleID:          copyUint(r.TempleID),
+		MedicalCondition:  r.MedicalCondition.String(),
+		Vassa:             r.Vassa,
+		NationalID:        r.NationalID.String(),
+		MonkCertificateNo: r.MonkCertificateNo.String(),
+		OrdinationDate:    formatOptionalDate(r.OrdinationDate),
+		Preceptor:         r.Preceptor,
+		ChantedPariwat:    &chantedPariwat,
+		ChantedManat:      &chantedManat,
+		ChantedOkApan:     &chantedOkApan,
+	}
+}
+
+func teacherRegistrationFieldsOf(r *models.TeacherRegistration) registrationFields {
+	return registrationFields{
+		FullName:          r.FullName,
+		Nickname:          r.Nickname,
+		BirthDate:         r.BirthDate.Format("2006-01-02"),
+		ProvinceID:        r.ProvinceID,
+		DistrictID:        r.DistrictID,
+		SubDistrictID:     r.SubDistrictID,
+		AddressDetail:     r.AddressDetail.String(),
+		PhoneNumber:       r.PhoneNumber.String(),
+		TempleName:        r.TempleName,
+		TempleID:          copyUint(r.TempleID),
+		MedicalCondition:  r.MedicalCondition.String(),
+		Vassa:             r.Vassa,
+		NationalID:        r.NationalID.String(),
+		MonkCertificateNo: r.MonkCertificateNo.String(),
+		OrdinationDate:    formatOptionalDate(r.OrdinationDate),
+		Preceptor:         r.Preceptor,
+	}
+}
+
+// apply - คืนค่าจาก snapshot ลงในข้อมูลการลงทะเบียน
+func (f registrationFields) apply(r *models.Registration) error {
+	birthDate, err := time.Parse("2006-01-02", f.BirthDate)
+	if err != nil {
+		return err
+	}
+	r.FullName = f.FullName
+	r.Nickname = f.Nickname
+	r.BirthDate = models.EncryptedDate{Time: birthDate}
+	r.ProvinceID = f.ProvinceID
+	r.DistrictID = f.DistrictID
+	r.SubDistrictID = f.SubDistrictID
+	r.AddressDetail = models.EncryptedString(f.AddressDetail)
+	if phoneChanged(r.PhoneNumber, f.PhoneNumber) {
+		r.PhoneVerifiedAt = nil
+	}
+	r.PhoneNumber = models.EncryptedString(f.PhoneNumber)
+	r.TempleName = f.TempleName
+	r.TempleID = copyUint(f.TempleID)
+	r.MedicalCondition = models.EncryptedString(f.MedicalCondition)
+	r.Vassa = f.Vassa
+	r.NationalID = models.EncryptedString(f.NationalID)
+	r.MonkCertificateNo = models.EncryptedString(f.MonkCertificateNo)
+	r.OrdinationDate = parseOptionalDate(f.OrdinationDate)
+	r.Preceptor = f.Preceptor
+	if f.ChantedPariwat != nil {
+		r.ChantedPariwat = *f.ChantedPariwat
+	}
+	if f.ChantedManat != nil {
+		r.ChantedManat = *f.ChantedManat
+	}
+	if f.ChantedOkApan != nil {
+		r.ChantedOkApan = *f.ChantedOkApan
+	}
+	return nil
+}
+
+// applyTeacher - คืนค่าจาก snapshot ลงในข้อมูลการลงทะเบียนพระอาจารย์
+func (f registrationFields) applyTeacher(r *models.TeacherRegistration) error {
+	birthDate, err := time.Parse("2006-01-02", f.BirthDate)
+	if err != nil {
+		return err
+	}
+	r.FullName = f.FullName
+	r.Nickname = f.Nickname
+	r.BirthDate = models.EncryptedDate{Time: birthDate}
+	r.ProvinceID = f.ProvinceID
+	r.DistrictID = f.DistrictID
+	r.SubDistrictID = f.SubDistrictID
+	r.AddressDetail = models.EncryptedString(f.AddressDetail)
+	if phoneChanged(r.PhoneNumber, f.PhoneNumber) {
+		r.PhoneVerifiedAt = nil
+	}
+	r.PhoneNumber = models.EncryptedString(f.PhoneNumber)
+	r.TempleName = f.TempleName
+	r.TempleID = copyUint(f.TempleID)
+	r.MedicalCondition = models.EncryptedString(f.MedicalCondition)
+	r.Vassa = f.Vassa
+	r.NationalID = models.EncryptedString(f.NationalID)
+	r.MonkCertificateNo = models.EncryptedString(f.MonkCertificateNo)
+	r.OrdinationDate = parseOptionalDate(f.OrdinationDate)
+	r.Preceptor = f.Preceptor
+	return nil
+}
+
+func formatOptionalDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+	return date.Format("2006-01-02")
+}
+
+func parseOptionalDate(value string) *time.Time {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
+
+func copyUint(value *uint) *uint {
+	if value == nil {
+		return nil
+	}
+	v := *value
+	return &v
+}
+
+func fieldsToMap(fields *registrationFields) map[string]interface{} {
+	values := map[string]interface{}{}
+	if fields == nil {
+		return values
+	}
+	data, _ := json.Marshal(fields)
+	json.Unmarshal(data, &values)
+	return values
+}
+
+// diffFields - เปรียบเทียบสองเวอร์ชัน (nil = ไม่มีข้อมูล เช่นตอนสร้าง)
+func diffFields(before, after *registrationFields) []FieldChange {
+	oldValues := fieldsToMap(before)
+	newValues := fieldsToMap(after)
+
+	keys := map[string]bool{}
+	for key := range oldValues {
+		keys[key] = true
+	}
+	for key := range newValues {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	changes := []FieldChange{}
+	for _, key := range sorted {
+		if !reflect.DeepEqual(oldValues[key], newValues[key]) {
+			changes = append(changes, FieldChange{Field: key, OldValue: oldValues[key], NewValue: newValues[key]})
+		}
+	}
+	return changes
+}
+
+// recordVersion - บันทึกเวอร์ชันใหม่ของข้อมูล (before/after เป็น nil ได้ตอนสร้าง/ลบ)
+// และเตรียม event registration.* ไว้ส่งหลัง commit (ถ้าทำใน eventTransaction)
+func recordVersion(tx *gorm.DB, recordType string, recordID uint, action string, before, after *registrationFields, userID *uint) error {
+	changes := diffFields(before, after)
+	if action == "update" && len(changes) == 0 {
+		return nil
+	}
+
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+
+	var latest int
+	tx.Model(&models.RecordVersion{}).Where("record_type = ? AND record_id = ?", recordType, recordID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest)
+
+	if err := tx.Create(&models.RecordVersion{
+		RecordType: recordType,
+		RecordID:   recordID,
+		Version:    latest + 1,
+		Action:     action,
+		Snapshot:   models.EncryptedString(snapshotJSON),
+		Changes:    models.EncryptedString(changesJSON),
+		UserID:     userID,
+	}).Error; err != nil {
+		return err
+	}
+
+	return stageRegistrationEvents(tx, recordType, recordID, action, before, after, changes, userID)
+}
+
+// currentUserID - id ของผู้ใช้ที่ login (nil ถ้าไม่ได้ login)
+func currentUserID(c *fiber.Ctx) *uint {
+	if userID, ok := c.Locals("userID").(uint); ok {
+		return &userID
+	}
+	return nil
+}
+
+// redactHistoryValue - ซ่อนค่าของ field ที่ผู้ใช้ไม่มีสิทธิ์เห็น
+func redactHistoryValue(c *fiber.Ctx, field string, value interface{}) interface{} {
+	roles, ok := sensitiveHistoryFields[field]
+	if !ok || value == nil || value == "" || middleware.HasRole(c, roles...) {
+		return value
+	}
+	return redactedValue
+}
+
+func getRecordHistory(c *fiber.Ctx, recordType string, table string) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "id ไม่ถูกต้อง",
+		})
+	}
+
+	// ดูประวัติของข้อมูลที่ถูกลบได้ด้วย
+	var count int64
+	database.DB.Table(table).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียน",
+		})
+	}
+
+	var versions []models.RecordVersion
+	if err := database.DB.Preload("User").Where("record_type = ? AND record_id = ?", recordType, id).
+		Order("version DESC").Find(&versions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	response := make([]RecordVersionResponse, 0, len(versions))
+	for _, version := range versions {
+		item := RecordVersionResponse{RecordVersion: version, Changes: []FieldChange{}, Snapshot: map[string]interface{}{}}
+		json.Unmarshal([]byte(version.Changes), &item.Changes)
+		json.Unmarshal([]byte(version.Snapshot), &item.Snapshot)
+
+		for i := range item.Changes {
+			item.Changes[i].OldValue = redactHistoryValue(c, item.Changes[i].Field, item.Changes[i].OldValue)
+			item.Changes[i].NewValue = redactHistoryValue(c, item.Changes[i].Field, item.Changes[i].NewValue)
+		}
+		for field, value := range item.Snapshot {
+			item.Snapshot[field] = redactHistoryValue(c, field, value)
+		}
+		response = append(response, item)
+	}
+
+	return c.JSON(response)
+}
+
+// GetRegistrationHistory - ประวัติการเปลี่ยนแปลงข้อมูลการลงทะเบียน
+func GetRegistrationHistory(c *fiber.Ctx) error {
+	return getRecordHistory(c, "registration", "registrations")
+}
+
+// GetTeacherRegistrationHistory - ประวัติการเปลี่ยนแปลงข้อมูลการลงทะเบียนพระอาจารย์
+func GetTeacherRegistrationHistory(c *fiber.Ctx) error {
+	return getRecordHistory(c, "teacher-registration", "teacher_registrations")
+}
+
+// loadVersionSnapshot - อ่าน snapshot ของเวอร์ชันที่ต้องการย้อนกลับ
+func loadVersionSnapshot(c *fiber.Ctx, recordType string, recordID uint) (*registrationFields, int, error) {
+	versionNumber, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return nil, 0, fmt.Errorf("เวอร์ชันไม่ถูกต้อง")
+	}
+
+	var version models.RecordVersion
+	if err := database.DB.Where("record_type = ? AND record_id = ? AND version = ?", recordType, recordID, versionNumber).
+		First(&version).Error; err != nil {
+		return nil, 0, fmt.Errorf("ไม่พบเวอร์ชันที่ระบุ")
+	}
+
+	var fields registrationFields
+	if err := json.Unmarshal([]byte(version.Snapshot), &fields); err != nil {
+		return nil, 0, fmt.Errorf("ข้อมูลเวอร์ชันเสียหาย")
+	}
+	return &fields, versionNumber, nil
+}
+
+// RevertRegistration - ย้อนข้อมูลการลงทะเบียนกลับไปเป็นเวอร์ชันที่ระบุ (ต้องส่ง If-Match เป็น version ปัจจุบัน)
+func RevertRegistration(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var registration models.Registration
+
+	if err := database.DB.First(&registration, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียน",
+		})
+	}
+	if registration.AnonymizedAt != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ข้อมูลนี้ถูกลบข้อมูลส่วนบุคคลแล้ว ไม่สามารถย้อนกลับได้",
+		})
+	}
+
+	expected, ok := expectedVersion(c, nil)
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != registration.Version {
+		return versionConflict(c, registration.Version, &registration)
+	}
+
+	fields, versionNumber, err := loadVersionSnapshot(c, "registration", registration.ID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if !validateAddress(fields.ProvinceID, fields.DistrictID, fields.SubDistrictID) {
+		return c.Status(422).JSON(fiber.Map{
+			"error": "ที่อยู่ในเวอร์ชันนี้ไม่ถูกต้องแล้ว ไม่สามารถย้อนกลับได้",
+		})
+	}
+	if identityErr := checkIdentity(fields, "registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
+	before := registrationFieldsOf(&registration)
+	if err := fields.apply(&registration); err != nil {
+		return c.Status(422).JSON(fiber.Map{
+			"error": "ข้อมูลเวอร์ชันเสียหาย",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	registration.Version++
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &registration, expected); err != nil {
+			return err
+		}
+		after := registrationFieldsOf(&registration)
+		return recordVersion(tx, "registration", registration.ID, "revert", &before, &after, &userID)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.Registration
+		database.DB.First(&current, registration.ID)
+		return versionConflict(c, current.Version, &current)
+	}
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถย้อนข้อมูลได้",
+		})
+	}
+
+	activityLog := models.ActivityLog{
+		Action:      "ย้อนข้อมูลการลงทะเบียน",
+		Description: fmt.Sprintf("ย้อนข้อมูลของ %s กลับไปเวอร์ชัน %d", registration.FullName, versionNumber),
+		Module:      "registration",
+		RecordID:    &registration.ID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
+	redactMedicalCondition(c, &registration)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ย้อนข้อมูลสำเร็จ",
+		"data":    registration,
+	})
+}
+
+// RevertTeacherRegistration - ย้อนข้อมูลการลงทะเบียนพระอาจารย์กลับไปเป็นเวอร์ชันที่ระบุ (ต้องส่ง If-Match เป็น version ปัจจุบัน)
+func RevertTeacherRegistration(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var registration models.TeacherRegistration
+
+	if err := database.DB.First(&registration, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียนพระอาจารย์",
+		})
+	}
+	if registration.AnonymizedAt != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ข้อมูลนี้ถูกลบข้อมูลส่วนบุคคลแล้ว ไม่สามารถย้อนกลับได้",
+		})
+	}
+
+	expected, ok := expectedVersion(c, nil)
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != registration.Version {
+		return versionConflict(c, registration.Version, &registration)
+	}
+
+	fields, versionNumber, err := loadVersionSnapshot(c, "teacher-registration", registration.ID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if !validateAddress(fields.ProvinceID, fields.DistrictID, fields.SubDistrictID) {
+		return c.Status(422).JSON(fiber.Map{
+			"error": "ที่อยู่ในเวอร์ชันนี้ไม่ถูกต้องแล้ว ไม่สามารถย้อนกลับได้",
+		})
+	}
+	if identityErr := checkIdentity(fields, "teacher_registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
+	before := teacherRegistrationFieldsOf(&registration)
+	if err := fields.applyTeacher(&registration); err != nil {
+		return c.Status(422).JSON(fiber.Map{
+			"error": "ข้อมูลเวอร์ชันเสียหาย",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	registration.Version++
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &registration, expected); err != nil {
+			return err
+		}
+		after := teacherRegistrationFieldsOf(&registration)
+		return recordVersion(tx, "teacher-registration", registration.ID, "revert", &before, &after, &userID)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.TeacherRegistration
+		database.DB.First(&current, registration.ID)
+		return versionConflict(c, current.Version, &current)
+	}
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถย้อนข้อมูลได้",
+		})
+	}
+
+	activityLog := models.ActivityLog{
+		Action:      "ย้อนข้อมูลการลงทะเบียนพระอาจารย์",
+		Description: fmt.Sprintf("ย้อนข้อมูลของ %s กลับไปเวอร์ชัน %d", registration.FullName, versionNumber),
+		Module:      "teacher-registration",
+		RecordID:    &registration.ID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
+	redactMedicalCondition(c, &registration)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ย้อนข้อมูลสำเร็จ",
+		"data":    registration,
+	})
+}
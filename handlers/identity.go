@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"registration-system/database"
+	"registration-system/fieldcrypt"
+	"registration-system/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxVassaDifference - พรรษาที่กรอกต่างจากที่คำนวณจากวันอุปสมบทได้ไม่เกินนี้ (วันเข้า/ออกพรรษาตามจันทรคติเลื่อนทุกปี)
+const maxVassaDifference = 1
+
+// identityError - ข้อมูลยืนยันตัวตนไม่ถูกต้อง (Conflict = ซ้ำกับผู้ลงทะเบียนอื่น)
+type identityError struct {
+	Field    string
+	Message  string
+	Conflict bool
+}
+
+// Error - ให้คืนจาก transaction ได้ แล้วแปลงกลับด้วย errors.As
+func (e *identityError) Error() string {
+	return e.Message
+}
+
+func (e *identityError) respond(c *fiber.Ctx) error {
+	status := fiber.StatusUnprocessableEntity
+	if e.Conflict {
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": e.Message,
+		"field": e.Field,
+	})
+}
+
+// asIdentityError - แปลง error จาก transaction ที่บันทึกผู้ลงทะเบียนเป็น identityError (nil ถ้าไม่ใช่)
+// รวมถึง unique violation ของ index เลขบัตร/ใบสุทธิ เมื่อบันทึกพร้อมกันจนผ่านการตรวจล่วงหน้าทั้งคู่
+func asIdentityError(err error) *identityError {
+	var identityErr *identityError
+	if errors.As(err, &identityErr) {
+		return identityErr
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return nil
+	}
+	switch {
+	case strings.HasSuffix(pgErr.ConstraintName, "_national_id_index_unique"):
+		return errNationalIDTaken
+	case strings.HasSuffix(pgErr.ConstraintName, "_monk_certificate_index_unique"):
+		return errMonkCertificateTaken
+	}
+	return nil
+}
+
+var (
+	errNationalIDTaken      = &identityError{Field: "national_id", Message: "เลขบัตรประชาชนนี้ลงทะเบียนในระบบแล้ว", Conflict: true}
+	errMonkCertificateTaken = &identityError{Field: "monk_certificate_no", Message: "เลขใบสุทธินี้ลงทะเบียนในระบบแล้ว", Conflict: true}
+)
+
+// validNationalID - ตรวจเลขบัตรประชาชน 13 หลักด้วยหลักตรวจสอบ (mod 11)
+func validNationalID(digits string) bool {
+	if len(digits) != 13 {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 12; i++ {
+		sum += int(digits[i]-'0') * (13 - i)
+	}
+	return (11-sum%11)%10 == int(digits[12]-'0')
+}
+
+// expectedVassa - จำนวนพรรษาที่ควรได้นับจากวันอุปสมบท
+// นับหนึ่งพรรษาเมื่ออุปสมบทก่อนเข้าพรรษา (ประมาณกลางเดือนกรกฎาคม) และผ่านออกพรรษา (ประมาณกลางเดือนตุลาคม) แล้ว
+func expectedVassa(ordinationDate, now time.Time) int {
+	vassa := 0
+	for year := ordinationDate.Year(); year <= now.Year(); year++ {
+		start := time.Date(year, time.July, 15, 0, 0, 0, 0, now.Location())
+		end := time.Date(year, time.October, 15, 0, 0, 0, 0, now.Location())
+		if !ordinationDate.After(start) && !now.Before(end) {
+			vassa++
+		}
+	}
+	return vassa
+}
+
+// identityTaken - มีผู้ลงทะเบียนอื่น (ทั้งสองประเภท) ใช้ blind index นี้แล้วหรือไม่
+func identityTaken(column, index, table string, excludeID uint) bool {
+	for _, other := range []string{"registrations", "teacher_registrations"} {
+		query := database.DB.Table(other).Where("deleted_at IS NULL AND "+column+" = ?", index)
+		if other == table && excludeID != 0 {
+			query = query.Where("id <> ?", excludeID)
+		}
+		var count int64
+		query.Count(&count)
+		if count > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// identityConflict - blind index ของเลขบัตรประชาชน/เลขใบสุทธิซ้ำกับผู้ลงทะเบียนอื่นหรือไม่ (ใช้ตอนกู้คืนซึ่งมี index อยู่แล้ว)
+func identityConflict(nationalIDIndex, monkCertificateIndex, table string, excludeID uint) *identityError {
+	if nationalIDIndex != "" && identityTaken("national_id_index", nationalIDIndex, table, excludeID) {
+		return errNationalIDTaken
+	}
+	if monkCertificateIndex != "" && identityTaken("monk_certificate_index", monkCertificateIndex, table, excludeID) {
+		return errMonkCertificateTaken
+	}
+	return nil
+}
+
+// checkIdentity - ตรวจเลขบัตรประชาชน ใบสุทธิ วันอุปสมบท และพรรษา (แก้เลขให้อยู่ในรูปแบบมาตรฐานด้วย)
+// table/excludeID คือแถวที่กำลังแก้ไข เพื่อไม่ให้นับว่าซ้ำกับตัวเอง
+func checkIdentity(fields *registrationFields, table string, excludeID uint) *identityError {
+	fields.Preceptor = strings.TrimSpace(fields.Preceptor)
+	fields.MonkCertificateNo = strings.TrimSpace(fields.MonkCertificateNo)
+
+	if strings.TrimSpace(fields.NationalID) != "" {
+		fields.NationalID = fieldcrypt.NormalizeDigits(fields.NationalID)
+		if !validNationalID(fields.NationalID) {
+			return &identityError{Field: "national_id", Message: "เลขบัตรประชาชนไม่ถูกต้อง"}
+		}
+		if identityTaken("national_id_index", models.NationalIDIndex(fields.NationalID), table, excludeID) {
+			return errNationalIDTaken
+		}
+	}
+
+	if fields.MonkCertificateNo != "" {
+		if len([]rune(fields.MonkCertificateNo)) > 50 {
+			return &identityError{Field: "monk_certificate_no", Message: "เลขใบสุทธิยาวเกินไป"}
+		}
+		if identityTaken("monk_certificate_index", models.MonkCertificateIndex(fields.MonkCertificateNo), table, excludeID) {
+			return errMonkCertificateTaken
+		}
+	}
+
+	if fields.OrdinationDate != "" {
+		ordinationDate, err := time.Parse("2006-01-02", fields.OrdinationDate)
+		if err != nil {
+			return &identityError{Field: "ordination_date", Message: "รูปแบบวันอุปสมบทไม่ถูกต้อง (ใช้ YYYY-MM-DD)"}
+		}
+		now := time.Now()
+		if ordinationDate.After(now) {
+			return &identityError{Field: "ordination_date", Message: "วันอุปสมบทอยู่ในอนาคต"}
+		}
+		if birthDate, err := time.Parse("2006-01-02", fields.BirthDate); err == nil && !ordinationDate.After(birthDate) {
+			return &identityError{Field: "ordination_date", Message: "วันอุปสมบทต้องอยู่หลังวันเกิด"}
+		}
+		expected := expectedVassa(ordinationDate, now)
+		if fields.Vassa < expected-maxVassaDifference || fields.Vassa > expected+maxVassaDifference {
+			return &identityError{Field: "vassa", Message: fmt.Sprintf("พรรษาไม่สอดคล้องกับวันอุปสมบท (ควรประมาณ %d พรรษา)", expected)}
+		}
+	}
+	return nil
+}
+
+// maskIdentifier - แสดงเฉพาะ 4 ตัวท้าย เช่น "xxxxxxxxx0121"
+func maskIdentifier(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 4 {
+		return value
+	}
+	return strings.Repeat("x", len(runes)-4) + string(runes[len(runes)-4:])
+}
+
+// keepMaskedIdentifier - client ส่งค่าที่ปิดบังจากหน้ารายการกลับมา ให้ใช้ค่าเดิม
+func keepMaskedIdentifier(submitted string, current models.EncryptedString) string {
+	if submitted != "" && submitted != current.String() && submitted == maskIdentifier(current.String()) {
+		return current.String()
+	}
+	return submitted
+}
+
+// maskRegistrationIdentity - ปิดบังเลขบัตรประชาชนและเลขใบสุทธิในหน้ารายการ
+func maskRegistrationIdentity(registrations []models.Registration) {
+	for i := range registrations {
+		registrations[i].NationalID = models.EncryptedString(maskIdentifier(registrations[i].NationalID.String()))
+		registrations[i].MonkCertificateNo = models.EncryptedString(maskIdentifier(registrations[i].MonkCertificateNo.String()))
+	}
+}
+
+// maskTeacherRegistrationIdentity - ปิดบังเลขบัตรประชาชนและเลขใบสุทธิในหน้ารายการพระอาจารย์
+func maskTeacherRegistrationIdentity(registrations []models.TeacherRegistration) {
+	for i := range registrations {
+		registrations[i].NationalID = models.EncryptedString(maskIdentifier(registrations[i].NationalID.String()))
+		registrations[i].MonkCertificateNo = models.EncryptedString(maskIdentifier(registrations[i].MonkCertificateNo.String()))
+	}
+}
+
+func (req *RegistrationRequest) identityFields() registrationFields {
+	return registrationFields{
+		BirthDate:         req.BirthDate,
+		Vassa:             req.Vassa,
+		NationalID:        req.NationalID,
+		MonkCertificateNo: req.MonkCertificateNo,
+		OrdinationDate:    req.OrdinationDate,
+		Preceptor:         req.Preceptor,
+	}
+}
+
+func (req *TeacherRegistrationRequest) identityFields() registrationFields {
+	return registrationFields{
+		BirthDate:         req.BirthDate,
+		Vassa:             req.Vassa,
+		NationalID:        req.NationalID,
+		MonkCertificateNo: req.MonkCertificateNo,
+		OrdinationDate:    req.OrdinationDate,
+		Preceptor:         req.Preceptor,
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidNationalID(t *testing.T) {
+	tests := []struct {
+		name   string
+		digits string
+		want   bool
+	}{
+		{"valid", "1103702071811", true},
+		{"valid check digit 5", "3101001234565", true},
+		{"valid check digit 1", "1234567890121", true},
+		{"wrong check digit", "1103702071812", false},
+		{"too short", "110370207181", false},
+		{"too long", "11037020718110", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validNationalID(tt.digits); got != tt.want {
+				t.Errorf("validNationalID(%q) = %v, want %v", tt.digits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpectedVassa(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name      string
+		ordained  time.Time
+		now       time.Time
+		wantVassa int
+	}{
+		{"ordained before vassa, five completed", date(2020, time.June, 1), date(2024, time.November, 1), 5},
+		{"ordained during vassa misses the first year", date(2020, time.August, 1), date(2024, time.November, 1), 4},
+		{"current vassa not finished yet", date(2020, time.June, 1), date(2024, time.September, 1), 4},
+		{"ordained on the first day, counted on the last day", date(2024, time.July, 15), date(2024, time.October, 15), 1},
+		{"ordained after vassa began", date(2024, time.July, 16), date(2025, time.January, 1), 0},
+		{"ordained in the future", date(2026, time.January, 1), date(2025, time.January, 1), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expectedVassa(tt.ordained, tt.now); got != tt.wantVassa {
+				t.Errorf("expectedVassa(%s, %s) = %d, want %d", tt.ordained.Format("2006-01-02"), tt.now.Format("2006-01-02"), got, tt.wantVassa)
+			}
+		})
+	}
+}
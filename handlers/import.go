@@ -0,0 +1,902 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"registration-system/database"
+	"registration-system/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// importProgressEvery - อัพเดทความคืบหน้าทุกกี่แถว
+	importProgressEvery = 50
+	// maxImportReportRows - จำนวนแถวที่มีปัญหาสูงสุดที่เก็บในรายงาน
+	maxImportReportRows = 1000
+)
+
+// importFields - field ที่นำเข้าได้ และ field ที่จำเป็นต้องมี
+var importFields = []string{
+	"full_name", "nickname", "birth_date", "province", "district", "sub_district",
+	"address_detail", "phone_number", "temple_name", "medical_condition", "vassa",
+	"national_id", "monk_certificate_no", "ordination_date", "preceptor",
+}
+
+var requiredImportFields = []string{"full_name", "birth_date", "province", "district", "sub_district", "phone_number"}
+
+// importHeaderAliases - หัวคอลัมน์ที่พบบ่อย (Google Forms / Excel ที่พิมพ์จากใบสมัคร) -> field
+var importHeaderAliases = map[string]string{
+	"ชื่อ":               "full_name",
+	"ชื่อ-สกุล":          "full_name",
+	"ชื่อ นามสกุล":       "full_name",
+	"ชื่อและนามสกุล":     "full_name",
+	"ชื่อเล่น":           "nickname",
+	"ฉายา":               "nickname",
+	"วันเกิด":            "birth_date",
+	"วันเดือนปีเกิด":     "birth_date",
+	"อำเภอ/เขต":          "district",
+	"เขต":                "district",
+	"ตำบล/แขวง":          "sub_district",
+	"แขวง":               "sub_district",
+	"บ้านเลขที่":         "address_detail",
+	"เบอร์โทรศัพท์":      "phone_number",
+	"โทรศัพท์":           "phone_number",
+	"หมายเลขโทรศัพท์":    "phone_number",
+	"สังกัดวัด":          "temple_name",
+	"โรคประจำตัว/ยา":     "medical_condition",
+	"ข้อมูลสุขภาพ":       "medical_condition",
+	"จำนวนพรรษา":         "vassa",
+	"เลขบัตรประชาชน":     "national_id",
+	"เลขประจำตัวประชาชน": "national_id",
+	"เลขใบสุทธิ":         "monk_certificate_no",
+	"ใบสุทธิ":            "monk_certificate_no",
+	"วันอุปสมบท":         "ordination_date",
+	"วันบวช":             "ordination_date",
+	"พระอุปัชฌาย์":       "preceptor",
+	"อุปัชฌาย์":          "preceptor",
+}
+
+// ImportRowReport - ผลตรวจสอบของแถวที่มีปัญหา
+type ImportRowReport struct {
+	Row      int      `json:"row"` // เลขแถวในไฟล์ (รวมหัวตาราง)
+	FullName string   `json:"full_name"`
+	Errors   []string `json:"errors"`
+}
+
+// ImportTemplateRequest - Request body สำหรับบันทึก mapping template
+type ImportTemplateRequest struct {
+	Name    string            `json:"name"`
+	Target  string            `json:"target"`
+	Mapping map[string]string `json:"mapping"`
+}
+
+func isImportField(field string) bool {
+	for _, f := range importFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func isImportTarget(target string) bool {
+	return target == "registration" || target == "teacher-registration"
+}
+
+// validateImportMapping - ตรวจว่า mapping ชี้ไปยัง field ที่รู้จัก
+func validateImportMapping(mapping map[string]string) error {
+	for header, field := range mapping {
+		if field != "" && !isImportField(field) {
+			return fmt.Errorf("คอลัมน์ '%s' จับคู่กับ field '%s' ที่ไม่รู้จัก", header, field)
+		}
+	}
+	return nil
+}
+
+// autoImportMapping - จับคู่หัวคอลัมน์กับ field อัตโนมัติจากชื่อ field, หัวคอลัมน์ของไฟล์ส่งออก และชื่อที่พบบ่อย
+func autoImportMapping(headers []string) map[string]string {
+	aliases := map[string]string{}
+	for alias, field := range importHeaderAliases {
+		aliases[alias] = field
+	}
+	for _, column := range exportColumns {
+		if isImportField(column.Key) {
+			aliases[column.Header] = column.Key
+		}
+	}
+
+	mapping := map[string]string{}
+	for _, header := range headers {
+		key := strings.TrimSpace(header)
+		if isImportField(strings.ToLower(key)) {
+			mapping[header] = strings.ToLower(key)
+		} else if field, ok := aliases[key]; ok {
+			mapping[header] = field
+		}
+	}
+	return mapping
+}
+
+// readImportFile - อ่านหัวตารางและแถวข้อมูลจากไฟล์ CSV หรือ XLSX (sheet แรก)
+func readImportFile(fileName string, data []byte) ([]string, [][]string, error) {
+	var rows [][]string
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, nil, fmt.Errorf("อ่านไฟล์ CSV ไม่ได้: %v", err)
+		}
+		rows = records
+	case ".xlsx":
+		file, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("อ่านไฟล์ XLSX ไม่ได้: %v", err)
+		}
+		defer file.Close()
+		rows, err = file.GetRows(file.GetSheetName(0))
+		if err != nil {
+			return nil, nil, fmt.Errorf("อ่านไฟล์ XLSX ไม่ได้: %v", err)
+		}
+	default:
+		return nil, nil, fmt.Errorf("รองรับเฉพาะไฟล์ .csv และ .xlsx")
+	}
+
+	if len(rows) == 0 {
+		return nil, nil, fmt.Errorf("ไฟล์ไม่มีข้อมูล")
+	}
+	return rows[0], rows[1:], nil
+}
+
+// parseImportDate - อ่านวันเกิดหลายรูปแบบ (รองรับปี พ.ศ. และวันที่แบบตัวเลขของ Excel)
+func parseImportDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if serial, err := strconv.ParseFloat(value, 64); err == nil && serial > 0 && serial < 100000 {
+		return excelize.ExcelDateToTime(serial, false)
+	}
+
+	for _, format := range []string{"2006-01-02", "2/1/2006", "2-1-2006", "2006/1/2", "2.1.2006"} {
+		if date, err := time.Parse(format, value); err == nil {
+			if date.Year() > 2400 {
+				date = date.AddDate(-543, 0, 0)
+			}
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("รูปแบบวันเกิดไม่ถูกต้อง '%s' (ใช้ YYYY-MM-DD หรือ วว/ดด/ปปปป)", value)
+}
+
+// placeCandidate - ชื่อสถานที่สำหรับจับคู่แบบ fuzzy
+type placeCandidate struct {
+	ID    uint
+	Name  string
+	Names []string // ชื่อที่ normalize แล้ว (ไทยและอังกฤษ)
+}
+
+// addressResolver - แปลงชื่อจังหวัด/อำเภอ/ตำบลที่พิมพ์เองเป็น id
+type addressResolver struct {
+	provinces    []placeCandidate
+	districts    map[uint][]placeCandidate // province_id -> districts
+	subDistricts map[uint][]placeCandidate // district_id -> sub-districts
+}
+
+var placeNamePrefixes = []string{"จังหวัด", "จ.", "กิ่งอำเภอ", "อำเภอ", "อ.", "เขต", "ตำบล", "ต.", "แขวง", "changwat", "amphoe", "khet", "tambon", "khwaeng"}
+
+var placeNameAliases = map[string]string{
+	"กทม":     "กรุงเทพมหานคร",
+	"กทม.":    "กรุงเทพมหานคร",
+	"กรุงเทพ": "กรุงเทพมหานคร",
+	"bangkok": "กรุงเทพมหานคร",
+	"bkk":     "กรุงเทพมหานคร",
+}
+
+func normalizePlaceName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := placeNameAliases[strings.ReplaceAll(name, " ", "")]; ok {
+		name = alias
+	}
+	for _, prefix := range placeNamePrefixes {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			name = strings.TrimPrefix(name, prefix)
+			break
+		}
+	}
+	return strings.Join(strings.Fields(name), "")
+}
+
+// levenshtein - ระยะห่างระหว่างสองคำ (นับเป็นตัวอักษร)
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current := make([]int, len(rb)+1)
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(rb)]
+}
+
+// matchPlace - หาชื่อที่ตรงที่สุด (ตรงทุกตัวก่อน แล้วจึงยอมให้สะกดผิดได้ประมาณ 1 ใน 4 ของความยาว)
+func matchPlace(candidates []placeCandidate, input, label string) (uint, error) {
+	name := normalizePlaceName(input)
+	if name == "" {
+		return 0, fmt.Errorf("ไม่ได้ระบุ%s", label)
+	}
+
+	best, bestDistance := []placeCandidate{}, -1
+	for _, candidate := range candidates {
+		for _, candidateName := range candidate.Names {
+			distance := levenshtein(name, candidateName)
+			if distance == 0 {
+				return candidate.ID, nil
+			}
+			if bestDistance == -1 || distance < bestDistance {
+				best, bestDistance = []placeCandidate{candidate}, distance
+			} else if distance == bestDistance && best[len(best)-1].ID != candidate.ID {
+				best = append(best, candidate)
+			}
+		}
+	}
+
+	threshold := max(1, utf8.RuneCountInString(name)/4)
+	if bestDistance == -1 || bestDistance > threshold {
+		return 0, fmt.Errorf("ไม่พบ%s '%s'", label, input)
+	}
+	if len(best) > 1 {
+		names := make([]string, len(best))
+		for i, candidate := range best {
+			names[i] = candidate.Name
+		}
+		return 0, fmt.Errorf("%s '%s' ใกล้เคียงหลายรายการ (%s)", label, input, strings.Join(names, ", "))
+	}
+	return best[0].ID, nil
+}
+
+func newAddressResolver() (*addressResolver, error) {
+	var provinces []models.Province
+	var districts []models.District
+	var subDistricts []models.SubDistrict
+	if err := database.DB.Find(&provinces).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Find(&districts).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Find(&subDistricts).Error; err != nil {
+		return nil, err
+	}
+
+	candidate := func(id uint, nameTh, nameEn string) placeCandidate {
+		return placeCandidate{ID: id, Name: nameTh, Names: []string{normalizePlaceName(nameTh), normalizePlaceName(nameEn)}}
+	}
+	resolver := &addressResolver{districts: map[uint][]placeCandidate{}, subDistricts: map[uint][]placeCandidate{}}
+	for _, p := range provinces {
+		resolver.provinces = append(resolver.provinces, candidate(p.ID, p.NameTh, p.NameEn))
+	}
+	for _, d := range districts {
+		resolver.districts[d.ProvinceID] = append(resolver.districts[d.ProvinceID], candidate(d.ID, d.NameTh, d.NameEn))
+	}
+	for _, s := range subDistricts {
+		resolver.subDistricts[s.DistrictID] = append(resolver.subDistricts[s.DistrictID], candidate(s.ID, s.NameTh, s.NameEn))
+	}
+	return resolver, nil
+}
+
+// resolve - แปลงชื่อที่อยู่เป็น id ตามลำดับ จังหวัด > อำเภอ > ตำบล
+func (r *addressResolver) resolve(province, district, subDistrict string) (uint, uint, uint, error) {
+	provinceID, err := matchPlace(r.provinces, province, "จังหวัด")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	districtID, err := matchPlace(r.districts[provinceID], district, "อำเภอ")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	subDistrictID, err := matchPlace(r.subDistricts[districtID], subDistrict, "ตำบล")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return provinceID, districtID, subDistrictID, nil
+}
+
+// importValidator - ตรวจสอบแถวข้อมูลและจำเบอร์โทร/เลขบัตรประชาชน/เลขใบสุทธิที่พบแล้วในไฟล์
+type importValidator struct {
+	resolver   *addressResolver
+	phones     map[string]int // blind index -> แถวแรกที่พบ
+	identities map[string]int // blind index ของเลขบัตรประชาชนและเลขใบสุทธิ -> แถวแรกที่พบ
+}
+
+// validate - แปลงแถวเป็นข้อมูลการลงทะเบียน คืนรายการ error ของแถว
+func (v *importValidator) validate(rowNumber int, values map[string]string) (registrationFields, []string) {
+	var fields registrationFields
+	var errs []string
+
+	for _, field := range requiredImportFields {
+		if values[field] == "" {
+			errs = append(errs, fmt.Sprintf("ไม่ได้ระบุ %s", field))
+		}
+	}
+
+	fields.FullName = values["full_name"]
+	fields.Nickname = values["nickname"]
+	fields.AddressDetail = values["address_detail"]
+	fields.PhoneNumber = values["phone_number"]
+	fields.TempleID, fields.TempleName, _ = resolveTemple(nil, values["temple_name"])
+	fields.MedicalCondition = values["medical_condition"]
+	fields.NationalID = values["national_id"]
+	fields.MonkCertificateNo = values["monk_certificate_no"]
+	fields.Preceptor = values["preceptor"]
+
+	if values["birth_date"] != "" {
+		if birthDate, err := parseImportDate(values["birth_date"]); err != nil {
+			errs = append(errs, err.Error())
+		} else if birthDate.After(time.Now()) {
+			errs = append(errs, "วันเกิดอยู่ในอนาคต")
+		} else {
+			fields.BirthDate = birthDate.Format("2006-01-02")
+		}
+	}
+
+	if values["vassa"] != "" {
+		vassa, err := strconv.Atoi(values["vassa"])
+		if err != nil || vassa < 0 {
+			errs = append(errs, fmt.Sprintf("พรรษาไม่ถูกต้อง '%s'", values["vassa"]))
+		}
+		fields.Vassa = vassa
+	}
+
+	if values["province"] != "" && values["district"] != "" && values["sub_district"] != "" {
+		provinceID, districtID, subDistrictID, err := v.resolver.resolve(values["province"], values["district"], values["sub_district"])
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		fields.ProvinceID, fields.DistrictID, fields.SubDistrictID = provinceID, districtID, subDistrictID
+	}
+
+	if fields.PhoneNumber != "" {
+		index := models.PhoneIndex(fields.PhoneNumber)
+		if firstRow, ok := v.phones[index]; ok {
+			errs = append(errs, fmt.Sprintf("เบอร์โทรซ้ำกับแถวที่ %d", firstRow))
+		} else {
+			v.phones[index] = rowNumber
+			var count, teacherCount int64
+			database.DB.Model(&models.Registration{}).Where("phone_number_index = ?", index).Count(&count)
+			database.DB.Model(&models.TeacherRegistration{}).Where("phone_number_index = ?", index).Count(&teacherCount)
+			if count+teacherCount > 0 {
+				errs = append(errs, "เบอร์โทรนี้ลงทะเบียนในระบบแล้ว")
+			}
+		}
+	}
+
+	if values["ordination_date"] != "" {
+		if ordinationDate, err := parseImportDate(values["ordination_date"]); err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			fields.OrdinationDate = ordinationDate.Format("2006-01-02")
+		}
+	}
+	if identityErr := checkIdentity(&fields, "", 0); identityErr != nil {
+		errs = append(errs, identityErr.Message)
+	}
+	for _, index := range []string{models.NationalIDIndex(fields.NationalID), models.MonkCertificateIndex(fields.MonkCertificateNo)} {
+		if index == "" {
+			continue
+		}
+		if firstRow, ok := v.identities[index]; ok {
+			errs = append(errs, fmt.Sprintf("เลขบัตรประชาชน/เลขใบสุทธิซ้ำกับแถวที่ %d", firstRow))
+		} else {
+			v.identities[index] = rowNumber
+		}
+	}
+
+	return fields, errs
+}
+
+// loadImportRows - อ่านไฟล์ของงานนำเข้าและแปลงแต่ละแถวตาม mapping
+func loadImportRows(job *models.ImportJob) ([]map[string]string, error) {
+	data, err := base64.StdEncoding.DecodeString(job.File.String())
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("ไม่พบไฟล์ของงานนำเข้า")
+	}
+	headers, rows, err := readImportFile(job.FileName, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []map[string]string
+	for _, row := range rows {
+		values := map[string]string{}
+		empty := true
+		for i, header := range headers {
+			field := job.Mapping[header]
+			if field == "" || i >= len(row) {
+				continue
+			}
+			value := strings.TrimSpace(row[i])
+			if value != "" {
+				empty = false
+			}
+			values[field] = value
+		}
+		// ข้ามแถวว่าง (Excel มักมีแถวว่างท้ายไฟล์)
+		if empty {
+			continue
+		}
+		result = append(result, values)
+	}
+	return result, nil
+}
+
+func updateImportJob(jobID uint, columns map[string]interface{}) {
+	if err := database.DB.Model(&models.ImportJob{}).Where("id = ?", jobID).UpdateColumns(columns).Error; err != nil {
+		log.Printf("Error updating import job %d: %v", jobID, err)
+	}
+}
+
+// failImportJob - งานที่ล้มเหลวนำเข้าต่อไม่ได้ จึงลบไฟล์ต้นฉบับทิ้งทันที (ต้องอัปโหลดใหม่)
+func failImportJob(jobID uint, message string) {
+	now := time.Now()
+	updateImportJob(jobID, map[string]interface{}{
+		"status":      "failed",
+		"message":     message,
+		"file":        models.EncryptedString(""),
+		"finished_at": &now,
+	})
+}
+
+// RecoverImportJobs - จัดการงานที่ค้างจากการรีสตาร์ทระหว่างทำงาน (เรียกตอนเริ่มระบบ)
+// งานที่กำลังตรวจสอบเริ่มตรวจใหม่ ส่วนงานที่กำลังนำเข้าไม่รู้ว่า transaction บันทึกไปแล้วหรือยัง จึงให้ล้มเหลว
+func RecoverImportJobs() {
+	var validating []uint
+	if err := database.DB.Model(&models.ImportJob{}).Where("status = ?", "validating").Pluck("id", &validating).Error; err != nil {
+		log.Printf("Error loading interrupted import jobs: %v", err)
+		return
+	}
+	for _, jobID := range validating {
+		updateImportJob(jobID, map[string]interface{}{"processed_rows": 0})
+		go runImportValidation(jobID)
+	}
+
+	var importing []uint
+	database.DB.Model(&models.ImportJob{}).Where("status = ?", "importing").Pluck("id", &importing)
+	for _, jobID := range importing {
+		failImportJob(jobID, "ระบบเริ่มทำงานใหม่ระหว่างนำเข้า กรุณาตรวจสอบรายการลงทะเบียนก่อนอัปโหลดไฟล์อีกครั้ง")
+	}
+
+	if len(validating)+len(importing) > 0 {
+		log.Printf("Recovered import jobs: %d revalidating, %d failed", len(validating), len(importing))
+	}
+}
+
+// validateImportRows - ตรวจทุกแถว คืนข้อมูลที่ผ่านการตรวจ (ตาม index ของแถว) และรายงานแถวที่มีปัญหา
+func validateImportRows(job *models.ImportJob, rows []map[string]string, progressOffset int) (map[int]registrationFields, []ImportRowReport, error) {
+	resolver, err := newAddressResolver()
+	if err != nil {
+		return nil, nil, err
+	}
+	validator := &importValidator{resolver: resolver, phones: map[string]int{}, identities: map[string]int{}}
+
+	valid := map[int]registrationFields{}
+	var report []ImportRowReport
+	for i, values := range rows {
+		rowNumber := i + 2 // แถวที่ 1 เป็นหัวตาราง
+		fields, errs := validator.validate(rowNumber, values)
+		if len(errs) == 0 {
+			valid[i] = fields
+		} else if len(report) < maxImportReportRows {
+			report = append(report, ImportRowReport{Row: rowNumber, FullName: values["full_name"], Errors: errs})
+		}
+		if (i+1)%importProgressEvery == 0 {
+			updateImportJob(job.ID, map[string]interface{}{"processed_rows": progressOffset + i + 1})
+		}
+	}
+	return valid, report, nil
+}
+
+// runImportValidation - ตรวจสอบไฟล์แบบ dry run (ทำงานเบื้องหลัง)
+func runImportValidation(jobID uint) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Import job %d panicked: %v", jobID, r)
+			failImportJob(jobID, "เกิดข้อผิดพลาดระหว่างตรวจสอบไฟล์")
+		}
+	}()
+
+	var job models.ImportJob
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		return
+	}
+	rows, err := loadImportRows(&job)
+	if err != nil {
+		failImportJob(jobID, err.Error())
+		return
+	}
+	updateImportJob(jobID, map[string]interface{}{"total_rows": len(rows)})
+
+	valid, report, err := validateImportRows(&job, rows, 0)
+	if err != nil {
+		failImportJob(jobID, "ไม่สามารถตรวจสอบข้อมูลได้")
+		return
+	}
+
+	reportJSON, _ := json.Marshal(report)
+	now := time.Now()
+	updateImportJob(jobID, map[string]interface{}{
+		"status":         "validated",
+		"processed_rows": len(rows),
+		"valid_rows":     len(valid),
+		"error_rows":     len(rows) - len(valid),
+		"report":         models.EncryptedString(reportJSON),
+		"finished_at":    &now,
+	})
+}
+
+// runImportCommit - ตรวจสอบซ้ำแล้วบันทึกแถวที่ผ่านทั้งหมดใน transaction เดียว (ทำงานเบื้องหลัง)
+func runImportCommit(jobID uint, skipInvalid bool, userID uint) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Import job %d panicked: %v", jobID, r)
+			failImportJob(jobID, "เกิดข้อผิดพลาดระหว่างนำเข้าข้อมูล")
+		}
+	}()
+
+	var job models.ImportJob
+	if err := database.DB.First(&job, jobID).Error; err != nil {
+		return
+	}
+	rows, err := loadImportRows(&job)
+	if err != nil {
+		failImportJob(jobID, err.Error())
+		return
+	}
+
+	// ข้อมูลในระบบอาจเปลี่ยนไปหลัง dry run จึงตรวจสอบอีกครั้ง (ความคืบหน้า: ครึ่งแรกตรวจ ครึ่งหลังบันทึก)
+	updateImportJob(jobID, map[string]interface{}{"total_rows": len(rows) * 2, "processed_rows": 0})
+	valid, report, err := validateImportRows(&job, rows, 0)
+	if err != nil {
+		failImportJob(jobID, "ไม่สามารถตรวจสอบข้อมูลได้")
+		return
+	}
+	reportJSON, _ := json.Marshal(report)
+	if len(valid) < len(rows) && !skipInvalid {
+		now := time.Now()
+		updateImportJob(jobID, map[string]interface{}{
+			"status":      "validated",
+			"valid_rows":  len(valid),
+			"error_rows":  len(rows) - len(valid),
+			"report":      models.EncryptedString(reportJSON),
+			"message":     "ข้อมูลเปลี่ยนไปหลังการตรวจสอบ พบแถวที่ไม่ผ่าน กรุณาตรวจสอบรายงานอีกครั้ง",
+			"finished_at": &now,
+		})
+		return
+	}
+
+	indexes := make([]int, 0, len(valid))
+	for i := range valid {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	err = eventTransaction(func(tx *gorm.DB) error {
+		for n, i := range indexes {
+			fields := valid[i]
+			if job.Target == "teacher-registration" {
+				var registration models.TeacherRegistration
+				fields.applyTeacher(&registration)
+				if err := tx.Create(&registration).Error; err != nil {
+					return err
+				}
+				after := teacherRegistrationFieldsOf(&registration)
+				if err := recordVersion(tx, "teacher-registration", registration.ID, "create", nil, &after, &userID); err != nil {
+					return err
+				}
+			} else {
+				var registration models.Registration
+				fields.apply(&registration)
+				if err := tx.Create(&registration).Error; err != nil {
+					return err
+				}
+				after := registrationFieldsOf(&registration)
+				if err := recordVersion(tx, "registration", registration.ID, "create", nil, &after, &userID); err != nil {
+					return err
+				}
+			}
+			if (n+1)%importProgressEvery == 0 {
+				updateImportJob(jobID, map[string]interface{}{"processed_rows": len(rows) + n + 1})
+			}
+		}
+
+		return tx.Create(&models.ActivityLog{
+			Action:      "นำเข้าข้อมูลการลงทะเบียน",
+			Description: fmt.Sprintf("นำเข้า %d รายการจากไฟล์ %s (ข้าม %d รายการ)", len(indexes), job.FileName, len(rows)-len(indexes)),
+			Module:      job.Target,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Error committing import job %d: %v", jobID, err)
+		if identityErr := asIdentityError(err); identityErr != nil {
+			failImportJob(jobID, identityErr.Message+" (ลงทะเบียนพร้อมกันระหว่างนำเข้า) ไม่มีข้อมูลใดถูกนำเข้า")
+			return
+		}
+		failImportJob(jobID, "ไม่สามารถบันทึกข้อมูลได้ ไม่มีข้อมูลใดถูกนำเข้า")
+		return
+	}
+
+	now := time.Now()
+	updateImportJob(jobID, map[string]interface{}{
+		"status":         "completed",
+		"processed_rows": len(rows) * 2,
+		"imported_rows":  len(indexes),
+		"report":         models.EncryptedString(reportJSON),
+		"file":           models.EncryptedString(""), // ไม่เก็บไฟล์ต้นฉบับหลังนำเข้าเสร็จ
+		"message":        "",
+		"finished_at":    &now,
+	})
+}
+
+// GetImportTemplates - รายการ mapping template
+func GetImportTemplates(c *fiber.Ctx) error {
+	var templates []models.ImportMappingTemplate
+	if err := database.DB.Order("name").Find(&templates).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	return c.JSON(templates)
+}
+
+// CreateImportTemplate - บันทึก mapping template
+func CreateImportTemplate(c *fiber.Ctx) error {
+	var req ImportTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+	if strings.TrimSpace(req.Name) == "" || len(req.Mapping) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณาระบุชื่อและการจับคู่คอลัมน์",
+		})
+	}
+	if req.Target == "" {
+		req.Target = "registration"
+	}
+	if !isImportTarget(req.Target) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "target ต้องเป็น 'registration' หรือ 'teacher-registration'",
+		})
+	}
+	if err := validateImportMapping(req.Mapping); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	template := models.ImportMappingTemplate{
+		Name:    strings.TrimSpace(req.Name),
+		Target:  req.Target,
+		Mapping: models.StringMap(req.Mapping),
+	}
+	if err := database.DB.Create(&template).Error; err != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "มี template ชื่อนี้แล้ว",
+		})
+	}
+	return c.Status(201).JSON(template)
+}
+
+// DeleteImportTemplate - ลบ mapping template
+func DeleteImportTemplate(c *fiber.Ctx) error {
+	result := database.DB.Delete(&models.ImportMappingTemplate{}, c.Params("id"))
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบ template",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบ template สำเร็จ",
+	})
+}
+
+// CreateImportJob - อัพโหลดไฟล์และเริ่มตรวจสอบแบบ dry run
+// form fields: file, target, template_id หรือ mapping (JSON) ถ้าไม่ระบุจะจับคู่คอลัมน์อัตโนมัติ
+func CreateImportJob(c *fiber.Ctx) error {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณาแนบไฟล์ CSV หรือ XLSX",
+		})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่สามารถอ่านไฟล์ได้",
+		})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่สามารถอ่านไฟล์ได้",
+		})
+	}
+
+	headers, _, err := readImportFile(fileHeader.Filename, data)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	target := c.FormValue("target", "registration")
+	var mapping map[string]string
+	if templateID := c.FormValue("template_id"); templateID != "" {
+		var template models.ImportMappingTemplate
+		if err := database.DB.First(&template, templateID).Error; err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "ไม่พบ template",
+			})
+		}
+		mapping = template.Mapping
+		target = template.Target
+	} else if raw := c.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "mapping ต้องเป็น JSON object ของ หัวคอลัมน์ -> field",
+			})
+		}
+	} else {
+		mapping = autoImportMapping(headers)
+	}
+
+	if !isImportTarget(target) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "target ต้องเป็น 'registration' หรือ 'teacher-registration'",
+		})
+	}
+	if err := validateImportMapping(mapping); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// ต้องจับคู่ field ที่จำเป็นครบ
+	mapped := map[string]bool{}
+	for _, header := range headers {
+		mapped[mapping[header]] = true
+	}
+	var missing []string
+	for _, field := range requiredImportFields {
+		if !mapped[field] {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return c.Status(422).JSON(fiber.Map{
+			"error":   "ไม่พบคอลัมน์สำหรับ field ที่จำเป็น: " + strings.Join(missing, ", "),
+			"headers": headers,
+			"mapping": mapping,
+		})
+	}
+
+	job := models.ImportJob{
+		Target:   target,
+		FileName: fileHeader.Filename,
+		Mapping:  models.StringMap(mapping),
+		Status:   "validating",
+		File:     models.EncryptedString(base64.StdEncoding.EncodeToString(data)),
+		UserID:   c.Locals("userID").(uint),
+	}
+	if err := database.DB.Create(&job).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถสร้างงานนำเข้าได้",
+		})
+	}
+
+	go runImportValidation(job.ID)
+
+	return c.Status(202).JSON(job)
+}
+
+// GetImportJobs - รายการงานนำเข้าล่าสุด
+func GetImportJobs(c *fiber.Ctx) error {
+	var jobs []models.ImportJob
+	if err := database.DB.Preload("User").Order("created_at DESC").Limit(50).Find(&jobs).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	return c.JSON(jobs)
+}
+
+// GetImportJob - ความคืบหน้าและรายงานผลตรวจสอบรายแถว (ใช้ poll ระหว่างทำงาน)
+func GetImportJob(c *fiber.Ctx) error {
+	var job models.ImportJob
+	if err := database.DB.Preload("User").First(&job, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบงานนำเข้า",
+		})
+	}
+
+	report := []ImportRowReport{}
+	if job.Report != "" {
+		json.Unmarshal([]byte(job.Report), &report)
+	}
+	progress := 0
+	if job.TotalRows > 0 {
+		progress = job.ProcessedRows * 100 / job.TotalRows
+	}
+	if job.Status == "validated" || job.Status == "completed" {
+		progress = 100
+	}
+
+	return c.JSON(fiber.Map{
+		"job":      job,
+		"progress": progress,
+		"report":   report,
+	})
+}
+
+// CommitImportJob - บันทึกข้อมูลจริงหลัง dry run (?skip_invalid=true เพื่อข้ามแถวที่ไม่ผ่าน)
+func CommitImportJob(c *fiber.Ctx) error {
+	var job models.ImportJob
+	if err := database.DB.First(&job, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบงานนำเข้า",
+		})
+	}
+
+	skipInvalid := c.Query("skip_invalid") == "true"
+	if job.Status != "validated" {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "นำเข้าได้เฉพาะงานที่ตรวจสอบเสร็จแล้ว (สถานะปัจจุบัน: " + job.Status + ")",
+		})
+	}
+	if job.ErrorRows > 0 && !skipInvalid {
+		return c.Status(409).JSON(fiber.Map{
+			"error": fmt.Sprintf("มี %d แถวที่ไม่ผ่านการตรวจสอบ แก้ไขไฟล์หรือใช้ ?skip_invalid=true", job.ErrorRows),
+		})
+	}
+
+	// เปลี่ยนสถานะแบบมีเงื่อนไข ป้องกันการกดนำเข้าซ้ำพร้อมกัน
+	result := database.DB.Model(&models.ImportJob{}).Where("id = ? AND status = ?", job.ID, "validated").
+		UpdateColumns(map[string]interface{}{"status": "importing", "message": "", "finished_at": nil})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "งานนี้กำลังนำเข้าอยู่แล้ว",
+		})
+	}
+
+	go runImportCommit(job.ID, skipInvalid, c.Locals("userID").(uint))
+
+	job.Status = "importing"
+	return c.Status(202).JSON(job)
+}
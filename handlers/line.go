@@ -0,0 +1,428 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"registration-system/database"
+	"registration-system/models"
+	"registration-system/notify"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	maxLineLinksPerUser  = 30               // เลขานุการวัดอาจผูกแทนหลายรูป
+	maxLineLinkFailures  = 5                // ผูกไม่สำเร็จเกินจำนวนนี้ต่อชั่วโมง ต้องรอก่อน (กันการเดารหัส)
+	lineLinkFailureReset = time.Hour        // ช่วงเวลานับจำนวนครั้งที่ผูกไม่สำเร็จ
+	lineReplyTimeout     = 10 * time.Second // LINE รอ webhook ไม่นาน
+)
+
+// lineReferencePattern - รหัสอ้างอิงจาก registrationReference เช่น "R-000123", "t45"
+var lineReferencePattern = regexp.MustCompile(`^([RrTt])-?0*([0-9]+)$`)
+
+// lineCommands - คำสั่งที่ bot รู้จัก (คำภาษาอังกฤษตอบเป็นภาษาอังกฤษ)
+var lineCommands = map[string]struct{ command, locale string }{
+	"ผูก":       {"link", "th"},
+	"link":      {"link", "en"},
+	"สถานะ":     {"status", "th"},
+	"status":    {"status", "en"},
+	"ยกเลิก":    {"unlink", "th"},
+	"unlink":    {"unlink", "en"},
+	"วิธีใช้":   {"help", "th"},
+	"ช่วยเหลือ": {"help", "th"},
+	"help":      {"help", "en"},
+}
+
+// lineMessages - ข้อความตอบกลับของ bot แยกตามภาษา
+var lineMessages = map[string]map[string]string{
+	"th": {
+		"help": "พิมพ์คำสั่งต่อไปนี้\n" +
+			"• ผูก <รหัสอ้างอิง> <เบอร์โทร> เช่น ผูก R-000123 0812345678 เพื่อรับการแจ้งเตือนทาง LINE\n" +
+			"• สถานะ เพื่อดูสถานะการลงทะเบียนและการสวด\n" +
+			"• ยกเลิก เพื่อยกเลิกการผูกทั้งหมด",
+		"link_usage":     "กรุณาพิมพ์ ผูก <รหัสอ้างอิง> <เบอร์โทร> เช่น ผูก R-000123 0812345678",
+		"link_not_found": "ไม่พบการลงทะเบียนที่ตรงกับรหัสอ้างอิงและเบอร์โทรนี้",
+		"link_throttled": "ผูกไม่สำเร็จหลายครั้งเกินไป กรุณาลองใหม่ภายหลัง",
+		"link_too_many":  "บัญชีนี้ผูกการลงทะเบียนครบจำนวนสูงสุดแล้ว",
+		"link_exists":    "บัญชีนี้ผูกกับการลงทะเบียนของ %s แล้ว",
+		"link_ok":        "ผูกกับการลงทะเบียนของ %s (%s) เรียบร้อยแล้ว จะได้รับการแจ้งเตือนทาง LINE",
+		"not_linked":     "บัญชีนี้ยังไม่ได้ผูกกับการลงทะเบียน พิมพ์ ผูก <รหัสอ้างอิง> <เบอร์โทร>",
+		"unlinked":       "ยกเลิกการผูก %d รายการแล้ว",
+		"error":          "ระบบขัดข้อง กรุณาลองใหม่ภายหลัง",
+		"status_teacher": "%s (%s)\nลงทะเบียนพระอาจารย์แล้ว",
+		"status_member":  "%s (%s)\nปริวาส: %s\nมานัต: %s\nออกอาพาน: %s",
+		"done":           "สวดแล้ว",
+		"pending":        "ยังไม่ได้สวด",
+	},
+	"en": {
+		"help": "Available commands\n" +
+			"• link <reference> <phone>, e.g. link R-000123 0812345678, to receive notifications on LINE\n" +
+			"• status to see your registration and chanting progress\n" +
+			"• unlink to remove all links",
+		"link_usage":     "Please type link <reference> <phone>, e.g. link R-000123 0812345678",
+		"link_not_found": "No registration matches this reference code and phone number.",
+		"link_throttled": "Too many failed attempts, please try again later.",
+		"link_too_many":  "This account has reached the maximum number of linked registrations.",
+		"link_exists":    "This account is already linked to the registration of %s.",
+		"link_ok":        "Linked to the registration of %s (%s). You will receive notifications on LINE.",
+		"not_linked":     "This account is not linked to any registration yet. Type link <reference> <phone>.",
+		"unlinked":       "Removed %d link(s).",
+		"error":          "Something went wrong, please try again later.",
+		"status_teacher": "%s (%s)\nRegistered as a teacher.",
+		"status_member":  "%s (%s)\nParivasa: %s\nManatta: %s\nAbbhana: %s",
+		"done":           "completed",
+		"pending":        "not yet",
+	},
+}
+
+// lineEvent - webhook event ของ LINE (เฉพาะ field ที่ใช้)
+type lineEvent struct {
+	Type       string `json:"type"` // "message", "follow" or "unfollow"
+	ReplyToken string `json:"replyToken"`
+	Source     struct {
+		Type   string `json:"type"`
+		UserID string `json:"userId"`
+	} `json:"source"`
+	Message struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// lineLinkFailures - จำนวนครั้งที่ผูกไม่สำเร็จต่อ LINE user (เก็บในหน่วยความจำ)
+var lineLinkFailures = struct {
+	sync.Mutex
+	attempts map[string][]time.Time
+}{attempts: map[string][]time.Time{}}
+
+// lineLinkThrottled - ผูกไม่สำเร็จครบจำนวนในชั่วโมงที่ผ่านมาแล้วหรือไม่
+func lineLinkThrottled(lineUserID string) bool {
+	lineLinkFailures.Lock()
+	defer lineLinkFailures.Unlock()
+	cutoff := time.Now().Add(-lineLinkFailureReset)
+	recent := lineLinkFailures.attempts[lineUserID][:0]
+	for _, at := range lineLinkFailures.attempts[lineUserID] {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	if len(recent) == 0 {
+		delete(lineLinkFailures.attempts, lineUserID)
+		return false
+	}
+	lineLinkFailures.attempts[lineUserID] = recent
+	return len(recent) >= maxLineLinkFailures
+}
+
+func recordLineLinkFailure(lineUserID string) {
+	lineLinkFailures.Lock()
+	defer lineLinkFailures.Unlock()
+	lineLinkFailures.attempts[lineUserID] = append(lineLinkFailures.attempts[lineUserID], time.Now())
+}
+
+// validLineSignature - ตรวจ X-Line-Signature (base64 ของ HMAC-SHA256 ของ body ด้วย channel secret)
+func validLineSignature(secret string, body []byte, signature string) bool {
+	given, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), given)
+}
+
+// LineWebhook - รับ webhook จาก LINE Messaging API (ตั้ง LINE_CHANNEL_SECRET)
+func LineWebhook(c *fiber.Ctx) error {
+	secret := os.Getenv("LINE_CHANNEL_SECRET")
+	if secret == "" {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "ยังไม่ได้ตั้งค่า LINE",
+		})
+	}
+	if !validLineSignature(secret, c.Body(), c.Get("X-Line-Signature")) {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "ลายเซ็นไม่ถูกต้อง",
+		})
+	}
+
+	var payload struct {
+		Events []lineEvent `json:"events"`
+	}
+	if err := json.Unmarshal(c.Body(), &payload); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	for _, event := range payload.Events {
+		// ตอบเฉพาะแชทส่วนตัว ไม่ตอบในกลุ่ม
+		if event.Source.Type != "user" || event.Source.UserID == "" {
+			continue
+		}
+		if reply := handleLineEvent(&event); reply != "" && event.ReplyToken != "" {
+			replyLine(event.ReplyToken, event.Source.UserID, reply)
+		}
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// replyLine - ตอบด้วย reply token (ถ้าช่องทางไม่รองรับ ใช้ push แทน)
+func replyLine(replyToken, lineUserID, text string) {
+	channel := notify.Get(notify.LINE)
+	if channel == nil {
+		log.Println("LINE webhook received but NOTIFY_LINE is not configured, reply dropped")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lineReplyTimeout)
+	defer cancel()
+
+	var err error
+	if replier, ok := channel.(notify.Replier); ok {
+		err = replier.Reply(ctx, replyToken, text)
+	} else {
+		err = channel.Send(ctx, notify.Message{To: lineUserID, Body: text})
+	}
+	if err != nil {
+		log.Printf("LINE reply failed: %v", err)
+	}
+}
+
+// handleLineEvent - ประมวลผลหนึ่ง event แล้วคืนข้อความตอบกลับ ("" = ไม่ต้องตอบ)
+func handleLineEvent(event *lineEvent) string {
+	lineUserID := event.Source.UserID
+	switch event.Type {
+	case "follow":
+		return lineMessages["th"]["help"]
+	case "unfollow":
+		// ผู้ใช้บล็อก bot แล้ว ส่งข้อความไม่ได้อีก
+		database.DB.Where("line_user_index = ?", models.LineUserIndex(lineUserID)).Delete(&models.LineLink{})
+		return ""
+	case "message":
+		if event.Message.Type != "text" {
+			return ""
+		}
+	default:
+		return ""
+	}
+
+	fields := strings.Fields(event.Message.Text)
+	if len(fields) == 0 {
+		return ""
+	}
+	command, ok := lineCommands[strings.ToLower(fields[0])]
+	args := fields[1:]
+	if !ok {
+		// พิมพ์แค่ "<รหัสอ้างอิง> <เบอร์โทร>" ก็ผูกได้
+		if len(fields) == 2 && lineReferencePattern.MatchString(fields[0]) {
+			command, args = lineCommands["ผูก"], fields
+		} else {
+			command = lineCommands["วิธีใช้"]
+		}
+	}
+
+	messages := lineMessages[command.locale]
+	switch command.command {
+	case "link":
+		return linkLineUser(lineUserID, args, command.locale)
+	case "status":
+		return lineStatus(lineUserID, messages)
+	case "unlink":
+		result := database.DB.Where("line_user_index = ?", models.LineUserIndex(lineUserID)).Delete(&models.LineLink{})
+		if result.Error != nil {
+			return messages["error"]
+		}
+		return fmt.Sprintf(messages["unlinked"], result.RowsAffected)
+	default:
+		return messages["help"]
+	}
+}
+
+// linkLineUser - ผูก LINE user กับการลงทะเบียนที่รหัสอ้างอิงและเบอร์โทรตรงกัน
+func linkLineUser(lineUserID string, args []string, locale string) string {
+	messages := lineMessages[locale]
+	if len(args) != 2 {
+		return messages["link_usage"]
+	}
+	if lineLinkThrottled(lineUserID) {
+		return messages["link_throttled"]
+	}
+
+	match := lineReferencePattern.FindStringSubmatch(args[0])
+	phoneIndex := models.PhoneIndex(args[1])
+	if match == nil || phoneIndex == "" {
+		recordLineLinkFailure(lineUserID)
+		return messages["link_not_found"]
+	}
+	id, err := strconv.ParseUint(match[2], 10, 64)
+	if err != nil {
+		recordLineLinkFailure(lineUserID)
+		return messages["link_not_found"]
+	}
+
+	link := models.LineLink{LineUserID: models.EncryptedString(lineUserID), Locale: locale}
+	var name, recordType string
+	if strings.EqualFold(match[1], "T") {
+		recordType = "teacher"
+		var registration models.TeacherRegistration
+		if err := database.DB.Where("id = ? AND phone_number_index = ?", id, phoneIndex).First(&registration).Error; err != nil {
+			recordLineLinkFailure(lineUserID)
+			return messages["link_not_found"]
+		}
+		link.TeacherRegistrationID = &registration.ID
+		name = registration.FullName
+	} else {
+		recordType = "registration"
+		var registration models.Registration
+		if err := database.DB.Where("id = ? AND phone_number_index = ?", id, phoneIndex).First(&registration).Error; err != nil {
+			recordLineLinkFailure(lineUserID)
+			return messages["link_not_found"]
+		}
+		link.RegistrationID = &registration.ID
+		name = registration.FullName
+	}
+
+	var links []models.LineLink
+	database.DB.Where("line_user_index = ?", models.LineUserIndex(lineUserID)).Find(&links)
+	for _, existing := range links {
+		if (link.RegistrationID != nil && existing.RegistrationID != nil && *existing.RegistrationID == *link.RegistrationID) ||
+			(link.TeacherRegistrationID != nil && existing.TeacherRegistrationID != nil && *existing.TeacherRegistrationID == *link.TeacherRegistrationID) {
+			return fmt.Sprintf(messages["link_exists"], name)
+		}
+	}
+	if len(links) >= maxLineLinksPerUser {
+		return messages["link_too_many"]
+	}
+
+	reference := registrationReference(recordType, uint(id))
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+		// ใช้ภาษาล่าสุดที่ผู้ใช้พิมพ์กับทุกการผูกของบัญชีนี้
+		return tx.Model(&models.LineLink{}).Where("line_user_index = ?", link.LineUserIndex).Update("locale", locale).Error
+	})
+	if err != nil {
+		return messages["error"]
+	}
+	logSystemActivity("ผูกบัญชี LINE", fmt.Sprintf("ผูกบัญชี LINE กับการลงทะเบียน %s", reference), "line")
+	return fmt.Sprintf(messages["link_ok"], name, reference)
+}
+
+// lineStatus - สถานะการลงทะเบียนและการสวดของทุกการลงทะเบียนที่ผูกไว้
+func lineStatus(lineUserID string, messages map[string]string) string {
+	var links []models.LineLink
+	if err := database.DB.Where("line_user_index = ?", models.LineUserIndex(lineUserID)).Order("id").Find(&links).Error; err != nil {
+		return messages["error"]
+	}
+
+	progress := func(done bool) string {
+		if done {
+			return messages["done"]
+		}
+		return messages["pending"]
+	}
+	var parts []string
+	for _, link := range links {
+		if link.RegistrationID != nil {
+			var registration models.Registration
+			if database.DB.First(&registration, *link.RegistrationID).Error != nil || registration.AnonymizedAt != nil {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf(messages["status_member"], registration.FullName, registrationReference("registration", registration.ID),
+				progress(registration.ChantedPariwat), progress(registration.ChantedManat), progress(registration.ChantedOkApan)))
+		}
+		if link.TeacherRegistrationID != nil {
+			var registration models.TeacherRegistration
+			if database.DB.First(&registration, *link.TeacherRegistrationID).Error != nil || registration.AnonymizedAt != nil {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf(messages["status_teacher"], registration.FullName, registrationReference("teacher", registration.ID)))
+		}
+	}
+	if len(parts) == 0 {
+		return messages["not_linked"]
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// lineRecipients - บัญชี LINE ที่ผูกกับการลงทะเบียน
+func lineRecipients(tx *gorm.DB, registrationID, teacherRegistrationID *uint) []notificationRecipient {
+	var links []models.LineLink
+	switch {
+	case registrationID != nil:
+		tx.Where("registration_id = ?", *registrationID).Find(&links)
+	case teacherRegistrationID != nil:
+		tx.Where("teacher_registration_id = ?", *teacherRegistrationID).Find(&links)
+	}
+
+	recipients := make([]notificationRecipient, 0, len(links))
+	for _, link := range links {
+		recipients = append(recipients, notificationRecipient{Channel: notify.LINE, Address: link.LineUserID.String(), Locale: link.Locale})
+	}
+	return recipients
+}
+
+// GetLineLinks - บัญชี LINE ที่ผูกกับการลงทะเบียน (?registration_id= หรือ ?teacher_registration_id=)
+func GetLineLinks(c *fiber.Ctx) error {
+	query := database.DB.Order("created_at DESC")
+	if id := c.QueryInt("registration_id"); id > 0 {
+		query = query.Where("registration_id = ?", id)
+	}
+	if id := c.QueryInt("teacher_registration_id"); id > 0 {
+		query = query.Where("teacher_registration_id = ?", id)
+	}
+
+	var links []models.LineLink
+	if err := query.Find(&links).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	return c.JSON(links)
+}
+
+// DeleteLineLink - ยกเลิกการผูกบัญชี LINE (เช่น ผู้ใช้แจ้งว่าผูกผิดคน)
+func DeleteLineLink(c *fiber.Ctx) error {
+	var link models.LineLink
+	if err := database.DB.First(&link, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบการผูกบัญชี LINE",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&link).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      "ยกเลิกการผูกบัญชี LINE",
+			Description: fmt.Sprintf("ยกเลิกการผูกบัญชี LINE #%d", link.ID),
+			Module:      "line",
+			RecordID:    &link.ID,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ยกเลิกการผูกบัญชี LINE สำเร็จ",
+	})
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
 	"registration-system/database"
 	"registration-system/models"
 	"strings"
+	"sync"
 
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type ActivityLogRequest struct {
@@ -45,6 +50,60 @@ func GetActivityLogs(c *fiber.Ctx) error {
 	return c.JSON(logs)
 }
 
+// systemUsername - ผู้ใช้ภายในสำหรับงานที่ระบบทำเอง (เช่น งานตั้งเวลา) ใช้ login ไม่ได้
+const systemUsername = "system"
+
+var (
+	systemUserOnce sync.Once
+	systemUser     uint
+)
+
+// systemUserID - หา/สร้างผู้ใช้ระบบสำหรับบันทึก Activity Log ที่ไม่มีผู้ใช้ login
+func systemUserID() uint {
+	systemUserOnce.Do(func() {
+		var user models.User
+		if err := database.DB.Where("username = ?", systemUsername).First(&user).Error; err == nil {
+			systemUser = user.ID
+			return
+		}
+
+		// รหัสผ่านสุ่มที่ไม่มีใครรู้ และปิดการใช้งานไว้เสมอ
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		hashed, _ := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(secret)), bcrypt.DefaultCost)
+
+		user = models.User{
+			Username: systemUsername,
+			Password: string(hashed),
+			FullName: "ระบบอัตโนมัติ",
+		}
+		if err := database.DB.Create(&user).Error; err != nil {
+			log.Printf("Error creating system user: %v", err)
+			return
+		}
+		database.DB.Model(&user).Update("is_active", false)
+		systemUser = user.ID
+	})
+	return systemUser
+}
+
+// logSystemActivity - บันทึก Activity Log ในนามของผู้ใช้ระบบ
+func logSystemActivity(action, description, module string) {
+	userID := systemUserID()
+	if userID == 0 {
+		log.Printf("[%s] %s: %s", module, action, description)
+		return
+	}
+
+	activityLog := models.ActivityLog{
+		Action:      action,
+		Description: description,
+		Module:      module,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+}
+
 // CreateActivityLog - สร้างบันทึกการทำกิจกรรม (ต้อง login)
 func CreateActivityLog(c *fiber.Ctx) error {
 	var req ActivityLogRequest
@@ -91,22 +150,13 @@ func CreateDeviceLog(c *fiber.Ctx) error {
 		ipAddress = req.IPAddress
 	}
 
-	// ปรับปรุง IP address เพื่อความเป็นส่วนตัว (PDPA)
-	// ลบส่วนสุดท้ายของ IP v4 หรือ hash สำหรับ IP v6
-	if strings.Contains(ipAddress, ".") {
-		parts := strings.Split(ipAddress, ".")
-		if len(parts) == 4 {
-			ipAddress = strings.Join(parts[:3], ".") + ".xxx" // แสดงแค่ 3 ส่วนแรก
-		}
-	}
-
 	log := models.DeviceLog{
 		DeviceType:  req.DeviceType,
 		DeviceInfo:  req.DeviceInfo,
 		Action:      req.Action,
 		Description: req.Description,
 		Module:      req.Module,
-		IPAddress:   ipAddress,
+		IPAddress:   maskIPAddress(ipAddress),
 	}
 
 	result := database.DB.Create(&log)
@@ -119,6 +169,18 @@ func CreateDeviceLog(c *fiber.Ctx) error {
 	return c.Status(201).JSON(log)
 }
 
+// maskIPAddress - ปรับปรุง IP address เพื่อความเป็นส่วนตัว (PDPA)
+// ลบส่วนสุดท้ายของ IP v4 หรือ hash สำหรับ IP v6
+func maskIPAddress(ipAddress string) string {
+	if strings.Contains(ipAddress, ".") {
+		parts := strings.Split(ipAddress, ".")
+		if len(parts) == 4 {
+			ipAddress = strings.Join(parts[:3], ".") + ".xxx" // แสดงแค่ 3 ส่วนแรก
+		}
+	}
+	return ipAddress
+}
+
 // GetDeviceLogs - ดึงบันทึกข้อมูลอุปกรณ์ (ต้อง login เพื่อดู)
 func GetDeviceLogs(c *fiber.Ctx) error {
 	var logs []models.DeviceLog
@@ -0,0 +1,622 @@
+package handlers
+
+import (
+	"fmt"
+	"registration-system/database"
+	"registration-system/middleware"
+	"registration-system/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type MedicalConditionTypeRequest struct {
+	Code                   string `json:"code"`
+	NameTh                 string `json:"name_th"`
+	NameEn                 string `json:"name_en"`
+	Category               string `json:"category"`
+	RequiresAccessibleRoom bool   `json:"requires_accessible_room"`
+	IsActive               *bool  `json:"is_active"`
+}
+
+type MedicationRequest struct {
+	Name     string `json:"name"`
+	Dosage   string `json:"dosage"`
+	Schedule string `json:"schedule"`
+	Notes    string `json:"notes"`
+}
+
+type MedicalProfileRequest struct {
+	ConditionIDs             []uint              `json:"condition_ids"`
+	Allergies                []string            `json:"allergies"`
+	Medications              []MedicationRequest `json:"medications"`
+	MobilityNeeds            string              `json:"mobility_needs"`
+	MobilityNotes            string              `json:"mobility_notes"`
+	EmergencyContactName     string              `json:"emergency_contact_name"`
+	EmergencyContactPhone    string              `json:"emergency_contact_phone"`
+	EmergencyContactRelation string              `json:"emergency_contact_relation"`
+}
+
+type MedicalIncidentRequest struct {
+	RegistrationID        *uint  `json:"registration_id"`
+	TeacherRegistrationID *uint  `json:"teacher_registration_id"`
+	OccurredAt            string `json:"occurred_at"` // RFC3339 เช่น "2025-01-15T14:30:00+07:00"
+	Symptoms              string `json:"symptoms"`
+	ActionTaken           string `json:"action_taken"`
+	ReferredToHospital    bool   `json:"referred_to_hospital"`
+	HospitalName          string `json:"hospital_name"`
+}
+
+// validMobilityNeeds - ระดับความช่วยเหลือด้านการเคลื่อนไหว
+var validMobilityNeeds = map[string]bool{
+	"none":       true,
+	"cane":       true,
+	"walker":     true,
+	"wheelchair": true,
+	"bedridden":  true,
+}
+
+// logMedicalAccess - บันทึก Activity Log ทุกครั้งที่มีการอ่าน/แก้ไขข้อมูลสุขภาพ
+func logMedicalAccess(c *fiber.Ctx, action, description string) {
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      action,
+		Description: description,
+		Module:      "medical",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+}
+
+// redactMedicalCondition - ล้าง medical_condition ก่อนตอบกลับ เว้นแต่ผู้ใช้มี role "medical"
+// record เป็น pointer ของ Registration/TeacherRegistration หรือ slice ของทั้งสองแบบ
+func redactMedicalCondition(c *fiber.Ctx, record interface{}) {
+	if middleware.HasRole(c, "medical") {
+		return
+	}
+	switch r := record.(type) {
+	case *models.Registration:
+		r.MedicalCondition = ""
+	case *models.TeacherRegistration:
+		r.MedicalCondition = ""
+	case []models.Registration:
+		for i := range r {
+			r[i].MedicalCondition = ""
+		}
+	case []models.TeacherRegistration:
+		for i := range r {
+			r[i].MedicalCondition = ""
+		}
+	}
+}
+
+// GetMedicalConditionTypes - ดึงรายการโรค/ภาวะสุขภาพ
+func GetMedicalConditionTypes(c *fiber.Ctx) error {
+	var conditions []models.MedicalConditionType
+
+	query := database.DB.Order("category, name_th")
+	if c.Query("active") == "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	if err := query.Find(&conditions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	return c.JSON(conditions)
+}
+
+// CreateMedicalConditionType - เพิ่มรายการโรค/ภาวะสุขภาพ
+func CreateMedicalConditionType(c *fiber.Ctx) error {
+	var req MedicalConditionTypeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.Code == "" || req.NameTh == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณากรอกรหัสและชื่อภาษาไทย",
+		})
+	}
+
+	condition := models.MedicalConditionType{
+		Code:                   strings.ToLower(strings.TrimSpace(req.Code)),
+		NameTh:                 req.NameTh,
+		NameEn:                 req.NameEn,
+		Category:               req.Category,
+		RequiresAccessibleRoom: req.RequiresAccessibleRoom,
+		IsActive:               true,
+	}
+
+	if err := database.DB.Create(&condition).Error; err != nil {
+		if strings.Contains(err.Error(), "duplicate") || strings.Contains(err.Error(), "unique") {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "รหัสนี้ถูกใช้งานแล้ว",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	return c.Status(201).JSON(condition)
+}
+
+// UpdateMedicalConditionType - แก้ไขรายการโรค/ภาวะสุขภาพ (รหัสแก้ไขไม่ได้)
+func UpdateMedicalConditionType(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var condition models.MedicalConditionType
+
+	if err := database.DB.First(&condition, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูล",
+		})
+	}
+
+	var req MedicalConditionTypeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.NameTh != "" {
+		condition.NameTh = req.NameTh
+	}
+	if req.NameEn != "" {
+		condition.NameEn = req.NameEn
+	}
+	if req.Category != "" {
+		condition.Category = req.Category
+	}
+	condition.RequiresAccessibleRoom = req.RequiresAccessibleRoom
+	if req.IsActive != nil {
+		condition.IsActive = *req.IsActive
+	}
+
+	if err := database.DB.Save(&condition).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	return c.JSON(condition)
+}
+
+// medicalProfileOwner - ระบุเจ้าของ profile จาก path (/registrations/:id หรือ /teacher-registrations/:id)
+type medicalProfileOwner struct {
+	column   string // "registration_id" or "teacher_registration_id"
+	id       uint
+	fullName string
+	module   string
+}
+
+func loadMedicalProfileOwner(c *fiber.Ctx, teacher bool) (*medicalProfileOwner, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid id")
+	}
+
+	if teacher {
+		var registration models.TeacherRegistration
+		if err := database.DB.First(&registration, id).Error; err != nil {
+			return nil, err
+		}
+		return &medicalProfileOwner{column: "teacher_registration_id", id: registration.ID, fullName: registration.FullName, module: "teacher-registration"}, nil
+	}
+
+	var registration models.Registration
+	if err := database.DB.First(&registration, id).Error; err != nil {
+		return nil, err
+	}
+	return &medicalProfileOwner{column: "registration_id", id: registration.ID, fullName: registration.FullName, module: "registration"}, nil
+}
+
+// GetMedicalProfile - ดูข้อมูลสุขภาพของผู้ลงทะเบียน
+func GetMedicalProfile(c *fiber.Ctx) error {
+	return getMedicalProfile(c, false)
+}
+
+// GetTeacherMedicalProfile - ดูข้อมูลสุขภาพของพระอาจารย์
+func GetTeacherMedicalProfile(c *fiber.Ctx) error {
+	return getMedicalProfile(c, true)
+}
+
+func getMedicalProfile(c *fiber.Ctx, teacher bool) error {
+	owner, err := loadMedicalProfileOwner(c, teacher)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียน",
+		})
+	}
+
+	var profile models.MedicalProfile
+	err = database.DB.Preload("Conditions").Preload("Medications").Where(owner.column+" = ?", owner.id).First(&profile).Error
+
+	logMedicalAccess(c, "ดูข้อมูลสุขภาพ", fmt.Sprintf("ดูข้อมูลสุขภาพของ %s (%s #%d)", owner.fullName, owner.module, owner.id))
+
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ยังไม่มีข้อมูลสุขภาพ",
+		})
+	}
+
+	return c.JSON(profile)
+}
+
+// UpsertMedicalProfile - บันทึก/แก้ไขข้อมูลสุขภาพของผู้ลงทะเบียน
+func UpsertMedicalProfile(c *fiber.Ctx) error {
+	return upsertMedicalProfile(c, false)
+}
+
+// UpsertTeacherMedicalProfile - บันทึก/แก้ไขข้อมูลสุขภาพของพระอาจารย์
+func UpsertTeacherMedicalProfile(c *fiber.Ctx) error {
+	return upsertMedicalProfile(c, true)
+}
+
+func upsertMedicalProfile(c *fiber.Ctx, teacher bool) error {
+	owner, err := loadMedicalProfileOwner(c, teacher)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียน",
+		})
+	}
+
+	var req MedicalProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.MobilityNeeds == "" {
+		req.MobilityNeeds = "none"
+	}
+	if !validMobilityNeeds[req.MobilityNeeds] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "mobility_needs ต้องเป็น 'none', 'cane', 'walker', 'wheelchair' หรือ 'bedridden'",
+		})
+	}
+	for _, medication := range req.Medications {
+		if strings.TrimSpace(medication.Name) == "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "กรุณากรอกชื่อยาให้ครบทุกรายการ",
+			})
+		}
+	}
+
+	var conditions []models.MedicalConditionType
+	if len(req.ConditionIDs) > 0 {
+		database.DB.Where("id IN ?", req.ConditionIDs).Find(&conditions)
+		if len(conditions) != len(req.ConditionIDs) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "พบรายการโรคที่ไม่มีอยู่ในระบบ",
+			})
+		}
+	}
+
+	userID := c.Locals("userID").(uint)
+	var profile models.MedicalProfile
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where(owner.column+" = ?", owner.id).First(&profile).Error; err != nil {
+			if err != gorm.ErrRecordNotFound {
+				return err
+			}
+			if teacher {
+				profile.TeacherRegistrationID = &owner.id
+			} else {
+				profile.RegistrationID = &owner.id
+			}
+		}
+
+		profile.Allergies = models.EncryptedStringArray(req.Allergies)
+		profile.MobilityNeeds = req.MobilityNeeds
+		profile.MobilityNotes = models.EncryptedString(req.MobilityNotes)
+		profile.EmergencyContactName = models.EncryptedString(req.EmergencyContactName)
+		profile.EmergencyContactPhone = models.EncryptedString(req.EmergencyContactPhone)
+		profile.EmergencyContactRelation = models.EncryptedString(req.EmergencyContactRelation)
+		profile.UpdatedByID = userID
+
+		if err := tx.Omit("Conditions", "Medications").Save(&profile).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&profile).Association("Conditions").Replace(conditions); err != nil {
+			return err
+		}
+
+		// แทนที่รายการยาทั้งหมดด้วยรายการใหม่
+		if err := tx.Where("medical_profile_id = ?", profile.ID).Delete(&models.Medication{}).Error; err != nil {
+			return err
+		}
+		for _, m := range req.Medications {
+			medication := models.Medication{
+				MedicalProfileID: profile.ID,
+				Name:             models.EncryptedString(m.Name),
+				Dosage:           models.EncryptedString(m.Dosage),
+				Schedule:         models.EncryptedString(m.Schedule),
+				Notes:            models.EncryptedString(m.Notes),
+			}
+			if err := tx.Create(&medication).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	logMedicalAccess(c, "แก้ไขข้อมูลสุขภาพ", fmt.Sprintf("แก้ไขข้อมูลสุขภาพของ %s (%s #%d)", owner.fullName, owner.module, owner.id))
+
+	database.DB.Preload("Conditions").Preload("Medications").First(&profile, profile.ID)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "บันทึกข้อมูลสุขภาพสำเร็จ",
+		"data":    profile,
+	})
+}
+
+// MedicalProfileListItem - ข้อมูลสุขภาพพร้อมชื่อผู้ลงทะเบียน สำหรับทีมปฐมพยาบาล/ครัว
+type MedicalProfileListItem struct {
+	models.MedicalProfile
+	FullName         string `json:"full_name"`
+	Nickname         string `json:"nickname"`
+	MedicalCondition string `json:"medical_condition"` // ข้อความเดิมที่ผู้ลงทะเบียนกรอก
+}
+
+// GetMedicalProfiles - ค้นหาข้อมูลสุขภาพ
+// Query: condition (code), mobility, has_allergy=true, has_medication=true
+func GetMedicalProfiles(c *fiber.Ctx) error {
+	var profiles []models.MedicalProfile
+
+	query := database.DB.Preload("Conditions").Preload("Medications").Order("id")
+
+	if code := c.Query("condition"); code != "" {
+		query = query.Where("id IN (?)", database.DB.Table("medical_profile_conditions").
+			Select("medical_profile_conditions.medical_profile_id").
+			Joins("JOIN medical_condition_types ON medical_condition_types.id = medical_profile_conditions.medical_condition_type_id").
+			Where("medical_condition_types.code = ?", code))
+	}
+	if mobility := c.Query("mobility"); mobility != "" {
+		if mobility == "any" {
+			query = query.Where("mobility_needs <> ?", "none")
+		} else {
+			query = query.Where("mobility_needs = ?", mobility)
+		}
+	}
+	if c.Query("has_allergy") == "true" {
+		query = query.Where("COALESCE(allergies, '') NOT IN ('', '{}')") // ค่าว่าง = ไม่มี ('{}' จากข้อมูลก่อนเข้ารหัส)
+	}
+	if c.Query("has_medication") == "true" {
+		query = query.Where("id IN (?)", database.DB.Model(&models.Medication{}).Select("medical_profile_id"))
+	}
+
+	if err := query.Find(&profiles).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	// โหลดชื่อผู้ลงทะเบียน (ข้ามรายการที่ถูกลบไปแล้ว)
+	var registrationIDs, teacherIDs []uint
+	for _, profile := range profiles {
+		if profile.RegistrationID != nil {
+			registrationIDs = append(registrationIDs, *profile.RegistrationID)
+		}
+		if profile.TeacherRegistrationID != nil {
+			teacherIDs = append(teacherIDs, *profile.TeacherRegistrationID)
+		}
+	}
+
+	registrations := make(map[uint]models.Registration)
+	if len(registrationIDs) > 0 {
+		var rows []models.Registration
+		database.DB.Where("id IN ?", registrationIDs).Find(&rows)
+		for _, r := range rows {
+			registrations[r.ID] = r
+		}
+	}
+	teachers := make(map[uint]models.TeacherRegistration)
+	if len(teacherIDs) > 0 {
+		var rows []models.TeacherRegistration
+		database.DB.Where("id IN ?", teacherIDs).Find(&rows)
+		for _, r := range rows {
+			teachers[r.ID] = r
+		}
+	}
+
+	items := make([]MedicalProfileListItem, 0, len(profiles))
+	for _, profile := range profiles {
+		item := MedicalProfileListItem{MedicalProfile: profile}
+		if profile.RegistrationID != nil {
+			r, ok := registrations[*profile.RegistrationID]
+			if !ok {
+				continue
+			}
+			item.FullName, item.Nickname, item.MedicalCondition = r.FullName, r.Nickname, r.MedicalCondition.String()
+		} else if profile.TeacherRegistrationID != nil {
+			r, ok := teachers[*profile.TeacherRegistrationID]
+			if !ok {
+				continue
+			}
+			item.FullName, item.Nickname, item.MedicalCondition = r.FullName, r.Nickname, r.MedicalCondition.String()
+		}
+		items = append(items, item)
+	}
+
+	logMedicalAccess(c, "ค้นหาข้อมูลสุขภาพ", fmt.Sprintf("ค้นหาข้อมูลสุขภาพ (%s) พบ %d รายการ", c.Context().QueryArgs().String(), len(items)))
+
+	return c.JSON(items)
+}
+
+// GetMedicalIncidents - ดึงบันทึกเหตุการณ์ด้านสุขภาพ
+// Query: registration_id, teacher_registration_id, referred=true, start_date, end_date
+func GetMedicalIncidents(c *fiber.Ctx) error {
+	var incidents []models.MedicalIncident
+
+	query := database.DB.Preload("Registration").Preload("TeacherRegistration").Preload("ReportedBy").Order("occurred_at DESC")
+
+	if id := c.Query("registration_id"); id != "" {
+		query = query.Where("registration_id = ?", id)
+	}
+	if id := c.Query("teacher_registration_id"); id != "" {
+		query = query.Where("teacher_registration_id = ?", id)
+	}
+	if c.Query("referred") == "true" {
+		query = query.Where("referred_to_hospital = ?", true)
+	}
+	if startDate := c.Query("start_date"); startDate != "" {
+		if date, err := time.Parse("2006-01-02", startDate); err == nil {
+			query = query.Where("occurred_at >= ?", date)
+		}
+	}
+	if endDate := c.Query("end_date"); endDate != "" {
+		if date, err := time.Parse("2006-01-02", endDate); err == nil {
+			query = query.Where("occurred_at < ?", date.AddDate(0, 0, 1))
+		}
+	}
+
+	if err := query.Find(&incidents).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	logMedicalAccess(c, "ดูบันทึกเหตุการณ์สุขภาพ", fmt.Sprintf("ดูบันทึกเหตุการณ์สุขภาพ (%s) พบ %d รายการ", c.Context().QueryArgs().String(), len(incidents)))
+
+	return c.JSON(incidents)
+}
+
+// CreateMedicalIncident - บันทึกเหตุการณ์ด้านสุขภาพ
+func CreateMedicalIncident(c *fiber.Ctx) error {
+	var req MedicalIncidentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if (req.RegistrationID == nil) == (req.TeacherRegistrationID == nil) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ต้องระบุ registration_id หรือ teacher_registration_id อย่างใดอย่างหนึ่ง",
+		})
+	}
+	if strings.TrimSpace(req.Symptoms) == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณากรอกอาการ",
+		})
+	}
+
+	occurredAt := time.Now()
+	if req.OccurredAt != "" {
+		parsed, err := time.Parse(time.RFC3339, req.OccurredAt)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "รูปแบบเวลาไม่ถูกต้อง (ใช้ RFC3339 เช่น 2025-01-15T14:30:00+07:00)",
+			})
+		}
+		occurredAt = parsed
+	}
+
+	var fullName string
+	if req.RegistrationID != nil {
+		var registration models.Registration
+		if err := database.DB.First(&registration, *req.RegistrationID).Error; err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "ไม่พบข้อมูลการลงทะเบียน",
+			})
+		}
+		fullName = registration.FullName
+	} else {
+		var registration models.TeacherRegistration
+		if err := database.DB.First(&registration, *req.TeacherRegistrationID).Error; err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "ไม่พบข้อมูลการลงทะเบียนพระอาจารย์",
+			})
+		}
+		fullName = registration.FullName
+	}
+
+	userID := c.Locals("userID").(uint)
+	incident := models.MedicalIncident{
+		RegistrationID:        req.RegistrationID,
+		TeacherRegistrationID: req.TeacherRegistrationID,
+		OccurredAt:            occurredAt,
+		Symptoms:              models.EncryptedString(req.Symptoms),
+		ActionTaken:           models.EncryptedString(req.ActionTaken),
+		ReferredToHospital:    req.ReferredToHospital,
+		HospitalName:          models.EncryptedString(req.HospitalName),
+		ReportedByID:          userID,
+	}
+
+	if err := database.DB.Create(&incident).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	logMedicalAccess(c, "บันทึกเหตุการณ์สุขภาพ", fmt.Sprintf("บันทึกเหตุการณ์สุขภาพของ %s (incident #%d)", fullName, incident.ID))
+
+	database.DB.Preload("Registration").Preload("TeacherRegistration").Preload("ReportedBy").First(&incident, incident.ID)
+
+	return c.Status(201).JSON(incident)
+}
+
+// UpdateMedicalIncident - แก้ไขบันทึกเหตุการณ์ (เช่น เพิ่มการรักษา/การส่งต่อ)
+func UpdateMedicalIncident(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var incident models.MedicalIncident
+
+	if err := database.DB.First(&incident, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูล",
+		})
+	}
+
+	var req MedicalIncidentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.OccurredAt != "" {
+		parsed, err := time.Parse(time.RFC3339, req.OccurredAt)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "รูปแบบเวลาไม่ถูกต้อง (ใช้ RFC3339 เช่น 2025-01-15T14:30:00+07:00)",
+			})
+		}
+		incident.OccurredAt = parsed
+	}
+	if req.Symptoms != "" {
+		incident.Symptoms = models.EncryptedString(req.Symptoms)
+	}
+	if req.ActionTaken != "" {
+		incident.ActionTaken = models.EncryptedString(req.ActionTaken)
+	}
+	incident.ReferredToHospital = req.ReferredToHospital
+	incident.HospitalName = models.EncryptedString(req.HospitalName)
+
+	if err := database.DB.Omit("Registration", "TeacherRegistration", "ReportedBy").Save(&incident).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	logMedicalAccess(c, "แก้ไขเหตุการณ์สุขภาพ", fmt.Sprintf("แก้ไขบันทึกเหตุการณ์สุขภาพ incident #%d", incident.ID))
+
+	database.DB.Preload("Registration").Preload("TeacherRegistration").Preload("ReportedBy").First(&incident, incident.ID)
+
+	return c.JSON(incident)
+}
@@ -0,0 +1,538 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"registration-system/database"
+	"registration-system/models"
+	"registration-system/notify"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxNotificationAttempts = 8                // ส่งไม่สำเร็จครบจำนวนนี้แล้วเลิกส่ง (status = failed)
+	notificationBatchSize   = 50               // จำนวนข้อความที่ worker หยิบต่อรอบ
+	notificationLease       = 5 * time.Minute  // ระหว่างส่ง เลื่อนเวลาส่งครั้งถัดไปไว้ กัน worker อื่นหยิบซ้ำ
+	notificationSendTimeout = 30 * time.Second // เวลาสูงสุดต่อการส่งหนึ่งข้อความ
+)
+
+// notificationTemplate - ข้อความแจ้งเตือนหนึ่งภาษา (Subject ใช้เฉพาะอีเมล)
+type notificationTemplate struct {
+	Subject string
+	Body    string
+}
+
+// notificationTemplates - event -> locale -> template
+// ตัวแปรเขียนแบบ {{.name}} และ {{label .stage}} แปลรหัสเป็นชื่อตามภาษา (ดู notificationLabels)
+var notificationTemplates = map[string]map[string]notificationTemplate{
+	"registration_created": {
+		"th": {
+			Subject: "ได้รับการลงทะเบียนแล้ว",
+			Body:    "ได้รับการลงทะเบียนของ {{.name}} แล้ว รหัสอ้างอิง {{.reference}} โปรดเก็บรหัสนี้ไว้ใช้ติดต่อเจ้าหน้าที่",
+		},
+		"en": {
+			Subject: "Registration received",
+			Body:    "We have received the registration for {{.name}}. Your reference code is {{.reference}}; please keep it for contacting our staff.",
+		},
+	},
+	"group_registration_created": {
+		"th": {
+			Subject: "ได้รับการลงทะเบียนกลุ่มแล้ว",
+			Body:    "ได้รับการลงทะเบียนกลุ่มที่ {{.name}} เป็นผู้ติดต่อแล้ว จำนวน {{.count}} รูป รหัสกลุ่ม {{.reference}}",
+		},
+		"en": {
+			Subject: "Group registration received",
+			Body:    "We have received the group registration with {{.name}} as contact: {{.count}} participants. Group code: {{.reference}}.",
+		},
+	},
+	"chanting_stage_completed": {
+		"th": {
+			Subject: "บันทึกการสวด{{label .stage}}แล้ว",
+			Body:    "{{.name}} สวด{{label .stage}}เรียบร้อยแล้ว (รหัสอ้างอิง {{.reference}})",
+		},
+		"en": {
+			Subject: "{{label .stage}} completed",
+			Body:    "{{.name}} has completed {{label .stage}} (reference {{.reference}}).",
+		},
+	},
+	"phone_verification": {
+		"th": {
+			Subject: "รหัสยืนยันเบอร์โทร",
+			Body:    "รหัสยืนยันเบอร์โทรของคุณคือ {{.code}} (ใช้ได้ {{.minutes}} นาที) ห้ามบอกรหัสนี้กับผู้อื่น",
+		},
+		"en": {
+			Subject: "Phone verification code",
+			Body:    "Your verification code is {{.code}} (valid for {{.minutes}} minutes). Do not share this code with anyone.",
+		},
+	},
+	"staff_registration_created": {
+		"th": {
+			Subject: "ลงทะเบียนใหม่ ({{label .type}}): {{.name}}",
+			Body:    "มีการลงทะเบียนใหม่ ({{label .type}})\nชื่อ: {{.name}}\nวัด: {{.temple}}\n{{if .count}}จำนวน: {{.count}} รูป\n{{end}}รหัสอ้างอิง: {{.reference}}",
+		},
+		"en": {
+			Subject: "New registration ({{label .type}}): {{.name}}",
+			Body:    "A new registration was received ({{label .type}})\nName: {{.name}}\nTemple: {{.temple}}\n{{if .count}}Participants: {{.count}}\n{{end}}Reference: {{.reference}}",
+		},
+	},
+}
+
+// notificationLabels - ชื่อที่แสดงของรหัสในตัวแปร แยกตามภาษา
+var notificationLabels = map[string]map[string]string{
+	"th": {
+		"pariwat":      "ปริวาส",
+		"manat":        "มานัต",
+		"ok_apan":      "ออกอาพาน",
+		"registration": "ผู้เข้าร่วม",
+		"teacher":      "พระอาจารย์",
+		"group":        "กลุ่ม",
+	},
+	"en": {
+		"pariwat":      "Parivasa",
+		"manat":        "Manatta",
+		"ok_apan":      "Abbhana",
+		"registration": "participant",
+		"teacher":      "teacher",
+		"group":        "group",
+	},
+}
+
+// notificationLocales - ภาษาที่มีข้อความแจ้งเตือน
+var notificationLocales = []string{"th", "en"}
+
+// defaultNotificationLocale - ภาษาของข้อความที่ส่งถึงผู้ลงทะเบียน (NOTIFY_LOCALE, ค่าเริ่มต้น "th")
+func defaultNotificationLocale() string {
+	if locale := os.Getenv("NOTIFY_LOCALE"); locale == "en" {
+		return locale
+	}
+	return "th"
+}
+
+// renderNotification - แทนค่าตัวแปรใน template ของ event ตามภาษา (ไม่มีภาษานั้นใช้ภาษาไทย)
+func renderNotification(event, locale string, vars map[string]string) (string, string, error) {
+	templates, ok := notificationTemplates[event]
+	if !ok {
+		return "", "", fmt.Errorf("unknown notification event %q", event)
+	}
+	tmpl, ok := templates[locale]
+	if !ok {
+		locale = "th"
+		tmpl = templates[locale]
+	}
+
+	funcs := template.FuncMap{"label": func(key string) string {
+		if label, ok := notificationLabels[locale][key]; ok {
+			return label
+		}
+		return key
+	}}
+	render := func(text string) (string, error) {
+		parsed, err := template.New(event).Funcs(funcs).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var out bytes.Buffer
+		if err := parsed.Execute(&out, vars); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	}
+
+	subject, err := render(tmpl.Subject)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := render(tmpl.Body)
+	if err != nil {
+		return "", "", err
+	}
+	return subject, body, nil
+}
+
+// registrationReference - รหัสอ้างอิงที่แจ้งผู้ลงทะเบียน เช่น "R-000123" (พระอาจารย์ขึ้นต้นด้วย T)
+func registrationReference(recordType string, id uint) string {
+	prefix := "R"
+	if recordType == "teacher" {
+		prefix = "T"
+	}
+	return fmt.Sprintf("%s-%06d", prefix, id)
+}
+
+// notificationRecipient - ผู้รับหนึ่งรายในหนึ่งช่องทาง
+type notificationRecipient struct {
+	Channel string
+	Address string
+	Locale  string
+}
+
+// registrantRecipients - ช่องทางที่ติดต่อผู้ลงทะเบียนได้ (SMS ไปยังเบอร์โทร และ LINE ที่ผูกไว้)
+func registrantRecipients(tx *gorm.DB, phone string, registrationID, teacherRegistrationID *uint) []notificationRecipient {
+	var recipients []notificationRecipient
+	if phone = strings.TrimSpace(phone); phone != "" {
+		recipients = append(recipients, notificationRecipient{Channel: notify.SMS, Address: phone, Locale: defaultNotificationLocale()})
+	}
+	if notify.Enabled(notify.LINE) {
+		recipients = append(recipients, lineRecipients(tx, registrationID, teacherRegistrationID)...)
+	}
+	return recipients
+}
+
+// staffRecipients - อีเมลเจ้าหน้าที่จาก NOTIFY_STAFF_EMAILS (คั่นด้วย comma, ต่อท้าย ":en" เพื่อรับภาษาอังกฤษ)
+func staffRecipients() []notificationRecipient {
+	var recipients []notificationRecipient
+	for _, entry := range strings.Split(os.Getenv("NOTIFY_STAFF_EMAILS"), ",") {
+		address, locale := strings.TrimSpace(entry), "th"
+		if strings.HasSuffix(address, ":en") {
+			address, locale = strings.TrimSuffix(address, ":en"), "en"
+		}
+		if _, err := mail.ParseAddress(address); err != nil {
+			continue
+		}
+		recipients = append(recipients, notificationRecipient{Channel: notify.Email, Address: address, Locale: locale})
+	}
+	return recipients
+}
+
+// enqueueNotification - เขียนข้อความลง outbox ใน transaction ของการเปลี่ยนแปลง (ข้ามช่องทางที่ไม่ได้เปิดใช้)
+// ถ้า transaction ถูก rollback ข้อความก็หายไปด้วย จึงไม่มีการแจ้งเตือนสิ่งที่ไม่ได้บันทึกจริง
+func enqueueNotification(tx *gorm.DB, event string, recipients []notificationRecipient, vars map[string]string, registrationID, teacherRegistrationID, groupID *uint) error {
+	now := time.Now()
+	for _, recipient := range recipients {
+		if !notify.Enabled(recipient.Channel) {
+			continue
+		}
+		subject, body, err := renderNotification(event, recipient.Locale, vars)
+		if err != nil {
+			return err
+		}
+		notification := models.Notification{
+			Event:                 event,
+			Channel:               recipient.Channel,
+			Locale:                recipient.Locale,
+			Recipient:             models.EncryptedString(recipient.Address),
+			Body:                  models.EncryptedString(body),
+			RegistrationID:        registrationID,
+			TeacherRegistrationID: teacherRegistrationID,
+			GroupID:               groupID,
+			Status:                "pending",
+			NextAttemptAt:         now,
+		}
+		if recipient.Channel == notify.Email {
+			notification.Subject = models.EncryptedString(subject)
+		}
+		if err := tx.Create(&notification).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueRegistrationCreated - แจ้งผู้ลงทะเบียนและเจ้าหน้าที่เมื่อมีการลงทะเบียนใหม่
+// recordType คือ "registration" หรือ "teacher"
+func enqueueRegistrationCreated(tx *gorm.DB, recordType string, id uint, name, phone, temple string) error {
+	vars := map[string]string{
+		"name":      name,
+		"reference": registrationReference(recordType, id),
+		"temple":    temple,
+		"type":      recordType,
+	}
+	registrationID, teacherRegistrationID := &id, (*uint)(nil)
+	if recordType == "teacher" {
+		registrationID, teacherRegistrationID = nil, &id
+	}
+	if err := enqueueNotification(tx, "registration_created", registrantRecipients(tx, phone, registrationID, teacherRegistrationID), vars, registrationID, teacherRegistrationID, nil); err != nil {
+		return err
+	}
+	return enqueueNotification(tx, "staff_registration_created", staffRecipients(), vars, registrationID, teacherRegistrationID, nil)
+}
+
+// enqueueGroupRegistrationCreated - แจ้งผู้ติดต่อของกลุ่ม (ข้อความเดียวแทนทุกคน) และเจ้าหน้าที่
+func enqueueGroupRegistrationCreated(tx *gorm.DB, group *models.RegistrationGroup, participants int) error {
+	vars := map[string]string{
+		"name":      group.LeaderName,
+		"reference": group.Code,
+		"temple":    group.TempleName,
+		"type":      "group",
+		"count":     fmt.Sprint(participants),
+	}
+	if err := enqueueNotification(tx, "group_registration_created", registrantRecipients(tx, group.LeaderPhone.String(), nil, nil), vars, nil, nil, &group.ID); err != nil {
+		return err
+	}
+	return enqueueNotification(tx, "staff_registration_created", staffRecipients(), vars, nil, nil, &group.ID)
+}
+
+// enqueueChantingCompleted - แจ้งผู้ลงทะเบียนเมื่อสวดขั้นใดขั้นหนึ่งเสร็จ (เฉพาะขั้นที่เพิ่งเปลี่ยนเป็นเสร็จ)
+func enqueueChantingCompleted(tx *gorm.DB, registration *models.Registration, before *registrationFields) error {
+	stages := []struct {
+		key    string
+		before *bool
+		after  bool
+	}{
+		{"pariwat", before.ChantedPariwat, registration.ChantedPariwat},
+		{"manat", before.ChantedManat, registration.ChantedManat},
+		{"ok_apan", before.ChantedOkApan, registration.ChantedOkApan},
+	}
+	for _, stage := range stages {
+		if !stage.after || (stage.before != nil && *stage.before) {
+			continue
+		}
+		vars := map[string]string{
+			"name":      registration.FullName,
+			"reference": registrationReference("registration", registration.ID),
+			"stage":     stage.key,
+		}
+		if err := enqueueNotification(tx, "chanting_stage_completed", registrantRecipients(tx, registration.PhoneNumber.String(), &registration.ID, nil), vars, &registration.ID, nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notificationBackoff - รอนานขึ้นเป็นเท่าตัวทุกครั้งที่ส่งไม่สำเร็จ (30 วินาที, 1 นาที, 2 นาที, ... สูงสุด 6 ชั่วโมง)
+func notificationBackoff(attempts int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempts && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
+
+// claimDueNotifications - หยิบข้อความที่ถึงเวลาส่ง และเลื่อนเวลาส่งครั้งถัดไปไว้ระหว่างส่ง
+// (ถ้า process ตายกลางทาง ข้อความจะถูกหยิบใหม่เมื่อพ้น notificationLease)
+func claimDueNotifications() ([]models.Notification, error) {
+	var batch []models.Notification
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", "pending", now).
+			Order("next_attempt_at").Limit(notificationBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, notification := range batch {
+			ids[i] = notification.ID
+		}
+		return tx.Model(&models.Notification{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(notificationLease)).Error
+	})
+	return batch, err
+}
+
+// deliverNotification - ส่งหนึ่งข้อความแล้วบันทึกผล (สำเร็จ, รอส่งใหม่ตาม backoff หรือเลิกส่ง)
+func deliverNotification(notification *models.Notification) error {
+	var err error
+	if channel := notify.Get(notification.Channel); channel == nil {
+		err = notify.Permanent(fmt.Errorf("channel %q is not configured", notification.Channel))
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationSendTimeout)
+		err = channel.Send(ctx, notify.Message{
+			To:      notification.Recipient.String(),
+			Subject: notification.Subject.String(),
+			Body:    notification.Body.String(),
+		})
+		cancel()
+	}
+
+	now := time.Now()
+	attempts := notification.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts}
+	switch {
+	case err == nil:
+		updates["status"] = "sent"
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+	case notify.IsPermanent(err) || attempts >= maxNotificationAttempts:
+		updates["status"] = "failed"
+		updates["last_error"] = err.Error()
+	default:
+		updates["next_attempt_at"] = now.Add(notificationBackoff(attempts))
+		updates["last_error"] = err.Error()
+	}
+	if dbErr := database.DB.Model(&models.Notification{}).Where("id = ?", notification.ID).Updates(updates).Error; dbErr != nil {
+		return dbErr
+	}
+	return err
+}
+
+// deliverDueNotifications - ส่งข้อความที่ถึงเวลาจนกว่าจะหมด คืนจำนวนที่ส่งสำเร็จ
+func deliverDueNotifications() (int, error) {
+	sent := 0
+	for {
+		batch, err := claimDueNotifications()
+		if err != nil {
+			return sent, err
+		}
+		for i := range batch {
+			if err := deliverNotification(&batch[i]); err != nil {
+				log.Printf("Notification %d (%s via %s) failed: %v", batch[i].ID, batch[i].Event, batch[i].Channel, err)
+				continue
+			}
+			sent++
+		}
+		if len(batch) < notificationBatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// StartNotificationWorker - ส่งข้อความใน outbox ตามรอบเวลา (NOTIFICATION_INTERVAL เช่น "10s", "off" = ปิด)
+func StartNotificationWorker() {
+	if err := notify.LoadFromEnv(); err != nil {
+		log.Fatal("Failed to configure notification channels:", err)
+	}
+
+	interval := 10 * time.Second
+	if env := os.Getenv("NOTIFICATION_INTERVAL"); env != "" {
+		if env == "off" {
+			log.Println("Notification worker disabled")
+			return
+		}
+		parsed, err := time.ParseDuration(env)
+		if err != nil || parsed < time.Second {
+			log.Printf("Invalid NOTIFICATION_INTERVAL %q, using %s", env, interval)
+		} else {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := deliverDueNotifications(); err != nil {
+				log.Printf("Notification worker failed: %v", err)
+			}
+		}
+	}()
+	log.Printf("Notification worker started (every %s)", interval)
+}
+
+// GetNotifications - รายการข้อความใน outbox
+// Query: status, event, channel, registration_id, teacher_registration_id, limit (ค่าเริ่มต้น 100, สูงสุด 500)
+func GetNotifications(c *fiber.Ctx) error {
+	query := database.DB.Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if event := c.Query("event"); event != "" {
+		query = query.Where("event = ?", event)
+	}
+	if channel := c.Query("channel"); channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if id := c.QueryInt("registration_id"); id > 0 {
+		query = query.Where("registration_id = ?", id)
+	}
+	if id := c.QueryInt("teacher_registration_id"); id > 0 {
+		query = query.Where("teacher_registration_id = ?", id)
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	var notifications []models.Notification
+	if err := query.Limit(limit).Find(&notifications).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	return c.JSON(notifications)
+}
+
+// RetryNotification - ส่งข้อความที่ล้มเหลวใหม่ทันที
+func RetryNotification(c *fiber.Ctx) error {
+	var notification models.Notification
+	if err := database.DB.First(&notification, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อความแจ้งเตือน",
+		})
+	}
+	if notification.Status == "sent" {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ข้อความนี้ส่งสำเร็จแล้ว",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// นับจำนวนครั้งใหม่ ให้ได้ส่งตาม backoff อีกรอบเต็ม
+		if err := tx.Model(&notification).Updates(map[string]interface{}{
+			"status":          "pending",
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      "ส่งข้อความแจ้งเตือนใหม่",
+			Description: fmt.Sprintf("ส่งข้อความ #%d (%s ทาง %s) ใหม่", notification.ID, notification.Event, notification.Channel),
+			Module:      "notification",
+			RecordID:    &notification.ID,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ตั้งให้ส่งข้อความใหม่แล้ว",
+	})
+}
+
+// GetNotificationTemplates - ข้อความแจ้งเตือนและตัวอย่างที่แทนค่าแล้ว (ใช้ตรวจคำผิดก่อนเปิดใช้ช่องทางจริง)
+func GetNotificationTemplates(c *fiber.Ctx) error {
+	sample := map[string]string{
+		"name":      "พระตัวอย่าง ฐิตธมฺโม",
+		"reference": registrationReference("registration", 123),
+		"temple":    "วัดตัวอย่าง",
+		"type":      "registration",
+		"stage":     "pariwat",
+		"count":     "12",
+		"code":      "123456",
+		"minutes":   "5",
+	}
+
+	result := fiber.Map{}
+	for event := range notificationTemplates {
+		previews := fiber.Map{}
+		for _, locale := range notificationLocales {
+			subject, body, err := renderNotification(event, locale, sample)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{
+					"error": err.Error(),
+				})
+			}
+			previews[locale] = fiber.Map{"subject": subject, "body": body}
+		}
+		result[event] = previews
+	}
+
+	channels := fiber.Map{}
+	for _, name := range []string{notify.Email, notify.SMS, notify.LINE} {
+		channels[name] = notify.Enabled(name)
+	}
+	return c.JSON(fiber.Map{
+		"templates": result,
+		"channels":  channels,
+	})
+}
@@ -0,0 +1,487 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"registration-system/database"
+	"registration-system/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// mergePatch - body ของ PATCH ตาม JSON Merge Patch (RFC 7396)
+// field ที่ไม่ส่งมาจะไม่ถูกแก้ไข, null หมายถึงล้างค่า
+type mergePatch struct {
+	fields map[string]json.RawMessage
+	errors map[string]string
+}
+
+// parseMergePatch - อ่าน body เป็น JSON object (รับ application/merge-patch+json และ application/json)
+func parseMergePatch(c *fiber.Ctx) (*mergePatch, error) {
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]))
+	if contentType != "" && contentType != "application/merge-patch+json" && contentType != fiber.MIMEApplicationJSON {
+		return nil, fmt.Errorf("Content-Type ต้องเป็น application/merge-patch+json")
+	}
+
+	patch := &mergePatch{fields: map[string]json.RawMessage{}, errors: map[string]string{}}
+	if err := json.Unmarshal(c.Body(), &patch.fields); err != nil || patch.fields == nil {
+		return nil, fmt.Errorf("body ต้องเป็น JSON object")
+	}
+	return patch, nil
+}
+
+func (p *mergePatch) has(field string) bool {
+	_, ok := p.fields[field]
+	return ok
+}
+
+func (p *mergePatch) isNull(field string) bool {
+	return bytes.Equal(bytes.TrimSpace(p.fields[field]), []byte("null"))
+}
+
+// decode - อ่านค่าของ field (คืน false ถ้าไม่ได้ส่งมา, null หรือผิดประเภท)
+func (p *mergePatch) decode(field string, required bool, target interface{}) bool {
+	if !p.has(field) {
+		return false
+	}
+	if p.isNull(field) {
+		if required {
+			p.errors[field] = "ไม่สามารถล้างค่าได้ (จำเป็นต้องมี)"
+		}
+		return false
+	}
+	if err := json.Unmarshal(p.fields[field], target); err != nil {
+		p.errors[field] = "ประเภทข้อมูลไม่ถูกต้อง"
+		return false
+	}
+	return true
+}
+
+// string - แก้ไขข้อความ (null = ค่าว่าง ถ้าไม่ required)
+func (p *mergePatch) string(field string, required bool, target *string) {
+	var value string
+	if p.decode(field, required, &value) {
+		value = strings.TrimSpace(value)
+		if required && value == "" {
+			p.errors[field] = "ต้องไม่เป็นค่าว่าง"
+			return
+		}
+		*target = value
+	} else if p.has(field) && p.isNull(field) && !required {
+		*target = ""
+	}
+}
+
+// uint - แก้ไข id อ้างอิง (ต้องมีค่าเสมอ)
+func (p *mergePatch) uint(field string, target *uint) {
+	var value uint
+	if p.decode(field, true, &value) {
+		if value == 0 {
+			p.errors[field] = "ต้องไม่เป็น 0"
+			return
+		}
+		*target = value
+	}
+}
+
+// optionalUint - แก้ไข id อ้างอิงที่ไม่บังคับ (null = ไม่อ้างอิง)
+func (p *mergePatch) optionalUint(field string, target **uint) {
+	var value uint
+	if p.decode(field, false, &value) {
+		if value == 0 {
+			p.errors[field] = "ต้องไม่เป็น 0"
+			return
+		}
+		*target = &value
+	} else if p.has(field) && p.isNull(field) {
+		*target = nil
+	}
+}
+
+// int - แก้ไขจำนวนเต็มที่ไม่ติดลบ (null = 0)
+func (p *mergePatch) int(field string, target *int) {
+	var value int
+	if p.decode(field, false, &value) {
+		if value < 0 {
+			p.errors[field] = "ต้องไม่ติดลบ"
+			return
+		}
+		*target = value
+	} else if p.has(field) && p.isNull(field) {
+		*target = 0
+	}
+}
+
+// bool - แก้ไขค่า true/false (null = false)
+func (p *mergePatch) bool(field string, target **bool) {
+	value := false
+	if p.decode(field, false, &value) || (p.has(field) && p.isNull(field)) {
+		*target = &value
+	}
+}
+
+// date - แก้ไขวันที่รูปแบบ YYYY-MM-DD (ต้องมีค่าเสมอ)
+func (p *mergePatch) date(field string, target *string) {
+	var value string
+	if p.decode(field, true, &value) {
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			p.errors[field] = "รูปแบบวันที่ไม่ถูกต้อง (ใช้ YYYY-MM-DD)"
+			return
+		}
+		*target = value
+	}
+}
+
+// optionalDate - แก้ไขวันที่ที่ไม่บังคับ (null = ล้างค่า)
+func (p *mergePatch) optionalDate(field string, target *string) {
+	var value string
+	if p.decode(field, false, &value) {
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			p.errors[field] = "รูปแบบวันที่ไม่ถูกต้อง (ใช้ YYYY-MM-DD)"
+			return
+		}
+		*target = value
+	} else if p.has(field) && p.isNull(field) {
+		*target = ""
+	}
+}
+
+// version - version ที่แก้ไขอยู่ (ใช้แทน If-Match ได้)
+func (p *mergePatch) version() *uint {
+	var value uint
+	if p.decode("version", false, &value) {
+		return &value
+	}
+	return nil
+}
+
+// rejectUnknown - field ที่แก้ไขไม่ได้
+func (p *mergePatch) rejectUnknown(allowed ...string) {
+	known := map[string]bool{"version": true}
+	for _, field := range allowed {
+		known[field] = true
+	}
+	for field := range p.fields {
+		if !known[field] {
+			p.errors[field] = "ไม่สามารถแก้ไข field นี้ได้"
+		}
+	}
+}
+
+func (p *mergePatch) invalid(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error":  "ข้อมูลไม่ถูกต้อง",
+		"fields": p.errors,
+	})
+}
+
+var registrationPatchFields = []string{
+	"full_name", "nickname", "birth_date", "province_id", "district_id", "sub_district_id",
+	"address_detail", "phone_number", "temple_name", "temple_id", "medical_condition", "vassa",
+	"national_id", "monk_certificate_no", "ordination_date", "preceptor",
+}
+
+// identityPatchFields - field ที่ต้องตรวจข้อมูลยืนยันตัวตนใหม่เมื่อถูกแก้ไข
+var identityPatchFields = []string{"national_id", "monk_certificate_no", "ordination_date", "birth_date", "vassa"}
+
+// patchRegistrationFields - ใช้ patch กับ field ของการลงทะเบียนและตรวจสอบความถูกต้อง
+func patchRegistrationFields(patch *mergePatch, fields *registrationFields) {
+	patch.string("full_name", true, &fields.FullName)
+	patch.string("nickname", false, &fields.Nickname)
+	patch.date("birth_date", &fields.BirthDate)
+	patch.uint("province_id", &fields.ProvinceID)
+	patch.uint("district_id", &fields.DistrictID)
+	patch.uint("sub_district_id", &fields.SubDistrictID)
+	patch.string("address_detail", false, &fields.AddressDetail)
+	patch.string("phone_number", true, &fields.PhoneNumber)
+	patch.string("temple_name", false, &fields.TempleName)
+	patch.optionalUint("temple_id", &fields.TempleID)
+	patch.string("medical_condition", false, &fields.MedicalCondition)
+	patch.int("vassa", &fields.Vassa)
+	patch.string("national_id", false, &fields.NationalID)
+	patch.string("monk_certificate_no", false, &fields.MonkCertificateNo)
+	patch.optionalDate("ordination_date", &fields.OrdinationDate)
+	patch.string("preceptor", false, &fields.Preceptor)
+
+	if patch.has("province_id") || patch.has("district_id") || patch.has("sub_district_id") {
+		if len(patch.errors) == 0 && !validateAddress(fields.ProvinceID, fields.DistrictID, fields.SubDistrictID) {
+			patch.errors["sub_district_id"] = "จังหวัด/อำเภอ/ตำบลไม่สัมพันธ์กัน"
+		}
+	}
+
+	// เปลี่ยนวัดจากทะเบียน หรือพิมพ์ชื่อวัดใหม่ (จับคู่กับทะเบียนวัดอีกครั้ง)
+	if patch.has("temple_id") || patch.has("temple_name") {
+		templeID := fields.TempleID
+		if !patch.has("temple_id") {
+			templeID = nil
+		}
+		if id, name, err := resolveTemple(templeID, fields.TempleName); err != nil {
+			patch.errors["temple_id"] = "ไม่พบวัดในทะเบียนวัด"
+		} else {
+			fields.TempleID, fields.TempleName = id, name
+		}
+	}
+}
+
+// patchIdentity - ตรวจข้อมูลยืนยันตัวตนอีกครั้งถ้ามี field ที่เกี่ยวข้องถูกแก้ไข
+func patchIdentity(patch *mergePatch, fields *registrationFields, table string, id uint) *identityError {
+	for _, field := range identityPatchFields {
+		if patch.has(field) {
+			return checkIdentity(fields, table, id)
+		}
+	}
+	return nil
+}
+
+// PatchRegistration - แก้ไขข้อมูลการลงทะเบียนบางส่วน (JSON Merge Patch)
+func PatchRegistration(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var registration models.Registration
+
+	if err := database.DB.First(&registration, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียน",
+		})
+	}
+
+	patch, err := parseMergePatch(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	expected, ok := expectedVersion(c, patch.version())
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != registration.Version {
+		return versionConflict(c, registration.Version, &registration)
+	}
+
+	before := registrationFieldsOf(&registration)
+	fields := before
+	patch.rejectUnknown(append(registrationPatchFields, "chanted_pariwat", "chanted_manat", "chanted_ok_apan")...)
+	patchRegistrationFields(patch, &fields)
+	patch.bool("chanted_pariwat", &fields.ChantedPariwat)
+	patch.bool("chanted_manat", &fields.ChantedManat)
+	patch.bool("chanted_ok_apan", &fields.ChantedOkApan)
+	if len(patch.errors) > 0 {
+		return patch.invalid(c)
+	}
+	if identityErr := patchIdentity(patch, &fields, "registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	fields.apply(&registration)
+
+	userID := c.Locals("userID").(uint)
+	registration.Version = expected + 1
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &registration, expected); err != nil {
+			return err
+		}
+		after := registrationFieldsOf(&registration)
+		if err := recordVersion(tx, "registration", registration.ID, "update", &before, &after, &userID); err != nil {
+			return err
+		}
+		return enqueueChantingCompleted(tx, &registration, &before)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.Registration
+		database.DB.First(&current, registration.ID)
+		return versionConflict(c, current.Version, &current)
+	}
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
+
+	redactMedicalCondition(c, &registration)
+	setETag(c, registration.Version)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "อัพเดทข้อมูลสำเร็จ",
+		"data":    registration,
+	})
+}
+
+// PatchTeacherRegistration - แก้ไขข้อมูลการลงทะเบียนพระอาจารย์บางส่วน (JSON Merge Patch)
+func PatchTeacherRegistration(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var registration models.TeacherRegistration
+
+	if err := database.DB.First(&registration, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียนพระอาจารย์",
+		})
+	}
+
+	patch, err := parseMergePatch(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	expected, ok := expectedVersion(c, patch.version())
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != registration.Version {
+		return versionConflict(c, registration.Version, &registration)
+	}
+
+	before := teacherRegistrationFieldsOf(&registration)
+	fields := before
+	patch.rejectUnknown(registrationPatchFields...)
+	patchRegistrationFields(patch, &fields)
+	if len(patch.errors) > 0 {
+		return patch.invalid(c)
+	}
+	if identityErr := patchIdentity(patch, &fields, "teacher_registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	fields.applyTeacher(&registration)
+
+	userID := c.Locals("userID").(uint)
+	registration.Version = expected + 1
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &registration, expected); err != nil {
+			return err
+		}
+		after := teacherRegistrationFieldsOf(&registration)
+		return recordVersion(tx, "teacher-registration", registration.ID, "update", &before, &after, &userID)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.TeacherRegistration
+		database.DB.First(&current, registration.ID)
+		return versionConflict(c, current.Version, &current)
+	}
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
+
+	redactMedicalCondition(c, &registration)
+	setETag(c, registration.Version)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "อัพเดทข้อมูลสำเร็จ",
+		"data":    registration,
+	})
+}
+
+// PatchFinanceTransaction - แก้ไขรายการรายรับรายจ่ายบางส่วน (JSON Merge Patch)
+func PatchFinanceTransaction(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var transaction models.Transaction
+
+	if err := database.DB.First(&transaction, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูล",
+		})
+	}
+
+	patch, err := parseMergePatch(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	expected, ok := expectedVersion(c, patch.version())
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != transaction.Version {
+		return versionConflict(c, transaction.Version, transaction)
+	}
+
+	patch.rejectUnknown("type", "amount", "description", "date", "category", "image_urls")
+
+	var transactionType string
+	if patch.decode("type", true, &transactionType) {
+		if transactionType != "income" && transactionType != "expense" {
+			patch.errors["type"] = "ประเภทต้องเป็น 'income' หรือ 'expense'"
+		} else {
+			transaction.Type = transactionType
+		}
+	}
+
+	var amount float64
+	if patch.decode("amount", true, &amount) {
+		if amount <= 0 {
+			patch.errors["amount"] = "จำนวนเงินต้องมากกว่า 0"
+		} else {
+			transaction.Amount = amount
+		}
+	}
+
+	patch.string("description", true, &transaction.Description)
+	patch.string("category", false, &transaction.Category)
+
+	var date string
+	patch.date("date", &date)
+	if date != "" {
+		transaction.Date, _ = time.Parse("2006-01-02", date)
+	}
+
+	var imageURLs []string
+	if patch.decode("image_urls", false, &imageURLs) {
+		if len(imageURLs) > 5 {
+			patch.errors["image_urls"] = "สามารถอัพโหลดได้สูงสุด 5 ภาพ"
+		} else {
+			transaction.ImageURLs = models.StringArray(imageURLs)
+		}
+	} else if patch.has("image_urls") && patch.isNull("image_urls") {
+		transaction.ImageURLs = models.StringArray{}
+	}
+
+	if len(patch.errors) > 0 {
+		return patch.invalid(c)
+	}
+
+	transaction.Version = expected + 1
+	if err := updateVersioned(database.DB, &transaction, expected); err != nil {
+		if errors.Is(err, errVersionConflict) {
+			var current models.Transaction
+			database.DB.Preload("User").First(&current, transaction.ID)
+			return versionConflict(c, current.Version, &current)
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	// บันทึก Activity Log
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "แก้ไขรายการ " + transaction.Type + " (Finance)",
+		Description: transaction.Description + " - จำนวน " + formatFinanceMoney(transaction.Amount),
+		Module:      "finance",
+		RecordID:    &transaction.ID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	database.DB.Preload("User").First(&transaction, transaction.ID)
+	setETag(c, transaction.Version)
+	return c.JSON(transaction)
+}
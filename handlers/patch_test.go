@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func newMergePatch(t *testing.T, body string) *mergePatch {
+	t.Helper()
+	patch := &mergePatch{fields: map[string]json.RawMessage{}, errors: map[string]string{}}
+	if err := json.Unmarshal([]byte(body), &patch.fields); err != nil {
+		t.Fatalf("invalid test body %s: %v", body, err)
+	}
+	return patch
+}
+
+func TestMergePatchString(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		required  bool
+		want      string
+		wantError bool
+	}{
+		{"absent keeps value", `{}`, true, "เดิม", false},
+		{"set and trimmed", `{"v": "  ใหม่ "}`, true, "ใหม่", false},
+		{"null clears optional", `{"v": null}`, false, "", false},
+		{"null rejected when required", `{"v": null}`, true, "เดิม", true},
+		{"blank rejected when required", `{"v": "  "}`, true, "เดิม", true},
+		{"wrong type", `{"v": 5}`, false, "เดิม", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := newMergePatch(t, tt.body)
+			value := "เดิม"
+			patch.string("v", tt.required, &value)
+			if value != tt.want {
+				t.Errorf("value = %q, want %q", value, tt.want)
+			}
+			if _, got := patch.errors["v"]; got != tt.wantError {
+				t.Errorf("error = %v, want %v (%v)", got, tt.wantError, patch.errors)
+			}
+		})
+	}
+}
+
+func TestMergePatchNumbersAndReferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantInt   int
+		wantID    uint
+		wantOptID *uint
+		wantError []string
+	}{
+		{"absent keeps values", `{}`, 3, 7, uintPtr(9), nil},
+		{"set values", `{"n": 5, "id": 8, "opt": 10}`, 5, 8, uintPtr(10), nil},
+		{"null resets int and optional id", `{"n": null, "opt": null}`, 0, 7, nil, nil},
+		{"negative int rejected", `{"n": -1}`, 3, 7, uintPtr(9), []string{"n"}},
+		{"zero ids rejected", `{"id": 0, "opt": 0}`, 3, 7, uintPtr(9), []string{"id", "opt"}},
+		{"required id cannot be null", `{"id": null}`, 3, 7, uintPtr(9), []string{"id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := newMergePatch(t, tt.body)
+			n, id, opt := 3, uint(7), uintPtr(9)
+			patch.int("n", &n)
+			patch.uint("id", &id)
+			patch.optionalUint("opt", &opt)
+
+			if n != tt.wantInt || id != tt.wantID {
+				t.Errorf("n, id = %d, %d, want %d, %d", n, id, tt.wantInt, tt.wantID)
+			}
+			if (opt == nil) != (tt.wantOptID == nil) || (opt != nil && *opt != *tt.wantOptID) {
+				t.Errorf("opt = %v, want %v", opt, tt.wantOptID)
+			}
+			if len(patch.errors) != len(tt.wantError) {
+				t.Errorf("errors = %v, want fields %v", patch.errors, tt.wantError)
+			}
+			for _, field := range tt.wantError {
+				if _, ok := patch.errors[field]; !ok {
+					t.Errorf("missing error for %q", field)
+				}
+			}
+		})
+	}
+}
+
+func TestMergePatchBoolAndDates(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantBool  *bool
+		wantDate  string
+		wantOpt   string
+		wantError int
+	}{
+		{"absent", `{}`, nil, "2000-01-01", "2010-01-01", 0},
+		{"set", `{"b": true, "d": "1990-05-06", "od": "2015-07-01"}`, boolPtr(true), "1990-05-06", "2015-07-01", 0},
+		{"null bool is false, null optional date clears", `{"b": null, "od": null}`, boolPtr(false), "2000-01-01", "", 0},
+		{"bad dates", `{"d": "06/05/1990", "od": "2015-13-01"}`, nil, "2000-01-01", "2010-01-01", 2},
+		{"required date cannot be null", `{"d": null}`, nil, "2000-01-01", "2010-01-01", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch := newMergePatch(t, tt.body)
+			var b *bool
+			d, od := "2000-01-01", "2010-01-01"
+			patch.bool("b", &b)
+			patch.date("d", &d)
+			patch.optionalDate("od", &od)
+
+			if (b == nil) != (tt.wantBool == nil) || (b != nil && *b != *tt.wantBool) {
+				t.Errorf("b = %v, want %v", b, tt.wantBool)
+			}
+			if d != tt.wantDate || od != tt.wantOpt {
+				t.Errorf("d, od = %q, %q, want %q, %q", d, od, tt.wantDate, tt.wantOpt)
+			}
+			if len(patch.errors) != tt.wantError {
+				t.Errorf("errors = %v, want %d", patch.errors, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestMergePatchVersionAndUnknownFields(t *testing.T) {
+	patch := newMergePatch(t, `{"version": 4, "nickname": "x", "id": 1, "created_at": "2024-01-01"}`)
+	if version := patch.version(); version == nil || *version != 4 {
+		t.Errorf("version = %v, want 4", version)
+	}
+	patch.rejectUnknown("nickname")
+	if len(patch.errors) != 2 || patch.errors["id"] == "" || patch.errors["created_at"] == "" {
+		t.Errorf("errors = %v, want id and created_at rejected", patch.errors)
+	}
+
+	if version := newMergePatch(t, `{}`).version(); version != nil {
+		t.Errorf("version without field = %v, want nil", *version)
+	}
+}
+
+func uintPtr(v uint) *uint { return &v }
+
+func boolPtr(v bool) *bool { return &v }
@@ -0,0 +1,711 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"registration-system/database"
+	"registration-system/middleware"
+	"registration-system/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// pdpaResponseDays - ระยะเวลาที่ต้องดำเนินการตามคำขอของเจ้าของข้อมูล
+const pdpaResponseDays = 30
+
+// ConsentRequest - ความยินยอมที่ส่งมาพร้อมฟอร์มลงทะเบียนสาธารณะ
+type ConsentRequest struct {
+	PolicyVersion string   `json:"policy_version"`
+	Purposes      []string `json:"purposes"` // ต้องมี "registration" เสมอ เช่น ["registration", "medical", "contact"]
+}
+
+type DataSubjectRequestRequest struct {
+	Type                  string `json:"type"`
+	Status                string `json:"status"`
+	RegistrationID        *uint  `json:"registration_id"`
+	TeacherRegistrationID *uint  `json:"teacher_registration_id"`
+	RequesterName         string `json:"requester_name"`
+	RequesterContact      string `json:"requester_contact"`
+	Details               string `json:"details"`
+	ReceivedAt            string `json:"received_at"` // Format: "2006-01-02" (ไม่ระบุ = วันนี้)
+	Resolution            string `json:"resolution"`
+}
+
+var validDataSubjectRequestTypes = map[string]bool{
+	"access":        true,
+	"erasure":       true,
+	"rectification": true,
+	"objection":     true,
+}
+
+var validDataSubjectRequestStatuses = map[string]bool{
+	"pending":     true,
+	"in_progress": true,
+	"fulfilled":   true,
+	"rejected":    true,
+}
+
+// buildConsentRecords - ตรวจสอบและสร้างบันทึกความยินยอมจาก request สาธารณะ
+func buildConsentRecords(c *fiber.Ctx, consent *ConsentRequest) ([]models.ConsentRecord, error) {
+	if consent == nil || strings.TrimSpace(consent.PolicyVersion) == "" {
+		return nil, fmt.Errorf("consent required")
+	}
+
+	hasRegistration := false
+	seen := make(map[string]bool)
+	now := time.Now()
+	records := make([]models.ConsentRecord, 0, len(consent.Purposes))
+	for _, purpose := range consent.Purposes {
+		purpose = strings.TrimSpace(purpose)
+		if purpose == "" || seen[purpose] {
+			continue
+		}
+		seen[purpose] = true
+		if purpose == "registration" {
+			hasRegistration = true
+		}
+		records = append(records, models.ConsentRecord{
+			Purpose:       purpose,
+			PolicyVersion: consent.PolicyVersion,
+			ConsentedAt:   now,
+			IPAddress:     maskIPAddress(c.IP()),
+			UserAgent:     c.Get("User-Agent"),
+		})
+	}
+
+	if !hasRegistration {
+		return nil, fmt.Errorf("registration consent required")
+	}
+	return records, nil
+}
+
+// saveConsentRecords - บันทึกความยินยอมผูกกับการลงทะเบียน (เรียกใน transaction เดียวกับการสร้าง)
+func saveConsentRecords(tx *gorm.DB, records []models.ConsentRecord, registrationID, teacherRegistrationID *uint) error {
+	for i := range records {
+		records[i].RegistrationID = registrationID
+		records[i].TeacherRegistrationID = teacherRegistrationID
+		if err := tx.Create(&records[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDataSubjectRequests - ดึงคำขอของเจ้าของข้อมูล
+// Query: status, type, overdue=true
+func GetDataSubjectRequests(c *fiber.Ctx) error {
+	var requests []models.DataSubjectRequest
+
+	query := database.DB.Preload("HandledBy").Order("due_at ASC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if requestType := c.Query("type"); requestType != "" {
+		query = query.Where("type = ?", requestType)
+	}
+	if c.Query("overdue") == "true" {
+		query = query.Where("status IN ? AND due_at < ?", []string{"pending", "in_progress"}, time.Now())
+	}
+
+	if err := query.Find(&requests).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	return c.JSON(requests)
+}
+
+// CreateDataSubjectRequest - บันทึกคำขอใช้สิทธิของเจ้าของข้อมูล
+func CreateDataSubjectRequest(c *fiber.Ctx) error {
+	var req DataSubjectRequestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if !validDataSubjectRequestTypes[req.Type] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ประเภทคำขอต้องเป็น 'access', 'erasure', 'rectification' หรือ 'objection'",
+		})
+	}
+	if strings.TrimSpace(req.RequesterName) == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณากรอกชื่อผู้ยื่นคำขอ",
+		})
+	}
+	if req.RegistrationID != nil && req.TeacherRegistrationID != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ระบุ registration_id หรือ teacher_registration_id ได้อย่างใดอย่างหนึ่ง",
+		})
+	}
+
+	receivedAt := time.Now()
+	if req.ReceivedAt != "" {
+		date, err := time.Parse("2006-01-02", req.ReceivedAt)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "รูปแบบวันที่ไม่ถูกต้อง (ใช้ YYYY-MM-DD)",
+			})
+		}
+		receivedAt = date
+	}
+
+	userID := c.Locals("userID").(uint)
+	request := models.DataSubjectRequest{
+		Type:                  req.Type,
+		Status:                "pending",
+		RegistrationID:        req.RegistrationID,
+		TeacherRegistrationID: req.TeacherRegistrationID,
+		RequesterName:         req.RequesterName,
+		RequesterContact:      req.RequesterContact,
+		Details:               req.Details,
+		ReceivedAt:            receivedAt,
+		DueAt:                 receivedAt.AddDate(0, 0, pdpaResponseDays),
+		HandledByID:           &userID,
+	}
+
+	if err := database.DB.Create(&request).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	activityLog := models.ActivityLog{
+		Action:      "รับคำขอเจ้าของข้อมูล",
+		Description: fmt.Sprintf("คำขอ %s #%d กำหนดเสร็จ %s", request.Type, request.ID, request.DueAt.Format("2006-01-02")),
+		Module:      "pdpa",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.Status(201).JSON(request)
+}
+
+// UpdateDataSubjectRequest - อัพเดทสถานะคำขอ
+func UpdateDataSubjectRequest(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var request models.DataSubjectRequest
+
+	if err := database.DB.First(&request, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบคำขอ",
+		})
+	}
+
+	var req DataSubjectRequestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.Status != "" {
+		if !validDataSubjectRequestStatuses[req.Status] {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "สถานะต้องเป็น 'pending', 'in_progress', 'fulfilled' หรือ 'rejected'",
+			})
+		}
+		request.Status = req.Status
+		if req.Status == "fulfilled" || req.Status == "rejected" {
+			now := time.Now()
+			request.FulfilledAt = &now
+		} else {
+			request.FulfilledAt = nil
+		}
+	}
+	if req.RegistrationID != nil {
+		request.RegistrationID = req.RegistrationID
+	}
+	if req.TeacherRegistrationID != nil {
+		request.TeacherRegistrationID = req.TeacherRegistrationID
+	}
+	if req.Details != "" {
+		request.Details = req.Details
+	}
+	if req.Resolution != "" {
+		request.Resolution = req.Resolution
+	}
+
+	userID := c.Locals("userID").(uint)
+	request.HandledByID = &userID
+
+	if err := database.DB.Omit("HandledBy").Save(&request).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	activityLog := models.ActivityLog{
+		Action:      "อัพเดทคำขอเจ้าของข้อมูล",
+		Description: fmt.Sprintf("คำขอ %s #%d สถานะ %s", request.Type, request.ID, request.Status),
+		Module:      "pdpa",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.JSON(request)
+}
+
+// errDataSubjectRequestMismatch - request_id ไม่พบ หรือเป็นคำขอของเจ้าของข้อมูลคนอื่น
+var errDataSubjectRequestMismatch = errors.New("data subject request does not belong to this subject")
+
+// fulfilDataSubjectRequest - ปิดคำขอที่อ้างถึงใน query request_id หลังดำเนินการสำเร็จ
+// คำขอต้องเป็นของเจ้าของข้อมูลรายนี้ ไม่เช่นนั้นคืน errDataSubjectRequestMismatch
+func fulfilDataSubjectRequest(c *fiber.Ctx, tx *gorm.DB, subject *dataSubject, resolution string) error {
+	requestID := c.QueryInt("request_id")
+	if requestID <= 0 {
+		return nil
+	}
+
+	var request models.DataSubjectRequest
+	if err := tx.Where("id = ? AND "+subject.column+" = ?", requestID, subject.id).First(&request).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errDataSubjectRequestMismatch
+		}
+		return err
+	}
+
+	userID := c.Locals("userID").(uint)
+	now := time.Now()
+	return tx.Model(&request).Updates(map[string]interface{}{
+		"status":        "fulfilled",
+		"fulfilled_at":  now,
+		"resolution":    resolution,
+		"handled_by_id": userID,
+	}).Error
+}
+
+// dataSubject - เจ้าของข้อมูล (ผู้ลงทะเบียนหรือพระอาจารย์) รวมรายการที่ถูก soft delete
+type dataSubject struct {
+	column   string // "registration_id" or "teacher_registration_id"
+	table    string
+	module   string
+	id       uint
+	fullName string
+	phone    string
+	record   interface{}
+}
+
+func loadDataSubject(c *fiber.Ctx, teacher bool) (*dataSubject, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid id")
+	}
+
+	if teacher {
+		var registration models.TeacherRegistration
+		if err := database.DB.Unscoped().Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, id).Error; err != nil {
+			return nil, err
+		}
+		return &dataSubject{
+			column: "teacher_registration_id", table: "teacher_registrations", module: "teacher-registration",
+			id: registration.ID, fullName: registration.FullName, phone: registration.PhoneNumber.String(), record: registration,
+		}, nil
+	}
+
+	var registration models.Registration
+	if err := database.DB.Unscoped().Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, id).Error; err != nil {
+		return nil, err
+	}
+	return &dataSubject{
+		column: "registration_id", table: "registrations", module: "registration",
+		id: registration.ID, fullName: registration.FullName, phone: registration.PhoneNumber.String(), record: registration,
+	}, nil
+}
+
+// DataExportPackage - ข้อมูลทั้งหมดที่ระบบเก็บเกี่ยวกับเจ้าของข้อมูลหนึ่งคน
+type DataExportPackage struct {
+	GeneratedAt      time.Time                   `json:"generated_at"`
+	Type             string                      `json:"type"`
+	Personal         interface{}                 `json:"personal"`
+	Consents         []models.ConsentRecord      `json:"consents"`
+	MedicalProfile   *models.MedicalProfile      `json:"medical_profile"`
+	MedicalIncidents []models.MedicalIncident    `json:"medical_incidents"`
+	RoomAssignment   *models.RoomAssignment      `json:"room_assignment"`
+	Requests         []models.DataSubjectRequest `json:"requests"`
+}
+
+// ExportRegistrationData - ส่งออกข้อมูลทั้งหมดของผู้ลงทะเบียน (format=json|pdf)
+func ExportRegistrationData(c *fiber.Ctx) error {
+	return exportDataSubject(c, false)
+}
+
+// ExportTeacherRegistrationData - ส่งออกข้อมูลทั้งหมดของพระอาจารย์ (format=json|pdf)
+func ExportTeacherRegistrationData(c *fiber.Ctx) error {
+	return exportDataSubject(c, true)
+}
+
+func exportDataSubject(c *fiber.Ctx, teacher bool) error {
+	subject, err := loadDataSubject(c, teacher)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียน",
+		})
+	}
+
+	pkg := DataExportPackage{
+		GeneratedAt: time.Now(),
+		Type:        subject.module,
+		Personal:    subject.record,
+	}
+	database.DB.Where(subject.column+" = ?", subject.id).Order("consented_at").Find(&pkg.Consents)
+	database.DB.Where(subject.column+" = ?", subject.id).Order("occurred_at").Find(&pkg.MedicalIncidents)
+	database.DB.Where(subject.column+" = ?", subject.id).Order("received_at").Find(&pkg.Requests)
+
+	var profile models.MedicalProfile
+	if err := database.DB.Preload("Conditions").Preload("Medications").Where(subject.column+" = ?", subject.id).First(&profile).Error; err == nil {
+		pkg.MedicalProfile = &profile
+	}
+	var assignment models.RoomAssignment
+	if err := database.DB.Preload("Room.Building").Where(subject.column+" = ?", subject.id).First(&assignment).Error; err == nil {
+		pkg.RoomAssignment = &assignment
+	}
+
+	format := c.Query("format", "json")
+	var body []byte
+	var contentType, extension string
+	switch format {
+	case "json":
+		body, err = json.MarshalIndent(pkg, "", "  ")
+		contentType, extension = fiber.MIMEApplicationJSONCharsetUTF8, "json"
+	case "pdf":
+		body, err = renderDataExportPDF(pkg, subject)
+		contentType, extension = "application/pdf", "pdf"
+	default:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "format ต้องเป็น 'json' หรือ 'pdf'",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถสร้างไฟล์ส่งออกได้: " + err.Error(),
+		})
+	}
+
+	if err := fulfilDataSubjectRequest(c, database.DB, subject, fmt.Sprintf("ส่งออกข้อมูล (%s) แล้ว", format)); err != nil {
+		if errors.Is(err, errDataSubjectRequestMismatch) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "ไม่พบคำขอ request_id ของเจ้าของข้อมูลรายนี้",
+			})
+		}
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทสถานะคำขอได้",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "ส่งออกข้อมูลส่วนบุคคล",
+		Description: fmt.Sprintf("ส่งออกข้อมูล %s #%d (%s)", subject.module, subject.id, format),
+		Module:      "pdpa",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%d-export.%s"`, subject.module, subject.id, extension))
+	return c.Send(body)
+}
+
+// renderDataExportPDF - สร้าง PDF จากชุดข้อมูลส่งออก
+// ต้องตั้ง PDPA_PDF_FONT เป็น path ของฟอนต์ TTF ที่รองรับภาษาไทย (เช่น THSarabunNew.ttf)
+func renderDataExportPDF(pkg DataExportPackage, subject *dataSubject) ([]byte, error) {
+	fontPath := os.Getenv("PDPA_PDF_FONT")
+	if fontPath == "" {
+		return nil, fmt.Errorf("PDPA_PDF_FONT ไม่ได้ตั้งค่า")
+	}
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8Font("thai", "", fontPath)
+	if pdf.Err() {
+		return nil, pdf.Error()
+	}
+	pdf.SetMargins(15, 15, 15)
+	pdf.AddPage()
+
+	pdf.SetFont("thai", "", 18)
+	pdf.MultiCell(0, 9, fmt.Sprintf("ข้อมูลส่วนบุคคลของ %s", subject.fullName), "", "L", false)
+	pdf.SetFont("thai", "", 11)
+	pdf.MultiCell(0, 6, fmt.Sprintf("สร้างเมื่อ %s", pkg.GeneratedAt.Format("2006-01-02 15:04:05")), "", "L", false)
+	pdf.Ln(4)
+
+	sections := []struct {
+		title string
+		data  interface{}
+	}{
+		{"ข้อมูลการลงทะเบียน", pkg.Personal},
+		{"ความยินยอม", pkg.Consents},
+		{"ข้อมูลสุขภาพ", pkg.MedicalProfile},
+		{"บันทึกเหตุการณ์สุขภาพ", pkg.MedicalIncidents},
+		{"ที่พัก", pkg.RoomAssignment},
+		{"คำขอของเจ้าของข้อมูล", pkg.Requests},
+	}
+	for _, section := range sections {
+		pdf.SetFont("thai", "", 14)
+		pdf.MultiCell(0, 8, section.title, "B", "L", false)
+		pdf.SetFont("thai", "", 11)
+
+		lines, err := flattenForPDF(section.data)
+		if err != nil {
+			return nil, err
+		}
+		if len(lines) == 0 {
+			lines = []string{"-"}
+		}
+		for _, line := range lines {
+			pdf.MultiCell(0, 6, line, "", "L", false)
+		}
+		pdf.Ln(3)
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flattenForPDF - แปลงข้อมูลเป็นบรรทัด "key: value" (ผ่าน JSON เพื่อใช้ชื่อ field เดียวกับไฟล์ JSON)
+func flattenForPDF(data interface{}) ([]string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	var walk func(prefix string, v interface{})
+	walk = func(prefix string, v interface{}) {
+		switch typed := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(typed))
+			for k := range typed {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				key := k
+				if prefix != "" {
+					key = prefix + "." + k
+				}
+				walk(key, typed[k])
+			}
+		case []interface{}:
+			for i, item := range typed {
+				walk(fmt.Sprintf("%s[%d]", prefix, i), item)
+			}
+		case nil:
+			return
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %v", prefix, typed))
+		}
+	}
+	walk("", value)
+	return lines, nil
+}
+
+// AnonymizeRegistration - ลบข้อมูลส่วนบุคคลของผู้ลงทะเบียนตามคำขอ (ยังคงนับในสถิติ)
+func AnonymizeRegistration(c *fiber.Ctx) error {
+	return anonymizeDataSubject(c, false)
+}
+
+// AnonymizeTeacherRegistration - ลบข้อมูลส่วนบุคคลของพระอาจารย์ตามคำขอ (ยังคงนับในสถิติ)
+func AnonymizeTeacherRegistration(c *fiber.Ctx) error {
+	return anonymizeDataSubject(c, true)
+}
+
+func anonymizeDataSubject(c *fiber.Ctx, teacher bool) error {
+	subject, err := loadDataSubject(c, teacher)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลการลงทะเบียน",
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := anonymizeSubject(tx, subject); err != nil {
+			return err
+		}
+		return fulfilDataSubjectRequest(c, tx, subject, "ลบข้อมูลส่วนบุคคล (anonymize) แล้ว")
+	})
+	if errors.Is(err, errDataSubjectRequestMismatch) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่พบคำขอ request_id ของเจ้าของข้อมูลรายนี้",
+		})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลส่วนบุคคลได้",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "ลบข้อมูลส่วนบุคคลตามคำขอ",
+		Description: fmt.Sprintf("anonymize %s #%d", subject.module, subject.id),
+		Module:      "pdpa",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบข้อมูลส่วนบุคคลสำเร็จ",
+	})
+}
+
+// anonymizeSubject - แทนที่ข้อมูลที่ระบุตัวตนได้ โดยเก็บจังหวัด/อำเภอ/ตำบล, ปีเกิด, พรรษา และสถานะการสวดไว้สำหรับสถิติ
+func anonymizeSubject(tx *gorm.DB, subject *dataSubject) error {
+	var birthDate time.Time
+	switch record := subject.record.(type) {
+	case models.Registration:
+		birthDate = record.BirthDate.Time
+	case models.TeacherRegistration:
+		birthDate = record.BirthDate.Time
+	}
+
+	now := time.Now()
+	if err := tx.Table(subject.table).Where("id = ?", subject.id).UpdateColumns(map[string]interface{}{
+		"full_name":              fmt.Sprintf("[ลบข้อมูลแล้ว #%d]", subject.id),
+		"nickname":               "",
+		"birth_date":             models.EncryptedDate{Time: time.Date(birthDate.Year(), 1, 1, 0, 0, 0, 0, time.UTC)},
+		"address_detail":         models.EncryptedString(""),
+		"phone_number":           models.EncryptedString(""),
+		"phone_number_index":     "",
+		"medical_condition":      models.EncryptedString(""),
+		"national_id":            models.EncryptedString(""),
+		"national_id_index":      "",
+		"monk_certificate_no":    models.EncryptedString(""),
+		"monk_certificate_index": "",
+		"ordination_date":        nil,
+		"preceptor":              "",
+		"anonymized_at":          now,
+		"updated_at":             now,
+		"version":                gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+
+	// ข้อมูลสุขภาพและที่พักไม่จำเป็นต้องเก็บไว้
+	var profileIDs []uint
+	tx.Model(&models.MedicalProfile{}).Where(subject.column+" = ?", subject.id).Pluck("id", &profileIDs)
+	if len(profileIDs) > 0 {
+		if err := tx.Where("medical_profile_id IN ?", profileIDs).Delete(&models.Medication{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM medical_profile_conditions WHERE medical_profile_id IN ?", profileIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", profileIDs).Delete(&models.MedicalProfile{}).Error; err != nil {
+			return err
+		}
+	}
+	if err := tx.Where(subject.column+" = ?", subject.id).Delete(&models.MedicalIncident{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where(subject.column+" = ?", subject.id).Delete(&models.RoomAssignment{}).Error; err != nil {
+		return err
+	}
+	// ข้อความแจ้งเตือนมีชื่อและเบอร์โทร
+	if err := tx.Where(subject.column+" = ?", subject.id).Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where(subject.column+" = ?", subject.id).Delete(&models.LineLink{}).Error; err != nil {
+		return err
+	}
+	// ผลการลงทะเบียนที่เก็บไว้ตอบคำขอซ้ำ (Idempotency-Key) มีข้อมูลทั้งแถว
+	if err := tx.Where("subject = ?", middleware.IdempotencySubject(subject.table, subject.id)).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.CheckIn{}).Where(subject.column+" = ?", subject.id).
+		Updates(map[string]interface{}{"note": "", "version": gorm.Expr("version + 1")}).Error; err != nil {
+		return err
+	}
+
+	// เก็บบันทึกความยินยอมไว้เป็นหลักฐาน แต่ลบข้อมูลอุปกรณ์
+	if err := tx.Model(&models.ConsentRecord{}).Where(subject.column+" = ?", subject.id).
+		Updates(map[string]interface{}{"ip_address": "", "user_agent": ""}).Error; err != nil {
+		return err
+	}
+
+	// ประวัติการแก้ไขมีข้อมูลส่วนบุคคลเดิมอยู่
+	if err := tx.Where("record_type = ? AND record_id = ?", subject.module, subject.id).Delete(&models.RecordVersion{}).Error; err != nil {
+		return err
+	}
+
+	// ลบชื่อ/เบอร์โทรที่ถูกบันทึกไว้ในคำอธิบายของ Activity Log
+	if err := scrubActivityLogs(tx, subject.fullName, subject.phone); err != nil {
+		return err
+	}
+
+	// ผู้ติดต่อของกลุ่มไม่ต้องเก็บไว้เมื่อผู้ลงทะเบียนทุกคนในกลุ่มถูก anonymize แล้ว
+	if record, ok := subject.record.(models.Registration); ok && record.GroupID != nil {
+		var remaining int64
+		if err := tx.Unscoped().Model(&models.Registration{}).
+			Where("group_id = ? AND anonymized_at IS NULL", *record.GroupID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return anonymizeGroupLeader(tx, *record.GroupID)
+		}
+	}
+
+	return nil
+}
+
+// anonymizeGroupLeader - ลบชื่อ/เบอร์โทรของผู้ติดต่อกลุ่ม พร้อมข้อความแจ้งเตือนที่ส่งถึงผู้ติดต่อ
+func anonymizeGroupLeader(tx *gorm.DB, groupID uint) error {
+	var group models.RegistrationGroup
+	if err := tx.First(&group, groupID).Error; err != nil {
+		return err
+	}
+	if group.AnonymizedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if err := tx.Model(&group).UpdateColumns(map[string]interface{}{
+		"leader_name":        fmt.Sprintf("[ลบข้อมูลแล้ว %s]", group.Code),
+		"leader_role":        "",
+		"leader_phone":       models.EncryptedString(""),
+		"leader_phone_index": "",
+		"notes":              "",
+		"cancellation_notes": "",
+		"anonymized_at":      now,
+		"updated_at":         now,
+	}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("group_id = ?", groupID).Delete(&models.Notification{}).Error; err != nil {
+		return err
+	}
+	return scrubActivityLogs(tx, group.LeaderName, group.LeaderPhone.String())
+}
+
+// scrubActivityLogs - แทนที่ชื่อ/เบอร์โทรในคำอธิบายของ Activity Log
+func scrubActivityLogs(tx *gorm.DB, values ...string) error {
+	for _, value := range values {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		// strpos แทน LIKE เพื่อไม่ให้ % หรือ _ ในชื่อกลายเป็น wildcard
+		if err := tx.Exec("UPDATE activity_logs SET description = replace(description, ?, '[ลบข้อมูลแล้ว]') WHERE strpos(description, ?) > 0",
+			value, value).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
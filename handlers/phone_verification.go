@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"registration-system/database"
+	"registration-system/fieldcrypt"
+	"registration-system/models"
+	"registration-system/notify"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	otpCodeTTL           = 5 * time.Minute  // รหัสใช้ได้นานเท่านี้
+	otpTokenTTL          = 30 * time.Minute // ยืนยันแล้วต้องส่งแบบฟอร์มภายในเวลานี้
+	otpMaxAttempts       = 5                // ใส่รหัสผิดได้ไม่เกินจำนวนนี้ต่อรหัส
+	otpResendInterval    = time.Minute      // ขอรหัสใหม่ให้เบอร์เดิมได้เมื่อพ้นเวลานี้
+	otpMaxPerPhonePerDay = 10
+	otpMaxPerIPPerHour   = 20
+	otpRetention         = 24 * time.Hour // ลบคำขอที่เก่ากว่านี้
+)
+
+// phoneVerificationRequired - บังคับยืนยันเบอร์โทรก่อนลงทะเบียนหรือไม่ (PHONE_VERIFICATION_REQUIRED=true)
+func phoneVerificationRequired() bool {
+	return os.Getenv("PHONE_VERIFICATION_REQUIRED") == "true" && notify.Enabled(notify.SMS)
+}
+
+// validMobilePhone - เบอร์มือถือไทย 10 หลัก (06, 08, 09)
+func validMobilePhone(phone string) bool {
+	digits := fieldcrypt.NormalizePhone(phone)
+	return len(digits) == 10 && (strings.HasPrefix(digits, "06") || strings.HasPrefix(digits, "08") || strings.HasPrefix(digits, "09"))
+}
+
+func hashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// errPhoneVerificationUsed - token ถูกใช้ลงทะเบียนไปแล้ว
+var errPhoneVerificationUsed = &identityError{Field: "phone_verification_token", Message: "การยืนยันเบอร์โทรนี้ถูกใช้ลงทะเบียนไปแล้ว กรุณายืนยันใหม่"}
+
+// checkPhoneVerification - ตรวจ token จากการยืนยัน OTP ว่าตรงกับเบอร์ที่ลงทะเบียน
+// ไม่ส่ง token มาคืน nil (ยกเว้นเปิดบังคับยืนยัน) token ใช้ได้ครั้งเดียว ต้องเรียก consumePhoneVerification ใน transaction ที่บันทึก
+func checkPhoneVerification(token, phone string) (*models.PhoneVerification, *identityError) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		if phoneVerificationRequired() {
+			return nil, &identityError{Field: "phone_verification_token", Message: "กรุณายืนยันเบอร์โทรด้วยรหัส OTP ก่อนลงทะเบียน"}
+		}
+		return nil, nil
+	}
+
+	var verification models.PhoneVerification
+	if err := database.DB.Where("token_hash = ?", hashVerificationToken(token)).First(&verification).Error; err != nil {
+		return nil, &identityError{Field: "phone_verification_token", Message: "การยืนยันเบอร์โทรไม่ถูกต้อง"}
+	}
+	if verification.TokenUsedAt != nil {
+		return nil, errPhoneVerificationUsed
+	}
+	if verification.TokenExpiresAt == nil || time.Now().After(*verification.TokenExpiresAt) {
+		return nil, &identityError{Field: "phone_verification_token", Message: "การยืนยันเบอร์โทรหมดอายุ กรุณายืนยันใหม่"}
+	}
+	if verification.PhoneIndex != models.PhoneIndex(phone) {
+		return nil, &identityError{Field: "phone_verification_token", Message: "เบอร์โทรไม่ตรงกับเบอร์ที่ยืนยันไว้"}
+	}
+	return &verification, nil
+}
+
+// consumePhoneVerification - ทำเครื่องหมายว่า token ถูกใช้แล้ว คืน errPhoneVerificationUsed ถ้ามีคำขออื่นใช้ไปก่อน
+func consumePhoneVerification(tx *gorm.DB, verification *models.PhoneVerification) error {
+	if verification == nil {
+		return nil
+	}
+	result := tx.Model(&models.PhoneVerification{}).
+		Where("id = ? AND token_used_at IS NULL", verification.ID).
+		Update("token_used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errPhoneVerificationUsed
+	}
+	return nil
+}
+
+// phoneVerifiedAt - เวลาที่ยืนยันเบอร์ (nil ถ้าไม่ได้ยืนยัน)
+func phoneVerifiedAt(verification *models.PhoneVerification) *time.Time {
+	if verification == nil {
+		return nil
+	}
+	return verification.VerifiedAt
+}
+
+// phoneChanged - เบอร์ใหม่ต่างจากเดิมหรือไม่ (เทียบแบบ normalize) ถ้าเปลี่ยนต้องยืนยันใหม่
+func phoneChanged(current models.EncryptedString, phone string) bool {
+	return fieldcrypt.NormalizePhone(current.String()) != fieldcrypt.NormalizePhone(phone)
+}
+
+// GetPhoneVerificationConfig - แบบฟอร์มสาธารณะใช้ตัดสินใจว่าจะแสดงขั้นตอน OTP หรือไม่
+func GetPhoneVerificationConfig(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"enabled":  notify.Enabled(notify.SMS),
+		"required": phoneVerificationRequired(),
+	})
+}
+
+// RequestPhoneVerification - ส่งรหัส OTP ทาง SMS ไปยังเบอร์โทร
+func RequestPhoneVerification(c *fiber.Ctx) error {
+	var req struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+	if !validMobilePhone(req.PhoneNumber) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณากรอกเบอร์มือถือ 10 หลัก",
+		})
+	}
+	channel := notify.Get(notify.SMS)
+	if channel == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "ระบบยืนยันเบอร์โทรยังไม่เปิดใช้งาน",
+		})
+	}
+
+	now := time.Now()
+	phoneIndex := models.PhoneIndex(req.PhoneNumber)
+	database.DB.Where("created_at < ?", now.Add(-otpRetention)).Delete(&models.PhoneVerification{})
+
+	var last models.PhoneVerification
+	if err := database.DB.Where("phone_index = ?", phoneIndex).Order("created_at DESC").First(&last).Error; err == nil {
+		if wait := last.CreatedAt.Add(otpResendInterval).Sub(now); wait > 0 {
+			c.Set(fiber.HeaderRetryAfter, fmt.Sprint(int(wait.Seconds())+1))
+			return c.Status(429).JSON(fiber.Map{
+				"error": fmt.Sprintf("กรุณารอ %d วินาทีก่อนขอรหัสใหม่", int(wait.Seconds())+1),
+			})
+		}
+	}
+	var phoneCount, ipCount int64
+	database.DB.Model(&models.PhoneVerification{}).Where("phone_index = ? AND created_at >= ?", phoneIndex, now.Add(-24*time.Hour)).Count(&phoneCount)
+	database.DB.Model(&models.PhoneVerification{}).Where("ip_address = ? AND created_at >= ?", c.IP(), now.Add(-time.Hour)).Count(&ipCount)
+	if phoneCount >= otpMaxPerPhonePerDay || ipCount >= otpMaxPerIPPerHour {
+		return c.Status(429).JSON(fiber.Map{
+			"error": "ขอรหัสบ่อยเกินไป กรุณาลองใหม่ภายหลัง",
+		})
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถสร้างรหัสได้",
+		})
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถสร้างรหัสได้",
+		})
+	}
+
+	verification := models.PhoneVerification{
+		PhoneIndex: phoneIndex,
+		IPAddress:  c.IP(),
+		CodeHash:   string(codeHash),
+		ExpiresAt:  now.Add(otpCodeTTL),
+	}
+	if err := database.DB.Create(&verification).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	// OTP ต้องถึงทันที จึงส่งตรงไม่ผ่าน outbox
+	_, body, err := renderNotification("phone_verification", defaultNotificationLocale(), map[string]string{
+		"code":    code,
+		"minutes": fmt.Sprint(int(otpCodeTTL.Minutes())),
+	})
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationSendTimeout)
+		err = channel.Send(ctx, notify.Message{To: fieldcrypt.NormalizePhone(req.PhoneNumber), Body: body})
+		cancel()
+	}
+	if err != nil {
+		database.DB.Delete(&verification)
+		return c.Status(502).JSON(fiber.Map{
+			"error": "ส่ง SMS ไม่สำเร็จ กรุณาลองใหม่อีกครั้ง",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"verification_id": verification.ID,
+		"expires_at":      verification.ExpiresAt,
+		"resend_after":    int(otpResendInterval.Seconds()),
+	})
+}
+
+// VerifyPhoneVerification - ตรวจรหัส OTP แล้วคืน token สำหรับส่งมากับการลงทะเบียน
+func VerifyPhoneVerification(c *fiber.Ctx) error {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	var verification models.PhoneVerification
+	if err := database.DB.First(&verification, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบคำขอยืนยันเบอร์โทร",
+		})
+	}
+	if verification.VerifiedAt != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ยืนยันเบอร์โทรนี้แล้ว",
+		})
+	}
+	now := time.Now()
+	if now.After(verification.ExpiresAt) {
+		return c.Status(410).JSON(fiber.Map{
+			"error": "รหัสหมดอายุ กรุณาขอรหัสใหม่",
+		})
+	}
+
+	// นับครั้งก่อนตรวจรหัส เพื่อให้คำขอพร้อมกันหลายคำขอนับครบทุกครั้ง
+	result := database.DB.Model(&models.PhoneVerification{}).
+		Where("id = ? AND attempts < ?", verification.ID, otpMaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(429).JSON(fiber.Map{
+			"error": "ใส่รหัสผิดเกินจำนวนครั้ง กรุณาขอรหัสใหม่",
+		})
+	}
+
+	code := fieldcrypt.NormalizeDigits(req.Code)
+	if bcrypt.CompareHashAndPassword([]byte(verification.CodeHash), []byte(code)) != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error":              "รหัสไม่ถูกต้อง",
+			"remaining_attempts": otpMaxAttempts - verification.Attempts - 1,
+		})
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถสร้าง token ได้",
+		})
+	}
+	token := hex.EncodeToString(secret)
+	tokenExpiresAt := now.Add(otpTokenTTL)
+	if err := database.DB.Model(&verification).Updates(map[string]interface{}{
+		"verified_at":      now,
+		"token_hash":       hashVerificationToken(token),
+		"token_expires_at": tokenExpiresAt,
+	}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"token":      token,
+		"expires_at": tokenExpiresAt,
+	})
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"registration-system/database"
+	"registration-system/middleware"
 	"registration-system/models"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type RegistrationRequest struct {
@@ -19,8 +22,24 @@ type RegistrationRequest struct {
 	AddressDetail    string `json:"address_detail"`
 	PhoneNumber      string `json:"phone_number"`
 	TempleName       string `json:"temple_name"`
+	TempleID         *uint  `json:"temple_id"` // วัดจากทะเบียน (ไม่ระบุ = จับคู่จาก temple_name)
 	MedicalCondition string `json:"medical_condition"`
 	Vassa            int    `json:"vassa"` // พรรษา
+
+	// ข้อมูลยืนยันตัวตน (ไม่บังคับ)
+	NationalID        string `json:"national_id"`
+	MonkCertificateNo string `json:"monk_certificate_no"`
+	OrdinationDate    string `json:"ordination_date"` // YYYY-MM-DD
+	Preceptor         string `json:"preceptor"`
+
+	// token จากการยืนยันเบอร์โทรด้วย OTP (ดู /public/phone-verifications)
+	PhoneVerificationToken string `json:"phone_verification_token,omitempty"`
+
+	// PDPA - ความยินยอม (บังคับเฉพาะการลงทะเบียนสาธารณะ)
+	Consent *ConsentRequest `json:"consent,omitempty"`
+
+	// version ที่แก้ไขอยู่ (ใช้แทน If-Match ได้)
+	Version *uint `json:"version,omitempty"`
 }
 
 func CreateRegistration(c *fiber.Ctx) error {
@@ -39,22 +58,70 @@ func CreateRegistration(c *fiber.Ctx) error {
 		})
 	}
 
+	consents, err := buildConsentRecords(c, req.Consent)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณายอมรับนโยบายความเป็นส่วนตัวก่อนลงทะเบียน",
+		})
+	}
+
+	templeID, templeName, err := resolveTemple(req.TempleID, req.TempleName)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่พบวัดที่เลือกในทะเบียนวัด",
+		})
+	}
+
+	phoneVerification, verifyErr := checkPhoneVerification(req.PhoneVerificationToken, req.PhoneNumber)
+	if verifyErr != nil {
+		return verifyErr.respond(c)
+	}
+
+	identity := req.identityFields()
+	if identityErr := checkIdentity(&identity, "registrations", 0); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
 	registration := models.Registration{
-		FullName:         req.FullName,
-		Nickname:         req.Nickname,
-		BirthDate:        birthDate,
-		ProvinceID:       req.ProvinceID,
-		DistrictID:       req.DistrictID,
-		SubDistrictID:    req.SubDistrictID,
-		AddressDetail:    req.AddressDetail,
-		PhoneNumber:      req.PhoneNumber,
-		TempleName:       req.TempleName,
-		MedicalCondition: req.MedicalCondition,
-		Vassa:            req.Vassa,
-	}
-
-	result := database.DB.Create(&registration)
-	if result.Error != nil {
+		FullName:          req.FullName,
+		Nickname:          req.Nickname,
+		BirthDate:         models.EncryptedDate{Time: birthDate},
+		ProvinceID:        req.ProvinceID,
+		DistrictID:        req.DistrictID,
+		SubDistrictID:     req.SubDistrictID,
+		AddressDetail:     models.EncryptedString(req.AddressDetail),
+		PhoneNumber:       models.EncryptedString(req.PhoneNumber),
+		PhoneVerifiedAt:   phoneVerifiedAt(phoneVerification),
+		TempleName:        templeName,
+		TempleID:          templeID,
+		MedicalCondition:  models.EncryptedString(req.MedicalCondition),
+		Vassa:             req.Vassa,
+		NationalID:        models.EncryptedString(identity.NationalID),
+		MonkCertificateNo: models.EncryptedString(identity.MonkCertificateNo),
+		OrdinationDate:    parseOptionalDate(identity.OrdinationDate),
+		Preceptor:         identity.Preceptor,
+	}
+
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := consumePhoneVerification(tx, phoneVerification); err != nil {
+			return err
+		}
+		if err := tx.Create(&registration).Error; err != nil {
+			return err
+		}
+		after := registrationFieldsOf(&registration)
+		if err := recordVersion(tx, "registration", registration.ID, "create", nil, &after, currentUserID(c)); err != nil {
+			return err
+		}
+		if err := saveConsentRecords(tx, consents, &registration.ID, nil); err != nil {
+			return err
+		}
+		return enqueueRegistrationCreated(tx, "registration", registration.ID, registration.FullName, registration.PhoneNumber.String(), registration.TempleName)
+	})
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create registration",
 		})
@@ -62,19 +129,38 @@ func CreateRegistration(c *fiber.Ctx) error {
 
 	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
 
+	middleware.SetIdempotencySubject(c, "registrations", registration.ID)
 	return c.Status(201).JSON(registration)
 }
 
+// filterRegistrationList - filter จาก query string ที่ใช้ร่วมกันระหว่างหน้ารายการและการส่งออก
+func filterRegistrationList(c *fiber.Ctx, query *gorm.DB) *gorm.DB {
+	// ค้นหาด้วยเบอร์โทร (เบอร์ถูกเข้ารหัส จึงค้นผ่าน blind index)
+	if phone := c.Query("phone"); phone != "" {
+		query = query.Where("phone_number_index = ?", models.PhoneIndex(phone))
+	}
+	if templeID := c.QueryInt("temple_id"); templeID > 0 {
+		query = query.Where("temple_id = ?", templeID)
+	}
+	return query
+}
+
 func GetRegistrations(c *fiber.Ctx) error {
 	var registrations []models.Registration
 
-	result := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").Order("created_at DESC").Find(&registrations)
+	query := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").Order("created_at DESC")
+
+	query = filterRegistrationList(c, query)
+
+	result := query.Find(&registrations)
 	if result.Error != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to fetch registrations",
 		})
 	}
 
+	maskRegistrationIdentity(registrations)
+	redactMedicalCondition(c, registrations)
 	return c.JSON(registrations)
 }
 
@@ -82,13 +168,15 @@ func GetRegistration(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var registration models.Registration
 
-	result := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, id)
+	result := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").Preload("RoomAssignment.Room.Building").First(&registration, id)
 	if result.Error != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Registration not found",
 		})
 	}
 
+	redactMedicalCondition(c, &registration)
+	setETag(c, registration.Version)
 	return c.JSON(registration)
 }
 
@@ -110,6 +198,14 @@ func UpdateRegistration(c *fiber.Ctx) error {
 		})
 	}
 
+	expected, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != registration.Version {
+		return versionConflict(c, registration.Version, &registration)
+	}
+
 	birthDate, err := time.Parse("2006-01-02", req.BirthDate)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
@@ -117,20 +213,61 @@ func UpdateRegistration(c *fiber.Ctx) error {
 		})
 	}
 
+	templeID, templeName, err := resolveTemple(req.TempleID, req.TempleName)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่พบวัดที่เลือกในทะเบียนวัด",
+		})
+	}
+
+	identity := req.identityFields()
+	identity.NationalID = keepMaskedIdentifier(identity.NationalID, registration.NationalID)
+	identity.MonkCertificateNo = keepMaskedIdentifier(identity.MonkCertificateNo, registration.MonkCertificateNo)
+	if identityErr := checkIdentity(&identity, "registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
+	before := registrationFieldsOf(&registration)
+
 	// Update fields
 	registration.FullName = req.FullName
 	registration.Nickname = req.Nickname
-	registration.BirthDate = birthDate
+	registration.BirthDate = models.EncryptedDate{Time: birthDate}
 	registration.ProvinceID = req.ProvinceID
 	registration.DistrictID = req.DistrictID
 	registration.SubDistrictID = req.SubDistrictID
-	registration.AddressDetail = req.AddressDetail
-	registration.PhoneNumber = req.PhoneNumber
-	registration.TempleName = req.TempleName
-	registration.MedicalCondition = req.MedicalCondition
+	registration.AddressDetail = models.EncryptedString(req.AddressDetail)
+	if phoneChanged(registration.PhoneNumber, req.PhoneNumber) {
+		registration.PhoneVerifiedAt = nil
+	}
+	registration.PhoneNumber = models.EncryptedString(req.PhoneNumber)
+	registration.TempleName = templeName
+	registration.TempleID = templeID
+	registration.MedicalCondition = models.EncryptedString(req.MedicalCondition)
 	registration.Vassa = req.Vassa
+	registration.NationalID = models.EncryptedString(identity.NationalID)
+	registration.MonkCertificateNo = models.EncryptedString(identity.MonkCertificateNo)
+	registration.OrdinationDate = parseOptionalDate(identity.OrdinationDate)
+	registration.Preceptor = identity.Preceptor
 
-	if err := database.DB.Save(&registration).Error; err != nil {
+	userID := c.Locals("userID").(uint)
+	registration.Version = expected + 1
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &registration, expected); err != nil {
+			return err
+		}
+		after := registrationFieldsOf(&registration)
+		return recordVersion(tx, "registration", registration.ID, "update", &before, &after, &userID)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.Registration
+		database.DB.First(&current, registration.ID)
+		return versionConflict(c, current.Version, &current)
+	}
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถอัพเดทข้อมูลได้",
 		})
@@ -139,6 +276,8 @@ func UpdateRegistration(c *fiber.Ctx) error {
 	// Load relationships
 	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
 
+	redactMedicalCondition(c, &registration)
+	setETag(c, registration.Version)
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "อัพเดทข้อมูลสำเร็จ",
@@ -161,7 +300,18 @@ func DeleteRegistration(c *fiber.Ctx) error {
 	userID := c.Locals("userID").(uint)
 
 	// Soft delete
-	if err := database.DB.Delete(&registration).Error; err != nil {
+	before := registrationFieldsOf(&registration)
+	err := eventTransaction(func(tx *gorm.DB) error {
+		if err := softDelete(tx, &registration, userID); err != nil {
+			return err
+		}
+		// คืนที่พักที่จัดไว้
+		if err := tx.Where("registration_id = ?", registration.ID).Delete(&models.RoomAssignment{}).Error; err != nil {
+			return err
+		}
+		return recordVersion(tx, "registration", registration.ID, "delete", &before, nil, &userID)
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถลบข้อมูลได้",
 		})
@@ -172,6 +322,7 @@ func DeleteRegistration(c *fiber.Ctx) error {
 		Action:      "ลบข้อมูลการลงทะเบียน",
 		Description: fmt.Sprintf("ลบข้อมูลของ %s (เบอร์โทร: %s)", registration.FullName, registration.PhoneNumber),
 		Module:      "registration",
+		RecordID:    &registration.ID,
 		UserID:      userID,
 	}
 	database.DB.Create(&activityLog)
@@ -181,3 +332,58 @@ func DeleteRegistration(c *fiber.Ctx) error {
 		"message": "ลบข้อมูลสำเร็จ",
 	})
 }
+
+// DuplicateGroup - กลุ่มการลงทะเบียนที่ใช้เบอร์โทร เลขบัตรประชาชน หรือเลขใบสุทธิเดียวกัน
+type DuplicateGroup struct {
+	MatchedOn            string                       `json:"matched_on"` // "phone_number", "national_id" or "monk_certificate_no"
+	PhoneNumber          string                       `json:"phone_number"`
+	Registrations        []models.Registration        `json:"registrations"`
+	TeacherRegistrations []models.TeacherRegistration `json:"teacher_registrations"`
+}
+
+// duplicateKeys - blind index ที่ใช้ตรวจการลงทะเบียนซ้ำ
+var duplicateKeys = []struct {
+	Column    string
+	MatchedOn string
+}{
+	{"phone_number_index", "phone_number"},
+	{"national_id_index", "national_id"},
+	{"monk_certificate_index", "monk_certificate_no"},
+}
+
+// GetDuplicateRegistrations - ค้นหาการลงทะเบียนซ้ำ (เบอร์โทร เลขบัตรประชาชน หรือเลขใบสุทธิเดียวกัน ทั้งผู้ลงทะเบียนและพระอาจารย์)
+func GetDuplicateRegistrations(c *fiber.Ctx) error {
+	groups := []DuplicateGroup{}
+	for _, key := range duplicateKeys {
+		var indexes []string
+		err := database.DB.Raw(fmt.Sprintf(`
+			SELECT %[1]s FROM (
+				SELECT %[1]s FROM registrations WHERE deleted_at IS NULL AND %[1]s <> ''
+				UNION ALL
+				SELECT %[1]s FROM teacher_registrations WHERE deleted_at IS NULL AND %[1]s <> ''
+			) AS identifiers
+			GROUP BY %[1]s
+			HAVING COUNT(*) > 1`, key.Column)).Scan(&indexes).Error
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "ไม่สามารถดึงข้อมูลได้",
+			})
+		}
+
+		for _, index := range indexes {
+			group := DuplicateGroup{MatchedOn: key.MatchedOn}
+			database.DB.Where(key.Column+" = ?", index).Order("created_at").Find(&group.Registrations)
+			database.DB.Where(key.Column+" = ?", index).Order("created_at").Find(&group.TeacherRegistrations)
+			if len(group.Registrations) > 0 {
+				group.PhoneNumber = group.Registrations[0].PhoneNumber.String()
+			} else if len(group.TeacherRegistrations) > 0 {
+				group.PhoneNumber = group.TeacherRegistrations[0].PhoneNumber.String()
+			}
+			maskRegistrationIdentity(group.Registrations)
+			maskTeacherRegistrationIdentity(group.TeacherRegistrations)
+			groups = append(groups, group)
+		}
+	}
+
+	return c.JSON(groups)
+}
@@ -0,0 +1,618 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"registration-system/database"
+	"registration-system/middleware"
+	"registration-system/models"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// retentionBatchSize - จำนวนแถวต่อ transaction ในการลบ/anonymize
+const retentionBatchSize = 200
+
+// retentionRule - กฎการเก็บข้อมูลที่ระบบรองรับ
+type retentionRule struct {
+	Name             string
+	Description      string
+	DefaultEnabled   bool
+	DefaultAfterDays int
+	// candidates คืน id ที่เข้าเงื่อนไข (สูงสุด limit แถว) แยกตามตาราง
+	candidates func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error)
+	// apply ลบ/anonymize แถวตาม id ภายใน transaction
+	apply func(tx *gorm.DB, table string, ids []uint) error
+}
+
+var retentionRules = []retentionRule{
+	{
+		Name:             "purge_deleted_registrations",
+		Description:      "ลบถาวรการลงทะเบียน (รวมพระอาจารย์) ที่ถูกลบไปแล้วเกินกำหนด",
+		DefaultEnabled:   true,
+		DefaultAfterDays: 90,
+		candidates: func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error) {
+			cutoff := time.Now().AddDate(0, 0, -policy.AfterDays)
+			result := make(map[string][]uint)
+			for _, table := range []string{"registrations", "teacher_registrations"} {
+				var ids []uint
+				if err := db.Table(table).Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+					Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+					return nil, err
+				}
+				if len(ids) > 0 {
+					result[table] = ids
+				}
+			}
+			return result, nil
+		},
+		apply: purgeRegistrations,
+	},
+	{
+		Name:             "anonymize_after_event",
+		Description:      "ลบข้อมูลส่วนบุคคลของการลงทะเบียนเมื่อพ้นวันจบงานตามกำหนด (ต้องตั้ง event_end_date)",
+		DefaultEnabled:   false,
+		DefaultAfterDays: 180,
+		candidates: func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error) {
+			if policy.EventEndDate == nil {
+				return nil, nil
+			}
+			if time.Now().Before(policy.EventEndDate.AddDate(0, 0, policy.AfterDays)) {
+				return nil, nil
+			}
+			result := make(map[string][]uint)
+			for _, table := range []string{"registrations", "teacher_registrations"} {
+				var ids []uint
+				// event_end_date เป็นวันที่ (00:00) จึงนับรวมทั้งวันจบงาน
+				if err := db.Table(table).Where("anonymized_at IS NULL AND created_at < ?", policy.EventEndDate.AddDate(0, 0, 1)).
+					Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+					return nil, err
+				}
+				if len(ids) > 0 {
+					result[table] = ids
+				}
+			}
+			return result, nil
+		},
+		apply: anonymizeRegistrations,
+	},
+	{
+		Name:             "delete_old_device_logs",
+		Description:      "ลบ Device Log ที่เก่ากว่ากำหนด",
+		DefaultEnabled:   true,
+		DefaultAfterDays: 365,
+		candidates: func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error) {
+			cutoff := time.Now().AddDate(0, 0, -policy.AfterDays)
+			var ids []uint
+			if err := db.Model(&models.DeviceLog{}).Where("created_at < ?", cutoff).
+				Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				return nil, nil
+			}
+			return map[string][]uint{"device_logs": ids}, nil
+		},
+		apply: func(tx *gorm.DB, table string, ids []uint) error {
+			return tx.Where("id IN ?", ids).Delete(&models.DeviceLog{}).Error
+		},
+	},
+	{
+		Name:             "clear_consent_ip_addresses",
+		Description:      "ลบ IP address และ user agent ในบันทึกความยินยอมที่เก่ากว่ากำหนด (เก็บบันทึกความยินยอมไว้)",
+		DefaultEnabled:   true,
+		DefaultAfterDays: 365,
+		candidates: func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error) {
+			cutoff := time.Now().AddDate(0, 0, -policy.AfterDays)
+			var ids []uint
+			if err := db.Model(&models.ConsentRecord{}).Where("created_at < ? AND (ip_address <> '' OR user_agent <> '')", cutoff).
+				Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				return nil, nil
+			}
+			return map[string][]uint{"consent_records": ids}, nil
+		},
+		apply: func(tx *gorm.DB, table string, ids []uint) error {
+			return tx.Model(&models.ConsentRecord{}).Where("id IN ?", ids).
+				Updates(map[string]interface{}{"ip_address": "", "user_agent": ""}).Error
+		},
+	},
+	{
+		Name:             "delete_old_blocked_requests",
+		Description:      "ลบบันทึกคำขอสาธารณะที่ถูกบล็อก (มี IP address) ที่เก่ากว่ากำหนด",
+		DefaultEnabled:   true,
+		DefaultAfterDays: 30,
+		candidates: func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error) {
+			cutoff := time.Now().AddDate(0, 0, -policy.AfterDays)
+			var ids []uint
+			if err := db.Model(&models.BlockedRequest{}).Where("created_at < ?", cutoff).
+				Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				return nil, nil
+			}
+			return map[string][]uint{"blocked_requests": ids}, nil
+		},
+		apply: func(tx *gorm.DB, table string, ids []uint) error {
+			return tx.Where("id IN ?", ids).Delete(&models.BlockedRequest{}).Error
+		},
+	},
+	{
+		Name:             "delete_old_webhook_deliveries",
+		Description:      "ลบประวัติการส่ง webhook (มีชื่อผู้ลงทะเบียนใน payload) ที่ส่งเสร็จหรือเลิกส่งแล้วเกินกำหนด",
+		DefaultEnabled:   true,
+		DefaultAfterDays: 30,
+		candidates: func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error) {
+			cutoff := time.Now().AddDate(0, 0, -policy.AfterDays)
+			var ids []uint
+			if err := db.Model(&models.WebhookDelivery{}).Where("status IN ? AND updated_at < ?", []string{"succeeded", "failed"}, cutoff).
+				Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				return nil, nil
+			}
+			return map[string][]uint{"webhook_deliveries": ids}, nil
+		},
+		apply: func(tx *gorm.DB, table string, ids []uint) error {
+			if err := tx.Where("delivery_id IN ?", ids).Delete(&models.WebhookAttempt{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("id IN ?", ids).Delete(&models.WebhookDelivery{}).Error
+		},
+	},
+	{
+		Name:             "delete_old_import_jobs",
+		Description:      "ลบงานนำเข้าข้อมูล (มีไฟล์ต้นฉบับและรายงานรายแถวที่มีข้อมูลส่วนบุคคล) ที่ไม่ได้ทำงานอยู่และเก่ากว่ากำหนด",
+		DefaultEnabled:   true,
+		DefaultAfterDays: 30,
+		candidates: func(db *gorm.DB, policy models.RetentionPolicy, limit int) (map[string][]uint, error) {
+			cutoff := time.Now().AddDate(0, 0, -policy.AfterDays)
+			var ids []uint
+			if err := db.Model(&models.ImportJob{}).Where("status IN ? AND updated_at < ?", []string{"validated", "completed", "failed"}, cutoff).
+				Order("id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				return nil, nil
+			}
+			return map[string][]uint{"import_jobs": ids}, nil
+		},
+		apply: func(tx *gorm.DB, table string, ids []uint) error {
+			return tx.Where("id IN ?", ids).Delete(&models.ImportJob{}).Error
+		},
+	},
+}
+
+// purgeRegistrations - ลบถาวรการลงทะเบียนพร้อมข้อมูลที่ผูกอยู่
+func purgeRegistrations(tx *gorm.DB, table string, ids []uint) error {
+	column := "registration_id"
+	if table == "teacher_registrations" {
+		column = "teacher_registration_id"
+	}
+
+	var profileIDs []uint
+	tx.Model(&models.MedicalProfile{}).Where(column+" IN ?", ids).Pluck("id", &profileIDs)
+	if len(profileIDs) > 0 {
+		if err := tx.Where("medical_profile_id IN ?", profileIDs).Delete(&models.Medication{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM medical_profile_conditions WHERE medical_profile_id IN ?", profileIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", profileIDs).Delete(&models.MedicalProfile{}).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, dependent := range []interface{}{&models.MedicalIncident{}, &models.RoomAssignment{}, &models.ConsentRecord{}, &models.Notification{}, &models.LineLink{}} {
+		if err := tx.Where(column+" IN ?", ids).Delete(dependent).Error; err != nil {
+			return err
+		}
+	}
+
+	// ผลการลงทะเบียนที่เก็บไว้ตอบคำขอซ้ำ (Idempotency-Key)
+	subjects := make([]string, len(ids))
+	for i, id := range ids {
+		subjects[i] = middleware.IdempotencySubject(table, id)
+	}
+	if err := tx.Where("subject IN ?", subjects).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return err
+	}
+
+	// บันทึกแถวที่ลบถาวรให้ sync แจ้งอุปกรณ์ออฟไลน์ลบออกจากเครื่อง
+	entity := "registration"
+	if table == "teacher_registrations" {
+		entity = "teacher_registration"
+	}
+	purged := make([]models.PurgedRecord, 0, len(ids))
+	for _, id := range ids {
+		purged = append(purged, models.PurgedRecord{Entity: entity, RecordID: id})
+	}
+	var checkIns []models.CheckIn
+	if err := tx.Unscoped().Select("id, client_id").Where(column+" IN ?", ids).Find(&checkIns).Error; err != nil {
+		return err
+	}
+	for _, checkIn := range checkIns {
+		purged = append(purged, models.PurgedRecord{Entity: "check_in", RecordID: checkIn.ID, ClientID: checkIn.ClientID})
+	}
+	if err := tx.Create(&purged).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where(column+" IN ?", ids).Delete(&models.CheckIn{}).Error; err != nil {
+		return err
+	}
+
+	recordType := "registration"
+	if table == "teacher_registrations" {
+		recordType = "teacher-registration"
+	}
+	if err := tx.Where("record_type = ? AND record_id IN ?", recordType, ids).Delete(&models.RecordVersion{}).Error; err != nil {
+		return err
+	}
+
+	var groupIDs []uint
+	if table == "registrations" {
+		if err := tx.Unscoped().Model(&models.Registration{}).Where("id IN ? AND group_id IS NOT NULL", ids).
+			Distinct().Pluck("group_id", &groupIDs).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec("DELETE FROM "+table+" WHERE id IN ?", ids).Error; err != nil {
+		return err
+	}
+
+	// กลุ่มที่ไม่เหลือผู้ลงทะเบียนแล้ว ลบพร้อมข้อมูลผู้ติดต่อ
+	for _, groupID := range groupIDs {
+		var remaining int64
+		if err := tx.Unscoped().Model(&models.Registration{}).Where("group_id = ?", groupID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining > 0 {
+			continue
+		}
+		if err := anonymizeGroupLeader(tx, groupID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.RegistrationGroup{}, groupID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// anonymizeRegistrations - anonymize ทีละรายการด้วยขั้นตอนเดียวกับคำขอ PDPA
+func anonymizeRegistrations(tx *gorm.DB, table string, ids []uint) error {
+	for _, id := range ids {
+		var subject *dataSubject
+		if table == "teacher_registrations" {
+			var registration models.TeacherRegistration
+			if err := tx.Unscoped().First(&registration, id).Error; err != nil {
+				return err
+			}
+			subject = &dataSubject{
+				column: "teacher_registration_id", table: table, module: "teacher-registration",
+				id: id, fullName: registration.FullName, phone: registration.PhoneNumber.String(), record: registration,
+			}
+		} else {
+			var registration models.Registration
+			if err := tx.Unscoped().First(&registration, id).Error; err != nil {
+				return err
+			}
+			subject = &dataSubject{
+				column: "registration_id", table: table, module: "registration",
+				id: id, fullName: registration.FullName, phone: registration.PhoneNumber.String(), record: registration,
+			}
+		}
+
+		if err := anonymizeSubject(tx, subject); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureRetentionPolicies - สร้างการตั้งค่าเริ่มต้นของกฎที่ยังไม่มีในฐานข้อมูล
+func ensureRetentionPolicies() ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	if err := database.DB.Find(&policies).Error; err != nil {
+		return nil, err
+	}
+
+	existing := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		existing[policy.Rule] = true
+	}
+	for _, rule := range retentionRules {
+		if existing[rule.Name] {
+			continue
+		}
+		policy := models.RetentionPolicy{
+			Rule:        rule.Name,
+			Description: rule.Description,
+			Enabled:     rule.DefaultEnabled,
+			AfterDays:   rule.DefaultAfterDays,
+		}
+		if err := database.DB.Create(&policy).Error; err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func findRetentionRule(name string) *retentionRule {
+	for i := range retentionRules {
+		if retentionRules[i].Name == name {
+			return &retentionRules[i]
+		}
+	}
+	return nil
+}
+
+// RetentionResult - ผลการทำงานของกฎหนึ่งข้อ
+type RetentionResult struct {
+	Rule     string           `json:"rule"`
+	Enabled  bool             `json:"enabled"`
+	Affected map[string]int64 `json:"affected"` // จำนวนแถวแยกตามตาราง
+	Error    string           `json:"error,omitempty"`
+}
+
+// runRetention - ทำงานตามกฎทั้งหมด (dryRun = นับอย่างเดียว)
+func runRetention(dryRun bool) ([]RetentionResult, error) {
+	policies, err := ensureRetentionPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]RetentionResult, 0, len(policies))
+	for _, policy := range policies {
+		rule := findRetentionRule(policy.Rule)
+		if rule == nil {
+			continue
+		}
+
+		result := RetentionResult{Rule: policy.Rule, Enabled: policy.Enabled, Affected: map[string]int64{}}
+		if dryRun {
+			// นับทั้งหมดโดยไม่จำกัด batch
+			candidates, err := rule.candidates(database.DB, policy, -1)
+			if err != nil {
+				result.Error = err.Error()
+			}
+			for table, ids := range candidates {
+				result.Affected[table] = int64(len(ids))
+			}
+			results = append(results, result)
+			continue
+		}
+
+		if !policy.Enabled {
+			results = append(results, result)
+			continue
+		}
+
+		var total int64
+		for {
+			candidates, err := rule.candidates(database.DB, policy, retentionBatchSize)
+			if err != nil {
+				result.Error = err.Error()
+				break
+			}
+			if len(candidates) == 0 {
+				break
+			}
+			err = database.DB.Transaction(func(tx *gorm.DB) error {
+				for table, ids := range candidates {
+					if err := rule.apply(tx, table, ids); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				result.Error = err.Error()
+				break
+			}
+			for table, ids := range candidates {
+				result.Affected[table] += int64(len(ids))
+				total += int64(len(ids))
+			}
+		}
+
+		now := time.Now()
+		database.DB.Model(&models.RetentionPolicy{}).Where("id = ?", policy.ID).Updates(map[string]interface{}{
+			"last_run_at":       now,
+			"last_run_affected": total,
+		})
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// summarizeRetention - ข้อความสรุปสำหรับ Activity Log
+func summarizeRetention(results []RetentionResult) (string, int64) {
+	var parts []string
+	var total int64
+	for _, result := range results {
+		for table, count := range result.Affected {
+			if count == 0 {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%s: %s %d แถว", result.Rule, table, count))
+			total += count
+		}
+		if result.Error != "" {
+			parts = append(parts, fmt.Sprintf("%s: ผิดพลาด %s", result.Rule, result.Error))
+		}
+	}
+	if len(parts) == 0 {
+		return "ไม่มีข้อมูลที่ถึงกำหนด", 0
+	}
+	return strings.Join(parts, ", "), total
+}
+
+// StartRetentionScheduler - รันกฎการเก็บข้อมูลตามรอบเวลา (RETENTION_INTERVAL เช่น "24h", "off" = ปิด)
+func StartRetentionScheduler() {
+	interval := 24 * time.Hour
+	if env := os.Getenv("RETENTION_INTERVAL"); env != "" {
+		if env == "off" {
+			log.Println("Retention scheduler disabled")
+			return
+		}
+		parsed, err := time.ParseDuration(env)
+		if err != nil || parsed < time.Minute {
+			log.Printf("Invalid RETENTION_INTERVAL %q, using %s", env, interval)
+		} else {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			results, err := runRetention(false)
+			if err != nil {
+				log.Printf("Retention job failed: %v", err)
+				continue
+			}
+			summary, total := summarizeRetention(results)
+			if total > 0 {
+				logSystemActivity("ลบข้อมูลตามระยะเวลาเก็บรักษา", summary, "retention")
+			}
+		}
+	}()
+	log.Printf("Retention scheduler started (every %s)", interval)
+}
+
+type RetentionPolicyRequest struct {
+	Enabled      *bool   `json:"enabled"`
+	AfterDays    *int    `json:"after_days"`
+	EventEndDate *string `json:"event_end_date"` // Format: "2006-01-02", "" = ล้างค่า
+}
+
+// GetRetentionPolicies - ดึงการตั้งค่าระยะเวลาเก็บข้อมูล
+func GetRetentionPolicies(c *fiber.Ctx) error {
+	policies, err := ensureRetentionPolicies()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	return c.JSON(policies)
+}
+
+// UpdateRetentionPolicy - แก้ไขการตั้งค่าของกฎ
+func UpdateRetentionPolicy(c *fiber.Ctx) error {
+	if _, err := ensureRetentionPolicies(); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	var policy models.RetentionPolicy
+	if err := database.DB.Where("rule = ?", c.Params("rule")).First(&policy).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบกฎที่ระบุ",
+		})
+	}
+
+	var req RetentionPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.AfterDays != nil {
+		if *req.AfterDays < 1 {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "after_days ต้องมากกว่า 0",
+			})
+		}
+		policy.AfterDays = *req.AfterDays
+	}
+	if req.EventEndDate != nil {
+		if *req.EventEndDate == "" {
+			policy.EventEndDate = nil
+		} else {
+			date, err := time.Parse("2006-01-02", *req.EventEndDate)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "รูปแบบวันที่ไม่ถูกต้อง (ใช้ YYYY-MM-DD)",
+				})
+			}
+			policy.EventEndDate = &date
+		}
+	}
+
+	if err := database.DB.Save(&policy).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "แก้ไขระยะเวลาเก็บข้อมูล",
+		Description: fmt.Sprintf("%s: enabled=%t after_days=%d", policy.Rule, policy.Enabled, policy.AfterDays),
+		Module:      "retention",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.JSON(policy)
+}
+
+// GetRetentionReport - รายงาน dry-run ว่าแต่ละกฎจะลบ/anonymize กี่แถว
+func GetRetentionReport(c *fiber.Ctx) error {
+	results, err := runRetention(true)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถสร้างรายงานได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"dry_run": true,
+		"results": results,
+	})
+}
+
+// RunRetention - สั่งรันกฎการเก็บข้อมูลทันที
+func RunRetention(c *fiber.Ctx) error {
+	results, err := runRetention(false)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถรันงานได้",
+		})
+	}
+
+	summary, _ := summarizeRetention(results)
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "ลบข้อมูลตามระยะเวลาเก็บรักษา",
+		Description: summary,
+		Module:      "retention",
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"results": results,
+	})
+}
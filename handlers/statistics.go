@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"fmt"
+	"registration-system/database"
+	"registration-system/models"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// statisticsCacheTTL - เก็บผลสถิติไว้ชั่วคราว (ถูกล้างทันทีเมื่อมีการแก้ไขข้อมูลการลงทะเบียน)
+const statisticsCacheTTL = time.Minute
+
+// statisticsTables - ตารางที่มีผลต่อสถิติ เขียนเมื่อไรให้ล้าง cache
+var statisticsTables = map[string]bool{
+	"registrations":         true,
+	"teacher_registrations": true,
+	"temples":               true,
+}
+
+type statisticsCacheEntry struct {
+	data      fiber.Map
+	expiresAt time.Time
+}
+
+var statisticsCache = struct {
+	sync.Mutex
+	entries    map[string]statisticsCacheEntry
+	generation uint64
+}{entries: map[string]statisticsCacheEntry{}}
+
+func invalidateStatisticsCache() {
+	statisticsCache.Lock()
+	statisticsCache.entries = map[string]statisticsCacheEntry{}
+	statisticsCache.generation++
+	statisticsCache.Unlock()
+}
+
+// RegisterStatisticsCacheInvalidation - ล้าง cache สถิติหลังการเขียนตารางการลงทะเบียนทุกครั้ง (ผ่าน GORM callback)
+func RegisterStatisticsCacheInvalidation(db *gorm.DB) {
+	invalidate := func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		if statisticsTables[tx.Statement.Table] {
+			invalidateStatisticsCache()
+			return
+		}
+		// tx.Exec ไม่มีชื่อตาราง ดูจาก SQL แทน
+		sql := tx.Statement.SQL.String()
+		for table := range statisticsTables {
+			if strings.Contains(sql, table) {
+				invalidateStatisticsCache()
+				return
+			}
+		}
+	}
+	db.Callback().Create().After("gorm:create").Register("statistics:invalidate_create", invalidate)
+	db.Callback().Update().After("gorm:update").Register("statistics:invalidate_update", invalidate)
+	db.Callback().Delete().After("gorm:delete").Register("statistics:invalidate_delete", invalidate)
+	db.Callback().Raw().After("gorm:raw").Register("statistics:invalidate_raw", invalidate)
+}
+
+// provinceRegions - ภาคของแต่ละจังหวัด (แบ่ง 6 ภาคตามราชบัณฑิตยสถาน)
+var provinceRegions = map[string][]string{
+	"ภาคเหนือ": {"เชียงราย", "เชียงใหม่", "น่าน", "พะเยา", "แพร่", "แม่ฮ่องสอน", "ลำปาง", "ลำพูน", "อุตรดิตถ์"},
+	"ภาคตะวันออกเฉียงเหนือ": {"กาฬสินธุ์", "ขอนแก่น", "ชัยภูมิ", "นครพนม", "นครราชสีมา", "บึงกาฬ", "บุรีรัมย์", "มหาสารคาม", "มุกดาหาร", "ยโสธร",
+		"ร้อยเอ็ด", "เลย", "ศรีสะเกษ", "สกลนคร", "สุรินทร์", "หนองคาย", "หนองบัวลำภู", "อำนาจเจริญ", "อุดรธานี", "อุบลราชธานี"},
+	"ภาคกลาง": {"กรุงเทพมหานคร", "กำแพงเพชร", "ชัยนาท", "นครนายก", "นครปฐม", "นครสวรรค์", "นนทบุรี", "ปทุมธานี", "พระนครศรีอยุธยา", "พิจิตร",
+		"พิษณุโลก", "เพชรบูรณ์", "ลพบุรี", "สมุทรปราการ", "สมุทรสงคราม", "สมุทรสาคร", "สิงห์บุรี", "สุโขทัย", "สุพรรณบุรี", "สระบุรี", "อ่างทอง", "อุทัยธานี"},
+	"ภาคตะวันออก": {"จันทบุรี", "ฉะเชิงเทรา", "ชลบุรี", "ตราด", "ปราจีนบุรี", "ระยอง", "สระแก้ว"},
+	"ภาคตะวันตก":  {"กาญจนบุรี", "ตาก", "ประจวบคีรีขันธ์", "เพชรบุรี", "ราชบุรี"},
+	"ภาคใต้":      {"กระบี่", "ชุมพร", "ตรัง", "นครศรีธรรมราช", "นราธิวาส", "ปัตตานี", "พังงา", "พัทลุง", "ภูเก็ต", "ยะลา", "ระนอง", "สงขลา", "สตูล", "สุราษฎร์ธานี"},
+}
+
+var regionOfProvince = func() map[string]string {
+	regions := map[string]string{}
+	for region, provinces := range provinceRegions {
+		for _, province := range provinces {
+			regions[province] = region
+		}
+	}
+	return regions
+}()
+
+// ageBands - ช่วงอายุ (อายุต่ำสุดของช่วง)
+var ageBands = []struct {
+	Label string
+	Min   int
+}{
+	{"ต่ำกว่า 20", 0}, {"20-29", 20}, {"30-39", 30}, {"40-49", 40}, {"50-59", 50}, {"60-69", 60}, {"70 ขึ้นไป", 70},
+}
+
+// StatisticsBucket - จำนวนในแต่ละกลุ่ม
+type StatisticsBucket struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Count int64  `json:"count"`
+}
+
+// statisticsFilter - เงื่อนไขจาก query string
+type statisticsFilter struct {
+	From       *time.Time
+	To         *time.Time
+	Type       string // "all", "registration" or "teacher"
+	ProvinceID int
+	TempleID   int
+	Stage      string // not_chanted, pariwat, manat หรือ ok_apan (เฉพาะผู้ลงทะเบียน)
+	Top        int
+}
+
+var statisticsStages = map[string]bool{"not_chanted": true, "pariwat": true, "manat": true, "ok_apan": true}
+
+func parseStatisticsFilter(c *fiber.Ctx) (*statisticsFilter, error) {
+	filter := &statisticsFilter{
+		Type:       c.Query("type", "all"),
+		ProvinceID: c.QueryInt("province_id"),
+		TempleID:   c.QueryInt("temple_id"),
+		Stage:      c.Query("stage"),
+		Top:        c.QueryInt("top", 20),
+	}
+	if filter.Type != "all" && filter.Type != "registration" && filter.Type != "teacher" {
+		return nil, fmt.Errorf("type ต้องเป็น 'all', 'registration' หรือ 'teacher'")
+	}
+	if filter.Stage != "" {
+		if !statisticsStages[filter.Stage] {
+			return nil, fmt.Errorf("stage ต้องเป็น 'not_chanted', 'pariwat', 'manat' หรือ 'ok_apan'")
+		}
+		filter.Type = "registration"
+	}
+	if filter.Top < 1 || filter.Top > 100 {
+		filter.Top = 20
+	}
+	if from := c.Query("from"); from != "" {
+		date, err := time.ParseInLocation("2006-01-02", from, statisticsLocation)
+		if err != nil {
+			return nil, fmt.Errorf("รูปแบบ from ไม่ถูกต้อง (ใช้ YYYY-MM-DD)")
+		}
+		filter.From = &date
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.ParseInLocation("2006-01-02", to, statisticsLocation)
+		if err != nil {
+			return nil, fmt.Errorf("รูปแบบ to ไม่ถูกต้อง (ใช้ YYYY-MM-DD)")
+		}
+		filter.To = &date
+	}
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, fmt.Errorf("to ต้องไม่อยู่ก่อน from")
+	}
+	return filter, nil
+}
+
+// statisticsLocation - นับวันตามเวลาไทย
+var statisticsLocation = time.FixedZone("Asia/Bangkok", 7*60*60)
+
+// source - subquery รวมผู้ลงทะเบียนและพระอาจารย์ตาม filter
+// status ของผู้ลงทะเบียนคือขั้นการสวดล่าสุด (พระอาจารย์ไม่มีสถานะการสวด)
+func (f *statisticsFilter) source() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	conditions = append(conditions, "deleted_at IS NULL")
+	if f.From != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *f.From)
+	}
+	if f.To != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, f.To.AddDate(0, 0, 1))
+	}
+	if f.ProvinceID > 0 {
+		conditions = append(conditions, "province_id = ?")
+		args = append(args, f.ProvinceID)
+	}
+	if f.TempleID > 0 {
+		conditions = append(conditions, "temple_id = ?")
+		args = append(args, f.TempleID)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var parts []string
+	var allArgs []interface{}
+	if f.Type != "teacher" {
+		parts = append(parts, `SELECT 'registration' AS type, province_id, district_id, temple_id, temple_name, vassa, birth_date, created_at,
+			CASE WHEN chanted_ok_apan THEN 'ok_apan' WHEN chanted_manat THEN 'manat' WHEN chanted_pariwat THEN 'pariwat' ELSE 'not_chanted' END AS status
+			FROM registrations WHERE `+where)
+		allArgs = append(allArgs, args...)
+	}
+	if f.Type != "registration" {
+		parts = append(parts, `SELECT 'teacher' AS type, province_id, district_id, temple_id, temple_name, vassa, birth_date, created_at, NULL AS status
+			FROM teacher_registrations WHERE `+where)
+		allArgs = append(allArgs, args...)
+	}
+	source := "(" + strings.Join(parts, " UNION ALL ") + ") AS r"
+	if f.Stage != "" {
+		source = "(SELECT * FROM " + source + " WHERE status = ?) AS r"
+		allArgs = append(allArgs, f.Stage)
+	}
+	return source, allArgs
+}
+
+// GetStatistics - สถิติการลงทะเบียนสำหรับ dashboard
+// Query: from, to (YYYY-MM-DD), type=all|registration|teacher, province_id, temple_id, stage, top (จำนวนวัดสูงสุด)
+func GetStatistics(c *fiber.Ctx) error {
+	filter, err := parseStatisticsFilter(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	cacheKey := string(c.Request().URI().QueryString())
+	statisticsCache.Lock()
+	entry, ok := statisticsCache.entries[cacheKey]
+	generation := statisticsCache.generation
+	statisticsCache.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		c.Set("X-Cache", "HIT")
+		return c.JSON(entry.data)
+	}
+
+	data, err := computeStatistics(filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถคำนวณสถิติได้",
+		})
+	}
+
+	// ไม่เก็บผลที่คำนวณระหว่างที่มีการเขียนข้อมูล
+	statisticsCache.Lock()
+	if statisticsCache.generation == generation {
+		statisticsCache.entries[cacheKey] = statisticsCacheEntry{data: data, expiresAt: time.Now().Add(statisticsCacheTTL)}
+	}
+	statisticsCache.Unlock()
+
+	c.Set("X-Cache", "MISS")
+	return c.JSON(data)
+}
+
+func computeStatistics(filter *statisticsFilter) (fiber.Map, error) {
+	source, args := filter.source()
+	db := database.DB
+
+	var byType []StatisticsBucket
+	if err := db.Raw(`SELECT type AS key, COUNT(*) AS count FROM `+source+` GROUP BY type ORDER BY type`, args...).Scan(&byType).Error; err != nil {
+		return nil, err
+	}
+	var total int64
+	for i := range byType {
+		total += byType[i].Count
+		byType[i].Label = map[string]string{"registration": "ผู้ลงทะเบียน", "teacher": "พระอาจารย์"}[byType[i].Key]
+	}
+
+	var byProvince []StatisticsBucket
+	if err := db.Raw(`SELECT r.province_id AS key, p.name_th AS label, COUNT(*) AS count FROM `+source+`
+		JOIN provinces p ON p.id = r.province_id
+		GROUP BY r.province_id, p.name_th ORDER BY count DESC, p.name_th`, args...).Scan(&byProvince).Error; err != nil {
+		return nil, err
+	}
+
+	regionCounts := map[string]int64{}
+	for _, province := range byProvince {
+		region := regionOfProvince[province.Label]
+		if region == "" {
+			region = "ไม่ทราบภาค"
+		}
+		regionCounts[region] += province.Count
+	}
+	byRegion := make([]StatisticsBucket, 0, len(regionCounts))
+	for region, count := range regionCounts {
+		byRegion = append(byRegion, StatisticsBucket{Key: region, Label: region, Count: count})
+	}
+	sort.Slice(byRegion, func(i, j int) bool { return byRegion[i].Count > byRegion[j].Count })
+
+	var byVassa []StatisticsBucket
+	if err := db.Raw(`SELECT band AS key, band AS label, COUNT(*) AS count FROM (
+			SELECT CASE WHEN vassa < 1 THEN '0' WHEN vassa < 5 THEN '1-4' WHEN vassa < 10 THEN '5-9'
+				WHEN vassa < 20 THEN '10-19' WHEN vassa < 30 THEN '20-29' ELSE '30+' END AS band,
+				LEAST(vassa, 30) AS sort_key
+			FROM `+source+`) AS bands
+		GROUP BY band ORDER BY MIN(sort_key)`, args...).Scan(&byVassa).Error; err != nil {
+		return nil, err
+	}
+
+	var byTemple []StatisticsBucket
+	if err := db.Raw(`SELECT COALESCE(CAST(r.temple_id AS TEXT), '') AS key,
+			COALESCE(t.name, NULLIF(TRIM(r.temple_name), ''), 'ไม่ระบุ') AS label, COUNT(*) AS count
+		FROM `+source+` LEFT JOIN temples t ON t.id = r.temple_id
+		GROUP BY 1, 2 ORDER BY count DESC, label LIMIT ?`, append(args, filter.Top)...).Scan(&byTemple).Error; err != nil {
+		return nil, err
+	}
+
+	var byStatus []StatisticsBucket
+	if err := db.Raw(`SELECT status AS key, COUNT(*) AS count FROM `+source+` WHERE status IS NOT NULL GROUP BY status`, args...).Scan(&byStatus).Error; err != nil {
+		return nil, err
+	}
+	statusLabels := map[string]string{"not_chanted": "ยังไม่ได้สวด", "pariwat": "สวดปริวาสแล้ว", "manat": "สวดมานัดแล้ว", "ok_apan": "สวดออกอาพานแล้ว"}
+	statusOrder := map[string]int{"not_chanted": 0, "pariwat": 1, "manat": 2, "ok_apan": 3}
+	for i := range byStatus {
+		byStatus[i].Label = statusLabels[byStatus[i].Key]
+	}
+	sort.Slice(byStatus, func(i, j int) bool { return statusOrder[byStatus[i].Key] < statusOrder[byStatus[j].Key] })
+
+	var daily []StatisticsBucket
+	if err := db.Raw(`SELECT TO_CHAR(created_at AT TIME ZONE 'Asia/Bangkok', 'YYYY-MM-DD') AS key, COUNT(*) AS count
+		FROM `+source+` GROUP BY 1 ORDER BY 1`, args...).Scan(&daily).Error; err != nil {
+		return nil, err
+	}
+	daily = fillDailySeries(daily, filter)
+
+	byAge, err := ageStatistics(source, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"total":       total,
+		"by_type":     byType,
+		"by_region":   byRegion,
+		"by_province": byProvince,
+		"by_age":      byAge,
+		"by_vassa":    byVassa,
+		"by_temple":   byTemple,
+		"by_status":   byStatus,
+		"daily":       daily,
+		"computed_at": time.Now(),
+	}, nil
+}
+
+// ageStatistics - วันเกิดถูกเข้ารหัส จึงคำนวณช่วงอายุใน Go แทน SQL
+func ageStatistics(source string, args []interface{}) ([]StatisticsBucket, error) {
+	counts := make([]int64, len(ageBands))
+	rows, err := database.DB.Raw(`SELECT birth_date FROM `+source, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	for rows.Next() {
+		var birthDate models.EncryptedDate
+		if err := rows.Scan(&birthDate); err != nil {
+			return nil, err
+		}
+		age := ageOn(birthDate.Time, now)
+		band := 0
+		for i, ageBand := range ageBands {
+			if age >= ageBand.Min {
+				band = i
+			}
+		}
+		counts[band]++
+	}
+
+	buckets := make([]StatisticsBucket, len(ageBands))
+	for i, band := range ageBands {
+		buckets[i] = StatisticsBucket{Key: band.Label, Label: band.Label, Count: counts[i]}
+	}
+	return buckets, rows.Err()
+}
+
+// fillDailySeries - เติมวันที่ไม่มีผู้ลงทะเบียนเป็น 0 เพื่อให้กราฟต่อเนื่อง
+func fillDailySeries(daily []StatisticsBucket, filter *statisticsFilter) []StatisticsBucket {
+	if len(daily) == 0 && (filter.From == nil || filter.To == nil) {
+		return []StatisticsBucket{}
+	}
+	counts := map[string]int64{}
+	for _, day := range daily {
+		counts[day.Key] = day.Count
+	}
+
+	var start, end time.Time
+	if filter.From != nil {
+		start = *filter.From
+	} else {
+		start, _ = time.ParseInLocation("2006-01-02", daily[0].Key, statisticsLocation)
+	}
+	if filter.To != nil {
+		end = *filter.To
+	} else {
+		end, _ = time.ParseInLocation("2006-01-02", daily[len(daily)-1].Key, statisticsLocation)
+	}
+	// กันช่วงวันที่ยาวเกินไป
+	if end.Sub(start) > 366*24*time.Hour {
+		return daily
+	}
+
+	series := []StatisticsBucket{}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		series = append(series, StatisticsBucket{Key: key, Label: key, Count: counts[key]})
+	}
+	return series
+}
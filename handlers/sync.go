@@ -0,0 +1,872 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"registration-system/database"
+	"registration-system/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	syncDefaultLimit = 500
+	syncMaxLimit     = 2000
+	syncMaxMutations = 500
+	// syncCursorVersion - cursor รุ่นอื่น (เช่น แบบเรียงตามเวลาเดิม) ให้ดึงใหม่ทั้งหมด
+	syncCursorVersion = 2
+)
+
+// syncPosition - ตำแหน่งล่าสุดที่ client ได้รับของแต่ละตาราง (เรียงตาม sync_xid แล้วตาม id)
+type syncPosition struct {
+	XID int64 `json:"x"`
+	ID  uint  `json:"id"`
+}
+
+// syncCursor - cursor ของการดึงข้อมูล ส่งให้ client แบบ opaque (base64 ของ JSON)
+type syncCursor struct {
+	Version              int          `json:"v"`
+	Registrations        syncPosition `json:"r"`
+	TeacherRegistrations syncPosition `json:"t"`
+	CheckIns             syncPosition `json:"c"`
+	Purged               syncPosition `json:"p"`
+}
+
+func (cursor syncCursor) encode() string {
+	cursor.Version = syncCursorVersion
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSyncCursor(value string) (syncCursor, error) {
+	var cursor syncCursor
+	if value == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, err
+	}
+	if cursor.Version != syncCursorVersion {
+		return syncCursor{}, nil
+	}
+	return cursor, nil
+}
+
+// syncRegistration - ข้อมูลที่แท็บเล็ตใช้ค้นหาและเช็คอิน (ไม่ส่งข้อมูลอ่อนไหว เช่น เบอร์โทร วันเกิด ที่อยู่ ข้อมูลสุขภาพ)
+type syncRegistration struct {
+	ID             uint       `json:"id"`
+	Version        uint       `json:"version"`
+	FullName       string     `json:"full_name"`
+	Nickname       string     `json:"nickname"`
+	TempleName     string     `json:"temple_name"`
+	TempleID       *uint      `json:"temple_id,omitempty"`
+	ProvinceID     uint       `json:"province_id"`
+	DistrictID     uint       `json:"district_id"`
+	SubDistrictID  uint       `json:"sub_district_id"`
+	Vassa          int        `json:"vassa"`
+	GroupID        *uint      `json:"group_id,omitempty"`
+	ChantedPariwat *bool      `json:"chanted_pariwat,omitempty"` // เฉพาะผู้ลงทะเบียน
+	ChantedManat   *bool      `json:"chanted_manat,omitempty"`
+	ChantedOkApan  *bool      `json:"chanted_ok_apan,omitempty"`
+	AnonymizedAt   *time.Time `json:"anonymized_at,omitempty"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// syncTombstone - แถวที่ถูกลบหลัง cursor ให้ client ลบออกจากเครื่อง
+type syncTombstone struct {
+	ID        uint      `json:"id"`
+	ClientID  string    `json:"client_id,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// syncRegistrationColumns - column ที่ใช้ (ไม่โหลด column ที่เข้ารหัส)
+const syncRegistrationColumns = "id, version, sync_xid, full_name, nickname, temple_name, temple_id, province_id, district_id, sub_district_id, vassa, anonymized_at, updated_at, deleted_at"
+
+func registrationSyncOf(r *models.Registration) syncRegistration {
+	chantedPariwat, chantedManat, chantedOkApan := r.ChantedPariwat, r.ChantedManat, r.ChantedOkApan
+	return syncRegistration{
+		ID: r.ID, Version: r.Version, FullName: r.FullName, Nickname: r.Nickname,
+		TempleName: r.TempleName, TempleID: r.TempleID,
+		ProvinceID: r.ProvinceID, DistrictID: r.DistrictID, SubDistrictID: r.SubDistrictID,
+		Vassa: r.Vassa, GroupID: r.GroupID,
+		ChantedPariwat: &chantedPariwat, ChantedManat: &chantedManat, ChantedOkApan: &chantedOkApan,
+		AnonymizedAt: r.AnonymizedAt, UpdatedAt: r.UpdatedAt,
+	}
+}
+
+func teacherRegistrationSyncOf(r *models.TeacherRegistration) syncRegistration {
+	return syncRegistration{
+		ID: r.ID, Version: r.Version, FullName: r.FullName, Nickname: r.Nickname,
+		TempleName: r.TempleName, TempleID: r.TempleID,
+		ProvinceID: r.ProvinceID, DistrictID: r.DistrictID, SubDistrictID: r.SubDistrictID,
+		Vassa: r.Vassa, AnonymizedAt: r.AnonymizedAt, UpdatedAt: r.UpdatedAt,
+	}
+}
+
+// syncChangeTime - เวลาเปลี่ยนแปลงของแถว และแถวถูกลบ (soft delete) หรือไม่
+func syncChangeTime(updatedAt time.Time, deletedAt gorm.DeletedAt) (time.Time, bool) {
+	if deletedAt.Valid && !deletedAt.Time.Before(updatedAt) {
+		return deletedAt.Time, true
+	}
+	return updatedAt, false
+}
+
+// syncHorizon - transaction ที่เก่าที่สุดที่ยังไม่จบ แถวที่ sync_xid น้อยกว่านี้จะไม่มีแถวใหม่แทรกเข้ามาอีก
+// (transaction ยาว เช่น การนำเข้า จะถูกส่งหลัง commit แทนที่จะถูกข้ามไป)
+func syncHorizon() (int64, error) {
+	var horizon int64
+	err := database.DB.Raw("SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint").Scan(&horizon).Error
+	return horizon, err
+}
+
+// syncChanges - ดึงแถวที่เปลี่ยนหลัง position (รวมแถวที่ถูกลบ) เกิน limit หนึ่งแถวเพื่อบอกว่ายังมีอีก
+func syncChanges(query *gorm.DB, position syncPosition, horizon int64, limit int, dest interface{}) error {
+	return query.Unscoped().
+		Where("(sync_xid, id) > (?, ?)", position.XID, position.ID).
+		Where("sync_xid < ?", horizon).
+		Order("sync_xid, id").
+		Limit(limit + 1).
+		Find(dest).Error
+}
+
+// SyncPull - ดึงการเปลี่ยนแปลงของผู้ลงทะเบียน พระอาจารย์ และการเช็คอินหลัง cursor (ไม่ส่ง cursor = ดึงทั้งหมด)
+// ดึงซ้ำด้วย cursor ที่ได้จนกว่า has_more เป็น false
+func SyncPull(c *fiber.Ctx) error {
+	cursor, err := decodeSyncCursor(c.Query("cursor"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "cursor ไม่ถูกต้อง",
+		})
+	}
+	limit := c.QueryInt("limit", syncDefaultLimit)
+	if limit < 1 || limit > syncMaxLimit {
+		limit = syncDefaultLimit
+	}
+	horizon, err := syncHorizon()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	hasMore := false
+
+	registrations := []syncRegistration{}
+	teacherRegistrations := []syncRegistration{}
+	checkIns := []models.CheckIn{}
+	deleted := fiber.Map{
+		"registrations":         []syncTombstone{},
+		"teacher_registrations": []syncTombstone{},
+		"check_ins":             []syncTombstone{},
+	}
+
+	var registrationRows []models.Registration
+	if err := syncChanges(database.DB.Select(syncRegistrationColumns+", group_id, chanted_pariwat, chanted_manat, chanted_ok_apan"),
+		cursor.Registrations, horizon, limit, &registrationRows); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	if len(registrationRows) > limit {
+		registrationRows, hasMore = registrationRows[:limit], true
+	}
+	tombstones := []syncTombstone{}
+	for i := range registrationRows {
+		r := &registrationRows[i]
+		at, isDeleted := syncChangeTime(r.UpdatedAt, r.DeletedAt)
+		cursor.Registrations = syncPosition{XID: r.SyncXID, ID: r.ID}
+		if isDeleted {
+			tombstones = append(tombstones, syncTombstone{ID: r.ID, DeletedAt: at})
+		} else {
+			registrations = append(registrations, registrationSyncOf(r))
+		}
+	}
+	deleted["registrations"] = tombstones
+
+	var teacherRows []models.TeacherRegistration
+	if err := syncChanges(database.DB.Select(syncRegistrationColumns), cursor.TeacherRegistrations, horizon, limit, &teacherRows); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	if len(teacherRows) > limit {
+		teacherRows, hasMore = teacherRows[:limit], true
+	}
+	tombstones = []syncTombstone{}
+	for i := range teacherRows {
+		r := &teacherRows[i]
+		at, isDeleted := syncChangeTime(r.UpdatedAt, r.DeletedAt)
+		cursor.TeacherRegistrations = syncPosition{XID: r.SyncXID, ID: r.ID}
+		if isDeleted {
+			tombstones = append(tombstones, syncTombstone{ID: r.ID, DeletedAt: at})
+		} else {
+			teacherRegistrations = append(teacherRegistrations, teacherRegistrationSyncOf(r))
+		}
+	}
+	deleted["teacher_registrations"] = tombstones
+
+	var checkInRows []models.CheckIn
+	if err := syncChanges(database.DB, cursor.CheckIns, horizon, limit, &checkInRows); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	if len(checkInRows) > limit {
+		checkInRows, hasMore = checkInRows[:limit], true
+	}
+	tombstones = []syncTombstone{}
+	for _, checkIn := range checkInRows {
+		at, isDeleted := syncChangeTime(checkIn.UpdatedAt, checkIn.DeletedAt)
+		cursor.CheckIns = syncPosition{XID: checkIn.SyncXID, ID: checkIn.ID}
+		if isDeleted {
+			tombstones = append(tombstones, syncTombstone{ID: checkIn.ID, ClientID: checkIn.ClientID, DeletedAt: at})
+		} else {
+			checkIns = append(checkIns, checkIn)
+		}
+	}
+	deleted["check_ins"] = tombstones
+
+	// แถวที่ถูกลบถาวร (ไม่เหลือแถวให้ส่งเป็น soft delete แล้ว)
+	var purgedRows []models.PurgedRecord
+	if err := syncChanges(database.DB, cursor.Purged, horizon, limit, &purgedRows); err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	if len(purgedRows) > limit {
+		purgedRows, hasMore = purgedRows[:limit], true
+	}
+	purgedKeys := map[string]string{
+		"registration":         "registrations",
+		"teacher_registration": "teacher_registrations",
+		"check_in":             "check_ins",
+	}
+	for _, purged := range purgedRows {
+		cursor.Purged = syncPosition{XID: purged.SyncXID, ID: purged.ID}
+		key := purgedKeys[purged.Entity]
+		if key == "" {
+			continue
+		}
+		deleted[key] = append(deleted[key].([]syncTombstone), syncTombstone{ID: purged.RecordID, ClientID: purged.ClientID, DeletedAt: purged.CreatedAt})
+	}
+
+	return c.JSON(fiber.Map{
+		"cursor":                cursor.encode(),
+		"has_more":              hasMore,
+		"server_time":           time.Now(),
+		"registrations":         registrations,
+		"teacher_registrations": teacherRegistrations,
+		"check_ins":             checkIns,
+		"deleted":               deleted,
+	})
+}
+
+// กฎแก้ข้อขัดแย้งเมื่อ base_version ของ client ไม่ตรงกับข้อมูลปัจจุบัน (ข้อมูลถูกแก้ที่อื่นระหว่างออฟไลน์)
+// ทุกกฎ: ถ้าค่าของ client ตรงกับ server หรือ server ยังเป็นค่า base ที่ client เห็น ใช้ค่าของ client
+const (
+	syncServerWins = "server_wins" // ใช้ค่าของ server
+	syncTrueWins   = "true_wins"   // true ชนะ (สถานะที่ทำแล้วไม่ถูกย้อนโดยอุปกรณ์ที่ข้อมูลเก่า)
+	syncEarliest   = "earliest"    // เวลาที่เก่ากว่า
+	syncLatest     = "latest"      // เวลาที่ใหม่กว่า (ค่าว่าง = ยังไม่เกิด)
+	syncImmutable  = "immutable"   // แก้ไขไม่ได้หลังสร้าง
+)
+
+// syncField - ชนิดข้อมูล (bool, string, id, time) และกฎแก้ข้อขัดแย้งของ field ที่ซิงค์ได้
+type syncField struct {
+	Kind      string `json:"kind"`
+	Rule      string `json:"rule"`
+	MaxLength int    `json:"max_length,omitempty"`
+}
+
+// syncFields - field ที่ client ส่งการแก้ไขมาได้ แยกตาม entity
+var syncFields = map[string]map[string]syncField{
+	"registration": {
+		"nickname":        {Kind: "string", Rule: syncServerWins, MaxLength: 100},
+		"chanted_pariwat": {Kind: "bool", Rule: syncTrueWins},
+		"chanted_manat":   {Kind: "bool", Rule: syncTrueWins},
+		"chanted_ok_apan": {Kind: "bool", Rule: syncTrueWins},
+	},
+	"check_in": {
+		"registration_id":         {Kind: "id", Rule: syncImmutable},
+		"teacher_registration_id": {Kind: "id", Rule: syncImmutable},
+		"checked_in_at":           {Kind: "time", Rule: syncEarliest},
+		"checked_out_at":          {Kind: "time", Rule: syncLatest},
+		"note":                    {Kind: "string", Rule: syncServerWins, MaxLength: 500},
+	},
+}
+
+// decodeSyncValue - แปลงค่า JSON เป็นค่ามาตรฐานสำหรับเปรียบเทียบ (bool, string, uint, time.Time หรือ nil)
+func decodeSyncValue(field syncField, raw json.RawMessage) (interface{}, error) {
+	null := strings.TrimSpace(string(raw)) == "null"
+	switch field.Kind {
+	case "bool":
+		var value bool
+		if null || json.Unmarshal(raw, &value) != nil {
+			return nil, errors.New("ต้องเป็น true หรือ false")
+		}
+		return value, nil
+	case "string":
+		var value string
+		if !null && json.Unmarshal(raw, &value) != nil {
+			return nil, errors.New("ต้องเป็นข้อความ")
+		}
+		value = strings.TrimSpace(value)
+		if field.MaxLength > 0 && len([]rune(value)) > field.MaxLength {
+			return nil, fmt.Errorf("ยาวเกิน %d ตัวอักษร", field.MaxLength)
+		}
+		return value, nil
+	case "id":
+		var value uint
+		if null {
+			return nil, nil
+		}
+		if json.Unmarshal(raw, &value) != nil || value == 0 {
+			return nil, errors.New("id ไม่ถูกต้อง")
+		}
+		return value, nil
+	case "time":
+		var value time.Time
+		if null {
+			return nil, nil
+		}
+		if json.Unmarshal(raw, &value) != nil {
+			return nil, errors.New("รูปแบบเวลาไม่ถูกต้อง (RFC3339)")
+		}
+		return value.UTC().Truncate(time.Microsecond), nil
+	}
+	return nil, errors.New("ชนิดข้อมูลไม่รองรับ")
+}
+
+func syncEqual(a, b interface{}) bool {
+	if at, ok := a.(time.Time); ok {
+		bt, ok := b.(time.Time)
+		return ok && at.Equal(bt)
+	}
+	return a == b
+}
+
+// resolveSyncField - เลือกค่าที่จะบันทึก คืน true ถ้าค่าของ client ไม่ถูกใช้ (ข้อขัดแย้ง)
+func resolveSyncField(field syncField, stale, hasBase bool, base, server, client interface{}) (interface{}, bool) {
+	if syncEqual(server, client) {
+		return server, false
+	}
+	if field.Rule == syncImmutable {
+		return server, true
+	}
+	if !stale || (hasBase && syncEqual(base, server)) {
+		return client, false
+	}
+
+	resolved := server
+	switch field.Rule {
+	case syncTrueWins:
+		resolved = server.(bool) || client.(bool)
+	case syncEarliest, syncLatest:
+		serverTime, serverSet := server.(time.Time)
+		clientTime, clientSet := client.(time.Time)
+		switch {
+		case !serverSet:
+			resolved = client
+		case !clientSet:
+			resolved = server
+		case (field.Rule == syncEarliest) == clientTime.Before(serverTime):
+			resolved = client
+		}
+	}
+	return resolved, !syncEqual(resolved, client)
+}
+
+// SyncMutation - การแก้ไขหนึ่งรายการที่ค้างอยู่บนอุปกรณ์
+type SyncMutation struct {
+	Entity      string                     `json:"entity"`    // "check_in" or "registration"
+	Op          string                     `json:"op"`        // "upsert" or "delete" (delete ใช้ได้กับ check_in)
+	ClientID    string                     `json:"client_id"` // check_in: UUID ที่อุปกรณ์สร้าง
+	ID          uint                       `json:"id"`        // registration: id บน server
+	BaseVersion uint                       `json:"base_version"`
+	Fields      map[string]json.RawMessage `json:"fields"`
+	Base        map[string]json.RawMessage `json:"base"` // ค่าเดิมที่ client เห็นก่อนแก้ (ไม่บังคับ ช่วยให้ merge ได้แม่นขึ้น)
+}
+
+// SyncConflict - field ที่ค่าของ client ไม่ถูกใช้
+type SyncConflict struct {
+	Field       string      `json:"field"`
+	Rule        string      `json:"rule"`
+	ClientValue interface{} `json:"client_value"`
+	ServerValue interface{} `json:"server_value"`
+	Resolved    interface{} `json:"resolved_value"`
+}
+
+// SyncResult - ผลของแต่ละรายการ
+type SyncResult struct {
+	Index     int            `json:"index"`
+	Entity    string         `json:"entity"`
+	ClientID  string         `json:"client_id,omitempty"`
+	ID        uint           `json:"id,omitempty"`
+	Status    string         `json:"status"` // "applied", "merged", "unchanged", "conflict", "deleted", "rejected", "not_found"
+	Version   uint           `json:"version,omitempty"`
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+	Record    interface{}    `json:"record,omitempty"` // ข้อมูลล่าสุดบน server
+	Message   string         `json:"message,omitempty"`
+}
+
+// errSyncRejected - รายการไม่ผ่านการตรวจสอบ (ข้อความอยู่ใน SyncResult)
+var errSyncRejected = errors.New("sync mutation rejected")
+
+// syncMerge - ผลการรวมค่าของ client กับ server
+type syncMerge struct {
+	values    map[string]interface{}
+	conflicts []SyncConflict
+}
+
+// mergeSyncFields - ตรวจและรวม field ที่ client ส่งมากับค่าปัจจุบัน (current = nil ตอนสร้างใหม่)
+func mergeSyncFields(entity string, mutation *SyncMutation, current map[string]interface{}, stale bool) (*syncMerge, error) {
+	fields := syncFields[entity]
+	merge := &syncMerge{values: map[string]interface{}{}}
+
+	names := make([]string, 0, len(mutation.Fields))
+	for name := range mutation.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("ไม่รองรับการแก้ไข field %s", name)
+		}
+		client, err := decodeSyncValue(field, mutation.Fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		if current == nil {
+			merge.values[name] = client
+			continue
+		}
+
+		var base interface{}
+		raw, hasBase := mutation.Base[name]
+		if hasBase {
+			if base, err = decodeSyncValue(field, raw); err != nil {
+				return nil, fmt.Errorf("base.%s: %s", name, err.Error())
+			}
+		}
+		resolved, conflict := resolveSyncField(field, stale, hasBase, base, current[name], client)
+		merge.values[name] = resolved
+		if conflict {
+			merge.conflicts = append(merge.conflicts, SyncConflict{
+				Field: name, Rule: field.Rule, ClientValue: client, ServerValue: current[name], Resolved: resolved,
+			})
+		}
+	}
+	return merge, nil
+}
+
+// changed - มี field ใดที่ค่าต่างจากปัจจุบัน
+func (m *syncMerge) changed(current map[string]interface{}) bool {
+	for name, value := range m.values {
+		if !syncEqual(current[name], value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *syncMerge) status() string {
+	if len(m.conflicts) > 0 {
+		return "merged"
+	}
+	return "applied"
+}
+
+func optionalSyncID(value *uint) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func optionalSyncTime(value *time.Time) interface{} {
+	if value == nil {
+		return nil
+	}
+	return value.UTC()
+}
+
+func syncIDPointer(value interface{}) *uint {
+	if id, ok := value.(uint); ok {
+		return &id
+	}
+	return nil
+}
+
+func syncTimePointer(value interface{}) *time.Time {
+	if t, ok := value.(time.Time); ok {
+		return &t
+	}
+	return nil
+}
+
+func registrationSyncValues(r *models.Registration) map[string]interface{} {
+	return map[string]interface{}{
+		"nickname":        r.Nickname,
+		"chanted_pariwat": r.ChantedPariwat,
+		"chanted_manat":   r.ChantedManat,
+		"chanted_ok_apan": r.ChantedOkApan,
+	}
+}
+
+func checkInSyncValues(checkIn *models.CheckIn) map[string]interface{} {
+	return map[string]interface{}{
+		"registration_id":         optionalSyncID(checkIn.RegistrationID),
+		"teacher_registration_id": optionalSyncID(checkIn.TeacherRegistrationID),
+		"checked_in_at":           checkIn.CheckedInAt.UTC(),
+		"checked_out_at":          optionalSyncTime(checkIn.CheckedOutAt),
+		"note":                    checkIn.Note,
+	}
+}
+
+func (m *syncMerge) applyCheckIn(checkIn *models.CheckIn) {
+	for name, value := range m.values {
+		switch name {
+		case "registration_id":
+			checkIn.RegistrationID = syncIDPointer(value)
+		case "teacher_registration_id":
+			checkIn.TeacherRegistrationID = syncIDPointer(value)
+		case "checked_in_at":
+			if t, ok := value.(time.Time); ok {
+				checkIn.CheckedInAt = t
+			}
+		case "checked_out_at":
+			checkIn.CheckedOutAt = syncTimePointer(value)
+		case "note":
+			checkIn.Note = value.(string)
+		}
+	}
+}
+
+// validateCheckIn - ตรวจความถูกต้องของการเช็คอินหลังรวมค่า
+func validateCheckIn(checkIn *models.CheckIn) error {
+	if (checkIn.RegistrationID == nil) == (checkIn.TeacherRegistrationID == nil) {
+		return errors.New("ต้องระบุ registration_id หรือ teacher_registration_id อย่างใดอย่างหนึ่ง")
+	}
+	if checkIn.CheckedInAt.IsZero() {
+		return errors.New("กรุณาระบุ checked_in_at")
+	}
+	if checkIn.CheckedOutAt != nil && checkIn.CheckedOutAt.Before(checkIn.CheckedInAt) {
+		return errors.New("checked_out_at ต้องไม่ก่อน checked_in_at")
+	}
+	return nil
+}
+
+// syncCheckIn - สร้าง แก้ไข หรือลบการเช็คอินตาม client_id
+func syncCheckIn(tx *gorm.DB, mutation *SyncMutation, deviceID string, userID uint, result *SyncResult) error {
+	if _, err := uuid.Parse(mutation.ClientID); err != nil {
+		result.Status, result.Message = "rejected", "client_id ต้องเป็น UUID"
+		return errSyncRejected
+	}
+
+	var checkIn models.CheckIn
+	err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Where("client_id = ?", mutation.ClientID).First(&checkIn).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	exists := err == nil
+
+	if exists && checkIn.DeletedAt.Valid {
+		// การลบชนะเสมอ
+		result.ID, result.Version = checkIn.ID, checkIn.Version
+		if mutation.Op == "delete" {
+			result.Status = "unchanged"
+		} else {
+			result.Status, result.Message = "deleted", "การเช็คอินนี้ถูกลบแล้ว"
+		}
+		return nil
+	}
+
+	if mutation.Op == "delete" {
+		if !exists {
+			result.Status = "unchanged"
+			return nil
+		}
+		result.ID = checkIn.ID
+		if mutation.BaseVersion != checkIn.Version {
+			result.Status, result.Version, result.Record = "conflict", checkIn.Version, checkIn
+			result.Message = "การเช็คอินถูกแก้ไขที่อื่นหลังจากที่อุปกรณ์ซิงค์ครั้งล่าสุด"
+			return nil
+		}
+		if err := tx.Model(&checkIn).UpdateColumn("version", gorm.Expr("version + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&checkIn).Error; err != nil {
+			return err
+		}
+		result.Status, result.Version = "applied", checkIn.Version+1
+		return nil
+	}
+
+	if exists {
+		current := checkInSyncValues(&checkIn)
+		merge, err := mergeSyncFields("check_in", mutation, current, mutation.BaseVersion != checkIn.Version)
+		if err != nil {
+			result.Status, result.Message = "rejected", err.Error()
+			return errSyncRejected
+		}
+		return saveMergedCheckIn(tx, &checkIn, current, merge, result)
+	}
+
+	merge, err := mergeSyncFields("check_in", mutation, nil, false)
+	if err != nil {
+		result.Status, result.Message = "rejected", err.Error()
+		return errSyncRejected
+	}
+	checkIn = models.CheckIn{ClientID: mutation.ClientID, DeviceID: deviceID, UserID: userID, Version: 1}
+	merge.applyCheckIn(&checkIn)
+	if err := validateCheckIn(&checkIn); err != nil {
+		result.Status, result.Message = "rejected", err.Error()
+		return errSyncRejected
+	}
+
+	// ล็อกผู้ลงทะเบียนไว้ ให้อุปกรณ์ที่เช็คอินคนเดียวกันพร้อมกันรวมเป็นรายการเดียว
+	table, column, id := "registrations", "registration_id", checkIn.RegistrationID
+	if id == nil {
+		table, column, id = "teacher_registrations", "teacher_registration_id", checkIn.TeacherRegistrationID
+	}
+	var found []uint
+	if err := tx.Table(table).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND deleted_at IS NULL", *id).Pluck("id", &found).Error; err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		result.Status, result.Message = "not_found", "ไม่พบข้อมูลการลงทะเบียน"
+		return errSyncRejected
+	}
+
+	var existing models.CheckIn
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(column+" = ?", *id).Order("id").First(&existing).Error
+	if err == nil {
+		// เช็คอินซ้ำจากอีกอุปกรณ์ รวมเข้ากับรายการที่มีอยู่ (ถือว่าค่าเริ่มต้นว่างเป็น base)
+		current := checkInSyncValues(&existing)
+		mutation.Base = map[string]json.RawMessage{"checked_out_at": json.RawMessage("null"), "note": json.RawMessage(`""`)}
+		merge, err := mergeSyncFields("check_in", mutation, current, true)
+		if err != nil {
+			result.Status, result.Message = "rejected", err.Error()
+			return errSyncRejected
+		}
+		if err := saveMergedCheckIn(tx, &existing, current, merge, result); err != nil {
+			return err
+		}
+		result.Status, result.ClientID = "merged", existing.ClientID
+		result.Message = "มีการเช็คอินของบุคคลนี้จากอุปกรณ์อื่นแล้ว ใช้ client_id ของรายการเดิม"
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err := tx.Create(&checkIn).Error; err != nil {
+		return err
+	}
+	result.ID, result.Status, result.Version, result.Record = checkIn.ID, "applied", checkIn.Version, checkIn
+	return nil
+}
+
+func saveMergedCheckIn(tx *gorm.DB, checkIn *models.CheckIn, current map[string]interface{}, merge *syncMerge, result *SyncResult) error {
+	result.ID = checkIn.ID
+	result.Conflicts = merge.conflicts
+	if !merge.changed(current) {
+		result.Status, result.Version, result.Record = "unchanged", checkIn.Version, checkIn
+		if len(merge.conflicts) > 0 {
+			result.Status = "merged"
+		}
+		return nil
+	}
+
+	expected := checkIn.Version
+	merge.applyCheckIn(checkIn)
+	if err := validateCheckIn(checkIn); err != nil {
+		result.Status, result.Message, result.Conflicts = "rejected", err.Error(), nil
+		return errSyncRejected
+	}
+	checkIn.Version = expected + 1
+	if err := updateVersioned(tx, checkIn, expected); err != nil {
+		return err
+	}
+	result.Status, result.Version, result.Record = merge.status(), checkIn.Version, checkIn
+	return nil
+}
+
+// syncRegistrationUpdate - แก้ไขชื่อเล่นและสถานะการสวดของผู้ลงทะเบียน
+func syncRegistrationUpdate(tx *gorm.DB, mutation *SyncMutation, userID uint, result *SyncResult) error {
+	result.ID = mutation.ID
+	if mutation.Op == "delete" {
+		result.Status, result.Message = "rejected", "ลบข้อมูลการลงทะเบียนจากอุปกรณ์ไม่ได้"
+		return errSyncRejected
+	}
+
+	var registration models.Registration
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&registration, mutation.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			result.Status, result.Message = "not_found", "ไม่พบข้อมูลการลงทะเบียน"
+			return errSyncRejected
+		}
+		return err
+	}
+
+	current := registrationSyncValues(&registration)
+	merge, err := mergeSyncFields("registration", mutation, current, mutation.BaseVersion != registration.Version)
+	if err != nil {
+		result.Status, result.Message = "rejected", err.Error()
+		return errSyncRejected
+	}
+	result.Conflicts = merge.conflicts
+	if !merge.changed(current) {
+		result.Status, result.Version, result.Record = "unchanged", registration.Version, registrationSyncOf(&registration)
+		if len(merge.conflicts) > 0 {
+			result.Status = "merged"
+		}
+		return nil
+	}
+
+	before := registrationFieldsOf(&registration)
+	for name, value := range merge.values {
+		switch name {
+		case "nickname":
+			registration.Nickname = value.(string)
+		case "chanted_pariwat":
+			registration.ChantedPariwat = value.(bool)
+		case "chanted_manat":
+			registration.ChantedManat = value.(bool)
+		case "chanted_ok_apan":
+			registration.ChantedOkApan = value.(bool)
+		}
+	}
+	expected := registration.Version
+	registration.Version = expected + 1
+	if err := updateVersioned(tx, &registration, expected); err != nil {
+		return err
+	}
+	after := registrationFieldsOf(&registration)
+	if err := recordVersion(tx, "registration", registration.ID, "update", &before, &after, &userID); err != nil {
+		return err
+	}
+	if err := enqueueChantingCompleted(tx, &registration, &before); err != nil {
+		return err
+	}
+	result.Status, result.Version, result.Record = merge.status(), registration.Version, registrationSyncOf(&registration)
+	return nil
+}
+
+// SyncPush - รับการแก้ไขที่ค้างอยู่บนอุปกรณ์ ทำทีละรายการ (รายการที่ผิดพลาดไม่กระทบรายการอื่น) และคืนผลของทุกรายการ
+// ส่งซ้ำได้อย่างปลอดภัย รายการที่บันทึกไปแล้วจะได้สถานะ unchanged
+func SyncPush(c *fiber.Ctx) error {
+	var req struct {
+		DeviceID  string         `json:"device_id"`
+		Mutations []SyncMutation `json:"mutations"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+	req.DeviceID = strings.TrimSpace(req.DeviceID)
+	if req.DeviceID == "" || len(req.DeviceID) > 100 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณาระบุ device_id (ไม่เกิน 100 ตัวอักษร)",
+		})
+	}
+	if len(req.Mutations) > syncMaxMutations {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("ส่งได้สูงสุด %d รายการต่อครั้ง", syncMaxMutations),
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	results := make([]SyncResult, 0, len(req.Mutations))
+	counts := map[string]int{}
+	for i := range req.Mutations {
+		mutation := &req.Mutations[i]
+		result := SyncResult{Index: i, Entity: mutation.Entity, ClientID: mutation.ClientID}
+
+		err := eventTransaction(func(tx *gorm.DB) error {
+			if mutation.Op != "upsert" && mutation.Op != "delete" {
+				result.Status, result.Message = "rejected", "op ต้องเป็น 'upsert' หรือ 'delete'"
+				return errSyncRejected
+			}
+			switch mutation.Entity {
+			case "check_in":
+				return syncCheckIn(tx, mutation, req.DeviceID, userID, &result)
+			case "registration":
+				return syncRegistrationUpdate(tx, mutation, userID, &result)
+			}
+			result.Status, result.Message = "rejected", "entity ต้องเป็น 'check_in' หรือ 'registration'"
+			return errSyncRejected
+		})
+		if err != nil && !errors.Is(err, errSyncRejected) {
+			result = SyncResult{Index: i, Entity: mutation.Entity, ClientID: mutation.ClientID, ID: result.ID,
+				Status: "rejected", Message: "ไม่สามารถบันทึกข้อมูลได้ กรุณาลองใหม่"}
+		}
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	if saved := counts["applied"] + counts["merged"]; saved > 0 {
+		database.DB.Create(&models.ActivityLog{
+			Action: "ซิงค์ข้อมูลจากอุปกรณ์",
+			Description: fmt.Sprintf("อุปกรณ์ %s: บันทึก %d รายการ (รวมข้อมูลที่ขัดแย้ง %d รายการ), ปฏิเสธ %d รายการ",
+				req.DeviceID, saved, counts["merged"], counts["rejected"]+counts["not_found"]),
+			Module: "sync",
+			UserID: userID,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"results": results,
+		"summary": counts,
+	})
+}
+
+// GetSyncRules - field ที่ซิงค์ได้และกฎแก้ข้อขัดแย้ง ให้ client แสดงผลและแก้ไขได้ตรงกับ server
+func GetSyncRules(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"entities":      syncFields,
+		"max_limit":     syncMaxLimit,
+		"max_mutations": syncMaxMutations,
+	})
+}
+
+// GetCheckIns - รายการเช็คอิน (กรองตามผู้ลงทะเบียนหรืออุปกรณ์)
+func GetCheckIns(c *fiber.Ctx) error {
+	query := database.DB.Order("checked_in_at DESC")
+	if id := c.QueryInt("registration_id"); id > 0 {
+		query = query.Where("registration_id = ?", id)
+	}
+	if id := c.QueryInt("teacher_registration_id"); id > 0 {
+		query = query.Where("teacher_registration_id = ?", id)
+	}
+	if device := c.Query("device_id"); device != "" {
+		query = query.Where("device_id = ?", device)
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	var checkIns []models.CheckIn
+	if err := query.Limit(limit).Find(&checkIns).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	return c.JSON(checkIns)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveSyncField(t *testing.T) {
+	early := time.Date(2024, time.March, 1, 8, 0, 0, 0, time.UTC)
+	late := early.Add(2 * time.Hour)
+
+	serverWins := syncField{Kind: "string", Rule: syncServerWins}
+	trueWins := syncField{Kind: "bool", Rule: syncTrueWins}
+	earliest := syncField{Kind: "time", Rule: syncEarliest}
+	latest := syncField{Kind: "time", Rule: syncLatest}
+	immutable := syncField{Kind: "id", Rule: syncImmutable}
+
+	tests := []struct {
+		name         string
+		field        syncField
+		stale        bool
+		hasBase      bool
+		base         interface{}
+		server       interface{}
+		client       interface{}
+		want         interface{}
+		wantConflict bool
+	}{
+		{"same value is never a conflict", serverWins, true, false, nil, "a", "a", "a", false},
+		{"equal times compare by instant", earliest, true, false, nil, early, early.In(time.FixedZone("ICT", 7*3600)), early, false},
+		{"current version takes client value", serverWins, false, false, nil, "server", "client", "client", false},
+		{"server unchanged since base takes client value", serverWins, true, true, "old", "old", "client", "client", false},
+		{"server changed since base keeps server", serverWins, true, true, "old", "server", "client", "server", true},
+		{"stale without base keeps server", serverWins, true, false, nil, "server", "client", "server", true},
+		{"immutable keeps server even when current", immutable, false, false, nil, uint(1), uint(2), uint(1), true},
+		{"true wins from client", trueWins, true, false, nil, false, true, true, false},
+		{"true wins from server", trueWins, true, false, nil, true, false, true, true},
+		{"earliest prefers client", earliest, true, false, nil, late, early, early, false},
+		{"earliest prefers server", earliest, true, false, nil, early, late, early, true},
+		{"earliest fills unset server", earliest, true, false, nil, nil, early, early, false},
+		{"earliest keeps server when client unset", earliest, true, false, nil, early, nil, early, true},
+		{"latest prefers client", latest, true, false, nil, early, late, late, false},
+		{"latest prefers server", latest, true, false, nil, late, early, late, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflict := resolveSyncField(tt.field, tt.stale, tt.hasBase, tt.base, tt.server, tt.client)
+			if !syncEqual(got, tt.want) {
+				t.Errorf("resolved = %v, want %v", got, tt.want)
+			}
+			if conflict != tt.wantConflict {
+				t.Errorf("conflict = %v, want %v", conflict, tt.wantConflict)
+			}
+		})
+	}
+}
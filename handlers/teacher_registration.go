@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"registration-system/database"
+	"registration-system/middleware"
 	"registration-system/models"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type TeacherRegistrationRequest struct {
@@ -19,8 +22,24 @@ type TeacherRegistrationRequest struct {
 	AddressDetail    string `json:"address_detail"`
 	PhoneNumber      string `json:"phone_number"`
 	TempleName       string `json:"temple_name"`
+	TempleID         *uint  `json:"temple_id"` // วัดจากทะเบียน (ไม่ระบุ = จับคู่จาก temple_name)
 	MedicalCondition string `json:"medical_condition"`
 	Vassa            int    `json:"vassa"`
+
+	// ข้อมูลยืนยันตัวตน (ไม่บังคับ)
+	NationalID        string `json:"national_id"`
+	MonkCertificateNo string `json:"monk_certificate_no"`
+	OrdinationDate    string `json:"ordination_date"` // YYYY-MM-DD
+	Preceptor         string `json:"preceptor"`
+
+	// token จากการยืนยันเบอร์โทรด้วย OTP (ดู /public/phone-verifications)
+	PhoneVerificationToken string `json:"phone_verification_token,omitempty"`
+
+	// PDPA - ความยินยอม (บังคับเฉพาะการลงทะเบียนสาธารณะ)
+	Consent *ConsentRequest `json:"consent,omitempty"`
+
+	// version ที่แก้ไขอยู่ (ใช้แทน If-Match ได้)
+	Version *uint `json:"version,omitempty"`
 }
 
 func CreateTeacherRegistration(c *fiber.Ctx) error {
@@ -39,21 +58,70 @@ func CreateTeacherRegistration(c *fiber.Ctx) error {
 		})
 	}
 
+	consents, err := buildConsentRecords(c, req.Consent)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณายอมรับนโยบายความเป็นส่วนตัวก่อนลงทะเบียน",
+		})
+	}
+
+	templeID, templeName, err := resolveTemple(req.TempleID, req.TempleName)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่พบวัดที่เลือกในทะเบียนวัด",
+		})
+	}
+
+	phoneVerification, verifyErr := checkPhoneVerification(req.PhoneVerificationToken, req.PhoneNumber)
+	if verifyErr != nil {
+		return verifyErr.respond(c)
+	}
+
+	identity := req.identityFields()
+	if identityErr := checkIdentity(&identity, "teacher_registrations", 0); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
 	registration := models.TeacherRegistration{
-		FullName:         req.FullName,
-		Nickname:         req.Nickname,
-		BirthDate:        birthDate,
-		ProvinceID:       req.ProvinceID,
-		DistrictID:       req.DistrictID,
-		SubDistrictID:    req.SubDistrictID,
-		AddressDetail:    req.AddressDetail,
-		PhoneNumber:      req.PhoneNumber,
-		TempleName:       req.TempleName,
-		MedicalCondition: req.MedicalCondition,
-		Vassa:            req.Vassa,
-	}
-
-	if result := database.DB.Create(&registration); result.Error != nil {
+		FullName:          req.FullName,
+		Nickname:          req.Nickname,
+		BirthDate:         models.EncryptedDate{Time: birthDate},
+		ProvinceID:        req.ProvinceID,
+		DistrictID:        req.DistrictID,
+		SubDistrictID:     req.SubDistrictID,
+		AddressDetail:     models.EncryptedString(req.AddressDetail),
+		PhoneNumber:       models.EncryptedString(req.PhoneNumber),
+		PhoneVerifiedAt:   phoneVerifiedAt(phoneVerification),
+		TempleName:        templeName,
+		TempleID:          templeID,
+		MedicalCondition:  models.EncryptedString(req.MedicalCondition),
+		Vassa:             req.Vassa,
+		NationalID:        models.EncryptedString(identity.NationalID),
+		MonkCertificateNo: models.EncryptedString(identity.MonkCertificateNo),
+		OrdinationDate:    parseOptionalDate(identity.OrdinationDate),
+		Preceptor:         identity.Preceptor,
+	}
+
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := consumePhoneVerification(tx, phoneVerification); err != nil {
+			return err
+		}
+		if err := tx.Create(&registration).Error; err != nil {
+			return err
+		}
+		after := teacherRegistrationFieldsOf(&registration)
+		if err := recordVersion(tx, "teacher-registration", registration.ID, "create", nil, &after, currentUserID(c)); err != nil {
+			return err
+		}
+		if err := saveConsentRecords(tx, consents, nil, &registration.ID); err != nil {
+			return err
+		}
+		return enqueueRegistrationCreated(tx, "teacher", registration.ID, registration.FullName, registration.PhoneNumber.String(), registration.TempleName)
+	})
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create teacher registration",
 		})
@@ -61,18 +129,25 @@ func CreateTeacherRegistration(c *fiber.Ctx) error {
 
 	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
 
+	middleware.SetIdempotencySubject(c, "teacher_registrations", registration.ID)
 	return c.Status(201).JSON(registration)
 }
 
 func GetTeacherRegistrations(c *fiber.Ctx) error {
 	var registrations []models.TeacherRegistration
 
-	if result := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").Order("created_at DESC").Find(&registrations); result.Error != nil {
+	query := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").Order("created_at DESC")
+
+	query = filterRegistrationList(c, query)
+
+	if result := query.Find(&registrations); result.Error != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to fetch teacher registrations",
 		})
 	}
 
+	maskTeacherRegistrationIdentity(registrations)
+	redactMedicalCondition(c, registrations)
 	return c.JSON(registrations)
 }
 
@@ -80,12 +155,14 @@ func GetTeacherRegistration(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var registration models.TeacherRegistration
 
-	if result := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, id); result.Error != nil {
+	if result := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").Preload("RoomAssignment.Room.Building").First(&registration, id); result.Error != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Teacher registration not found",
 		})
 	}
 
+	redactMedicalCondition(c, &registration)
+	setETag(c, registration.Version)
 	return c.JSON(registration)
 }
 
@@ -106,6 +183,14 @@ func UpdateTeacherRegistration(c *fiber.Ctx) error {
 		})
 	}
 
+	expected, ok := expectedVersion(c, req.Version)
+	if !ok {
+		return versionRequired(c)
+	}
+	if expected != registration.Version {
+		return versionConflict(c, registration.Version, &registration)
+	}
+
 	birthDate, err := time.Parse("2006-01-02", req.BirthDate)
 	if err != nil {
 		return c.Status(400).JSON(fiber.Map{
@@ -113,19 +198,60 @@ func UpdateTeacherRegistration(c *fiber.Ctx) error {
 		})
 	}
 
+	templeID, templeName, err := resolveTemple(req.TempleID, req.TempleName)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ไม่พบวัดที่เลือกในทะเบียนวัด",
+		})
+	}
+
+	identity := req.identityFields()
+	identity.NationalID = keepMaskedIdentifier(identity.NationalID, registration.NationalID)
+	identity.MonkCertificateNo = keepMaskedIdentifier(identity.MonkCertificateNo, registration.MonkCertificateNo)
+	if identityErr := checkIdentity(&identity, "teacher_registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
+	before := teacherRegistrationFieldsOf(&registration)
+
 	registration.FullName = req.FullName
 	registration.Nickname = req.Nickname
-	registration.BirthDate = birthDate
+	registration.BirthDate = models.EncryptedDate{Time: birthDate}
 	registration.ProvinceID = req.ProvinceID
 	registration.DistrictID = req.DistrictID
 	registration.SubDistrictID = req.SubDistrictID
-	registration.AddressDetail = req.AddressDetail
-	registration.PhoneNumber = req.PhoneNumber
-	registration.TempleName = req.TempleName
-	registration.MedicalCondition = req.MedicalCondition
+	registration.AddressDetail = models.EncryptedString(req.AddressDetail)
+	if phoneChanged(registration.PhoneNumber, req.PhoneNumber) {
+		registration.PhoneVerifiedAt = nil
+	}
+	registration.PhoneNumber = models.EncryptedString(req.PhoneNumber)
+	registration.TempleName = templeName
+	registration.TempleID = templeID
+	registration.MedicalCondition = models.EncryptedString(req.MedicalCondition)
 	registration.Vassa = req.Vassa
+	registration.NationalID = models.EncryptedString(identity.NationalID)
+	registration.MonkCertificateNo = models.EncryptedString(identity.MonkCertificateNo)
+	registration.OrdinationDate = parseOptionalDate(identity.OrdinationDate)
+	registration.Preceptor = identity.Preceptor
 
-	if err := database.DB.Save(&registration).Error; err != nil {
+	userID := c.Locals("userID").(uint)
+	registration.Version = expected + 1
+	err = eventTransaction(func(tx *gorm.DB) error {
+		if err := updateVersioned(tx, &registration, expected); err != nil {
+			return err
+		}
+		after := teacherRegistrationFieldsOf(&registration)
+		return recordVersion(tx, "teacher-registration", registration.ID, "update", &before, &after, &userID)
+	})
+	if errors.Is(err, errVersionConflict) {
+		var current models.TeacherRegistration
+		database.DB.First(&current, registration.ID)
+		return versionConflict(c, current.Version, &current)
+	}
+	if identityErr := asIdentityError(err); identityErr != nil {
+		return identityErr.respond(c)
+	}
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถอัพเดทข้อมูลได้",
 		})
@@ -133,6 +259,8 @@ func UpdateTeacherRegistration(c *fiber.Ctx) error {
 
 	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
 
+	redactMedicalCondition(c, &registration)
+	setETag(c, registration.Version)
 	return c.JSON(fiber.Map{
 		"success": true,
 		"message": "อัพเดทข้อมูลสำเร็จ",
@@ -152,7 +280,18 @@ func DeleteTeacherRegistration(c *fiber.Ctx) error {
 
 	userID := c.Locals("userID").(uint)
 
-	if err := database.DB.Delete(&registration).Error; err != nil {
+	before := teacherRegistrationFieldsOf(&registration)
+	err := eventTransaction(func(tx *gorm.DB) error {
+		if err := softDelete(tx, &registration, userID); err != nil {
+			return err
+		}
+		// คืนที่พักที่จัดไว้
+		if err := tx.Where("teacher_registration_id = ?", registration.ID).Delete(&models.RoomAssignment{}).Error; err != nil {
+			return err
+		}
+		return recordVersion(tx, "teacher-registration", registration.ID, "delete", &before, nil, &userID)
+	})
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถลบข้อมูลได้",
 		})
@@ -162,6 +301,7 @@ func DeleteTeacherRegistration(c *fiber.Ctx) error {
 		Action:      "ลบข้อมูลการลงทะเบียนพระอาจารย์",
 		Description: fmt.Sprintf("ลบข้อมูลของ %s (เบอร์โทร: %s)", registration.FullName, registration.PhoneNumber),
 		Module:      "teacher-registration",
+		RecordID:    &registration.ID,
 		UserID:      userID,
 	}
 	database.DB.Create(&activityLog)
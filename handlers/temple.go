@@ -0,0 +1,616 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"registration-system/database"
+	"registration-system/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// validSects - นิกายที่บันทึกได้ (ว่าง = ไม่ระบุ)
+var validSects = map[string]bool{
+	"":         true,
+	"มหานิกาย": true,
+	"ธรรมยุติกนิกาย": true,
+}
+
+var errTempleNotFound = errors.New("temple not found")
+
+type TempleRequest struct {
+	Name          string   `json:"name"`
+	Aliases       []string `json:"aliases"`
+	Sect          string   `json:"sect"`
+	ProvinceID    *uint    `json:"province_id"`
+	DistrictID    *uint    `json:"district_id"`
+	SubDistrictID *uint    `json:"sub_district_id"`
+	AddressDetail string   `json:"address_detail"`
+	AbbotName     string   `json:"abbot_name"`
+	ContactName   string   `json:"contact_name"`
+	ContactPhone  string   `json:"contact_phone"`
+}
+
+// MergeTemplesRequest - วัดที่จะรวมเข้ากับวัดปลายทาง
+type MergeTemplesRequest struct {
+	SourceIDs []uint `json:"source_ids"`
+}
+
+// BackfillTemplesRequest - ผูกการลงทะเบียนเดิมที่พิมพ์ชื่อวัดเองเข้ากับทะเบียนวัด
+type BackfillTemplesRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// TempleSuggestion - ผลการค้นหาแบบ autocomplete (ไม่มีข้อมูลติดต่อ)
+type TempleSuggestion struct {
+	ID       uint     `json:"id"`
+	Name     string   `json:"name"`
+	Aliases  []string `json:"aliases"`
+	Sect     string   `json:"sect"`
+	Province string   `json:"province,omitempty"`
+	District string   `json:"district,omitempty"`
+}
+
+// resolveTemple - หาวัดที่จะผูกกับการลงทะเบียน: ใช้ templeID ถ้าระบุ ไม่เช่นนั้นจับคู่จากชื่อที่พิมพ์
+// คืน temple_id (nil = ไม่พบในทะเบียน ใช้ชื่อที่พิมพ์เอง) และชื่อวัดที่จะบันทึก
+func resolveTemple(templeID *uint, templeName string) (*uint, string, error) {
+	if templeID != nil && *templeID != 0 {
+		var temple models.Temple
+		if err := database.DB.First(&temple, *templeID).Error; err != nil {
+			return nil, templeName, errTempleNotFound
+		}
+		return &temple.ID, temple.Name, nil
+	}
+
+	templeName = strings.TrimSpace(templeName)
+	if temple := matchTemple(database.DB, templeName); temple != nil {
+		return &temple.ID, temple.Name, nil
+	}
+	return nil, templeName, nil
+}
+
+// matchTemple - หาวัดที่ชื่อหรือ alias ตรงกับชื่อที่พิมพ์ (คืน nil ถ้าไม่พบหรือตรงหลายวัด)
+func matchTemple(db *gorm.DB, name string) *models.Temple {
+	key := models.NormalizeTempleName(name)
+	if key == "" {
+		return nil
+	}
+	var temples []models.Temple
+	db.Where("? = ANY(search_keys)", key).Limit(2).Find(&temples)
+	if len(temples) != 1 {
+		return nil
+	}
+	return &temples[0]
+}
+
+// templeConflict - วัดอื่นที่มีชื่อหรือ alias ซ้ำกับ temple
+func templeConflict(db *gorm.DB, temple *models.Temple) *models.Temple {
+	temple.BeforeSave(db)
+	for _, key := range temple.SearchKeys {
+		query := db.Where("? = ANY(search_keys)", key)
+		if temple.ID != 0 {
+			query = query.Where("id <> ?", temple.ID)
+		}
+		var other models.Temple
+		if query.First(&other).Error == nil {
+			return &other
+		}
+	}
+	return nil
+}
+
+// cleanAliases - ตัดช่องว่าง ค่าว่าง ค่าซ้ำ และชื่อเดียวกับชื่อหลักออก
+func cleanAliases(name string, aliases []string) models.StringArray {
+	seen := map[string]bool{models.NormalizeTempleName(name): true}
+	result := models.StringArray{}
+	for _, alias := range aliases {
+		alias = strings.TrimSpace(alias)
+		key := models.NormalizeTempleName(alias)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, alias)
+	}
+	return result
+}
+
+// applyTempleRequest - ตรวจสอบและคัดลอกข้อมูลจาก request
+func applyTempleRequest(temple *models.Temple, req *TempleRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fmt.Errorf("กรุณากรอกชื่อวัด")
+	}
+	if !validSects[req.Sect] {
+		return fmt.Errorf("นิกายต้องเป็น 'มหานิกาย' หรือ 'ธรรมยุติกนิกาย'")
+	}
+
+	hasAddress := req.ProvinceID != nil || req.DistrictID != nil || req.SubDistrictID != nil
+	if hasAddress {
+		if req.ProvinceID == nil || req.DistrictID == nil || req.SubDistrictID == nil ||
+			!validateAddress(*req.ProvinceID, *req.DistrictID, *req.SubDistrictID) {
+			return fmt.Errorf("ที่อยู่ไม่ถูกต้อง")
+		}
+	}
+
+	temple.Name = name
+	temple.Aliases = cleanAliases(name, req.Aliases)
+	temple.Sect = req.Sect
+	temple.ProvinceID = req.ProvinceID
+	temple.DistrictID = req.DistrictID
+	temple.SubDistrictID = req.SubDistrictID
+	temple.AddressDetail = req.AddressDetail
+	temple.AbbotName = req.AbbotName
+	temple.ContactName = req.ContactName
+	temple.ContactPhone = models.EncryptedString(req.ContactPhone)
+	return nil
+}
+
+// SearchTemples - ค้นหาวัดสำหรับช่องกรอกชื่อวัด (?q=&province_id=&limit=)
+func SearchTemples(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return c.JSON([]TempleSuggestion{})
+	}
+	limit := c.QueryInt("limit", 10)
+	if limit < 1 || limit > 20 {
+		limit = 10
+	}
+
+	// ค้นทั้งชื่อที่พิมพ์ตรงๆ และแบบ normalize (เช่น "วัดป่า สุคะโต" เจอ "ป่าสุคะโต")
+	pattern := "%" + q + "%"
+	condition := database.DB.Where("name ILIKE ? OR array_to_string(aliases, '|') ILIKE ?", pattern, pattern)
+	if key := models.NormalizeTempleName(q); key != "" {
+		condition = condition.Or("array_to_string(search_keys, '|') LIKE ?", "%"+key+"%")
+	}
+	query := database.DB.Preload("Province").Preload("District").Where(condition)
+	if provinceID := c.QueryInt("province_id"); provinceID > 0 {
+		query = query.Where("province_id = ?", provinceID)
+	}
+
+	// ชื่อที่ขึ้นต้นด้วยคำค้นขึ้นก่อน
+	var temples []models.Temple
+	if err := query.Order(gorm.Expr("name ILIKE ? DESC", q+"%")).Order("name").Limit(limit).Find(&temples).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to search temples",
+		})
+	}
+
+	suggestions := make([]TempleSuggestion, 0, len(temples))
+	for _, temple := range temples {
+		suggestion := TempleSuggestion{ID: temple.ID, Name: temple.Name, Aliases: temple.Aliases, Sect: temple.Sect}
+		if temple.Province != nil {
+			suggestion.Province = temple.Province.NameTh
+		}
+		if temple.District != nil {
+			suggestion.District = temple.District.NameTh
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return c.JSON(suggestions)
+}
+
+// GetTemples - รายการวัดพร้อมจำนวนผู้ลงทะเบียนที่ผูกไว้ (?q=&province_id=)
+func GetTemples(c *fiber.Ctx) error {
+	type templeSummary struct {
+		models.Temple
+		RegistrationCount        int64 `json:"registration_count"`
+		TeacherRegistrationCount int64 `json:"teacher_registration_count"`
+	}
+
+	query := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").Order("name")
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := "%" + q + "%"
+		query = query.Where("name ILIKE ? OR array_to_string(aliases, '|') ILIKE ?", pattern, pattern)
+	}
+	if provinceID := c.QueryInt("province_id"); provinceID > 0 {
+		query = query.Where("province_id = ?", provinceID)
+	}
+
+	var temples []models.Temple
+	if err := query.Find(&temples).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	type templeCount struct {
+		TempleID uint
+		Count    int64
+	}
+	var registrationCounts, teacherCounts []templeCount
+	database.DB.Model(&models.Registration{}).Select("temple_id, COUNT(*) AS count").
+		Where("temple_id IS NOT NULL").Group("temple_id").Scan(&registrationCounts)
+	database.DB.Model(&models.TeacherRegistration{}).Select("temple_id, COUNT(*) AS count").
+		Where("temple_id IS NOT NULL").Group("temple_id").Scan(&teacherCounts)
+	counts := map[uint]*templeSummary{}
+
+	result := make([]templeSummary, len(temples))
+	for i := range temples {
+		result[i] = templeSummary{Temple: temples[i]}
+		counts[temples[i].ID] = &result[i]
+	}
+	for _, count := range registrationCounts {
+		if summary, ok := counts[count.TempleID]; ok {
+			summary.RegistrationCount = count.Count
+		}
+	}
+	for _, count := range teacherCounts {
+		if summary, ok := counts[count.TempleID]; ok {
+			summary.TeacherRegistrationCount = count.Count
+		}
+	}
+	return c.JSON(result)
+}
+
+// GetTemple - ดึงข้อมูลวัด
+func GetTemple(c *fiber.Ctx) error {
+	var temple models.Temple
+	if err := database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&temple, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลวัด",
+		})
+	}
+	return c.JSON(temple)
+}
+
+// CreateTemple - เพิ่มวัดในทะเบียน
+func CreateTemple(c *fiber.Ctx) error {
+	var req TempleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	var temple models.Temple
+	if err := applyTempleRequest(&temple, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if other := templeConflict(database.DB, &temple); other != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error":     fmt.Sprintf("ชื่อวัดซ้ำกับ '%s' ในทะเบียน", other.Name),
+			"temple_id": other.ID,
+		})
+	}
+
+	if err := database.DB.Create(&temple).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	return c.Status(201).JSON(temple)
+}
+
+// UpdateTemple - แก้ไขข้อมูลวัด (ชื่อวัดในการลงทะเบียนที่ผูกไว้จะเปลี่ยนตาม)
+func UpdateTemple(c *fiber.Ctx) error {
+	var temple models.Temple
+	if err := database.DB.First(&temple, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลวัด",
+		})
+	}
+
+	var req TempleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+
+	oldName := temple.Name
+	if err := applyTempleRequest(&temple, &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if other := templeConflict(database.DB, &temple); other != nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error":     fmt.Sprintf("ชื่อวัดซ้ำกับ '%s' ในทะเบียน", other.Name),
+			"temple_id": other.ID,
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	var relinked int
+	err := eventTransaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&temple).Error; err != nil {
+			return err
+		}
+		if temple.Name == oldName {
+			return nil
+		}
+		var err error
+		relinked, err = linkTempleRegistrations(tx, &temple, userID, "temple_id = ?", temple.ID)
+		return err
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถอัพเดทข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"message":  "อัพเดทข้อมูลสำเร็จ",
+		"data":     temple,
+		"relinked": relinked,
+	})
+}
+
+// DeleteTemple - ลบวัด (ต้องไม่มีการลงทะเบียนผูกอยู่ ให้ใช้การรวมวัดแทน)
+func DeleteTemple(c *fiber.Ctx) error {
+	var temple models.Temple
+	if err := database.DB.First(&temple, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลวัด",
+		})
+	}
+
+	var count, teacherCount int64
+	database.DB.Unscoped().Model(&models.Registration{}).Where("temple_id = ?", temple.ID).Count(&count)
+	database.DB.Unscoped().Model(&models.TeacherRegistration{}).Where("temple_id = ?", temple.ID).Count(&teacherCount)
+	if count+teacherCount > 0 {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ไม่สามารถลบวัดที่มีการลงทะเบียนผูกอยู่ได้ กรุณารวมเข้ากับวัดอื่นแทน",
+		})
+	}
+
+	// กลุ่มที่ผูกอยู่เก็บชื่อวัดไว้แต่ไม่ผูกกับทะเบียนแล้ว
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.RegistrationGroup{}).Where("temple_id = ?", temple.ID).Update("temple_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&temple).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบข้อมูลสำเร็จ",
+	})
+}
+
+// linkTempleRegistrations - ผูกการลงทะเบียนที่ตรงกับเงื่อนไขเข้ากับวัด (เพิ่ม version และบันทึกประวัติ)
+// รวมข้อมูลในถังขยะด้วย เพื่อไม่ให้อ้างอิงวัดที่ถูกรวมไปแล้วเมื่อกู้คืน
+func linkTempleRegistrations(tx *gorm.DB, temple *models.Temple, userID uint, condition string, args ...interface{}) (int, error) {
+	now := time.Now()
+	columns := map[string]interface{}{
+		"temple_id":   temple.ID,
+		"temple_name": temple.Name,
+		"version":     gorm.Expr("version + 1"),
+		"updated_at":  now,
+	}
+
+	var registrations []models.Registration
+	if err := tx.Unscoped().Where(condition, args...).Find(&registrations).Error; err != nil {
+		return 0, err
+	}
+	for i := range registrations {
+		r := &registrations[i]
+		before := registrationFieldsOf(r)
+		r.TempleID, r.TempleName = &temple.ID, temple.Name
+		after := registrationFieldsOf(r)
+		if err := tx.Unscoped().Model(r).UpdateColumns(columns).Error; err != nil {
+			return 0, err
+		}
+		if err := recordVersion(tx, "registration", r.ID, "update", &before, &after, &userID); err != nil {
+			return 0, err
+		}
+	}
+
+	var teachers []models.TeacherRegistration
+	if err := tx.Unscoped().Where(condition, args...).Find(&teachers).Error; err != nil {
+		return 0, err
+	}
+	for i := range teachers {
+		r := &teachers[i]
+		before := teacherRegistrationFieldsOf(r)
+		r.TempleID, r.TempleName = &temple.ID, temple.Name
+		after := teacherRegistrationFieldsOf(r)
+		if err := tx.Unscoped().Model(r).UpdateColumns(columns).Error; err != nil {
+			return 0, err
+		}
+		if err := recordVersion(tx, "teacher-registration", r.ID, "update", &before, &after, &userID); err != nil {
+			return 0, err
+		}
+	}
+
+	// กลุ่มที่ลงทะเบียนในนามวัดนี้ (ไม่มีประวัติเวอร์ชัน)
+	if err := tx.Model(&models.RegistrationGroup{}).Where(condition, args...).UpdateColumns(map[string]interface{}{
+		"temple_id":   temple.ID,
+		"temple_name": temple.Name,
+		"updated_at":  now,
+	}).Error; err != nil {
+		return 0, err
+	}
+	return len(registrations) + len(teachers), nil
+}
+
+// MergeTemples - รวมวัดที่สะกดต่างกันเข้าเป็นวัดเดียว
+// ชื่อของวัดที่ถูกรวมกลายเป็น alias ของวัดปลายทาง และการลงทะเบียนทั้งหมดย้ายมาผูกกับวัดปลายทาง
+func MergeTemples(c *fiber.Ctx) error {
+	var target models.Temple
+	if err := database.DB.First(&target, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลวัด",
+		})
+	}
+
+	var req MergeTemplesRequest
+	if err := c.BodyParser(&req); err != nil || len(req.SourceIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "กรุณาระบุวัดที่จะรวม (source_ids)",
+		})
+	}
+	for _, id := range req.SourceIDs {
+		if id == target.ID {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "ไม่สามารถรวมวัดเข้ากับตัวเองได้",
+			})
+		}
+	}
+
+	var sources []models.Temple
+	database.DB.Where("id IN ?", req.SourceIDs).Find(&sources)
+	if len(sources) != len(uniqueUints(req.SourceIDs)) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบวัดที่จะรวมบางรายการ",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	var relinked int
+	err := eventTransaction(func(tx *gorm.DB) error {
+		names := append([]string{}, target.Aliases...)
+		sourceIDs := make([]uint, len(sources))
+		sourceNames := make([]string, len(sources))
+		for i, source := range sources {
+			names = append(names, source.Name)
+			names = append(names, source.Aliases...)
+			sourceIDs[i] = source.ID
+			sourceNames[i] = source.Name
+		}
+
+		// ลบวัดต้นทางก่อน เพื่อไม่ให้ชื่อของวัดต้นทางชนกับ alias ใหม่
+		if err := tx.Model(&models.Temple{}).Where("id IN ?", sourceIDs).Update("merged_into_id", target.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", sourceIDs).Delete(&models.Temple{}).Error; err != nil {
+			return err
+		}
+
+		target.Aliases = cleanAliases(target.Name, names)
+		if err := tx.Save(&target).Error; err != nil {
+			return err
+		}
+
+		var err error
+		relinked, err = linkTempleRegistrations(tx, &target, userID, "temple_id IN ?", sourceIDs)
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.ActivityLog{
+			Action:      "รวมข้อมูลวัด",
+			Description: fmt.Sprintf("รวม %s เข้ากับ %s (ย้ายการลงทะเบียน %d รายการ)", strings.Join(sourceNames, ", "), target.Name, relinked),
+			Module:      "temple",
+			RecordID:    &target.ID,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถรวมข้อมูลวัดได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"message":  "รวมข้อมูลวัดสำเร็จ",
+		"data":     target,
+		"relinked": relinked,
+	})
+}
+
+func uniqueUints(values []uint) []uint {
+	seen := map[uint]bool{}
+	result := []uint{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// BackfillTemples - ผูกการลงทะเบียนที่ยังพิมพ์ชื่อวัดเองเข้ากับทะเบียนวัดจากชื่อหรือ alias
+// dry_run = true แสดงผลโดยไม่บันทึก; ชื่อที่จับคู่ไม่ได้จะแสดงพร้อมจำนวน เพื่อเพิ่มวัดหรือ alias ต่อ
+func BackfillTemples(c *fiber.Ctx) error {
+	var req BackfillTemplesRequest
+	c.BodyParser(&req)
+
+	type unlinkedName struct {
+		TempleName string `json:"temple_name"`
+		Count      int64  `json:"count"`
+	}
+	type backfillMatch struct {
+		TempleName string `json:"temple_name"`
+		TempleID   uint   `json:"temple_id"`
+		Temple     string `json:"temple"`
+		Count      int64  `json:"count"`
+	}
+
+	// ชื่อวัดที่ยังไม่ผูก รวมทั้งสองประเภทการลงทะเบียน
+	var names []unlinkedName
+	err := database.DB.Raw(`
+		SELECT temple_name, COUNT(*) AS count FROM (
+			SELECT temple_name FROM registrations WHERE temple_id IS NULL AND temple_name <> ''
+			UNION ALL
+			SELECT temple_name FROM teacher_registrations WHERE temple_id IS NULL AND temple_name <> ''
+		) names GROUP BY temple_name`).Scan(&names).Error
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	matches := []backfillMatch{}
+	unmatched := []unlinkedName{}
+	temples := map[string]*models.Temple{}
+	for _, name := range names {
+		temple := matchTemple(database.DB, name.TempleName)
+		if temple == nil {
+			unmatched = append(unmatched, name)
+			continue
+		}
+		temples[name.TempleName] = temple
+		matches = append(matches, backfillMatch{TempleName: name.TempleName, TempleID: temple.ID, Temple: temple.Name, Count: name.Count})
+	}
+	sort.Slice(unmatched, func(i, j int) bool { return unmatched[i].Count > unmatched[j].Count })
+
+	var linked int
+	if !req.DryRun && len(matches) > 0 {
+		userID := c.Locals("userID").(uint)
+		err = eventTransaction(func(tx *gorm.DB) error {
+			for _, match := range matches {
+				count, err := linkTempleRegistrations(tx, temples[match.TempleName], userID, "temple_id IS NULL AND temple_name = ?", match.TempleName)
+				if err != nil {
+					return err
+				}
+				linked += count
+			}
+			return tx.Create(&models.ActivityLog{
+				Action:      "ผูกการลงทะเบียนกับทะเบียนวัด",
+				Description: fmt.Sprintf("ผูกการลงทะเบียน %d รายการ จากชื่อวัด %d ชื่อ", linked, len(matches)),
+				Module:      "temple",
+				UserID:      userID,
+			}).Error
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "ไม่สามารถผูกข้อมูลวัดได้",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success":   true,
+		"dry_run":   req.DryRun,
+		"linked":    linked,
+		"matches":   matches,
+		"unmatched": unmatched,
+	})
+}
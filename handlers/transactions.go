@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 type TransactionRequest struct {
@@ -190,14 +191,16 @@ func DeleteTransaction(c *fiber.Ctx) error {
 		})
 	}
 
-	if err := database.DB.Delete(&transaction).Error; err != nil {
+	userID := c.Locals("userID").(uint)
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		return softDelete(tx, &transaction, userID)
+	}); err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "ไม่สามารถลบข้อมูลได้",
 		})
 	}
 
 	// บันทึก Activity Log
-	userID := c.Locals("userID").(uint)
 	activityLog := models.ActivityLog{
 		Action:      "ลบรายการ " + transaction.Type,
 		Description: transaction.Description + " - จำนวน " + formatMoney(transaction.Amount),
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"fmt"
+	"registration-system/database"
+	"registration-system/models"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// TrashItem - ข้อมูลในถังขยะ พร้อมผู้ลบและเวลาที่ลบ
+type TrashItem struct {
+	DeletedAt time.Time    `json:"deleted_at"`
+	DeletedBy *models.User `json:"deleted_by,omitempty"`
+	Record    interface{}  `json:"record"`
+}
+
+// softDelete - soft delete พร้อมบันทึกผู้ลบไว้ที่แถว (แสดงในถังขยะ)
+func softDelete(tx *gorm.DB, record interface{}, userID uint) error {
+	if err := tx.Model(record).UpdateColumn("deleted_by_id", userID).Error; err != nil {
+		return err
+	}
+	return tx.Delete(record).Error
+}
+
+// trashDeleters - ผู้ลบของแต่ละรายการ (id -> ผู้ใช้) ดึงครั้งเดียวทั้งหน้า
+// แถวที่ลบก่อนมี deleted_by_id ใช้ Activity Log ที่มี record_id แทน
+func trashDeleters(module string, deletedBy map[uint]*uint) map[uint]*models.User {
+	result := make(map[uint]*models.User, len(deletedBy))
+	userIDs := []uint{}
+	legacyIDs := []uint{}
+	for recordID, userID := range deletedBy {
+		if userID != nil {
+			userIDs = append(userIDs, *userID)
+		} else {
+			legacyIDs = append(legacyIDs, recordID)
+		}
+	}
+
+	users := map[uint]*models.User{}
+	if len(userIDs) > 0 {
+		var found []models.User
+		database.DB.Where("id IN ?", userIDs).Find(&found)
+		for i := range found {
+			users[found[i].ID] = &found[i]
+		}
+	}
+	for recordID, userID := range deletedBy {
+		if userID != nil && users[*userID] != nil {
+			result[recordID] = users[*userID]
+		}
+	}
+
+	if len(legacyIDs) > 0 {
+		var logs []models.ActivityLog
+		database.DB.Preload("User").
+			Where("module = ? AND record_id IN ? AND action LIKE ?", module, legacyIDs, "ลบ%").
+			Order("created_at").Find(&logs)
+		for i := range logs {
+			// เรียงเก่าไปใหม่ log ล่าสุดของแต่ละรายการเขียนทับ
+			result[*logs[i].RecordID] = &logs[i].User
+		}
+	}
+	return result
+}
+
+// GetRegistrationTrash - รายการลงทะเบียนที่ถูกลบ
+func GetRegistrationTrash(c *fiber.Ctx) error {
+	var registrations []models.Registration
+	result := database.DB.Unscoped().Preload("Province").Preload("District").Preload("SubDistrict").
+		Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&registrations)
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	maskRegistrationIdentity(registrations)
+	redactMedicalCondition(c, registrations)
+	deletedBy := make(map[uint]*uint, len(registrations))
+	for _, registration := range registrations {
+		deletedBy[registration.ID] = registration.DeletedByID
+	}
+	deleters := trashDeleters("registration", deletedBy)
+	items := make([]TrashItem, 0, len(registrations))
+	for _, registration := range registrations {
+		items = append(items, TrashItem{DeletedAt: registration.DeletedAt.Time, DeletedBy: deleters[registration.ID], Record: registration})
+	}
+	return c.JSON(items)
+}
+
+// GetTeacherRegistrationTrash - รายการลงทะเบียนพระอาจารย์ที่ถูกลบ
+func GetTeacherRegistrationTrash(c *fiber.Ctx) error {
+	var registrations []models.TeacherRegistration
+	result := database.DB.Unscoped().Preload("Province").Preload("District").Preload("SubDistrict").
+		Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&registrations)
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	maskTeacherRegistrationIdentity(registrations)
+	redactMedicalCondition(c, registrations)
+	deletedBy := make(map[uint]*uint, len(registrations))
+	for _, registration := range registrations {
+		deletedBy[registration.ID] = registration.DeletedByID
+	}
+	deleters := trashDeleters("teacher-registration", deletedBy)
+	items := make([]TrashItem, 0, len(registrations))
+	for _, registration := range registrations {
+		items = append(items, TrashItem{DeletedAt: registration.DeletedAt.Time, DeletedBy: deleters[registration.ID], Record: registration})
+	}
+	return c.JSON(items)
+}
+
+// GetFinanceTransactionTrash - รายการรายรับรายจ่ายที่ถูกลบ
+func GetFinanceTransactionTrash(c *fiber.Ctx) error {
+	var transactions []models.Transaction
+	result := database.DB.Unscoped().Preload("User").
+		Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&transactions)
+	if result.Error != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+
+	deletedBy := make(map[uint]*uint, len(transactions))
+	for _, transaction := range transactions {
+		deletedBy[transaction.ID] = transaction.DeletedByID
+	}
+	deleters := trashDeleters("finance", deletedBy)
+	items := make([]TrashItem, 0, len(transactions))
+	for _, transaction := range transactions {
+		items = append(items, TrashItem{DeletedAt: transaction.DeletedAt.Time, DeletedBy: deleters[transaction.ID], Record: transaction})
+	}
+	return c.JSON(items)
+}
+
+// restoreConflict - ตรวจข้อมูลก่อนกู้คืน คืนข้อความ error (ว่าง = ผ่าน) และ status code
+func restoreConflict(c *fiber.Ctx, anonymizedAt *time.Time, provinceID, districtID, subDistrictID uint, phoneIndex string) (int, string) {
+	if anonymizedAt != nil {
+		return fiber.StatusConflict, "ข้อมูลนี้ถูกลบข้อมูลส่วนบุคคลแล้ว ไม่สามารถกู้คืนได้"
+	}
+	if !validateAddress(provinceID, districtID, subDistrictID) {
+		return fiber.StatusUnprocessableEntity, "ที่อยู่ไม่ถูกต้อง กรุณาแก้ไขก่อนกู้คืน"
+	}
+
+	// มีผู้ลงทะเบียนเบอร์เดียวกันอยู่แล้ว - กู้คืนได้เมื่อยืนยันด้วย ?force=true
+	if phoneIndex != "" && c.Query("force") != "true" {
+		var count int64
+		database.DB.Model(&models.Registration{}).Where("phone_number_index = ?", phoneIndex).Count(&count)
+		var teacherCount int64
+		database.DB.Model(&models.TeacherRegistration{}).Where("phone_number_index = ?", phoneIndex).Count(&teacherCount)
+		if count+teacherCount > 0 {
+			return fiber.StatusConflict, "มีการลงทะเบียนด้วยเบอร์โทรนี้อยู่แล้ว (ใช้ ?force=true เพื่อกู้คืน)"
+		}
+	}
+	return 0, ""
+}
+
+// RestoreRegistration - กู้คืนการลงทะเบียนที่ถูกลบ
+func RestoreRegistration(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var registration models.Registration
+
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&registration, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลในถังขยะ",
+		})
+	}
+
+	if status, message := restoreConflict(c, registration.AnonymizedAt, registration.ProvinceID, registration.DistrictID, registration.SubDistrictID, registration.PhoneNumberIndex); message != "" {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	// เลขบัตรประชาชน/ใบสุทธิซ้ำ กู้คืนไม่ได้แม้ใช้ ?force=true
+	if identityErr := identityConflict(registration.NationalIDIndex, registration.MonkCertificateIndex, "registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
+	userID := c.Locals("userID").(uint)
+	err := eventTransaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&registration).Updates(map[string]interface{}{"deleted_at": nil, "deleted_by_id": nil}).Error; err != nil {
+			return err
+		}
+		after := registrationFieldsOf(&registration)
+		return recordVersion(tx, "registration", registration.ID, "restore", nil, &after, &userID)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถกู้คืนข้อมูลได้",
+		})
+	}
+
+	activityLog := models.ActivityLog{
+		Action:      "กู้คืนข้อมูลการลงทะเบียน",
+		Description: fmt.Sprintf("กู้คืนข้อมูลของ %s", registration.FullName),
+		Module:      "registration",
+		RecordID:    &registration.ID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "กู้คืนข้อมูลสำเร็จ",
+		"data":    registration,
+	})
+}
+
+// RestoreTeacherRegistration - กู้คืนการลงทะเบียนพระอาจารย์ที่ถูกลบ
+func RestoreTeacherRegistration(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var registration models.TeacherRegistration
+
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&registration, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลในถังขยะ",
+		})
+	}
+
+	if status, message := restoreConflict(c, registration.AnonymizedAt, registration.ProvinceID, registration.DistrictID, registration.SubDistrictID, registration.PhoneNumberIndex); message != "" {
+		return c.Status(status).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	// เลขบัตรประชาชน/ใบสุทธิซ้ำ กู้คืนไม่ได้แม้ใช้ ?force=true
+	if identityErr := identityConflict(registration.NationalIDIndex, registration.MonkCertificateIndex, "teacher_registrations", registration.ID); identityErr != nil {
+		return identityErr.respond(c)
+	}
+
+	userID := c.Locals("userID").(uint)
+	err := eventTransaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&registration).Updates(map[string]interface{}{"deleted_at": nil, "deleted_by_id": nil}).Error; err != nil {
+			return err
+		}
+		after := teacherRegistrationFieldsOf(&registration)
+		return recordVersion(tx, "teacher-registration", registration.ID, "restore", nil, &after, &userID)
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถกู้คืนข้อมูลได้",
+		})
+	}
+
+	activityLog := models.ActivityLog{
+		Action:      "กู้คืนข้อมูลการลงทะเบียนพระอาจารย์",
+		Description: fmt.Sprintf("กู้คืนข้อมูลของ %s", registration.FullName),
+		Module:      "teacher-registration",
+		RecordID:    &registration.ID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	database.DB.Preload("Province").Preload("District").Preload("SubDistrict").First(&registration, registration.ID)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "กู้คืนข้อมูลสำเร็จ",
+		"data":    registration,
+	})
+}
+
+// RestoreFinanceTransaction - กู้คืนรายการรายรับรายจ่ายที่ถูกลบ
+func RestoreFinanceTransaction(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var transaction models.Transaction
+
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&transaction, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลในถังขยะ",
+		})
+	}
+
+	if transaction.Type != "income" && transaction.Type != "expense" {
+		return c.Status(422).JSON(fiber.Map{
+			"error": "ประเภทต้องเป็น 'income' หรือ 'expense'",
+		})
+	}
+	if transaction.Amount <= 0 {
+		return c.Status(422).JSON(fiber.Map{
+			"error": "จำนวนเงินต้องมากกว่า 0",
+		})
+	}
+
+	if err := database.DB.Unscoped().Model(&transaction).Updates(map[string]interface{}{"deleted_at": nil, "deleted_by_id": nil}).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถกู้คืนข้อมูลได้",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "กู้คืนรายการ " + transaction.Type + " (Finance)",
+		Description: transaction.Description + " - จำนวน " + formatFinanceMoney(transaction.Amount),
+		Module:      "finance",
+		RecordID:    &transaction.ID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	database.DB.Preload("User").First(&transaction, transaction.ID)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "กู้คืนข้อมูลสำเร็จ",
+		"data":    transaction,
+	})
+}
+
+// PurgeRegistration - ลบการลงทะเบียนออกจากถังขยะถาวร (superadmin)
+func PurgeRegistration(c *fiber.Ctx) error {
+	return purgeTrashedRegistration(c, "registrations", "registration")
+}
+
+// PurgeTeacherRegistration - ลบการลงทะเบียนพระอาจารย์ออกจากถังขยะถาวร (superadmin)
+func PurgeTeacherRegistration(c *fiber.Ctx) error {
+	return purgeTrashedRegistration(c, "teacher_registrations", "teacher-registration")
+}
+
+func purgeTrashedRegistration(c *fiber.Ctx, table, module string) error {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "id ไม่ถูกต้อง",
+		})
+	}
+
+	var fullName string
+	result := database.DB.Table(table).Where("id = ? AND deleted_at IS NOT NULL", id).Limit(1).Pluck("full_name", &fullName)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลในถังขยะ",
+		})
+	}
+
+	recordID := uint(id)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeRegistrations(tx, table, []uint{recordID})
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลถาวรได้",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "ลบข้อมูลถาวร",
+		Description: fmt.Sprintf("ลบข้อมูลของ %s ออกจากถังขยะถาวร", fullName),
+		Module:      module,
+		RecordID:    &recordID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบข้อมูลถาวรสำเร็จ",
+	})
+}
+
+// PurgeFinanceTransaction - ลบรายการรายรับรายจ่ายออกจากถังขยะถาวร (superadmin)
+func PurgeFinanceTransaction(c *fiber.Ctx) error {
+	id := c.Params("id")
+	var transaction models.Transaction
+
+	if err := database.DB.Unscoped().Where("deleted_at IS NOT NULL").First(&transaction, id).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบข้อมูลในถังขยะ",
+		})
+	}
+
+	if err := database.DB.Unscoped().Delete(&transaction).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลถาวรได้",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	activityLog := models.ActivityLog{
+		Action:      "ลบรายการถาวร " + transaction.Type + " (Finance)",
+		Description: transaction.Description + " - จำนวน " + formatFinanceMoney(transaction.Amount),
+		Module:      "finance",
+		RecordID:    &transaction.ID,
+		UserID:      userID,
+	}
+	database.DB.Create(&activityLog)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบข้อมูลถาวรสำเร็จ",
+	})
+}
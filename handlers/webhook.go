@@ -0,0 +1,787 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"registration-system/database"
+	"registration-system/events"
+	"registration-system/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxWebhookAttempts         = 10               // ส่งไม่สำเร็จครบจำนวนนี้แล้วเลิกส่ง (status = failed)
+	webhookBatchSize           = 50               // จำนวนรายการที่ worker หยิบต่อรอบ
+	webhookLease               = 2 * time.Minute  // ระหว่างส่ง เลื่อนเวลาส่งครั้งถัดไปไว้ กัน worker อื่นหยิบซ้ำ
+	webhookSendTimeout         = 10 * time.Second // เวลาสูงสุดต่อการส่งหนึ่งครั้ง
+	webhookResponseLimit       = 1024             // เก็บ response body ไม่เกินนี้ (byte)
+	defaultWebhookDisableAfter = 20               // ส่งไม่สำเร็จติดกันครบจำนวนนี้แล้วปิด subscription อัตโนมัติ
+	webhookPingEvent           = "ping"
+)
+
+// webhookEventTypes - event ที่สมัครรับได้ ("*" = ทุก event)
+var webhookEventTypes = []string{
+	"registration.created",
+	"registration.updated",
+	"registration.deleted",
+	"chanting.stage_changed",
+	"transaction.created",
+}
+
+// webhookClient - ไม่ตาม redirect (ปลายทางต้องตอบ 2xx เอง)
+var webhookClient = &http.Client{
+	Timeout: webhookSendTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// webhookWake - ปลุก worker ทันทีเมื่อมีรายการใหม่ ไม่ต้องรอรอบถัดไป
+var webhookWake = make(chan struct{}, 1)
+
+// WebhookSubscriptionRequest - ข้อมูลสำหรับสร้าง/แก้ไข webhook
+type WebhookSubscriptionRequest struct {
+	Name         string   `json:"name"`
+	URL          string   `json:"url"`
+	EventTypes   []string `json:"event_types"`
+	Format       string   `json:"format"`        // "json" (ค่าเริ่มต้น) หรือ "discord"
+	Secret       string   `json:"secret"`        // ว่าง = สร้างให้ (ตอนสร้าง)
+	RotateSecret bool     `json:"rotate_secret"` // แก้ไข: สร้าง secret ใหม่
+	Active       *bool    `json:"active"`        // แก้ไข: เปิด/ปิด (เปิดใหม่จะล้างจำนวนครั้งที่ล้มเหลว)
+}
+
+// webhookDisableAfter - จำนวนครั้งที่ส่งไม่สำเร็จติดกันก่อนปิดอัตโนมัติ (WEBHOOK_DISABLE_AFTER)
+func webhookDisableAfter() int {
+	if env := os.Getenv("WEBHOOK_DISABLE_AFTER"); env != "" {
+		if parsed, err := strconv.Atoi(env); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("Invalid WEBHOOK_DISABLE_AFTER %q, using %d", env, defaultWebhookDisableAfter)
+	}
+	return defaultWebhookDisableAfter
+}
+
+// newWebhookSecret - secret สำหรับลงลายมือชื่อ เช่น "whsec_3f9a..."
+func newWebhookSecret() string {
+	buf := make([]byte, 24)
+	rand.Read(buf)
+	return "whsec_" + hex.EncodeToString(buf)
+}
+
+// signWebhook - ลายมือชื่อ HMAC-SHA256 ของ "<timestamp>.<body>" ในรูปแบบ "sha256=<hex>"
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff - รอนานขึ้นเป็นเท่าตัวทุกครั้งที่ส่งไม่สำเร็จ (1 นาที, 2 นาที, 4 นาที, ... สูงสุด 12 ชั่วโมง)
+func webhookBackoff(attempts int) time.Duration {
+	delay := time.Minute
+	for i := 1; i < attempts && delay < 12*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 12*time.Hour {
+		delay = 12 * time.Hour
+	}
+	return delay
+}
+
+// validateWebhookRequest - ตรวจ URL, event และรูปแบบ คืนข้อความผิดพลาด (ว่าง = ผ่าน)
+func validateWebhookRequest(req *WebhookSubscriptionRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.URL = strings.TrimSpace(req.URL)
+	if req.Name == "" {
+		return "กรุณาระบุชื่อ webhook"
+	}
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "URL ต้องขึ้นต้นด้วย http:// หรือ https://"
+	}
+	if len(req.URL) > 500 {
+		return "URL ยาวเกิน 500 ตัวอักษร"
+	}
+	if len(req.EventTypes) == 0 {
+		return "กรุณาเลือก event อย่างน้อย 1 รายการ"
+	}
+	for _, eventType := range req.EventTypes {
+		if eventType == "*" {
+			continue
+		}
+		known := false
+		for _, supported := range webhookEventTypes {
+			if eventType == supported {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Sprintf("ไม่รู้จัก event %q", eventType)
+		}
+	}
+	if req.Format == "" {
+		req.Format = "json"
+	}
+	if req.Format != "json" && req.Format != "discord" {
+		return "format ต้องเป็น json หรือ discord"
+	}
+	return ""
+}
+
+// webhookPayload - body ที่ส่งให้ subscription ตามรูปแบบที่เลือก
+func webhookPayload(subscription *models.WebhookSubscription, event events.Event) ([]byte, error) {
+	if subscription.Format == "discord" {
+		return json.Marshal(fiber.Map{
+			"content":          webhookSummary(event),
+			"allowed_mentions": fiber.Map{"parse": []string{}},
+		})
+	}
+	return json.Marshal(event)
+}
+
+// webhookSummary - ข้อความสั้นของ event (สำหรับช่องแชท เช่น Discord)
+func webhookSummary(event events.Event) string {
+	switch data := event.Data.(type) {
+	case RegistrationEvent:
+		recordType := "registration"
+		if data.RecordType == "teacher-registration" {
+			recordType = "teacher"
+		}
+		reference := registrationReference(recordType, data.ID)
+		switch event.Type {
+		case "registration.created":
+			return fmt.Sprintf("ลงทะเบียนใหม่: %s (%s)", data.FullName, reference)
+		case "registration.deleted":
+			return fmt.Sprintf("ลบการลงทะเบียน: %s (%s)", data.FullName, reference)
+		}
+		if len(data.ChangedFields) > 0 {
+			return fmt.Sprintf("แก้ไขข้อมูล: %s (%s) - %s", data.FullName, reference, strings.Join(data.ChangedFields, ", "))
+		}
+		return fmt.Sprintf("แก้ไขข้อมูล: %s (%s)", data.FullName, reference)
+	case ChantingEvent:
+		reference := registrationReference("registration", data.ID)
+		if len(data.Completed) > 0 {
+			return fmt.Sprintf("สวดผ่าน %s: %s (%s)", strings.Join(data.Completed, ", "), data.FullName, reference)
+		}
+		return fmt.Sprintf("แก้ผลการสวด %s: %s (%s)", strings.Join(data.Reverted, ", "), data.FullName, reference)
+	case fiber.Map:
+		if event.Type == "transaction.created" {
+			kind := "รายรับ"
+			if data["type"] == "expense" {
+				kind = "รายจ่าย"
+			}
+			return fmt.Sprintf("%s %v บาท: %v (%v)", kind, data["amount"], data["description"], data["category"])
+		}
+		if message, ok := data["message"].(string); ok {
+			return message
+		}
+	}
+	return event.Type
+}
+
+// stageWebhookDeliveries - สร้างรายการส่งใน tx ให้ทุก subscription ที่เปิดอยู่และสมัครรับ event นี้
+// รายการจึงถูกบันทึกพร้อมการเปลี่ยนแปลงที่เป็นต้นเหตุ (ไม่หายเมื่อ server หยุดหลัง commit) คืน true ถ้ามีรายการใหม่
+func stageWebhookDeliveries(tx *gorm.DB, eventType string, data interface{}) (bool, error) {
+	var subscriptions []models.WebhookSubscription
+	if err := tx.Where("active = ? AND (? = ANY(event_types) OR '*' = ANY(event_types))", true, eventType).
+		Find(&subscriptions).Error; err != nil {
+		return false, err
+	}
+	if len(subscriptions) == 0 {
+		return false, nil
+	}
+
+	// id ของ event ใน webhook ไม่ตรงกับ id ใน event bus (ซึ่งได้หลัง commit)
+	now := time.Now()
+	event := events.Event{ID: "evt_" + uuid.NewString(), Type: eventType, Time: now, Data: data}
+	deliveries := make([]models.WebhookDelivery, 0, len(subscriptions))
+	for i := range subscriptions {
+		payload, err := webhookPayload(&subscriptions[i], event)
+		if err != nil {
+			return false, err
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			SubscriptionID: subscriptions[i].ID,
+			EventID:        event.ID,
+			EventType:      event.Type,
+			Payload:        models.EncryptedString(payload),
+			Status:         "pending",
+			NextAttemptAt:  now,
+		})
+	}
+	if err := tx.Create(&deliveries).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// wakeWebhookWorker - ให้ worker ส่งทันที (เรียกหลัง commit)
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// claimDueWebhookDeliveries - หยิบรายการที่ถึงเวลาส่ง (เฉพาะ subscription ที่เปิดอยู่) และเลื่อนเวลาส่งครั้งถัดไปไว้ระหว่างส่ง
+func claimDueWebhookDeliveries() ([]models.WebhookDelivery, error) {
+	var batch []models.WebhookDelivery
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		active := database.DB.Model(&models.WebhookSubscription{}).Select("id").Where("active = ?", true)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ? AND subscription_id IN (?)", "pending", now, active).
+			Order("next_attempt_at").Limit(webhookBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		ids := make([]uint, len(batch))
+		for i, delivery := range batch {
+			ids[i] = delivery.ID
+		}
+		return tx.Model(&models.WebhookDelivery{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(webhookLease)).Error
+	})
+	return batch, err
+}
+
+// sendWebhook - POST payload ไปยังปลายทางหนึ่งครั้ง คืนผลการส่ง (ยังไม่บันทึก)
+func sendWebhook(subscription *models.WebhookSubscription, delivery *models.WebhookDelivery) models.WebhookAttempt {
+	attempt := models.WebhookAttempt{DeliveryID: delivery.ID}
+	body := []byte(delivery.Payload.String())
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "registration-system-webhook/1.0")
+	req.Header.Set("X-Webhook-Id", strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Webhook-Signature", signWebhook(subscription.Secret.String(), timestamp, body))
+
+	start := time.Now()
+	resp, err := webhookClient.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	attempt.ResponseBody = strings.ToValidUTF8(string(responseBody), "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("ปลายทางตอบ HTTP %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// deliverWebhook - ส่งหนึ่งรายการแล้วบันทึกผล (สำเร็จ, รอส่งใหม่ตาม backoff หรือเลิกส่ง)
+// error คือบันทึกผลไม่สำเร็จ ผลการส่งดูจาก attempt.Error และปิด subscription อัตโนมัติเมื่อส่งไม่สำเร็จติดกันครบ WEBHOOK_DISABLE_AFTER ครั้ง
+func deliverWebhook(subscription *models.WebhookSubscription, delivery *models.WebhookDelivery, manual bool) (models.WebhookAttempt, error) {
+	attempt := sendWebhook(subscription, delivery)
+	attempt.Manual = manual
+	succeeded := attempt.Error == ""
+
+	now := time.Now()
+	attempts := delivery.Attempts + 1
+	updates := map[string]interface{}{
+		"attempts":         attempts,
+		"last_status_code": attempt.StatusCode,
+		"last_error":       attempt.Error,
+	}
+	switch {
+	case succeeded:
+		updates["status"] = "succeeded"
+		updates["delivered_at"] = now
+	case attempts >= maxWebhookAttempts || delivery.EventType == webhookPingEvent:
+		updates["status"] = "failed"
+	default:
+		updates["status"] = "pending"
+		updates["next_attempt_at"] = now.Add(webhookBackoff(attempts))
+	}
+
+	disabled := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attempt).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.WebhookDelivery{}).Where("id = ?", delivery.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if succeeded {
+			subscription.ConsecutiveFailures = 0
+			return tx.Model(&models.WebhookSubscription{}).Where("id = ?", subscription.ID).
+				Update("consecutive_failures", 0).Error
+		}
+
+		if err := tx.Raw("UPDATE webhook_subscriptions SET consecutive_failures = consecutive_failures + 1 WHERE id = ? RETURNING consecutive_failures",
+			subscription.ID).Scan(&subscription.ConsecutiveFailures).Error; err != nil {
+			return err
+		}
+		if !subscription.Active || subscription.ConsecutiveFailures < webhookDisableAfter() {
+			return nil
+		}
+		reason := fmt.Sprintf("ส่งไม่สำเร็จติดกัน %d ครั้ง (ล่าสุด: %s)", subscription.ConsecutiveFailures, attempt.Error)
+		result := tx.Model(&models.WebhookSubscription{}).Where("id = ? AND active = ?", subscription.ID, true).
+			Updates(map[string]interface{}{"active": false, "disabled_at": now, "disabled_reason": reason})
+		if result.Error != nil {
+			return result.Error
+		}
+		subscription.Active = false
+		subscription.DisabledAt = &now
+		subscription.DisabledReason = reason
+		disabled = result.RowsAffected == 1
+		return nil
+	})
+	if err != nil {
+		return attempt, err
+	}
+
+	if disabled {
+		logSystemActivity("ปิด webhook อัตโนมัติ",
+			fmt.Sprintf("ปิด webhook #%d (%s) เพราะ%s", subscription.ID, subscription.Name, subscription.DisabledReason), "webhook")
+	}
+	delivery.Attempts = attempts
+	return attempt, nil
+}
+
+// deliverDueWebhooks - ส่งรายการที่ถึงเวลาจนกว่าจะหมด คืนจำนวนที่ส่งสำเร็จ
+func deliverDueWebhooks() (int, error) {
+	sent := 0
+	for {
+		batch, err := claimDueWebhookDeliveries()
+		if err != nil {
+			return sent, err
+		}
+
+		subscriptionIDs := make([]uint, 0, len(batch))
+		for _, delivery := range batch {
+			subscriptionIDs = append(subscriptionIDs, delivery.SubscriptionID)
+		}
+		var subscriptions []models.WebhookSubscription
+		if len(subscriptionIDs) > 0 {
+			if err := database.DB.Where("id IN ?", subscriptionIDs).Find(&subscriptions).Error; err != nil {
+				return sent, err
+			}
+		}
+		byID := make(map[uint]*models.WebhookSubscription, len(subscriptions))
+		for i := range subscriptions {
+			byID[subscriptions[i].ID] = &subscriptions[i]
+		}
+
+		for i := range batch {
+			subscription := byID[batch[i].SubscriptionID]
+			if subscription == nil || !subscription.Active {
+				// ถูกปิดระหว่างรอบนี้ ค้างไว้จนกว่าจะเปิดใหม่
+				continue
+			}
+			attempt, err := deliverWebhook(subscription, &batch[i], false)
+			if err != nil {
+				return sent, err
+			}
+			if attempt.Error != "" {
+				log.Printf("Webhook delivery %d (%s to %s) failed: %s", batch[i].ID, batch[i].EventType, subscription.Name, attempt.Error)
+				continue
+			}
+			sent++
+		}
+		if len(batch) < webhookBatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// StartWebhookWorker - ส่ง event ไปยัง webhook ที่สมัครไว้ (WEBHOOK_INTERVAL เช่น "5s", "off" = ปิด)
+func StartWebhookWorker() {
+	interval := 5 * time.Second
+	if env := os.Getenv("WEBHOOK_INTERVAL"); env != "" {
+		if env == "off" {
+			log.Println("Webhook worker disabled")
+			return
+		}
+		parsed, err := time.ParseDuration(env)
+		if err != nil || parsed < time.Second {
+			log.Printf("Invalid WEBHOOK_INTERVAL %q, using %s", env, interval)
+		} else {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-webhookWake:
+			}
+			if _, err := deliverDueWebhooks(); err != nil {
+				log.Printf("Webhook worker failed: %v", err)
+			}
+		}
+	}()
+	log.Printf("Webhook worker started (every %s)", interval)
+}
+
+// GetWebhookEventTypes - event ที่สมัครรับได้
+func GetWebhookEventTypes(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"event_types": webhookEventTypes,
+		"formats":     []string{"json", "discord"},
+	})
+}
+
+// GetWebhooks - รายการ webhook ทั้งหมด
+func GetWebhooks(c *fiber.Ctx) error {
+	var subscriptions []models.WebhookSubscription
+	if err := database.DB.Order("created_at DESC").Find(&subscriptions).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	return c.JSON(subscriptions)
+}
+
+// CreateWebhook - สร้าง webhook (secret แสดงครั้งเดียวในผลลัพธ์)
+func CreateWebhook(c *fiber.Ctx) error {
+	var req WebhookSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+	if message := validateWebhookRequest(&req); message != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	secret := req.Secret
+	if secret == "" {
+		secret = newWebhookSecret()
+	}
+
+	userID := c.Locals("userID").(uint)
+	subscription := models.WebhookSubscription{
+		Name:        req.Name,
+		URL:         req.URL,
+		EventTypes:  models.StringArray(req.EventTypes),
+		Format:      req.Format,
+		Secret:      models.EncryptedString(secret),
+		Active:      true,
+		CreatedByID: userID,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&subscription).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      "สร้าง webhook",
+			Description: fmt.Sprintf("สร้าง webhook %s (%s) รับ %s", subscription.Name, subscription.URL, strings.Join(req.EventTypes, ", ")),
+			Module:      "webhook",
+			RecordID:    &subscription.ID,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"webhook": subscription,
+		"secret":  secret,
+	})
+}
+
+// UpdateWebhook - แก้ไข webhook, เปิด/ปิด หรือสร้าง secret ใหม่ (rotate_secret)
+func UpdateWebhook(c *fiber.Ctx) error {
+	var subscription models.WebhookSubscription
+	if err := database.DB.First(&subscription, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบ webhook",
+		})
+	}
+
+	var req WebhookSubscriptionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "ข้อมูลไม่ถูกต้อง",
+		})
+	}
+	if message := validateWebhookRequest(&req); message != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	updates := map[string]interface{}{
+		"name":        req.Name,
+		"url":         req.URL,
+		"event_types": models.StringArray(req.EventTypes),
+		"format":      req.Format,
+	}
+	secret := ""
+	if req.RotateSecret {
+		secret = newWebhookSecret()
+	} else if req.Secret != "" {
+		secret = req.Secret
+	}
+	if secret != "" {
+		updates["secret"] = models.EncryptedString(secret)
+	}
+	if req.Active != nil {
+		updates["active"] = *req.Active
+		if *req.Active && !subscription.Active {
+			updates["consecutive_failures"] = 0
+			updates["disabled_at"] = nil
+			updates["disabled_reason"] = ""
+		} else if !*req.Active && subscription.Active {
+			updates["disabled_at"] = time.Now()
+			updates["disabled_reason"] = "ปิดโดยผู้ดูแล"
+		}
+	}
+
+	userID := c.Locals("userID").(uint)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&subscription).Updates(updates).Error; err != nil {
+			return err
+		}
+		description := fmt.Sprintf("แก้ไข webhook %s (%s)", req.Name, req.URL)
+		if secret != "" {
+			description += " และเปลี่ยน secret"
+		}
+		if req.Active != nil && *req.Active != subscription.Active {
+			if *req.Active {
+				description += " และเปิดใช้งาน"
+			} else {
+				description += " และปิดใช้งาน"
+			}
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      "แก้ไข webhook",
+			Description: description,
+			Module:      "webhook",
+			RecordID:    &subscription.ID,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	database.DB.First(&subscription, subscription.ID)
+	result := fiber.Map{"webhook": subscription}
+	if secret != "" {
+		result["secret"] = secret
+	}
+	return c.JSON(result)
+}
+
+// DeleteWebhook - ลบ webhook พร้อมประวัติการส่ง
+func DeleteWebhook(c *fiber.Ctx) error {
+	var subscription models.WebhookSubscription
+	if err := database.DB.First(&subscription, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบ webhook",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		deliveryIDs := database.DB.Model(&models.WebhookDelivery{}).Select("id").Where("subscription_id = ?", subscription.ID)
+		if err := tx.Where("delivery_id IN (?)", deliveryIDs).Delete(&models.WebhookAttempt{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("subscription_id = ?", subscription.ID).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&subscription).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      "ลบ webhook",
+			Description: fmt.Sprintf("ลบ webhook %s (%s)", subscription.Name, subscription.URL),
+			Module:      "webhook",
+			RecordID:    &subscription.ID,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถลบข้อมูลได้",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "ลบ webhook สำเร็จ",
+	})
+}
+
+// TestWebhook - ส่ง event "ping" ไปยังปลายทางทันทีและคืนผล (ใช้ตรวจ URL และการตรวจลายมือชื่อฝั่งผู้รับ)
+func TestWebhook(c *fiber.Ctx) error {
+	var subscription models.WebhookSubscription
+	if err := database.DB.First(&subscription, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบ webhook",
+		})
+	}
+
+	now := time.Now()
+	event := events.Event{
+		ID:   fmt.Sprintf("ping-%d", now.UnixNano()),
+		Type: webhookPingEvent,
+		Time: now,
+		Data: fiber.Map{"webhook_id": subscription.ID, "message": "ทดสอบ webhook: " + subscription.Name},
+	}
+	payload, err := webhookPayload(&subscription, event)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถสร้างข้อมูลได้",
+		})
+	}
+	delivery := models.WebhookDelivery{
+		SubscriptionID: subscription.ID,
+		EventID:        event.ID,
+		EventType:      event.Type,
+		Payload:        models.EncryptedString(payload),
+		Status:         "pending",
+		NextAttemptAt:  now.Add(webhookLease), // ส่งเองด้านล่าง ไม่ให้ worker หยิบ
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	attempt, err := deliverWebhook(&subscription, &delivery, true)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success":     attempt.Error == "",
+		"delivery_id": delivery.ID,
+		"attempt":     attempt,
+	})
+}
+
+// GetWebhookDeliveries - ประวัติการส่งของ webhook
+// Query: status, event_type, limit (ค่าเริ่มต้น 100, สูงสุด 500)
+func GetWebhookDeliveries(c *fiber.Ctx) error {
+	query := database.DB.Where("subscription_id = ?", c.Params("id")).Order("created_at DESC")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("event_type"); eventType != "" {
+		query = query.Where("event_type = ?", eventType)
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Limit(limit).Find(&deliveries).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถดึงข้อมูลได้",
+		})
+	}
+	return c.JSON(deliveries)
+}
+
+// GetWebhookDelivery - รายการส่งหนึ่งรายการพร้อมผลการส่งทุกครั้ง (status code, response)
+func GetWebhookDelivery(c *fiber.Ctx) error {
+	var delivery models.WebhookDelivery
+	if err := database.DB.Preload("AttemptLog", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).First(&delivery, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบรายการส่ง",
+		})
+	}
+	return c.JSON(delivery)
+}
+
+// RedeliverWebhook - ส่งรายการเดิมใหม่ทันที (payload เดิม ลายมือชื่อใหม่) และนับจำนวนครั้งใหม่
+// ถ้ายังไม่สำเร็จ worker จะส่งซ้ำตาม backoff ต่อ (เมื่อ webhook เปิดอยู่)
+func RedeliverWebhook(c *fiber.Ctx) error {
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบรายการส่ง",
+		})
+	}
+	var subscription models.WebhookSubscription
+	if err := database.DB.First(&subscription, delivery.SubscriptionID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ไม่พบ webhook",
+		})
+	}
+
+	userID := c.Locals("userID").(uint)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// เลื่อนเวลาส่งไว้ระหว่างส่งเอง กัน worker หยิบซ้ำ
+		if err := tx.Model(&delivery).Updates(map[string]interface{}{
+			"status":          "pending",
+			"attempts":        0,
+			"next_attempt_at": time.Now().Add(webhookLease),
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ActivityLog{
+			Action:      "ส่ง webhook ใหม่",
+			Description: fmt.Sprintf("ส่งรายการ #%d (%s) ไปยัง webhook %s ใหม่", delivery.ID, delivery.EventType, subscription.Name),
+			Module:      "webhook",
+			RecordID:    &delivery.ID,
+			UserID:      userID,
+		}).Error
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+
+	delivery.Attempts = 0
+	attempt, err := deliverWebhook(&subscription, &delivery, true)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "ไม่สามารถบันทึกข้อมูลได้",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success":     attempt.Error == "",
+		"delivery_id": delivery.ID,
+		"attempt":     attempt,
+	})
+}
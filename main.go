@@ -3,10 +3,14 @@ package main
 import (
 	"log"
 	"os"
+	"registration-system/captcha"
 	"registration-system/database"
+	"registration-system/events"
+	"registration-system/fieldcrypt"
 	"registration-system/handlers"
 	"registration-system/middleware"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -19,11 +23,39 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	if err := fieldcrypt.LoadFromEnv(); err != nil {
+		log.Fatal("Failed to load field encryption keys:", err)
+	}
+	if err := captcha.LoadFromEnv(); err != nil {
+		log.Fatal("Failed to configure captcha:", err)
+	}
+	events.LoadFromEnv()
+
 	database.Connect()
 	database.Migrate()
+	handlers.RegisterStatisticsCacheInvalidation(database.DB)
+	handlers.EnsureSuperadmin()
+
+	// อยู่หลัง nginx: อ่าน IP ผู้ใช้จาก header ที่ proxy ตั้ง (เชื่อเฉพาะ proxy ใน TRUSTED_PROXIES)
+	proxyHeader := os.Getenv("PROXY_HEADER")
+	if proxyHeader == "" {
+		proxyHeader = "X-Real-IP"
+	}
+	trustedProxies := []string{"127.0.0.1", "::1"}
+	if env := os.Getenv("TRUSTED_PROXIES"); env != "" {
+		trustedProxies = trustedProxies[:0]
+		for _, proxy := range strings.Split(env, ",") {
+			if proxy = strings.TrimSpace(proxy); proxy != "" {
+				trustedProxies = append(trustedProxies, proxy)
+			}
+		}
+	}
 
 	app := fiber.New(fiber.Config{
-		AppName: "Registration System API",
+		AppName:                 "Registration System API",
+		ProxyHeader:             proxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          trustedProxies,
 	})
 
 	// Get CORS origins from environment
@@ -46,9 +78,9 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     strings.Join(corsOrigins, ","),
 		AllowCredentials: true,
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Requested-With",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Requested-With, If-Match, X-Captcha-Token, Idempotency-Key, Last-Event-ID",
 		AllowMethods:     "GET, POST, PUT, DELETE, OPTIONS, PATCH",
-		ExposeHeaders:    "Content-Length, Content-Type",
+		ExposeHeaders:    "Content-Length, Content-Type, ETag, Retry-After, Idempotent-Replayed",
 	}))
 
 	app.Use(logger.New())
@@ -57,12 +89,35 @@ func main() {
 
 	// Public routes - ระบบลงทะเบียนสาธารณะ (ไม่ต้อง login)
 	public := api.Group("/public")
-	public.Get("/provinces", handlers.GetProvinces)
-	public.Get("/provinces/:province_id/districts", handlers.GetDistricts)
-	public.Get("/districts/:district_id/sub-districts", handlers.GetSubDistricts)
-	public.Post("/registrations", handlers.CreateRegistration)
-	public.Post("/teacher-registrations", handlers.CreateTeacherRegistration)
-	public.Post("/device-logs", handlers.CreateDeviceLog) // บันทึกข้อมูลอุปกรณ์ (ไม่ต้อง login - PDPA compliant)
+	// ค่าจำกัดแต่ละ route ปรับได้ด้วย PROTECT_<NAME>_PER_IP/_GLOBAL/_WINDOW/_MAX_BODY/_CAPTCHA/_HONEYPOT
+	lookup := middleware.Protect(middleware.ProtectConfig{Name: "lookup", PerIP: 300, Window: time.Minute})
+	public.Get("/provinces", lookup, handlers.GetProvinces)
+	public.Get("/provinces/:province_id/districts", lookup, handlers.GetDistricts)
+	public.Get("/districts/:district_id/sub-districts", lookup, handlers.GetSubDistricts)
+	public.Get("/temples", lookup, handlers.SearchTemples)
+	public.Get("/challenge", middleware.Protect(middleware.ProtectConfig{Name: "challenge", PerIP: 30, Window: time.Minute}), handlers.GetCaptchaChallenge)
+	public.Get("/phone-verifications", lookup, handlers.GetPhoneVerificationConfig)
+	public.Post("/phone-verifications", middleware.Protect(middleware.ProtectConfig{
+		Name: "phone_verifications", PerIP: 10, Global: 300, Window: 10 * time.Minute, MaxBodyBytes: 1 << 10, Captcha: true,
+	}), handlers.RequestPhoneVerification)
+	public.Post("/phone-verifications/:id/verify", middleware.Protect(middleware.ProtectConfig{
+		Name: "phone_verifications_verify", PerIP: 30, Window: 10 * time.Minute, MaxBodyBytes: 1 << 10,
+	}), handlers.VerifyPhoneVerification)
+	public.Post("/registrations", middleware.Protect(middleware.ProtectConfig{
+		Name: "registrations", PerIP: 30, Global: 1000, Window: 10 * time.Minute, MaxBodyBytes: 32 << 10, Captcha: true, HoneypotField: "website",
+	}), middleware.Idempotent("registrations"), handlers.CreateRegistration)
+	public.Post("/teacher-registrations", middleware.Protect(middleware.ProtectConfig{
+		Name: "teacher_registrations", PerIP: 30, Global: 1000, Window: 10 * time.Minute, MaxBodyBytes: 32 << 10, Captcha: true, HoneypotField: "website",
+	}), middleware.Idempotent("teacher_registrations"), handlers.CreateTeacherRegistration)
+	public.Post("/registration-groups", middleware.Protect(middleware.ProtectConfig{
+		Name: "registration_groups", PerIP: 10, Global: 300, Window: 10 * time.Minute, MaxBodyBytes: 512 << 10, Captcha: true, HoneypotField: "website",
+	}), middleware.Idempotent("registration_groups"), handlers.CreateGroupRegistration)
+	public.Post("/device-logs", middleware.Protect(middleware.ProtectConfig{
+		Name: "device_logs", PerIP: 60, Global: 3000, Window: 10 * time.Minute, MaxBodyBytes: 8 << 10,
+	}), handlers.CreateDeviceLog) // บันทึกข้อมูลอุปกรณ์ (ไม่ต้อง login - PDPA compliant)
+
+	// LINE webhook - bot สำหรับผู้ลงทะเบียน (ตรวจ X-Line-Signature แทนการ login)
+	api.Post("/line/webhook", handlers.LineWebhook)
 
 	// Auth routes - สำหรับ admin login/register
 	auth := api.Group("/auth")
@@ -74,14 +129,66 @@ func main() {
 	admin := api.Group("/admin", middleware.AuthRequired)
 	admin.Get("/me", handlers.GetCurrentUser)
 	admin.Get("/registrations", handlers.GetRegistrations)
+	admin.Get("/registrations/duplicates", handlers.GetDuplicateRegistrations)
+	admin.Post("/registrations/bulk", handlers.BulkUpdateRegistrations)
+	admin.Get("/registrations/export", handlers.ExportRegistrations)
+	admin.Get("/registrations/trash", handlers.GetRegistrationTrash)
+	admin.Post("/registrations/trash/:id/restore", handlers.RestoreRegistration)
+	admin.Delete("/registrations/trash/:id", middleware.RequireRole("superadmin"), handlers.PurgeRegistration)
 	admin.Get("/registrations/:id", handlers.GetRegistration)
 	admin.Put("/registrations/:id", handlers.UpdateRegistration)
+	admin.Patch("/registrations/:id", handlers.PatchRegistration)
 	admin.Delete("/registrations/:id", handlers.DeleteRegistration)
 	admin.Put("/registrations/:id/chanting", handlers.UpdateChantingStatus)
+	admin.Get("/registrations/:id/history", handlers.GetRegistrationHistory)
+	admin.Post("/registrations/:id/history/:version/revert", handlers.RevertRegistration)
+	admin.Get("/registration-groups", handlers.GetRegistrationGroups)
+	admin.Get("/registration-groups/:id", handlers.GetRegistrationGroup)
+	admin.Post("/registration-groups/:id/cancel", handlers.CancelRegistrationGroup)
 	admin.Get("/teacher-registrations", handlers.GetTeacherRegistrations)
+	admin.Get("/teacher-registrations/export", handlers.ExportTeacherRegistrations)
+	admin.Get("/teacher-registrations/trash", handlers.GetTeacherRegistrationTrash)
+	admin.Post("/teacher-registrations/trash/:id/restore", handlers.RestoreTeacherRegistration)
+	admin.Delete("/teacher-registrations/trash/:id", middleware.RequireRole("superadmin"), handlers.PurgeTeacherRegistration)
 	admin.Get("/teacher-registrations/:id", handlers.GetTeacherRegistration)
 	admin.Put("/teacher-registrations/:id", handlers.UpdateTeacherRegistration)
+	admin.Patch("/teacher-registrations/:id", handlers.PatchTeacherRegistration)
 	admin.Delete("/teacher-registrations/:id", handlers.DeleteTeacherRegistration)
+	admin.Get("/teacher-registrations/:id/history", handlers.GetTeacherRegistrationHistory)
+	admin.Post("/teacher-registrations/:id/history/:version/revert", handlers.RevertTeacherRegistration)
+
+	// PDPA routes - สิทธิของเจ้าของข้อมูล (ส่งออก/ลบข้อมูลส่วนบุคคล และติดตามคำขอ) - anonymize ย้อนกลับไม่ได้ เฉพาะ superadmin
+	admin.Get("/pdpa/requests", handlers.GetDataSubjectRequests)
+	admin.Post("/pdpa/requests", handlers.CreateDataSubjectRequest)
+	admin.Put("/pdpa/requests/:id", handlers.UpdateDataSubjectRequest)
+	admin.Get("/pdpa/registrations/:id/export", handlers.ExportRegistrationData)
+	admin.Post("/pdpa/registrations/:id/anonymize", middleware.RequireRole("superadmin"), handlers.AnonymizeRegistration)
+	admin.Get("/pdpa/teacher-registrations/:id/export", handlers.ExportTeacherRegistrationData)
+	admin.Post("/pdpa/teacher-registrations/:id/anonymize", middleware.RequireRole("superadmin"), handlers.AnonymizeTeacherRegistration)
+
+	// Retention routes - ระยะเวลาเก็บข้อมูลและการลบอัตโนมัติ (แก้กฎและสั่งรันเฉพาะ superadmin)
+	admin.Get("/retention/policies", handlers.GetRetentionPolicies)
+	admin.Put("/retention/policies/:rule", middleware.RequireRole("superadmin"), handlers.UpdateRetentionPolicy)
+	admin.Get("/retention/report", handlers.GetRetentionReport)
+	admin.Post("/retention/run", middleware.RequireRole("superadmin"), handlers.RunRetention)
+
+	// Import routes - นำเข้าข้อมูลจาก CSV/XLSX (ตรวจสอบก่อน แล้วจึงบันทึกจริง)
+	admin.Get("/import-templates", handlers.GetImportTemplates)
+	admin.Post("/import-templates", handlers.CreateImportTemplate)
+	admin.Delete("/import-templates/:id", handlers.DeleteImportTemplate)
+	admin.Get("/imports", handlers.GetImportJobs)
+	admin.Post("/imports", handlers.CreateImportJob)
+	admin.Get("/imports/:id", handlers.GetImportJob)
+	admin.Post("/imports/:id/commit", handlers.CommitImportJob)
+
+	// Temple routes - ทะเบียนวัด รวมชื่อที่สะกดต่างกัน และผูกการลงทะเบียนเดิม
+	admin.Get("/temples", handlers.GetTemples)
+	admin.Post("/temples", handlers.CreateTemple)
+	admin.Post("/temples/backfill", handlers.BackfillTemples)
+	admin.Get("/temples/:id", handlers.GetTemple)
+	admin.Put("/temples/:id", handlers.UpdateTemple)
+	admin.Delete("/temples/:id", handlers.DeleteTemple)
+	admin.Post("/temples/:id/merge", handlers.MergeTemples)
 
 	// Activity Log routes - บันทึกการทำกิจกรรม (ต้อง login)
 	admin.Get("/activity-logs", handlers.GetActivityLogs)
@@ -89,10 +196,61 @@ func main() {
 
 	// Summary routes - สรุปข้อมูลทั้งหมด (ต้อง login) - สำหรับ backward compatibility
 	admin.Get("/summary", handlers.GetSummary)
+	admin.Get("/statistics", handlers.GetStatistics)
+
+	// Notification routes - outbox ข้อความแจ้งเตือน (SMS/อีเมล/LINE)
+	admin.Get("/notifications", handlers.GetNotifications)
+	admin.Get("/notifications/templates", handlers.GetNotificationTemplates)
+	admin.Post("/notifications/:id/retry", handlers.RetryNotification)
+	admin.Get("/line-links", handlers.GetLineLinks)
+	admin.Delete("/line-links/:id", handlers.DeleteLineLink)
+
+	// Geo routes - ข้อมูลแผนที่ (GeoJSON) พร้อมจำนวนผู้ลงทะเบียนต่อพื้นที่
+	admin.Get("/geo/provinces", handlers.GetProvinceGeoJSON)
+	admin.Get("/geo/provinces/:province_id/districts", handlers.GetDistrictGeoJSON)
+	admin.Post("/geo/boundaries/import", middleware.RequireRole("superadmin"), handlers.ImportAreaBoundaries)
+
+	// Event stream - Server-Sent Events ของการเปลี่ยนแปลงข้อมูล (กรองตาม role ของผู้ใช้)
+	admin.Get("/events", handlers.StreamEvents)
+
+	// Sync routes - ซิงค์ข้อมูลกับแท็บเล็ตเช็คอินที่ทำงานออฟไลน์
+	admin.Get("/sync/pull", handlers.SyncPull)
+	admin.Post("/sync/push", handlers.SyncPush)
+	admin.Get("/sync/rules", handlers.GetSyncRules)
+	admin.Get("/check-ins", handlers.GetCheckIns)
+
+	// Webhook routes - ส่ง event ไปยังระบบภายนอก (Google Apps Script, Discord ฯลฯ)
+	webhooks := admin.Group("/webhooks", middleware.RequireRole("superadmin"))
+	webhooks.Get("/", handlers.GetWebhooks)
+	webhooks.Post("/", handlers.CreateWebhook)
+	webhooks.Get("/event-types", handlers.GetWebhookEventTypes)
+	webhooks.Get("/deliveries/:id", handlers.GetWebhookDelivery)
+	webhooks.Post("/deliveries/:id/redeliver", handlers.RedeliverWebhook)
+	webhooks.Put("/:id", handlers.UpdateWebhook)
+	webhooks.Delete("/:id", handlers.DeleteWebhook)
+	webhooks.Post("/:id/test", handlers.TestWebhook)
+	webhooks.Get("/:id/deliveries", handlers.GetWebhookDeliveries)
 
 	// Device Log routes - บันทึกข้อมูลอุปกรณ์ (ดูต้อง login, สร้างไม่ต้อง)
 	admin.Get("/device-logs", handlers.GetDeviceLogs)
 
+	// Blocked request routes - คำขอสาธารณะที่ถูกบล็อก (rate limit, captcha, honeypot)
+	admin.Get("/blocked-requests", middleware.RequireRole("superadmin"), handlers.GetBlockedRequests)
+
+	// Accommodation routes - จัดการที่พัก (กุฏิ/ศาลา)
+	admin.Get("/accommodation/buildings", handlers.GetBuildings)
+	admin.Post("/accommodation/buildings", handlers.CreateBuilding)
+	admin.Put("/accommodation/buildings/:id", handlers.UpdateBuilding)
+	admin.Delete("/accommodation/buildings/:id", handlers.DeleteBuilding)
+	admin.Post("/accommodation/rooms", handlers.CreateRoom)
+	admin.Put("/accommodation/rooms/:id", handlers.UpdateRoom)
+	admin.Delete("/accommodation/rooms/:id", handlers.DeleteRoom)
+	admin.Post("/accommodation/assignments", handlers.CreateRoomAssignment)
+	admin.Delete("/accommodation/assignments/:id", handlers.DeleteRoomAssignment)
+	admin.Post("/accommodation/auto-assign", handlers.AutoAssignRooms)
+	admin.Get("/accommodation/occupancy", handlers.GetOccupancyReport)
+	admin.Get("/accommodation/roster", handlers.GetAccommodationRoster)
+
 	// User Management routes - จัดการผู้ใช้ admin
 	admin.Get("/users", handlers.GetAllUsers)
 	admin.Put("/users/:id", handlers.UpdateUser)
@@ -102,14 +260,38 @@ func main() {
 	// ใช้ login เดียวกัน แต่แยก path ออกมา
 	finance := api.Group("/finance", middleware.AuthRequired)
 	finance.Get("/transactions", handlers.GetFinanceTransactions)
+	finance.Get("/transactions/trash", handlers.GetFinanceTransactionTrash)
+	finance.Post("/transactions/trash/:id/restore", handlers.RestoreFinanceTransaction)
+	finance.Delete("/transactions/trash/:id", middleware.RequireRole("superadmin"), handlers.PurgeFinanceTransaction)
 	finance.Get("/transactions/:id", handlers.GetFinanceTransaction)
-	finance.Post("/transactions", handlers.CreateFinanceTransaction)
+	finance.Post("/transactions", middleware.Idempotent("finance_transactions"), handlers.CreateFinanceTransaction)
 	finance.Put("/transactions/:id", handlers.UpdateFinanceTransaction)
+	finance.Patch("/transactions/:id", handlers.PatchFinanceTransaction)
 	finance.Delete("/transactions/:id", handlers.DeleteFinanceTransaction)
 	finance.Get("/summary", handlers.GetFinanceSummary)
 	finance.Post("/upload-image", handlers.UploadImageToCloudinary)         // Upload image to Cloudinary (fallback)
 	finance.Get("/upload-signature", handlers.GetCloudinaryUploadSignature) // Get signature for direct upload
 
+	// Medical routes - ข้อมูลสุขภาพ (ต้องมี role "medical" และทุกการอ่านถูกบันทึกใน Activity Log)
+	medical := api.Group("/medical", middleware.AuthRequired, middleware.RequireRole("medical"))
+	medical.Get("/condition-types", handlers.GetMedicalConditionTypes)
+	medical.Post("/condition-types", handlers.CreateMedicalConditionType)
+	medical.Put("/condition-types/:id", handlers.UpdateMedicalConditionType)
+	medical.Get("/profiles", handlers.GetMedicalProfiles)
+	medical.Get("/registrations/:id/profile", handlers.GetMedicalProfile)
+	medical.Put("/registrations/:id/profile", handlers.UpsertMedicalProfile)
+	medical.Get("/teacher-registrations/:id/profile", handlers.GetTeacherMedicalProfile)
+	medical.Put("/teacher-registrations/:id/profile", handlers.UpsertTeacherMedicalProfile)
+	medical.Get("/incidents", handlers.GetMedicalIncidents)
+	medical.Post("/incidents", handlers.CreateMedicalIncident)
+	medical.Put("/incidents/:id", handlers.UpdateMedicalIncident)
+
+	// Background jobs
+	handlers.StartRetentionScheduler()
+	handlers.StartNotificationWorker()
+	handlers.StartWebhookWorker()
+	handlers.RecoverImportJobs()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3000"
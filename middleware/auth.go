@@ -44,10 +44,38 @@ func AuthRequired(c *fiber.Ctx) error {
 	// Store user ID in context
 	c.Locals("userID", user.ID)
 	c.Locals("username", user.Username)
+	c.Locals("roles", []string(user.Roles))
 
 	return c.Next()
 }
 
+// RequireRole middleware allows the request only if the user has one of the given roles
+// Must be used after AuthRequired
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if HasRole(c, roles...) {
+			return c.Next()
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "คุณไม่มีสิทธิ์เข้าถึงข้อมูลส่วนนี้",
+		})
+	}
+}
+
+// HasRole checks whether the logged in user has any of the given roles
+func HasRole(c *fiber.Ctx, roles ...string) bool {
+	userRoles, _ := c.Locals("roles").([]string)
+	for _, userRole := range userRoles {
+		for _, role := range roles {
+			if userRole == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Simple in-memory session storage (replace with Redis in production)
 var sessions = make(map[string]uint)
 
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"registration-system/database"
+	"registration-system/models"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLease - คำขอที่ค้างสถานะ processing นานกว่านี้ถือว่า server ล้มระหว่างทำ ให้คำขอใหม่ทำแทนได้
+	idempotencyLease = 2 * time.Minute
+)
+
+// idempotencyTTL - ระยะเวลาที่ตอบซ้ำด้วยผลเดิม (IDEMPOTENCY_TTL เช่น "24h")
+func idempotencyTTL() time.Duration {
+	if env := os.Getenv("IDEMPOTENCY_TTL"); env != "" {
+		if parsed, err := time.ParseDuration(env); err == nil && parsed > 0 {
+			return parsed
+		}
+		log.Printf("Invalid IDEMPOTENCY_TTL %q, using %s", env, defaultIdempotencyTTL)
+	}
+	return defaultIdempotencyTTL
+}
+
+var idempotencyPurge = struct {
+	sync.Mutex
+	last time.Time
+}{}
+
+// purgeExpiredIdempotencyKeys - ลบ key ที่หมดอายุ (ไม่เกินชั่วโมงละครั้ง)
+func purgeExpiredIdempotencyKeys(ttl time.Duration) {
+	idempotencyPurge.Lock()
+	if time.Since(idempotencyPurge.last) < time.Hour {
+		idempotencyPurge.Unlock()
+		return
+	}
+	idempotencyPurge.last = time.Now()
+	idempotencyPurge.Unlock()
+
+	if err := database.DB.Where("created_at < ?", time.Now().Add(-ttl)).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		log.Printf("Error purging idempotency keys: %v", err)
+	}
+}
+
+// IdempotencySubject - ค่า subject ของข้อมูลที่คำขอสร้าง (ตารางและ id)
+func IdempotencySubject(table string, id uint) string {
+	return fmt.Sprintf("%s:%d", table, id)
+}
+
+// SetIdempotencySubject - handler แจ้งว่าผลที่ตอบกลับมีข้อมูลของแถวนี้ เพื่อลบผลที่เก็บไว้เมื่อเจ้าของข้อมูลขอลบ
+func SetIdempotencySubject(c *fiber.Ctx, table string, id uint) {
+	c.Locals("idempotencySubject", IdempotencySubject(table, id))
+}
+
+// Idempotent - รองรับ header Idempotency-Key: คำขอแรกทำงานตามปกติและเก็บผลไว้ คำขอซ้ำด้วย key เดิมภายใน
+// IDEMPOTENCY_TTL ได้ผลเดิมกลับไป (header Idempotent-Replayed: true) ถ้า body ต่างจากเดิมตอบ 409
+// key แยกตาม scope และผู้ใช้ที่ login ผลที่เป็น 5xx ไม่ถูกเก็บเพื่อให้ลองใหม่ได้
+func Idempotent(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get("Idempotency-Key")
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Idempotency-Key ยาวเกิน 255 ตัวอักษร",
+			})
+		}
+
+		keyScope := scope
+		if userID, ok := c.Locals("userID").(uint); ok {
+			keyScope = fmt.Sprintf("%s:user:%d", scope, userID)
+		}
+		sum := sha256.Sum256([]byte(c.Method() + " " + c.Path() + "\n" + string(c.Body())))
+		requestHash := hex.EncodeToString(sum[:])
+
+		ttl := idempotencyTTL()
+		purgeExpiredIdempotencyKeys(ttl)
+
+		record := models.IdempotencyKey{Scope: keyScope, Key: key, RequestHash: requestHash, Status: "processing"}
+		for attempt := 0; ; attempt++ {
+			result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+			if result.Error != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "ไม่สามารถบันทึกข้อมูลได้",
+				})
+			}
+			if result.RowsAffected == 1 {
+				break
+			}
+
+			var existing models.IdempotencyKey
+			if err := database.DB.Where("scope = ? AND key = ?", keyScope, key).First(&existing).Error; err != nil {
+				if attempt < 2 {
+					continue // ถูกลบไประหว่างนั้น ลองจองใหม่
+				}
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"error": "ไม่สามารถดึงข้อมูลได้",
+				})
+			}
+
+			expired := time.Since(existing.CreatedAt) >= ttl
+			abandoned := existing.Status == "processing" && time.Since(existing.UpdatedAt) >= idempotencyLease
+			if (expired || abandoned) && attempt < 2 {
+				// ลบเฉพาะแถวเดิม (เทียบ updated_at) กันลบแถวที่คำขออื่นเพิ่งจองใหม่
+				database.DB.Where("id = ? AND updated_at = ?", existing.ID, existing.UpdatedAt).Delete(&models.IdempotencyKey{})
+				record.ID = 0
+				continue
+			}
+
+			if existing.RequestHash != requestHash {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "Idempotency-Key นี้ถูกใช้กับข้อมูลอื่นแล้ว",
+				})
+			}
+			if existing.Status != "completed" {
+				c.Set(fiber.HeaderRetryAfter, "1")
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+					"error": "คำขอนี้กำลังดำเนินการอยู่ กรุณารอสักครู่",
+				})
+			}
+
+			c.Set("Idempotent-Replayed", "true")
+			if existing.ResponseContentType != "" {
+				c.Set(fiber.HeaderContentType, existing.ResponseContentType)
+			}
+			return c.Status(existing.ResponseStatus).SendString(existing.ResponseBody.String())
+		}
+
+		if err := c.Next(); err != nil {
+			database.DB.Delete(&models.IdempotencyKey{}, record.ID)
+			return err
+		}
+
+		status := c.Response().StatusCode()
+		subject, _ := c.Locals("idempotencySubject").(string)
+		if status >= fiber.StatusInternalServerError {
+			database.DB.Delete(&models.IdempotencyKey{}, record.ID)
+			return nil
+		}
+		if err := database.DB.Model(&models.IdempotencyKey{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+			"status":                "completed",
+			"response_status":       status,
+			"response_content_type": string(c.Response().Header.ContentType()),
+			"response_body":         models.EncryptedString(c.Response().Body()),
+			"subject":               subject,
+		}).Error; err != nil {
+			log.Printf("Error saving idempotent response: %v", err)
+			database.DB.Delete(&models.IdempotencyKey{}, record.ID)
+		}
+		return nil
+	}
+}
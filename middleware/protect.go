@@ -0,0 +1,255 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"registration-system/captcha"
+	"registration-system/database"
+	"registration-system/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProtectConfig - การป้องกันการใช้งานผิดวัตถุประสงค์ของ route สาธารณะหนึ่ง route
+// ทุกค่าปรับได้ด้วย environment variable PROTECT_<NAME>_<FIELD> เช่น PROTECT_REGISTRATIONS_PER_IP=20
+type ProtectConfig struct {
+	Name          string        // ชื่อ route ใช้ใน Blocked Request log และชื่อ env
+	PerIP         int           // จำนวนคำขอต่อ IP ใน Window (0 = ไม่จำกัด)                  env: _PER_IP
+	Global        int           // จำนวนคำขอรวมทุก IP ใน Window (0 = ไม่จำกัด)               env: _GLOBAL
+	Window        time.Duration // ช่วงเวลานับจำนวนคำขอ                                       env: _WINDOW (เช่น "1h")
+	MaxBodyBytes  int           // ขนาด body สูงสุด (0 = ใช้ค่าของ server)                    env: _MAX_BODY
+	Captcha       bool          // ต้องแนบ X-Captcha-Token ที่ผ่านการตรวจ (เมื่อเปิด CAPTCHA_PROVIDER) env: _CAPTCHA
+	HoneypotField string        // field ที่ต้องว่างเสมอ (ซ่อนจากผู้ใช้ bot มักกรอก)            env: _HONEYPOT
+}
+
+// fromEnv - แทนค่าด้วย environment variable ที่ตั้งไว้
+func (cfg ProtectConfig) fromEnv() ProtectConfig {
+	prefix := "PROTECT_" + strings.ToUpper(strings.NewReplacer("-", "_", "/", "_").Replace(cfg.Name)) + "_"
+	intEnv := func(name string, value *int) {
+		if env := os.Getenv(prefix + name); env != "" {
+			if parsed, err := strconv.Atoi(env); err == nil && parsed >= 0 {
+				*value = parsed
+			} else {
+				log.Printf("Invalid %s%s %q, using %d", prefix, name, env, *value)
+			}
+		}
+	}
+	intEnv("PER_IP", &cfg.PerIP)
+	intEnv("GLOBAL", &cfg.Global)
+	intEnv("MAX_BODY", &cfg.MaxBodyBytes)
+	if env := os.Getenv(prefix + "WINDOW"); env != "" {
+		if parsed, err := time.ParseDuration(env); err == nil && parsed > 0 {
+			cfg.Window = parsed
+		} else {
+			log.Printf("Invalid %sWINDOW %q, using %s", prefix, env, cfg.Window)
+		}
+	}
+	if env := os.Getenv(prefix + "CAPTCHA"); env != "" {
+		cfg.Captcha = env == "true"
+	}
+	if env, ok := os.LookupEnv(prefix + "HONEYPOT"); ok {
+		cfg.HoneypotField = env
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+	return cfg
+}
+
+// rateWindow - จำนวนคำขอใน window ปัจจุบัน (fixed window)
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// rateLimiter - ตัวนับคำขอในหน่วยความจำ (แยกตาม key)
+type rateLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{windows: map[string]*rateWindow{}}
+}
+
+// allow - นับคำขอและคืน false เมื่อเกิน limit พร้อมเวลาที่ต้องรอ
+func (l *rateLimiter) allow(key string, limit int, window time.Duration) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= window {
+				delete(l.windows, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= window {
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+	if w.count >= limit {
+		return false, w.start.Add(window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// blockedLog - บันทึกคำขอที่ถูกบล็อกไม่เกินนาทีละครั้งต่อ (route, เหตุผล, IP) ที่เหลือนับรวมไว้
+// เพื่อไม่ให้การยิงคำขอจำนวนมากกลายเป็นการเขียนฐานข้อมูลจำนวนมากแทน
+var blockedLog = struct {
+	sync.Mutex
+	entries map[string]*blockedEntry
+}{entries: map[string]*blockedEntry{}}
+
+type blockedEntry struct {
+	loggedAt   time.Time
+	suppressed int
+}
+
+const blockedLogInterval = time.Minute
+
+func recordBlocked(c *fiber.Ctx, route, reason, detail string) {
+	key := route + "|" + reason + "|" + c.IP()
+	now := time.Now()
+
+	blockedLog.Lock()
+	entry, ok := blockedLog.entries[key]
+	if ok && now.Sub(entry.loggedAt) < blockedLogInterval {
+		entry.suppressed++
+		blockedLog.Unlock()
+		return
+	}
+	count := 1
+	if ok {
+		count += entry.suppressed
+	}
+	if len(blockedLog.entries) > 10000 {
+		for k, e := range blockedLog.entries {
+			if now.Sub(e.loggedAt) >= blockedLogInterval {
+				delete(blockedLog.entries, k)
+			}
+		}
+	}
+	blockedLog.entries[key] = &blockedEntry{loggedAt: now}
+	blockedLog.Unlock()
+
+	request := models.BlockedRequest{
+		Route:     route,
+		Reason:    reason,
+		Detail:    detail,
+		Method:    c.Method(),
+		Path:      c.Path(),
+		IPAddress: c.IP(),
+		UserAgent: truncate(c.Get(fiber.HeaderUserAgent), 255),
+		Count:     count,
+	}
+	if err := database.DB.Create(&request).Error; err != nil {
+		log.Printf("Error logging blocked request: %v", err)
+	}
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
+
+// honeypotFilled - field กับดักมีค่าหรือไม่ (รองรับ JSON และ form)
+func honeypotFilled(c *fiber.Ctx, field string) bool {
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		var body map[string]json.RawMessage
+		if json.Unmarshal(c.Body(), &body) != nil {
+			return false
+		}
+		raw, ok := body[field]
+		if !ok {
+			return false
+		}
+		var value interface{}
+		json.Unmarshal(raw, &value)
+		switch v := value.(type) {
+		case nil:
+			return false
+		case string:
+			return strings.TrimSpace(v) != ""
+		default:
+			return true
+		}
+	}
+	return strings.TrimSpace(c.FormValue(field)) != ""
+}
+
+// Protect - rate limit ต่อ IP และรวม, จำกัดขนาด body, ตรวจ captcha และ honeypot ของ route สาธารณะ
+// คำขอที่ถูกบล็อกบันทึกใน BlockedRequest ให้ผู้ดูแลตรวจสอบ
+func Protect(cfg ProtectConfig) fiber.Handler {
+	cfg = cfg.fromEnv()
+	limiter := newRateLimiter()
+
+	return func(c *fiber.Ctx) error {
+		if cfg.MaxBodyBytes > 0 && (len(c.Body()) > cfg.MaxBodyBytes || c.Request().Header.ContentLength() > cfg.MaxBodyBytes) {
+			recordBlocked(c, cfg.Name, "body_size", fmt.Sprintf("%d bytes", len(c.Body())))
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+				"error": "ข้อมูลมีขนาดใหญ่เกินไป",
+			})
+		}
+
+		if cfg.PerIP > 0 {
+			if ok, wait := limiter.allow("ip:"+c.IP(), cfg.PerIP, cfg.Window); !ok {
+				recordBlocked(c, cfg.Name, "rate_ip", fmt.Sprintf("limit %d per %s", cfg.PerIP, cfg.Window))
+				return tooManyRequests(c, wait)
+			}
+		}
+		if cfg.Global > 0 {
+			if ok, wait := limiter.allow("global", cfg.Global, cfg.Window); !ok {
+				recordBlocked(c, cfg.Name, "rate_global", fmt.Sprintf("limit %d per %s", cfg.Global, cfg.Window))
+				return tooManyRequests(c, wait)
+			}
+		}
+
+		if cfg.HoneypotField != "" && honeypotFilled(c, cfg.HoneypotField) {
+			recordBlocked(c, cfg.Name, "honeypot", cfg.HoneypotField)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "ข้อมูลไม่ถูกต้อง",
+			})
+		}
+
+		if cfg.Captcha {
+			if verifier := captcha.Get(); verifier != nil {
+				ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+				err := verifier.Verify(ctx, c.Get("X-Captcha-Token"), c.IP())
+				cancel()
+				if err != nil {
+					recordBlocked(c, cfg.Name, "captcha", err.Error())
+					return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+						"error":   "กรุณายืนยันว่าไม่ใช่โปรแกรมอัตโนมัติ",
+						"captcha": true,
+					})
+				}
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+func tooManyRequests(c *fiber.Ctx, wait time.Duration) error {
+	seconds := int(wait.Seconds()) + 1
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"error": fmt.Sprintf("มีคำขอมากเกินไป กรุณาลองใหม่ใน %d วินาที", seconds),
+	})
+}
@@ -0,0 +1,213 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"registration-system/fieldcrypt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EncryptedString is a string column encrypted at rest with fieldcrypt
+// Values are encrypted on write and decrypted on read, so handlers use it like a normal string
+type EncryptedString string
+
+// Value implements the driver.Valuer interface
+func (s EncryptedString) Value() (driver.Value, error) {
+	return fieldcrypt.Encrypt(string(s))
+}
+
+// Scan implements the sql.Scanner interface
+func (s *EncryptedString) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return errors.New("cannot scan non-string value into EncryptedString")
+	}
+
+	plaintext, err := fieldcrypt.Decrypt(str)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// String returns the plaintext value
+func (s EncryptedString) String() string {
+	return string(s)
+}
+
+// EncryptedStringArray is a list of strings stored as one encrypted JSON array
+// An empty list is stored as an empty string, so "has any" filters work without decrypting
+type EncryptedStringArray []string
+
+// Value implements the driver.Valuer interface
+func (a EncryptedStringArray) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal([]string(a))
+	if err != nil {
+		return nil, err
+	}
+	return fieldcrypt.Encrypt(string(data))
+}
+
+// Scan implements the sql.Scanner interface
+// Plain text rows from the former text[] column ("{a,b}") are read as well
+func (a *EncryptedStringArray) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case nil:
+		*a = EncryptedStringArray{}
+		return nil
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return errors.New("cannot scan non-string value into EncryptedStringArray")
+	}
+
+	plaintext, err := fieldcrypt.Decrypt(str)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(plaintext, "[") {
+		values := []string{}
+		if err := json.Unmarshal([]byte(plaintext), &values); err != nil {
+			return err
+		}
+		*a = EncryptedStringArray(values)
+		return nil
+	}
+	var legacy StringArray
+	if err := legacy.Scan(plaintext); err != nil {
+		return err
+	}
+	*a = EncryptedStringArray(legacy)
+	return nil
+}
+
+// EncryptedDate is a date column encrypted at rest with fieldcrypt
+// JSON encoding is the same as time.Time
+type EncryptedDate struct {
+	time.Time
+}
+
+// encryptedDateFormats - รูปแบบที่อ่านได้ (รวมค่าที่ยังไม่ได้เข้ารหัสจาก timestamptz เดิม)
+var encryptedDateFormats = []string{
+	"2006-01-02",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05Z07",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05.999999999Z07",
+	"2006-01-02 15:04:05",
+}
+
+// Value implements the driver.Valuer interface
+func (d EncryptedDate) Value() (driver.Value, error) {
+	return fieldcrypt.Encrypt(d.Time.Format(time.RFC3339))
+}
+
+// Scan implements the sql.Scanner interface
+func (d *EncryptedDate) Scan(value interface{}) error {
+	var str string
+	switch v := value.(type) {
+	case nil:
+		d.Time = time.Time{}
+		return nil
+	case time.Time:
+		d.Time = v
+		return nil
+	case []byte:
+		str = string(v)
+	case string:
+		str = v
+	default:
+		return errors.New("cannot scan value into EncryptedDate")
+	}
+
+	plaintext, err := fieldcrypt.Decrypt(str)
+	if err != nil {
+		return err
+	}
+	for _, format := range encryptedDateFormats {
+		if t, err := time.Parse(format, plaintext); err == nil {
+			d.Time = t
+			return nil
+		}
+	}
+	return errors.New("cannot parse EncryptedDate value")
+}
+
+// PhoneIndex returns the blind index used to look up an encrypted phone number
+func PhoneIndex(phone string) string {
+	return fieldcrypt.BlindIndex(fieldcrypt.NormalizePhone(phone))
+}
+
+// NationalIDIndex returns the blind index used to look up an encrypted national ID
+func NationalIDIndex(nationalID string) string {
+	digits := fieldcrypt.NormalizeDigits(nationalID)
+	if digits == "" {
+		return ""
+	}
+	return fieldcrypt.BlindIndex("national-id:" + digits)
+}
+
+// MonkCertificateIndex returns the blind index used to look up an encrypted monk certificate number
+func MonkCertificateIndex(certificateNo string) string {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(certificateNo), ""))
+	if normalized == "" {
+		return ""
+	}
+	return fieldcrypt.BlindIndex("monk-certificate:" + normalized)
+}
+
+// BeforeSave keeps the blind indexes in sync with PhoneNumber, NationalID and MonkCertificateNo
+func (r *Registration) BeforeSave(tx *gorm.DB) error {
+	r.PhoneNumberIndex = PhoneIndex(string(r.PhoneNumber))
+	r.NationalIDIndex = NationalIDIndex(string(r.NationalID))
+	r.MonkCertificateIndex = MonkCertificateIndex(string(r.MonkCertificateNo))
+	return nil
+}
+
+// BeforeSave keeps the blind indexes in sync with PhoneNumber, NationalID and MonkCertificateNo
+func (r *TeacherRegistration) BeforeSave(tx *gorm.DB) error {
+	r.PhoneNumberIndex = PhoneIndex(string(r.PhoneNumber))
+	r.NationalIDIndex = NationalIDIndex(string(r.NationalID))
+	r.MonkCertificateIndex = MonkCertificateIndex(string(r.MonkCertificateNo))
+	return nil
+}
+
+// BeforeSave keeps the leader phone blind index in sync with LeaderPhone
+func (g *RegistrationGroup) BeforeSave(tx *gorm.DB) error {
+	g.LeaderPhoneIndex = PhoneIndex(string(g.LeaderPhone))
+	return nil
+}
+
+// LineUserIndex returns the blind index used to look up an encrypted LINE user ID
+func LineUserIndex(lineUserID string) string {
+	lineUserID = strings.TrimSpace(lineUserID)
+	if lineUserID == "" {
+		return ""
+	}
+	return fieldcrypt.BlindIndex("line-user:" + lineUserID)
+}
+
+// BeforeSave keeps the LINE user blind index in sync with LineUserID
+func (l *LineLink) BeforeSave(tx *gorm.DB) error {
+	l.LineUserIndex = LineUserIndex(string(l.LineUserID))
+	return nil
+}
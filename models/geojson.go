@@ -0,0 +1,51 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+)
+
+// GeoJSONGeometry is a raw GeoJSON geometry object stored in a jsonb column
+// An empty value is stored as NULL
+type GeoJSONGeometry []byte
+
+// Value implements the driver.Valuer interface
+func (g GeoJSONGeometry) Value() (driver.Value, error) {
+	if len(g) == 0 {
+		return nil, nil
+	}
+	return string(g), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (g *GeoJSONGeometry) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*g = nil
+	case []byte:
+		*g = append(GeoJSONGeometry(nil), v...)
+	case string:
+		*g = GeoJSONGeometry(v)
+	default:
+		return errors.New("cannot scan non-string value into GeoJSONGeometry")
+	}
+	return nil
+}
+
+// MarshalJSON writes the geometry as-is instead of base64
+func (g GeoJSONGeometry) MarshalJSON() ([]byte, error) {
+	if len(g) == 0 {
+		return []byte("null"), nil
+	}
+	return g, nil
+}
+
+// UnmarshalJSON keeps the raw geometry object
+func (g *GeoJSONGeometry) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*g = nil
+		return nil
+	}
+	*g = append(GeoJSONGeometry(nil), data...)
+	return nil
+}
@@ -23,6 +23,10 @@ type Province struct {
 	NameTh    string     `gorm:"type:varchar(100);not null" json:"name_th"`
 	NameEn    string     `gorm:"type:varchar(100);not null" json:"name_en"`
 	Districts []District `json:"districts,omitempty"`
+
+	// Geo - จุดกึ่งกลาง (ขอบเขตเก็บแยกใน AreaBoundary)
+	CentroidLat *float64 `json:"centroid_lat,omitempty"`
+	CentroidLng *float64 `json:"centroid_lng,omitempty"`
 }
 
 type District struct {
@@ -32,6 +36,10 @@ type District struct {
 	NameTh       string        `gorm:"type:varchar(100);not null" json:"name_th"`
 	NameEn       string        `gorm:"type:varchar(100);not null" json:"name_en"`
 	SubDistricts []SubDistrict `json:"sub_districts,omitempty"`
+
+	// Geo - จุดกึ่งกลาง (ขอบเขตเก็บแยกใน AreaBoundary)
+	CentroidLat *float64 `json:"centroid_lat,omitempty"`
+	CentroidLng *float64 `json:"centroid_lng,omitempty"`
 }
 
 type SubDistrict struct {
@@ -48,28 +56,55 @@ type Registration struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Version   uint           `gorm:"not null;default:1" json:"version"` // optimistic locking
+
+	DeletedByID *uint `json:"-"` // ผู้ลบ (แสดงในถังขยะ)
+
+	SyncXID int64 `gorm:"column:sync_xid;not null;default:0;index" json:"-"` // transaction ที่แก้ไขล่าสุด (trigger ตั้งให้) ใช้เป็น cursor ของ sync
 
-	FullName  string    `gorm:"type:varchar(200);not null" json:"full_name"`
-	Nickname  string    `gorm:"type:varchar(100)" json:"nickname"`
-	BirthDate time.Time `gorm:"not null" json:"birth_date"`
+	FullName  string        `gorm:"type:varchar(200);not null" json:"full_name"`
+	Nickname  string        `gorm:"type:varchar(100)" json:"nickname"`
+	BirthDate EncryptedDate `gorm:"type:text;not null" json:"birth_date"` // เข้ารหัส
 
-	ProvinceID    uint        `gorm:"not null" json:"province_id"`
-	Province      Province    `json:"province,omitempty"`
-	DistrictID    uint        `gorm:"not null" json:"district_id"`
-	District      District    `json:"district,omitempty"`
-	SubDistrictID uint        `gorm:"not null" json:"sub_district_id"`
-	SubDistrict   SubDistrict `json:"sub_district,omitempty"`
-	AddressDetail string      `gorm:"type:text;not null" json:"address_detail"`
+	ProvinceID    uint            `gorm:"not null" json:"province_id"`
+	Province      Province        `json:"province,omitempty"`
+	DistrictID    uint            `gorm:"not null" json:"district_id"`
+	District      District        `json:"district,omitempty"`
+	SubDistrictID uint            `gorm:"not null" json:"sub_district_id"`
+	SubDistrict   SubDistrict     `json:"sub_district,omitempty"`
+	AddressDetail EncryptedString `gorm:"type:text;not null" json:"address_detail"` // เข้ารหัส
 
-	PhoneNumber      string `gorm:"type:varchar(20);not null" json:"phone_number"`
-	TempleName       string `gorm:"type:varchar(200)" json:"temple_name"`
-	MedicalCondition string `gorm:"type:text" json:"medical_condition"`
-	Vassa            int    `gorm:"default:0" json:"vassa"` // พรรษา
+	PhoneNumber      EncryptedString `gorm:"type:text;not null" json:"phone_number"` // เข้ารหัส
+	PhoneNumberIndex string          `gorm:"type:varchar(64);index" json:"-"`        // blind index สำหรับค้นหาเบอร์โทร
+	PhoneVerifiedAt  *time.Time      `json:"phone_verified_at,omitempty"`            // ยืนยันเบอร์โทรด้วย OTP แล้ว (ล้างเมื่อเปลี่ยนเบอร์)
+	TempleName       string          `gorm:"type:varchar(200)" json:"temple_name"`   // ชื่อที่พิมพ์เอง หรือชื่อวัดจากทะเบียนเมื่อผูกกับ TempleID
+	TempleID         *uint           `gorm:"index" json:"temple_id,omitempty"`
+	Temple           *Temple         `json:"temple,omitempty"`
+	MedicalCondition EncryptedString `gorm:"type:text" json:"medical_condition"` // เข้ารหัส
+	Vassa            int             `gorm:"default:0" json:"vassa"`             // พรรษา
+
+	// Identity - ข้อมูลยืนยันตัวตน (ไม่บังคับ)
+	NationalID           EncryptedString `gorm:"type:text" json:"national_id"`         // เลขบัตรประชาชน เข้ารหัส
+	NationalIDIndex      string          `gorm:"type:varchar(64);index" json:"-"`      // blind index สำหรับตรวจเลขซ้ำ
+	MonkCertificateNo    EncryptedString `gorm:"type:text" json:"monk_certificate_no"` // เลขใบสุทธิ เข้ารหัส
+	MonkCertificateIndex string          `gorm:"type:varchar(64);index" json:"-"`      // blind index สำหรับตรวจเลขซ้ำ
+	OrdinationDate       *time.Time      `gorm:"type:date" json:"ordination_date"`     // วันอุปสมบท
+	Preceptor            string          `gorm:"type:varchar(200)" json:"preceptor"`   // พระอุปัชฌาย์
 
 	// Chanting Status - สถานะการสวด
 	ChantedPariwat bool `gorm:"default:false" json:"chanted_pariwat"` // สวดปริวาสแล้ว
 	ChantedManat   bool `gorm:"default:false" json:"chanted_manat"`   // สวดมานัดแล้ว
 	ChantedOkApan  bool `gorm:"default:false" json:"chanted_ok_apan"` // สวดออกอาพานแล้ว
+
+	// Group - ลงทะเบียนพร้อมกันเป็นกลุ่ม (ว่างถ้าลงทะเบียนเดี่ยว)
+	GroupID *uint              `gorm:"index" json:"group_id,omitempty"`
+	Group   *RegistrationGroup `json:"group,omitempty"`
+
+	// Accommodation - ที่พักที่ได้รับการจัด
+	RoomAssignment *RoomAssignment `gorm:"foreignKey:RegistrationID" json:"room_assignment,omitempty"`
+
+	// PDPA - เวลาที่ข้อมูลส่วนบุคคลถูกลบตามคำขอ (ยังนับในสถิติได้)
+	AnonymizedAt *time.Time `gorm:"index" json:"anonymized_at,omitempty"`
 }
 
 type TeacherRegistration struct {
@@ -77,23 +112,46 @@ type TeacherRegistration struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Version   uint           `gorm:"not null;default:1" json:"version"` // optimistic locking
+
+	DeletedByID *uint `json:"-"` // ผู้ลบ (แสดงในถังขยะ)
+
+	SyncXID int64 `gorm:"column:sync_xid;not null;default:0;index" json:"-"` // transaction ที่แก้ไขล่าสุด (trigger ตั้งให้) ใช้เป็น cursor ของ sync
+
+	FullName  string        `gorm:"type:varchar(200);not null" json:"full_name"`
+	Nickname  string        `gorm:"type:varchar(100)" json:"nickname"`
+	BirthDate EncryptedDate `gorm:"type:text;not null" json:"birth_date"` // เข้ารหัส
+
+	ProvinceID    uint            `gorm:"not null" json:"province_id"`
+	Province      Province        `json:"province,omitempty"`
+	DistrictID    uint            `gorm:"not null" json:"district_id"`
+	District      District        `json:"district,omitempty"`
+	SubDistrictID uint            `gorm:"not null" json:"sub_district_id"`
+	SubDistrict   SubDistrict     `json:"sub_district,omitempty"`
+	AddressDetail EncryptedString `gorm:"type:text;not null" json:"address_detail"` // เข้ารหัส
+
+	PhoneNumber      EncryptedString `gorm:"type:text;not null" json:"phone_number"` // เข้ารหัส
+	PhoneNumberIndex string          `gorm:"type:varchar(64);index" json:"-"`        // blind index สำหรับค้นหาเบอร์โทร
+	PhoneVerifiedAt  *time.Time      `json:"phone_verified_at,omitempty"`            // ยืนยันเบอร์โทรด้วย OTP แล้ว (ล้างเมื่อเปลี่ยนเบอร์)
+	TempleName       string          `gorm:"type:varchar(200)" json:"temple_name"`   // ชื่อที่พิมพ์เอง หรือชื่อวัดจากทะเบียนเมื่อผูกกับ TempleID
+	TempleID         *uint           `gorm:"index" json:"temple_id,omitempty"`
+	Temple           *Temple         `json:"temple,omitempty"`
+	MedicalCondition EncryptedString `gorm:"type:text" json:"medical_condition"` // เข้ารหัส
+	Vassa            int             `gorm:"default:0" json:"vassa"`
 
-	FullName  string    `gorm:"type:varchar(200);not null" json:"full_name"`
-	Nickname  string    `gorm:"type:varchar(100)" json:"nickname"`
-	BirthDate time.Time `gorm:"not null" json:"birth_date"`
+	// Identity - ข้อมูลยืนยันตัวตน (ไม่บังคับ)
+	NationalID           EncryptedString `gorm:"type:text" json:"national_id"`         // เลขบัตรประชาชน เข้ารหัส
+	NationalIDIndex      string          `gorm:"type:varchar(64);index" json:"-"`      // blind index สำหรับตรวจเลขซ้ำ
+	MonkCertificateNo    EncryptedString `gorm:"type:text" json:"monk_certificate_no"` // เลขใบสุทธิ เข้ารหัส
+	MonkCertificateIndex string          `gorm:"type:varchar(64);index" json:"-"`      // blind index สำหรับตรวจเลขซ้ำ
+	OrdinationDate       *time.Time      `gorm:"type:date" json:"ordination_date"`     // วันอุปสมบท
+	Preceptor            string          `gorm:"type:varchar(200)" json:"preceptor"`   // พระอุปัชฌาย์
 
-	ProvinceID    uint        `gorm:"not null" json:"province_id"`
-	Province      Province    `json:"province,omitempty"`
-	DistrictID    uint        `gorm:"not null" json:"district_id"`
-	District      District    `json:"district,omitempty"`
-	SubDistrictID uint        `gorm:"not null" json:"sub_district_id"`
-	SubDistrict   SubDistrict `json:"sub_district,omitempty"`
-	AddressDetail string      `gorm:"type:text;not null" json:"address_detail"`
+	// Accommodation - ที่พักที่ได้รับการจัด
+	RoomAssignment *RoomAssignment `gorm:"foreignKey:TeacherRegistrationID" json:"room_assignment,omitempty"`
 
-	PhoneNumber      string `gorm:"type:varchar(20);not null" json:"phone_number"`
-	TempleName       string `gorm:"type:varchar(200)" json:"temple_name"`
-	MedicalCondition string `gorm:"type:text" json:"medical_condition"`
-	Vassa            int    `gorm:"default:0" json:"vassa"`
+	// PDPA - เวลาที่ข้อมูลส่วนบุคคลถูกลบตามคำขอ (ยังนับในสถิติได้)
+	AnonymizedAt *time.Time `gorm:"index" json:"anonymized_at,omitempty"`
 }
 
 // Transaction - รายรับรายจ่าย
@@ -102,6 +160,9 @@ type Transaction struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Version   uint           `gorm:"not null;default:1" json:"version"` // optimistic locking
+
+	DeletedByID *uint `json:"-"` // ผู้ลบ (แสดงในถังขยะ)
 
 	Type        string      `gorm:"type:varchar(20);not null" json:"type"` // "income" or "expense"
 	Amount      float64     `gorm:"type:decimal(15,2);not null" json:"amount"`
@@ -123,6 +184,7 @@ type ActivityLog struct {
 	Action      string `gorm:"type:varchar(200);not null" json:"action"` // สิ่งที่ทำ เช่น "เพิ่มรายรับ", "แก้ไขข้อมูล", "ลบรายการ"
 	Description string `gorm:"type:text" json:"description"`             // รายละเอียดเพิ่มเติม
 	Module      string `gorm:"type:varchar(50)" json:"module"`           // โมดูล เช่น "transaction", "registration"
+	RecordID    *uint  `gorm:"index" json:"record_id,omitempty"`         // id ของข้อมูลที่ถูกกระทำ (ถ้ามี)
 
 	// Relationship
 	UserID uint `gorm:"not null" json:"user_id"`
@@ -144,3 +206,490 @@ type DeviceLog struct {
 	// Optional - ไม่เก็บข้อมูลที่ระบุตัวตน
 	IPAddress string `gorm:"type:varchar(50)" json:"ip_address"` // IP address (อาจลบส่วนสุดท้ายเพื่อความเป็นส่วนตัว)
 }
+
+// Building - อาคารที่พัก เช่น กุฏิ, ศาลา
+type Building struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name        string `gorm:"type:varchar(200);not null" json:"name"`
+	Type        string `gorm:"type:varchar(20);not null" json:"type"` // "kuti" or "hall"
+	Description string `gorm:"type:text" json:"description"`
+	Rooms       []Room `json:"rooms,omitempty"`
+}
+
+// Room - ห้องพัก/พื้นที่นอนภายในอาคาร
+type Room struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	BuildingID uint     `gorm:"not null;index" json:"building_id"`
+	Building   Building `json:"building,omitempty"`
+	Name       string   `gorm:"type:varchar(100);not null" json:"name"`
+	Capacity   int      `gorm:"not null;default:1" json:"capacity"`
+
+	// Attributes - ใช้ประกอบการจัดที่พักอัตโนมัติ
+	GroundFloor  bool   `gorm:"default:false" json:"ground_floor"`  // อยู่ชั้นล่าง
+	NearBathroom bool   `gorm:"default:false" json:"near_bathroom"` // ใกล้ห้องน้ำ
+	TeacherOnly  bool   `gorm:"default:false" json:"teacher_only"`  // สำหรับพระอาจารย์เท่านั้น
+	Notes        string `gorm:"type:text" json:"notes"`
+
+	Assignments []RoomAssignment `json:"assignments,omitempty"`
+}
+
+// RoomAssignment - การจัดที่พักให้ผู้ลงทะเบียน (ผู้ลงทะเบียนหรือพระอาจารย์อย่างใดอย่างหนึ่ง)
+type RoomAssignment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	RoomID uint `gorm:"not null;index" json:"room_id"`
+	Room   Room `json:"room,omitempty"`
+
+	RegistrationID        *uint                `gorm:"uniqueIndex" json:"registration_id"`
+	Registration          *Registration        `json:"registration,omitempty"`
+	TeacherRegistrationID *uint                `gorm:"uniqueIndex" json:"teacher_registration_id"`
+	TeacherRegistration   *TeacherRegistration `json:"teacher_registration,omitempty"`
+
+	Note       string `gorm:"type:text" json:"note"`
+	AutoAssign bool   `gorm:"default:false" json:"auto_assign"` // จัดโดยระบบอัตโนมัติ
+
+	// Relationship - ผู้จัดที่พัก
+	AssignedByID uint `gorm:"not null" json:"assigned_by_id"`
+}
+
+// MedicalConditionType - รายการโรค/ภาวะสุขภาพที่ผู้ดูแลกำหนด (เช่น เบาหวาน, ความดัน)
+type MedicalConditionType struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Code     string `gorm:"type:varchar(50);uniqueIndex;not null" json:"code"` // เช่น "diabetes", "hypertension"
+	NameTh   string `gorm:"type:varchar(100);not null" json:"name_th"`
+	NameEn   string `gorm:"type:varchar(100)" json:"name_en"`
+	Category string `gorm:"type:varchar(50)" json:"category"` // เช่น "chronic", "diet", "mobility"
+
+	RequiresAccessibleRoom bool `gorm:"default:false" json:"requires_accessible_room"` // ควรพักชั้นล่างใกล้ห้องน้ำ
+	IsActive               bool `gorm:"default:true" json:"is_active"`
+}
+
+// MedicalProfile - ข้อมูลสุขภาพแบบมีโครงสร้าง (ใช้คู่กับ MedicalCondition แบบข้อความ)
+type MedicalProfile struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	RegistrationID        *uint `gorm:"uniqueIndex" json:"registration_id"`
+	TeacherRegistrationID *uint `gorm:"uniqueIndex" json:"teacher_registration_id"`
+
+	Conditions  []MedicalConditionType `gorm:"many2many:medical_profile_conditions" json:"conditions"`
+	Allergies   EncryptedStringArray   `gorm:"type:text" json:"allergies"` // แพ้ยา/อาหาร เข้ารหัส
+	Medications []Medication           `json:"medications"`
+
+	MobilityNeeds string          `gorm:"type:varchar(30);default:'none'" json:"mobility_needs"` // "none", "cane", "walker", "wheelchair", "bedridden"
+	MobilityNotes EncryptedString `gorm:"type:text" json:"mobility_notes"`                       // เข้ารหัส
+
+	// Emergency Contact - ผู้ติดต่อกรณีฉุกเฉิน (เข้ารหัส)
+	EmergencyContactName     EncryptedString `gorm:"type:text" json:"emergency_contact_name"`
+	EmergencyContactPhone    EncryptedString `gorm:"type:text" json:"emergency_contact_phone"`
+	EmergencyContactRelation EncryptedString `gorm:"type:text" json:"emergency_contact_relation"`
+
+	// Relationship - ผู้บันทึกล่าสุด
+	UpdatedByID uint `gorm:"not null" json:"updated_by_id"`
+}
+
+// Medication - ยาที่ใช้ประจำพร้อมเวลาที่ต้องรับประทาน (ข้อความเข้ารหัสทั้งหมด)
+type Medication struct {
+	ID               uint            `gorm:"primaryKey" json:"id"`
+	MedicalProfileID uint            `gorm:"not null;index" json:"medical_profile_id"`
+	Name             EncryptedString `gorm:"type:text;not null" json:"name"`
+	Dosage           EncryptedString `gorm:"type:text" json:"dosage"`   // เช่น "500mg 1 เม็ด"
+	Schedule         EncryptedString `gorm:"type:text" json:"schedule"` // เช่น "หลังอาหารเช้า-เย็น"
+	Notes            EncryptedString `gorm:"type:text" json:"notes"`
+}
+
+// MedicalIncident - บันทึกเหตุการณ์ด้านสุขภาพระหว่างงาน
+type MedicalIncident struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	RegistrationID        *uint                `gorm:"index" json:"registration_id"`
+	Registration          *Registration        `json:"registration,omitempty"`
+	TeacherRegistrationID *uint                `gorm:"index" json:"teacher_registration_id"`
+	TeacherRegistration   *TeacherRegistration `json:"teacher_registration,omitempty"`
+
+	OccurredAt         time.Time       `gorm:"not null;index" json:"occurred_at"`
+	Symptoms           EncryptedString `gorm:"type:text;not null" json:"symptoms"`        // เข้ารหัส
+	ActionTaken        EncryptedString `gorm:"type:text" json:"action_taken"`             // เข้ารหัส
+	ReferredToHospital bool            `gorm:"default:false" json:"referred_to_hospital"` // ส่งต่อโรงพยาบาล
+	HospitalName       EncryptedString `gorm:"type:text" json:"hospital_name"`            // เข้ารหัส
+
+	// Relationship - ผู้บันทึก
+	ReportedByID uint `gorm:"not null" json:"reported_by_id"`
+	ReportedBy   User `json:"reported_by,omitempty"`
+}
+
+// ConsentRecord - หลักฐานการให้ความยินยอม (PDPA) ต่อหนึ่งวัตถุประสงค์
+type ConsentRecord struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	RegistrationID        *uint `gorm:"index" json:"registration_id"`
+	TeacherRegistrationID *uint `gorm:"index" json:"teacher_registration_id"`
+
+	Purpose       string    `gorm:"type:varchar(100);not null" json:"purpose"`       // เช่น "registration", "medical", "contact"
+	PolicyVersion string    `gorm:"type:varchar(50);not null" json:"policy_version"` // เวอร์ชันนโยบายความเป็นส่วนตัวที่ยอมรับ
+	ConsentedAt   time.Time `gorm:"not null" json:"consented_at"`
+
+	IPAddress string `gorm:"type:varchar(50)" json:"ip_address"` // ลบส่วนสุดท้ายเหมือน DeviceLog
+	UserAgent string `gorm:"type:text" json:"user_agent"`
+}
+
+// DataSubjectRequest - คำขอใช้สิทธิของเจ้าของข้อมูล (PDPA) พร้อมกำหนดเวลาดำเนินการ
+type DataSubjectRequest struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Type   string `gorm:"type:varchar(20);not null" json:"type"`                     // "access", "erasure", "rectification", "objection"
+	Status string `gorm:"type:varchar(20);not null;default:'pending'" json:"status"` // "pending", "in_progress", "fulfilled", "rejected"
+
+	RegistrationID        *uint `gorm:"index" json:"registration_id"`
+	TeacherRegistrationID *uint `gorm:"index" json:"teacher_registration_id"`
+
+	RequesterName    string `gorm:"type:varchar(200);not null" json:"requester_name"`
+	RequesterContact string `gorm:"type:varchar(200)" json:"requester_contact"`
+	Details          string `gorm:"type:text" json:"details"`
+
+	ReceivedAt  time.Time  `gorm:"not null" json:"received_at"`
+	DueAt       time.Time  `gorm:"not null;index" json:"due_at"` // PDPA กำหนดดำเนินการภายใน 30 วัน
+	FulfilledAt *time.Time `json:"fulfilled_at"`
+	Resolution  string     `gorm:"type:text" json:"resolution"`
+
+	// Relationship - ผู้รับผิดชอบ
+	HandledByID *uint `json:"handled_by_id"`
+	HandledBy   *User `json:"handled_by,omitempty"`
+}
+
+// RetentionPolicy - การตั้งค่าระยะเวลาเก็บข้อมูลต่อกฎ (กฎถูกกำหนดในโค้ด ตั้งค่าได้จากหน้า admin)
+type RetentionPolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Rule         string     `gorm:"type:varchar(50);uniqueIndex;not null" json:"rule"` // เช่น "purge_deleted_registrations"
+	Description  string     `gorm:"type:text" json:"description"`
+	Enabled      bool       `json:"enabled"`
+	AfterDays    int        `gorm:"not null" json:"after_days"`
+	EventEndDate *time.Time `json:"event_end_date"` // ใช้กับกฎที่นับจากวันจบงาน
+
+	LastRunAt       *time.Time `json:"last_run_at"`
+	LastRunAffected int64      `json:"last_run_affected"`
+}
+
+// RecordVersion - ประวัติการเปลี่ยนแปลงข้อมูลการลงทะเบียน (snapshot และ diff ทุกครั้งที่สร้าง/แก้ไข/ลบ)
+type RecordVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	RecordType string `gorm:"type:varchar(50);not null;uniqueIndex:idx_record_version" json:"record_type"` // "registration" or "teacher-registration"
+	RecordID   uint   `gorm:"not null;uniqueIndex:idx_record_version" json:"record_id"`
+	Version    int    `gorm:"not null;uniqueIndex:idx_record_version" json:"version"`
+	Action     string `gorm:"type:varchar(20);not null" json:"action"` // "create", "update", "delete", "restore", "revert"
+
+	Snapshot EncryptedString `gorm:"type:text" json:"-"` // JSON ของข้อมูลหลังเปลี่ยนแปลง (เข้ารหัส)
+	Changes  EncryptedString `gorm:"type:text" json:"-"` // JSON ของรายการ field ที่เปลี่ยน (เข้ารหัส)
+
+	// Relationship - ผู้แก้ไข (ว่างถ้าเป็นการลงทะเบียนสาธารณะ)
+	UserID *uint `json:"user_id"`
+	User   *User `json:"user,omitempty"`
+}
+
+// ImportMappingTemplate - การจับคู่หัวคอลัมน์ของไฟล์นำเข้ากับ field ที่บันทึกไว้ใช้ซ้ำ (เช่น Google Forms ปีที่แล้ว)
+type ImportMappingTemplate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name    string    `gorm:"type:varchar(100);uniqueIndex;not null" json:"name"`
+	Target  string    `gorm:"type:varchar(30);not null" json:"target"` // "registration" or "teacher-registration"
+	Mapping StringMap `gorm:"type:jsonb" json:"mapping"`               // หัวคอลัมน์ -> field เช่น {"ชื่อ-นามสกุล": "full_name"}
+}
+
+// ImportJob - งานนำเข้าข้อมูลจากไฟล์ CSV/XLSX (ตรวจสอบก่อน แล้วจึงบันทึกจริง)
+type ImportJob struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Target   string    `gorm:"type:varchar(30);not null" json:"target"` // "registration" or "teacher-registration"
+	FileName string    `gorm:"type:varchar(255)" json:"file_name"`
+	Mapping  StringMap `gorm:"type:jsonb" json:"mapping"`
+	Status   string    `gorm:"type:varchar(20);not null;index" json:"status"` // "validating", "validated", "importing", "completed", "failed"
+
+	TotalRows     int `json:"total_rows"`
+	ProcessedRows int `json:"processed_rows"`
+	ValidRows     int `json:"valid_rows"`
+	ErrorRows     int `json:"error_rows"`
+	ImportedRows  int `json:"imported_rows"`
+
+	Report     EncryptedString `gorm:"type:text" json:"-"` // JSON ของผลตรวจสอบรายแถว (มีข้อมูลส่วนบุคคล)
+	File       EncryptedString `gorm:"type:text" json:"-"` // ไฟล์ต้นฉบับ (base64) ลบทิ้งเมื่อนำเข้าเสร็จ
+	Message    string          `gorm:"type:text" json:"message"`
+	FinishedAt *time.Time      `json:"finished_at"`
+
+	// Relationship - ผู้นำเข้า
+	UserID uint `gorm:"not null" json:"user_id"`
+	User   User `json:"user,omitempty"`
+}
+
+// RegistrationGroup - การลงทะเบียนแบบกลุ่มที่วัดส่งแทนพระหลายรูป
+type RegistrationGroup struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Code   string `gorm:"type:varchar(20);uniqueIndex;not null" json:"code"`        // รหัสอ้างอิงของกลุ่ม
+	Status string `gorm:"type:varchar(20);not null;default:'active'" json:"status"` // "active" or "cancelled"
+
+	// ผู้ติดต่อของกลุ่ม
+	LeaderName        string          `gorm:"type:varchar(200);not null" json:"leader_name"`
+	LeaderRole        string          `gorm:"type:varchar(100)" json:"leader_role"`   // เช่น "เจ้าอาวาส"
+	LeaderPhone       EncryptedString `gorm:"type:text;not null" json:"leader_phone"` // เข้ารหัส
+	LeaderPhoneIndex  string          `gorm:"type:varchar(64);index" json:"-"`        // blind index
+	TempleName        string          `gorm:"type:varchar(200)" json:"temple_name"`   // ชื่อที่พิมพ์เอง หรือชื่อวัดจากทะเบียนเมื่อผูกกับ TempleID
+	TempleID          *uint           `gorm:"index" json:"temple_id,omitempty"`
+	Temple            *Temple         `json:"temple,omitempty"`
+	Notes             string          `gorm:"type:text" json:"notes"`
+	CancelledAt       *time.Time      `json:"cancelled_at,omitempty"`
+	CancelledByID     *uint           `json:"cancelled_by_id,omitempty"`
+	CancellationNotes string          `gorm:"type:text" json:"cancellation_notes,omitempty"`
+
+	// PDPA - เวลาที่ข้อมูลผู้ติดต่อถูกลบ (เมื่อผู้ลงทะเบียนทุกคนในกลุ่มถูก anonymize แล้ว)
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty"`
+
+	Registrations []Registration `gorm:"foreignKey:GroupID" json:"registrations,omitempty"`
+}
+
+// Temple - ทะเบียนวัด ใช้อ้างอิงแทนชื่อวัดที่พิมพ์เอง เพื่อให้สรุปข้อมูลรายวัดได้
+type Temple struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	Name       string      `gorm:"type:varchar(200);not null" json:"name"`
+	Aliases    StringArray `gorm:"type:text[]" json:"aliases"`           // ชื่อที่สะกดต่างออกไป
+	SearchKeys StringArray `gorm:"type:text[];index:,type:gin" json:"-"` // ชื่อและ aliases ที่ normalize แล้ว สำหรับจับคู่
+	Sect       string      `gorm:"type:varchar(50)" json:"sect"`         // "มหานิกาย" or "ธรรมยุติกนิกาย"
+
+	ProvinceID    *uint        `json:"province_id,omitempty"`
+	Province      *Province    `json:"province,omitempty"`
+	DistrictID    *uint        `json:"district_id,omitempty"`
+	District      *District    `json:"district,omitempty"`
+	SubDistrictID *uint        `json:"sub_district_id,omitempty"`
+	SubDistrict   *SubDistrict `json:"sub_district,omitempty"`
+	AddressDetail string       `gorm:"type:text" json:"address_detail"`
+
+	AbbotName    string          `gorm:"type:varchar(200)" json:"abbot_name"` // เจ้าอาวาส
+	ContactName  string          `gorm:"type:varchar(200)" json:"contact_name"`
+	ContactPhone EncryptedString `gorm:"type:text" json:"contact_phone"` // เข้ารหัส
+
+	MergedIntoID *uint `json:"merged_into_id,omitempty"` // วัดที่ถูกรวมเข้าไป (ลบแล้ว)
+}
+
+// AreaBoundary - ขอบเขตของจังหวัด/อำเภอสำหรับแผนที่ (เก็บแยกจากตารางที่อยู่เพราะข้อมูลใหญ่)
+type AreaBoundary struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Level    string          `gorm:"type:varchar(20);not null;uniqueIndex:idx_area_boundary" json:"level"` // "province" or "district"
+	AreaID   uint            `gorm:"not null;uniqueIndex:idx_area_boundary" json:"area_id"`
+	Geometry GeoJSONGeometry `gorm:"type:jsonb;not null" json:"geometry"`
+}
+
+// Notification - outbox ข้อความแจ้งเตือน เขียนใน transaction เดียวกับการเปลี่ยนแปลงที่เป็นต้นเหตุ แล้ว worker ส่งภายหลัง
+type Notification struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Event     string          `gorm:"type:varchar(50);not null;index" json:"event"` // เช่น "registration_created"
+	Channel   string          `gorm:"type:varchar(20);not null" json:"channel"`     // "email", "sms" or "line"
+	Locale    string          `gorm:"type:varchar(5);not null" json:"locale"`       // "th" or "en"
+	Recipient EncryptedString `gorm:"type:text;not null" json:"recipient"`          // อีเมล/เบอร์โทร/LINE user ID เข้ารหัส
+	Subject   EncryptedString `gorm:"type:text" json:"subject"`                     // ใช้เฉพาะอีเมล
+	Body      EncryptedString `gorm:"type:text;not null" json:"body"`               // ข้อความที่แทนค่าตัวแปรแล้ว เข้ารหัส
+
+	RegistrationID        *uint `gorm:"index" json:"registration_id,omitempty"`
+	TeacherRegistrationID *uint `gorm:"index" json:"teacher_registration_id,omitempty"`
+	GroupID               *uint `gorm:"index" json:"group_id,omitempty"` // ข้อความถึงผู้ติดต่อของกลุ่ม
+
+	// Delivery - สถานะการส่ง
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';index:idx_notification_due" json:"status"` // "pending", "sent" or "failed"
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_notification_due" json:"next_attempt_at"`
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// LineLink - บัญชี LINE ที่ผูกกับการลงทะเบียน (ผูกผ่าน bot ด้วยรหัสอ้างอิงและเบอร์โทร)
+// บัญชีเดียวผูกได้หลายการลงทะเบียน เช่น เลขานุการวัดที่ลงทะเบียนแทนหลายรูป
+type LineLink struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	LineUserID    EncryptedString `gorm:"type:text;not null" json:"line_user_id"`              // เข้ารหัส
+	LineUserIndex string          `gorm:"type:varchar(64);not null;index" json:"-"`            // blind index สำหรับค้นหา
+	Locale        string          `gorm:"type:varchar(5);not null;default:'th'" json:"locale"` // ภาษาที่ใช้ตอนผูก ("th" or "en")
+
+	RegistrationID        *uint `gorm:"index" json:"registration_id,omitempty"`
+	TeacherRegistrationID *uint `gorm:"index" json:"teacher_registration_id,omitempty"`
+}
+
+// PhoneVerification - รหัส OTP ยืนยันเบอร์โทรก่อนลงทะเบียน (เก็บเฉพาะ hash ของรหัสและ token)
+type PhoneVerification struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	PhoneIndex string    `gorm:"type:varchar(64);not null;index" json:"-"` // blind index ของเบอร์โทร
+	IPAddress  string    `gorm:"type:varchar(45);index" json:"-"`          // ใช้จำกัดจำนวนคำขอต่อ IP
+	CodeHash   string    `gorm:"type:varchar(100);not null" json:"-"`      // bcrypt
+	ExpiresAt  time.Time `gorm:"not null" json:"expires_at"`
+	Attempts   int       `gorm:"default:0" json:"attempts"`
+
+	VerifiedAt     *time.Time `json:"verified_at,omitempty"`
+	TokenHash      string     `gorm:"type:varchar(64);index" json:"-"` // sha256 ของ token ที่ส่งมากับการลงทะเบียน
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+	TokenUsedAt    *time.Time `json:"token_used_at,omitempty"` // token ใช้ลงทะเบียนได้ครั้งเดียว
+}
+
+// BlockedRequest - คำขอไปยัง route สาธารณะที่ถูกบล็อก (rate limit, ขนาด body, captcha, honeypot)
+// บันทึกไม่เกินนาทีละครั้งต่อ route/เหตุผล/IP โดย Count รวมจำนวนคำขอที่ถูกบล็อกในช่วงนั้น
+type BlockedRequest struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	Route     string `gorm:"type:varchar(50);not null;index" json:"route"`
+	Reason    string `gorm:"type:varchar(20);not null;index" json:"reason"` // rate_ip, rate_global, body_size, captcha, honeypot
+	Detail    string `gorm:"type:varchar(255)" json:"detail"`
+	Method    string `gorm:"type:varchar(10)" json:"method"`
+	Path      string `gorm:"type:varchar(255)" json:"path"`
+	IPAddress string `gorm:"type:varchar(45);index" json:"ip_address"`
+	UserAgent string `gorm:"type:varchar(255)" json:"user_agent"`
+	Count     int    `gorm:"default:1" json:"count"`
+}
+
+// IdempotencyKey - ผลของคำขอที่ส่ง Idempotency-Key มา ใช้ตอบซ้ำเมื่อ client ส่งคำขอเดิมซ้ำ
+// ResponseBody เข้ารหัสเพราะมีข้อมูลส่วนบุคคลของผู้ลงทะเบียน
+type IdempotencyKey struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Scope       string `gorm:"type:varchar(100);not null;uniqueIndex:idx_idempotency_scope_key" json:"scope"` // route และผู้ใช้ (ถ้า login)
+	Key         string `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_scope_key" json:"key"`
+	RequestHash string `gorm:"type:varchar(64);not null" json:"-"`      // sha256 ของ method, path และ body
+	Status      string `gorm:"type:varchar(20);not null" json:"status"` // processing, completed
+
+	ResponseStatus      int             `json:"response_status"`
+	ResponseContentType string          `gorm:"type:varchar(100)" json:"-"`
+	ResponseBody        EncryptedString `gorm:"type:text" json:"-"`
+	Subject             string          `gorm:"type:varchar(60);index" json:"-"` // ข้อมูลที่คำขอสร้าง เช่น "registrations:12" ใช้ลบผลที่เก็บไว้เมื่อ anonymize
+}
+
+// CheckIn - การเช็คอินเข้างานของผู้ลงทะเบียนหรือพระอาจารย์ (สร้างจากแท็บเล็ตที่อาจออฟไลน์)
+// ClientID สร้างโดยอุปกรณ์ (UUID) เพื่อให้ส่งซ้ำได้โดยไม่สร้างรายการซ้ำ
+type CheckIn struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `gorm:"index" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	Version   uint           `gorm:"not null;default:1" json:"version"`
+	SyncXID   int64          `gorm:"column:sync_xid;not null;default:0;index" json:"-"` // transaction ที่แก้ไขล่าสุด (trigger ตั้งให้)
+
+	ClientID string `gorm:"type:varchar(36);not null;uniqueIndex" json:"client_id"`
+
+	RegistrationID        *uint `gorm:"index" json:"registration_id,omitempty"`
+	TeacherRegistrationID *uint `gorm:"index" json:"teacher_registration_id,omitempty"`
+
+	CheckedInAt  time.Time  `gorm:"not null" json:"checked_in_at"` // เวลาบนอุปกรณ์ขณะเช็คอิน
+	CheckedOutAt *time.Time `json:"checked_out_at,omitempty"`
+	Note         string     `gorm:"type:varchar(500)" json:"note"`
+
+	DeviceID string `gorm:"type:varchar(100)" json:"device_id"`
+	UserID   uint   `gorm:"not null" json:"user_id"` // เจ้าหน้าที่ที่ซิงค์รายการนี้ครั้งแรก
+}
+
+// PurgedRecord - แถวที่ถูกลบถาวร (retention หรือลบจากถังขยะ) เก็บไว้ให้ sync แจ้งอุปกรณ์ให้ลบออกจากเครื่อง
+type PurgedRecord struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	SyncXID   int64     `gorm:"column:sync_xid;not null;default:0;index" json:"-"` // transaction ที่ลบ (trigger ตั้งให้)
+
+	Entity   string `gorm:"type:varchar(30);not null" json:"entity"` // "registration", "teacher_registration" or "check_in"
+	RecordID uint   `gorm:"not null" json:"record_id"`
+	ClientID string `gorm:"type:varchar(36)" json:"client_id,omitempty"` // เฉพาะการเช็คอิน
+}
+
+// WebhookSubscription - ปลายทางที่รับ event ของระบบทาง HTTP POST (เช่น Google Apps Script, Discord)
+// payload ลงลายมือชื่อด้วย HMAC-SHA256 ของ Secret
+type WebhookSubscription struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name       string          `gorm:"type:varchar(100);not null" json:"name"`
+	URL        string          `gorm:"type:varchar(500);not null" json:"url"`
+	EventTypes StringArray     `gorm:"type:text[]" json:"event_types"`                         // เช่น ["registration.created"], "*" = ทุก event
+	Secret     EncryptedString `gorm:"type:text;not null" json:"-"`                            // เข้ารหัส
+	Format     string          `gorm:"type:varchar(20);not null;default:'json'" json:"format"` // "json" หรือ "discord" (ส่งเป็นข้อความ content)
+
+	Active              bool       `gorm:"default:true" json:"active"`
+	ConsecutiveFailures int        `gorm:"default:0" json:"consecutive_failures"` // ส่งไม่สำเร็จติดกัน (ล้างเมื่อสำเร็จ)
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `gorm:"type:varchar(255)" json:"disabled_reason,omitempty"`
+
+	CreatedByID uint `json:"created_by_id"`
+}
+
+// WebhookDelivery - event หนึ่งรายการที่ต้องส่งไปยัง subscription (outbox)
+type WebhookDelivery struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	SubscriptionID uint                `gorm:"not null;index" json:"subscription_id"`
+	Subscription   WebhookSubscription `json:"-"`
+	EventID        string              `gorm:"type:varchar(50);not null" json:"event_id"`
+	EventType      string              `gorm:"type:varchar(50);not null;index" json:"event_type"`
+	Payload        EncryptedString     `gorm:"type:text;not null" json:"payload"` // JSON ที่ส่ง (มีชื่อผู้ลงทะเบียน เข้ารหัส)
+
+	Status         string     `gorm:"type:varchar(20);not null;default:'pending';index:idx_webhook_due" json:"status"` // "pending", "succeeded" or "failed"
+	NextAttemptAt  time.Time  `gorm:"not null;index:idx_webhook_due" json:"next_attempt_at"`
+	Attempts       int        `gorm:"default:0" json:"attempts"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+
+	AttemptLog []WebhookAttempt `gorm:"foreignKey:DeliveryID" json:"attempt_log,omitempty"`
+}
+
+// WebhookAttempt - ผลการส่งแต่ละครั้ง
+type WebhookAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+
+	DeliveryID   uint   `gorm:"not null;index" json:"delivery_id"`
+	StatusCode   int    `json:"status_code"` // 0 = เชื่อมต่อไม่ได้
+	Error        string `gorm:"type:text" json:"error,omitempty"`
+	ResponseBody string `gorm:"type:text" json:"response_body,omitempty"` // ตัดเหลือไม่เกิน 1 KB
+	DurationMs   int64  `json:"duration_ms"`
+	Manual       bool   `gorm:"default:false" json:"manual"` // ส่งใหม่โดยผู้ดูแล
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+)
+
+// StringMap is a custom type for a JSON object of strings stored in a jsonb column
+type StringMap map[string]string
+
+// Value implements the driver.Valuer interface
+func (m StringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(map[string]string(m))
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements the sql.Scanner interface
+func (m *StringMap) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = StringMap{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("cannot scan non-string value into StringMap")
+	}
+
+	result := map[string]string{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*m = StringMap(result)
+	return nil
+}
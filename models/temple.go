@@ -0,0 +1,36 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// NormalizeTempleName returns a key for matching temple spellings
+// It ignores case, spaces, punctuation and the leading "วัด", so "วัด ป่า-สุคะโต" and "ป่าสุคะโต" match
+func NormalizeTempleName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return strings.TrimPrefix(b.String(), "วัด")
+}
+
+// BeforeSave keeps SearchKeys in sync with Name and Aliases
+func (t *Temple) BeforeSave(tx *gorm.DB) error {
+	seen := map[string]bool{}
+	keys := StringArray{}
+	for _, name := range append([]string{t.Name}, t.Aliases...) {
+		key := NormalizeTempleName(name)
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	t.SearchKeys = keys
+	return nil
+}
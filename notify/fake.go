@@ -0,0 +1,61 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// maxFakeMessages bounds the history kept by a Fake channel.
+const maxFakeMessages = 200
+
+// Fake is an in-memory channel for local development and tests.
+// It logs every message and can be told to fail the next sends.
+type Fake struct {
+	name string
+
+	mu       sync.Mutex
+	messages []Message
+	failures []error
+}
+
+// NewFake returns a fake channel; name is only used in log output.
+func NewFake(name string) *Fake {
+	return &Fake{name: name}
+}
+
+// Send records the message, or returns the next queued failure.
+func (f *Fake) Send(ctx context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.failures) > 0 {
+		err := f.failures[0]
+		f.failures = f.failures[1:]
+		return err
+	}
+	f.messages = append(f.messages, msg)
+	if len(f.messages) > maxFakeMessages {
+		f.messages = f.messages[len(f.messages)-maxFakeMessages:]
+	}
+	log.Printf("[notify:%s] to=%s subject=%q body=%q", f.name, msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// Reply records the answer as a message addressed to "reply:<token>".
+func (f *Fake) Reply(ctx context.Context, replyToken, text string) error {
+	return f.Send(ctx, Message{To: "reply:" + replyToken, Body: text})
+}
+
+// Messages returns a copy of the messages sent so far (oldest first).
+func (f *Fake) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.messages...)
+}
+
+// FailNext makes the following sends return errs in order.
+func (f *Fake) FailNext(errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = append(f.failures, errs...)
+}
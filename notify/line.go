@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultLINEAPIBaseURL is the LINE Messaging API; LINE_API_BASE_URL points
+// elsewhere (e.g. a local fake server) during development.
+const defaultLINEAPIBaseURL = "https://api.line.me"
+
+// maxLINETextLength is the LINE limit for one text message.
+const maxLINETextLength = 5000
+
+// LINEMessaging pushes text messages to LINE user IDs.
+type LINEMessaging struct {
+	BaseURL     string
+	AccessToken string
+}
+
+// newLINEFromEnv reads LINE_CHANNEL_ACCESS_TOKEN and LINE_API_BASE_URL.
+func newLINEFromEnv() (Channel, error) {
+	channel := &LINEMessaging{
+		BaseURL:     strings.TrimRight(os.Getenv("LINE_API_BASE_URL"), "/"),
+		AccessToken: os.Getenv("LINE_CHANNEL_ACCESS_TOKEN"),
+	}
+	if channel.BaseURL == "" {
+		channel.BaseURL = defaultLINEAPIBaseURL
+	}
+	if channel.AccessToken == "" {
+		return nil, errors.New("LINE_CHANNEL_ACCESS_TOKEN is required")
+	}
+	return channel, nil
+}
+
+// Send pushes msg.Body to the LINE user ID in msg.To.
+func (l *LINEMessaging) Send(ctx context.Context, msg Message) error {
+	if msg.To == "" {
+		return Permanent(errors.New("empty LINE user ID"))
+	}
+	if err := postJSON(ctx, l.BaseURL+"/v2/bot/message/push", l.AccessToken, map[string]interface{}{
+		"to":       msg.To,
+		"messages": lineTextMessages(msg.Body),
+	}); err != nil {
+		return fmt.Errorf("line push: %w", err)
+	}
+	return nil
+}
+
+// Reply answers a webhook event using its reply token.
+func (l *LINEMessaging) Reply(ctx context.Context, replyToken, text string) error {
+	if err := postJSON(ctx, l.BaseURL+"/v2/bot/message/reply", l.AccessToken, map[string]interface{}{
+		"replyToken": replyToken,
+		"messages":   lineTextMessages(text),
+	}); err != nil {
+		return fmt.Errorf("line reply: %w", err)
+	}
+	return nil
+}
+
+func lineTextMessages(body string) []map[string]string {
+	text := []rune(body)
+	if len(text) > maxLINETextLength {
+		text = text[:maxLINETextLength]
+	}
+	return []map[string]string{{"type": "text", "text": string(text)}}
+}
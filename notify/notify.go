@@ -0,0 +1,126 @@
+// Package notify delivers outbound messages through pluggable channels
+// (SMTP email, an HTTP SMS gateway and the LINE Messaging API).
+//
+// Channels are configured from environment variables by LoadFromEnv. Every
+// channel has a local fake that logs messages and keeps them in memory, so the
+// whole notification flow can be exercised without external accounts:
+//
+//	NOTIFY_EMAIL  "smtp" or "fake" (empty = disabled)
+//	NOTIFY_SMS    "http" or "fake" (empty = disabled)
+//	NOTIFY_LINE   "line" or "fake" (empty = disabled)
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Channel names used in the outbox.
+const (
+	Email = "email"
+	SMS   = "sms"
+	LINE  = "line"
+)
+
+// Message is a single rendered message for one recipient.
+// Subject is only used by email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Channel sends messages through one delivery mechanism.
+type Channel interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Replier is implemented by channels that can answer an incoming message
+// (LINE reply tokens), which unlike pushes does not count against the message quota.
+type Replier interface {
+	Reply(ctx context.Context, replyToken, text string) error
+}
+
+// permanentError marks failures that will not succeed on retry (bad recipient, rejected content).
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the outbox stops retrying the message.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was wrapped with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+var (
+	mu       sync.RWMutex
+	channels = map[string]Channel{}
+)
+
+// Register installs (or with nil removes) the channel used for name.
+func Register(name string, channel Channel) {
+	mu.Lock()
+	defer mu.Unlock()
+	if channel == nil {
+		delete(channels, name)
+		return
+	}
+	channels[name] = channel
+}
+
+// Get returns the channel registered for name, or nil when it is disabled.
+func Get(name string) Channel {
+	mu.RLock()
+	defer mu.RUnlock()
+	return channels[name]
+}
+
+// Enabled reports whether a channel is registered for name.
+func Enabled(name string) bool {
+	return Get(name) != nil
+}
+
+// LoadFromEnv registers the channels selected by NOTIFY_EMAIL, NOTIFY_SMS and NOTIFY_LINE.
+func LoadFromEnv() error {
+	loaders := []struct {
+		name    string
+		env     string
+		kind    string
+		newReal func() (Channel, error)
+	}{
+		{Email, "NOTIFY_EMAIL", "smtp", newSMTPFromEnv},
+		{SMS, "NOTIFY_SMS", "http", newSMSGatewayFromEnv},
+		{LINE, "NOTIFY_LINE", "line", newLINEFromEnv},
+	}
+
+	for _, loader := range loaders {
+		switch kind := strings.ToLower(strings.TrimSpace(os.Getenv(loader.env))); kind {
+		case "", "off":
+			Register(loader.name, nil)
+		case "fake":
+			Register(loader.name, NewFake(loader.name))
+			log.Printf("Notification channel %s: fake (messages are only logged)", loader.name)
+		case loader.kind:
+			channel, err := loader.newReal()
+			if err != nil {
+				return fmt.Errorf("notify: %s: %w", loader.env, err)
+			}
+			Register(loader.name, channel)
+			log.Printf("Notification channel %s: %s", loader.name, kind)
+		default:
+			return fmt.Errorf("notify: %s must be %q, \"fake\" or empty", loader.env, loader.kind)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// SMSGateway posts messages to an HTTP SMS gateway as JSON:
+//
+//	{"to": "0812345678", "message": "...", "sender": "..."}
+//
+// with "Authorization: Bearer <token>". Gateways with a different API can be
+// adapted with a small proxy or by registering another Channel.
+type SMSGateway struct {
+	URL    string
+	Token  string
+	Sender string
+}
+
+// newSMSGatewayFromEnv reads SMS_GATEWAY_URL, SMS_GATEWAY_TOKEN and SMS_SENDER.
+func newSMSGatewayFromEnv() (Channel, error) {
+	channel := &SMSGateway{
+		URL:    os.Getenv("SMS_GATEWAY_URL"),
+		Token:  os.Getenv("SMS_GATEWAY_TOKEN"),
+		Sender: os.Getenv("SMS_SENDER"),
+	}
+	if channel.URL == "" {
+		return nil, errors.New("SMS_GATEWAY_URL is required")
+	}
+	return channel, nil
+}
+
+// Send delivers one text message.
+func (s *SMSGateway) Send(ctx context.Context, msg Message) error {
+	to := strings.TrimSpace(msg.To)
+	if to == "" {
+		return Permanent(errors.New("empty phone number"))
+	}
+	if err := postJSON(ctx, s.URL, s.Token, map[string]string{
+		"to":      to,
+		"message": msg.Body,
+		"sender":  s.Sender,
+	}); err != nil {
+		return fmt.Errorf("sms gateway: %w", err)
+	}
+	return nil
+}
@@ -58,3 +58,86 @@ func fetchJSON(url string, target interface{}) error {
 
 	return nil
 }
+
+// provinceCentroids - approximate coordinates {lat, lng} of each provincial seat,
+// keyed by name_th. Used as the province map marker until boundaries are
+// imported (POST /api/admin/geo/boundaries/import recomputes true centroids).
+var provinceCentroids = map[string][2]float64{
+	"กรุงเทพมหานคร":   {13.7563, 100.5018},
+	"สมุทรปราการ":     {13.5991, 100.5968},
+	"นนทบุรี":         {13.8621, 100.5144},
+	"ปทุมธานี":        {14.0208, 100.5250},
+	"พระนครศรีอยุธยา": {14.3532, 100.5689},
+	"อ่างทอง":         {14.5896, 100.4550},
+	"ลพบุรี":          {14.7995, 100.6534},
+	"สิงห์บุรี":       {14.8936, 100.3967},
+	"ชัยนาท":          {15.1852, 100.1251},
+	"สระบุรี":         {14.5289, 100.9101},
+	"ชลบุรี":          {13.3611, 100.9847},
+	"ระยอง":           {12.6814, 101.2816},
+	"จันทบุรี":        {12.6113, 102.1039},
+	"ตราด":            {12.2428, 102.5175},
+	"ฉะเชิงเทรา":      {13.6904, 101.0780},
+	"ปราจีนบุรี":      {14.0509, 101.3717},
+	"นครนายก":         {14.2069, 101.2131},
+	"สระแก้ว":         {13.8240, 102.0646},
+	"นครราชสีมา":      {14.9799, 102.0978},
+	"บุรีรัมย์":       {14.9930, 103.1029},
+	"สุรินทร์":        {14.8818, 103.4936},
+	"ศรีสะเกษ":        {15.1186, 104.3220},
+	"อุบลราชธานี":     {15.2287, 104.8564},
+	"ยโสธร":           {15.7924, 104.1453},
+	"ชัยภูมิ":         {15.8068, 102.0317},
+	"อำนาจเจริญ":      {15.8657, 104.6258},
+	"บึงกาฬ":          {18.3609, 103.6464},
+	"หนองบัวลำภู":     {17.2218, 102.4260},
+	"ขอนแก่น":         {16.4419, 102.8360},
+	"อุดรธานี":        {17.4138, 102.7872},
+	"เลย":             {17.4860, 101.7223},
+	"หนองคาย":         {17.8783, 102.7420},
+	"มหาสารคาม":       {16.1851, 103.3029},
+	"ร้อยเอ็ด":        {16.0538, 103.6520},
+	"กาฬสินธุ์":       {16.4322, 103.5061},
+	"สกลนคร":          {17.1546, 104.1348},
+	"นครพนม":          {17.3920, 104.7695},
+	"มุกดาหาร":        {16.5453, 104.7235},
+	"เชียงใหม่":       {18.7883, 98.9853},
+	"ลำพูน":           {18.5745, 99.0087},
+	"ลำปาง":           {18.2888, 99.4909},
+	"อุตรดิตถ์":       {17.6201, 100.0993},
+	"แพร่":            {18.1446, 100.1403},
+	"น่าน":            {18.7756, 100.7730},
+	"พะเยา":           {19.1666, 99.9019},
+	"เชียงราย":        {19.9105, 99.8406},
+	"แม่ฮ่องสอน":      {19.3020, 97.9654},
+	"นครสวรรค์":       {15.7047, 100.1372},
+	"อุทัยธานี":       {15.3835, 100.0246},
+	"กำแพงเพชร":       {16.4828, 99.5227},
+	"ตาก":             {16.8840, 99.1259},
+	"สุโขทัย":         {17.0078, 99.8230},
+	"พิษณุโลก":        {16.8211, 100.2659},
+	"พิจิตร":          {16.4429, 100.3487},
+	"เพชรบูรณ์":       {16.4190, 101.1606},
+	"ราชบุรี":         {13.5283, 99.8134},
+	"กาญจนบุรี":       {14.0228, 99.5328},
+	"สุพรรณบุรี":      {14.4745, 100.1177},
+	"นครปฐม":          {13.8199, 100.0621},
+	"สมุทรสาคร":       {13.5475, 100.2744},
+	"สมุทรสงคราม":     {13.4098, 100.0023},
+	"เพชรบุรี":        {13.1119, 99.9398},
+	"ประจวบคีรีขันธ์": {11.8124, 99.7973},
+	"นครศรีธรรมราช":   {8.4304, 99.9631},
+	"กระบี่":          {8.0863, 98.9063},
+	"พังงา":           {8.4501, 98.5255},
+	"ภูเก็ต":          {7.8804, 98.3923},
+	"สุราษฎร์ธานี":    {9.1382, 99.3215},
+	"ระนอง":           {9.9529, 98.6085},
+	"ชุมพร":           {10.4930, 99.1800},
+	"สงขลา":           {7.1898, 100.5954},
+	"สตูล":            {6.6238, 100.0674},
+	"ตรัง":            {7.5594, 99.6114},
+	"พัทลุง":          {7.6167, 100.0740},
+	"ปัตตานี":         {6.8695, 101.2502},
+	"ยะลา":            {6.5411, 101.2804},
+	"นราธิวาส":        {6.4255, 101.8253},
+}
@@ -40,6 +40,22 @@ func main() {
 	}
 	log.Printf("Seeded %d provinces successfully\n", len(provincesData))
 
+	// Centroids are only filled in when missing so imported boundaries are kept
+	log.Println("Seeding province centroids...")
+	seededCentroids := 0
+	for _, province := range provincesData {
+		centroid, ok := provinceCentroids[province.NameTh]
+		if !ok {
+			log.Printf("No centroid for province %s\n", province.NameTh)
+			continue
+		}
+		result := database.DB.Model(&models.Province{}).
+			Where("id = ? AND centroid_lat IS NULL", province.ID).
+			Updates(map[string]interface{}{"centroid_lat": centroid[0], "centroid_lng": centroid[1]})
+		seededCentroids += int(result.RowsAffected)
+	}
+	log.Printf("Seeded %d province centroids\n", seededCentroids)
+
 	log.Println("Fetching districts data...")
 	var districtsData []DistrictData
 	if err := fetchJSON("https://raw.githubusercontent.com/kongvut/thai-province-data/refs/heads/master/api/latest/district.json", &districtsData); err != nil {